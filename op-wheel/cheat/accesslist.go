@@ -0,0 +1,41 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// GenAccessList writes an EIP-2930 access list of the given accounts as JSON, e.g. for transactions of tests.
+// If slots are given, each account lists those storage keys. Otherwise each account lists all of its storage keys,
+// read like a storage dump, which fails if a storage key of the accounts has an unknown pre-image.
+func GenAccessList(addrs []common.Address, slots []common.Hash, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		list := make(types.AccessList, 0, len(addrs))
+		for _, addr := range addrs {
+			keys := append([]common.Hash{}, slots...)
+			if len(slots) == 0 {
+				storage, err := readStorage(ctx, headState, addr)
+				if err != nil {
+					return err
+				}
+				for key := range storage {
+					keys = append(keys, key)
+				}
+				sort.Slice(keys, func(i, j int) bool {
+					return bytes.Compare(keys[i][:], keys[j][:]) < 0
+				})
+			}
+			list = append(list, types.AccessTuple{Address: addr, StorageKeys: keys})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+}
@@ -0,0 +1,40 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenAccessList(t *testing.T) {
+	headState := newTestState(t)
+	db := headState.Database()
+	contract, eoa := common.Address{0xc}, common.Address{0xe}
+	headState.SetNonce(contract, 1)
+	headState.SetState(contract, common.Hash{2}, common.Hash{0x22})
+	headState.SetState(contract, common.Hash{1}, common.Hash{0x11})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, GenAccessList([]common.Address{contract, eoa}, nil, &out)(context.Background(), headState))
+	var list types.AccessList
+	require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+	require.Equal(t, types.AccessList{
+		{Address: contract, StorageKeys: []common.Hash{{1}, {2}}},
+		{Address: eoa, StorageKeys: []common.Hash{}},
+	}, list)
+
+	out.Reset()
+	require.NoError(t, GenAccessList([]common.Address{eoa}, []common.Hash{{7}}, &out)(context.Background(), headState))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+	require.Equal(t, types.AccessList{{Address: eoa, StorageKeys: []common.Hash{{7}}}}, list)
+}
@@ -0,0 +1,101 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// BackfillReport summarizes the historical block data that was backfilled.
+type BackfillReport struct {
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+	Bodies     uint64 `json:"bodies"`
+	Receipts   uint64 `json:"receipts"`
+	// Skipped is the number of blocks that already had a body and receipts.
+	Skipped uint64 `json:"skipped"`
+}
+
+// Backfill inserts the bodies and receipts of the canonical blocks from..to (inclusive) into the database,
+// fetched with debug_getRawBlock and debug_getRawReceipts from the source node, for engines that only snap-synced recent state.
+// The headers must be in the database already: the fetched data is verified against the local headers, and transaction
+// lookup entries are written, so the engine can serve historical blocks, transactions and receipts.
+// Geth has no API to insert historical bodies into a running node, so the engine must be stopped.
+// If onBlock is not nil, it is called with the number of each block after its data is written, e.g. to journal the progress.
+func Backfill(ctx context.Context, db ethdb.Database, source client.RPC, from, to uint64, onBlock func(n uint64) error) (*BackfillReport, error) {
+	if from > to {
+		return nil, fmt.Errorf("range start %d is after range end %d", from, to)
+	}
+	report := &BackfillReport{FirstBlock: from, LastBlock: to}
+	for n := from; n <= to; n++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		hash := rawdb.ReadCanonicalHash(db, n)
+		header := rawdb.ReadHeader(db, hash, n)
+		if header == nil {
+			return report, fmt.Errorf("canonical header %d is missing, cannot verify backfilled data", n)
+		}
+		hasBody, hasReceipts := rawdb.HasBody(db, hash, n), rawdb.HasReceipts(db, hash, n)
+		if hasBody && hasReceipts {
+			report.Skipped += 1
+			continue
+		}
+		tag := hexutil.Uint64(n).String()
+		var rawBlock hexutil.Bytes
+		if err := source.CallContext(ctx, &rawBlock, "debug_getRawBlock", tag); err != nil {
+			return report, fmt.Errorf("failed to fetch block %d: %w", n, err)
+		}
+		var block types.Block
+		if err := rlp.DecodeBytes(rawBlock, &block); err != nil {
+			return report, fmt.Errorf("failed to decode block %d: %w", n, err)
+		}
+		if block.Hash() != hash {
+			return report, fmt.Errorf("source block %d %s does not match local canonical block %s", n, block.Hash(), hash)
+		}
+		if root := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); root != header.TxHash {
+			return report, fmt.Errorf("transactions of block %d have root %s, expected %s", n, root, header.TxHash)
+		}
+		var rawReceipts []hexutil.Bytes
+		if err := source.CallContext(ctx, &rawReceipts, "debug_getRawReceipts", tag); err != nil {
+			return report, fmt.Errorf("failed to fetch receipts of block %d: %w", n, err)
+		}
+		receipts := make(types.Receipts, len(rawReceipts))
+		for i, raw := range rawReceipts {
+			receipts[i] = new(types.Receipt)
+			if err := receipts[i].UnmarshalBinary(raw); err != nil {
+				return report, fmt.Errorf("failed to decode receipt %d of block %d: %w", i, n, err)
+			}
+		}
+		if root := types.DeriveSha(receipts, trie.NewStackTrie(nil)); root != header.ReceiptHash {
+			return report, fmt.Errorf("receipts of block %d have root %s, expected %s", n, root, header.ReceiptHash)
+		}
+		batch := db.NewBatch()
+		if !hasBody {
+			rawdb.WriteBody(batch, hash, n, block.Body())
+			rawdb.WriteTxLookupEntriesByBlock(batch, &block)
+			report.Bodies += 1
+		}
+		if !hasReceipts {
+			rawdb.WriteReceipts(batch, hash, n, receipts)
+			report.Receipts += 1
+		}
+		if err := batch.Write(); err != nil {
+			return report, fmt.Errorf("failed to write block %d data: %w", n, err)
+		}
+		if onBlock != nil {
+			if err := onBlock(n); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
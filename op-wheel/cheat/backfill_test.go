@@ -0,0 +1,124 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// rawBlocksRemote serves debug_getRawBlock and debug_getRawReceipts of the given blocks, like geth.
+type rawBlocksRemote struct {
+	client.RPC
+	blocks   map[uint64]*types.Block
+	receipts map[uint64]types.Receipts
+}
+
+func (r *rawBlocksRemote) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	n, err := hexutil.DecodeUint64(args[0].(string))
+	if err != nil {
+		return err
+	}
+	block, ok := r.blocks[n]
+	if !ok {
+		return fmt.Errorf("block %d not found", n)
+	}
+	var res any
+	switch method {
+	case "debug_getRawBlock":
+		data, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return err
+		}
+		res = hexutil.Bytes(data)
+	case "debug_getRawReceipts":
+		raw := make([]hexutil.Bytes, len(r.receipts[n]))
+		for i, receipt := range r.receipts[n] {
+			if raw[i], err = receipt.MarshalBinary(); err != nil {
+				return err
+			}
+		}
+		res = raw
+	default:
+		return fmt.Errorf("unexpected method %q", method)
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	db := rawdb.NewMemoryDatabase()
+	remote := &rawBlocksRemote{blocks: map[uint64]*types.Block{}, receipts: map[uint64]types.Receipts{}}
+	parent := common.Hash{}
+	for n := uint64(1); n <= 4; n++ {
+		tx := types.NewTx(&types.LegacyTx{Nonce: n, Gas: 21000, GasPrice: big.NewInt(1)})
+		receipt := &types.Receipt{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000 * n, Logs: []*types.Log{}}
+		block := types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(n), ParentHash: parent, Difficulty: common.Big0},
+			[]*types.Transaction{tx}, nil, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+		parent = block.Hash()
+		remote.blocks[n], remote.receipts[n] = block, types.Receipts{receipt}
+		// like a snap-synced engine: headers only, except for the recent block 2
+		rawdb.WriteHeader(db, block.Header())
+		rawdb.WriteCanonicalHash(db, block.Hash(), n)
+		if n == 2 {
+			rawdb.WriteBody(db, block.Hash(), n, block.Body())
+			rawdb.WriteReceipts(db, block.Hash(), n, types.Receipts{receipt})
+		}
+	}
+
+	_, err := Backfill(ctx, db, remote, 3, 1, nil)
+	require.ErrorContains(t, err, "range start 3 is after range end 1")
+	_, err = Backfill(ctx, db, remote, 5, 5, nil)
+	require.ErrorContains(t, err, "canonical header 5 is missing")
+
+	var written []uint64
+	report, err := Backfill(ctx, db, remote, 1, 3, func(n uint64) error {
+		written = append(written, n)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, &BackfillReport{FirstBlock: 1, LastBlock: 3, Bodies: 2, Receipts: 2, Skipped: 1}, report)
+	require.Equal(t, []uint64{1, 3}, written)
+	for _, n := range []uint64{1, 3} {
+		block := remote.blocks[n]
+		require.Equal(t, block.Hash(), rawdb.ReadBlock(db, block.Hash(), n).Hash())
+		require.Len(t, rawdb.ReadRawReceipts(db, block.Hash(), n), 1)
+		require.Equal(t, n, *rawdb.ReadTxLookupEntry(db, block.Transactions()[0].Hash()))
+	}
+
+	t.Run("other block", func(t *testing.T) {
+		other := types.NewBlock(&types.Header{Number: big.NewInt(4), ParentHash: common.Hash{0: 1}, Difficulty: common.Big0}, nil, nil, nil, trie.NewStackTrie(nil))
+		_, err := Backfill(ctx, db, &rawBlocksRemote{blocks: map[uint64]*types.Block{4: other}}, 4, 4, nil)
+		require.ErrorContains(t, err, "does not match local canonical block")
+	})
+
+	t.Run("other transactions", func(t *testing.T) {
+		// the header of the local block, with a body that does not match it
+		tx := types.NewTx(&types.LegacyTx{Nonce: 100, Gas: 21000, GasPrice: big.NewInt(1)})
+		block := types.NewBlockWithHeader(remote.blocks[4].Header()).WithBody([]*types.Transaction{tx}, nil)
+		_, err := Backfill(ctx, db, &rawBlocksRemote{blocks: map[uint64]*types.Block{4: block}}, 4, 4, nil)
+		require.ErrorContains(t, err, "transactions of block 4 have root")
+	})
+
+	t.Run("other receipts", func(t *testing.T) {
+		failed := &types.Receipt{Type: types.LegacyTxType, Status: types.ReceiptStatusFailed, CumulativeGasUsed: 21000, Logs: []*types.Log{}}
+		_, err := Backfill(ctx, db, &rawBlocksRemote{blocks: remote.blocks, receipts: map[uint64]types.Receipts{4: {failed}}}, 4, 4, nil)
+		require.ErrorContains(t, err, "receipts of block 4 have root")
+		require.False(t, rawdb.HasBody(db, remote.blocks[4].Hash(), 4), "nothing is written for an unverified block")
+	})
+}
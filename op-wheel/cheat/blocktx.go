@@ -0,0 +1,156 @@
+package cheat
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// InsertTxConfig configures the insertion of a transaction into a stored block, see InsertTx.
+type InsertTxConfig struct {
+	Number uint64
+	Tx     *types.Transaction
+	// Replace is the index of the transaction to replace, or nil to append the transaction.
+	Replace *uint64
+	// UpdateTxRoot recomputes the transactions root of the header.
+	UpdateTxRoot bool
+	// UpdateReceipts stores a placeholder receipt of the transaction,
+	// and recomputes the receipts root and logs bloom of the header.
+	UpdateReceipts bool
+}
+
+// InsertTxReport describes the changed block.
+type InsertTxReport struct {
+	Number      uint64      `json:"number"`
+	OldHash     common.Hash `json:"oldHash"`
+	NewHash     common.Hash `json:"newHash"`
+	TxIndex     uint64      `json:"txIndex"`
+	TxHash      common.Hash `json:"txHash"`
+	TxRoot      common.Hash `json:"txRoot"`
+	ReceiptRoot common.Hash `json:"receiptRoot"`
+	// Consistent is true if the header commits to the changed body and receipts.
+	Consistent bool `json:"consistent"`
+	// Orphaned is true if the block hash changed while the block has descendants,
+	// which then no longer connect to the canonical chain.
+	Orphaned bool `json:"orphaned"`
+}
+
+// InsertTx appends or replaces a transaction in the body of a canonical block in the database,
+// to construct deliberately inconsistent blocks for negative testing.
+// The transaction is not executed: the state root, gas used and other receipts are left as-is.
+// If the header changes, the block is stored under its new hash, and made canonical in place of the old block.
+func InsertTx(db ethdb.Database, cfg *InsertTxConfig) (*InsertTxReport, error) {
+	n := cfg.Number
+	if frozen, err := db.Ancients(); err == nil && n < frozen {
+		return nil, fmt.Errorf("block %d is in the ancient store (%d blocks), and cannot be changed", n, frozen)
+	}
+	hash := rawdb.ReadCanonicalHash(db, n)
+	header := rawdb.ReadHeader(db, hash, n)
+	if header == nil {
+		return nil, fmt.Errorf("canonical header %d (%s) is missing", n, hash)
+	}
+	body := rawdb.ReadBody(db, hash, n)
+	if body == nil {
+		return nil, fmt.Errorf("body of block %d (%s) is missing", n, hash)
+	}
+	txs := make(types.Transactions, len(body.Transactions))
+	copy(txs, body.Transactions)
+	index := uint64(len(txs))
+	var replaced *types.Transaction
+	if cfg.Replace != nil {
+		index = *cfg.Replace
+		if index >= uint64(len(txs)) {
+			return nil, fmt.Errorf("cannot replace transaction %d, block %d has %d transactions", index, n, len(txs))
+		}
+		replaced = txs[index]
+		txs[index] = cfg.Tx
+	} else {
+		txs = append(txs, cfg.Tx)
+	}
+
+	newHeader := types.CopyHeader(header)
+	if cfg.UpdateTxRoot {
+		newHeader.TxHash = types.DeriveSha(txs, trie.NewStackTrie(nil))
+	}
+	receipts := rawdb.ReadRawReceipts(db, hash, n)
+	if cfg.UpdateReceipts {
+		if receipts == nil {
+			return nil, fmt.Errorf("receipts of block %d (%s) are missing", n, hash)
+		}
+		// an earlier insertion without receipt update may have left the receipts out of line with the transactions
+		if (replaced != nil && index >= uint64(len(receipts))) || (replaced == nil && len(receipts) != len(body.Transactions)) {
+			return nil, fmt.Errorf("block %d has %d receipts for %d transactions, cannot store receipt %d", n, len(receipts), len(body.Transactions), index)
+		}
+		placeholder := &types.Receipt{Type: cfg.Tx.Type(), Status: types.ReceiptStatusFailed, Logs: []*types.Log{}}
+		if index > 0 {
+			placeholder.CumulativeGasUsed = receipts[index-1].CumulativeGasUsed
+		}
+		if replaced != nil {
+			receipts[index] = placeholder
+		} else {
+			receipts = append(receipts, placeholder)
+		}
+		newHeader.ReceiptHash = types.DeriveSha(receipts, trie.NewStackTrie(nil))
+		newHeader.Bloom = types.CreateBloom(receipts)
+	}
+	newHash := newHeader.Hash()
+	report := &InsertTxReport{
+		Number:      n,
+		OldHash:     hash,
+		NewHash:     newHash,
+		TxIndex:     index,
+		TxHash:      cfg.Tx.Hash(),
+		TxRoot:      newHeader.TxHash,
+		ReceiptRoot: newHeader.ReceiptHash,
+		Consistent:  cfg.UpdateTxRoot && cfg.UpdateReceipts,
+	}
+
+	batch := db.NewBatch()
+	newBody := &types.Body{Transactions: txs, Uncles: body.Uncles, Withdrawals: body.Withdrawals}
+	rawdb.WriteBody(batch, newHash, n, newBody)
+	if replaced != nil {
+		rawdb.DeleteTxLookupEntry(batch, replaced.Hash())
+	}
+	rawdb.WriteTxLookupEntries(batch, n, []common.Hash{cfg.Tx.Hash()})
+	if receipts != nil && (cfg.UpdateReceipts || newHash != hash) {
+		rawdb.WriteReceipts(batch, newHash, n, receipts)
+	}
+	if newHash != hash {
+		report.Orphaned = replaceCanonicalHeader(db, batch, hash, newHeader)
+	}
+	if err := batch.Write(); err != nil {
+		return nil, fmt.Errorf("failed to write block %d: %w", n, err)
+	}
+	return report, nil
+}
+
+// replaceCanonicalHeader writes the header, and makes it canonical in place of the header with the given hash:
+// the total difficulty and any head and finalized pointers to the old block are moved to the new header.
+// The body and receipts are not moved. It returns true if the old block has descendants, which no longer connect.
+func replaceCanonicalHeader(db ethdb.Database, batch ethdb.Batch, hash common.Hash, header *types.Header) bool {
+	n := header.Number.Uint64()
+	newHash := header.Hash()
+	rawdb.WriteHeader(batch, header)
+	if td := rawdb.ReadTd(db, hash, n); td != nil {
+		rawdb.WriteTd(batch, newHash, n, td)
+	}
+	rawdb.WriteCanonicalHash(batch, newHash, n)
+	if rawdb.ReadHeadHeaderHash(db) == hash {
+		rawdb.WriteHeadHeaderHash(batch, newHash)
+	}
+	if rawdb.ReadHeadBlockHash(db) == hash {
+		rawdb.WriteHeadBlockHash(batch, newHash)
+	}
+	if rawdb.ReadHeadFastBlockHash(db) == hash {
+		rawdb.WriteHeadFastBlockHash(batch, newHash)
+	}
+	if rawdb.ReadFinalizedBlockHash(db) == hash {
+		rawdb.WriteFinalizedBlockHash(batch, newHash)
+	}
+	head := rawdb.ReadHeadHeader(db)
+	return head != nil && head.Number.Uint64() > n
+}
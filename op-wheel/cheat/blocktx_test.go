@@ -0,0 +1,54 @@
+package cheat
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertTx(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	receipt := &types.Receipt{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: common.Big0},
+		[]*types.Transaction{tx}, nil, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+	rawdb.WriteBlock(db, block)
+	rawdb.WriteReceipts(db, block.Hash(), 1, types.Receipts{receipt})
+	rawdb.WriteCanonicalHash(db, block.Hash(), 1)
+	rawdb.WriteHeadHeaderHash(db, block.Hash())
+	rawdb.WriteHeadBlockHash(db, block.Hash())
+
+	// without header updates the block keeps its hash, and becomes inconsistent
+	inserted := types.NewTx(&types.LegacyTx{Nonce: 2, Gas: 21000, GasPrice: big.NewInt(1)})
+	report, err := InsertTx(db, &InsertTxConfig{Number: 1, Tx: inserted})
+	require.NoError(t, err)
+	require.Equal(t, block.Hash(), report.NewHash)
+	require.False(t, report.Consistent)
+	require.Len(t, rawdb.ReadBody(db, block.Hash(), 1).Transactions, 2)
+
+	replacement := types.NewTx(&types.LegacyTx{Nonce: 3, Gas: 21000, GasPrice: big.NewInt(1)})
+	index := uint64(1)
+	report, err = InsertTx(db, &InsertTxConfig{Number: 1, Tx: replacement, Replace: &index, UpdateTxRoot: true, UpdateReceipts: true})
+	require.ErrorContains(t, err, "1 receipts for 2 transactions")
+
+	report, err = InsertTx(db, &InsertTxConfig{Number: 1, Tx: replacement, Replace: new(uint64), UpdateTxRoot: true, UpdateReceipts: true})
+	require.NoError(t, err)
+	require.True(t, report.Consistent)
+	require.NotEqual(t, block.Hash(), report.NewHash)
+	require.Equal(t, report.NewHash, rawdb.ReadCanonicalHash(db, 1))
+	require.Equal(t, report.NewHash, rawdb.ReadHeadBlockHash(db))
+	changed := rawdb.ReadBlock(db, report.NewHash, 1)
+	require.NotNil(t, changed)
+	require.Equal(t, replacement.Hash(), changed.Transactions()[0].Hash())
+	require.Equal(t, types.DeriveSha(changed.Transactions(), trie.NewStackTrie(nil)), changed.TxHash())
+	receipts := rawdb.ReadRawReceipts(db, report.NewHash, 1)
+	require.Len(t, receipts, 1)
+	require.Equal(t, types.ReceiptStatusFailed, receipts[0].Status)
+	require.Equal(t, types.DeriveSha(receipts, trie.NewStackTrie(nil)), changed.ReceiptHash())
+	require.Nil(t, rawdb.ReadTxLookupEntry(db, tx.Hash()))
+}
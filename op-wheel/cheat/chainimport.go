@@ -0,0 +1,68 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ChainImporter imports copied blocks into the database of a stopped engine, see engine.CopyRangeTo.
+// The blocks are executed and verified like geth import does, without the Engine API round-trips of a running engine,
+// so bulk imports of historical blocks are much faster, and do not need the engine binary.
+type ChainImporter struct {
+	ch *Cheater
+}
+
+func NewChainImporter(ch *Cheater) *ChainImporter {
+	return &ChainImporter{ch: ch}
+}
+
+// Head returns the head block of the database.
+func (d *ChainImporter) Head() *types.Header {
+	return d.ch.Blockchain.CurrentBlock()
+}
+
+// InsertBlocks executes and inserts the blocks, and makes the last block the head.
+func (d *ChainImporter) InsertBlocks(ctx context.Context, blocks []*types.Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n, err := d.ch.Blockchain.InsertChain(blocks); err != nil {
+		return fmt.Errorf("failed to import block %d: %w", blocks[n].NumberU64(), err)
+	}
+	return nil
+}
+
+// Forkchoice makes the given blocks the head, safe and finalized block. The blocks must be in the database.
+// Geth does not persist the safe block: it is reset to the finalized block when the engine restarts.
+func (d *ChainImporter) Forkchoice(ctx context.Context, head, safe, finalized common.Hash) error {
+	bc := d.ch.Blockchain
+	headBlock := bc.GetBlockByHash(head)
+	if headBlock == nil {
+		return fmt.Errorf("head block %s is not in the database", head)
+	}
+	safeHeader := bc.GetHeaderByHash(safe)
+	if safeHeader == nil {
+		return fmt.Errorf("safe block %s is not in the database", safe)
+	}
+	finalizedHeader := bc.GetHeaderByHash(finalized)
+	if finalizedHeader == nil {
+		return fmt.Errorf("finalized block %s is not in the database", finalized)
+	}
+	if bc.CurrentBlock().Hash() != head {
+		if _, err := bc.SetCanonical(headBlock); err != nil {
+			return fmt.Errorf("failed to set head block %s: %w", head, err)
+		}
+	}
+	bc.SetSafe(safeHeader)
+	bc.SetFinalized(finalizedHeader)
+	return nil
+}
+
+// Close persists the state of the recent blocks, which geth keeps in memory while importing, and closes the database.
+func (d *ChainImporter) Close() error {
+	d.ch.Blockchain.Stop()
+	return d.ch.Close()
+}
@@ -0,0 +1,49 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainImporter(t *testing.T) {
+	dataDir := t.TempDir()
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{common.Address{0: 0xa}: {Balance: big.NewInt(1)}},
+	}
+	db, err := OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	genesis.MustCommit(db)
+	require.NoError(t, db.Close())
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 5, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{0: 0xc, 19: byte(i)})
+	})
+
+	ch, err := OpenGethDB(dataDir, false)
+	require.NoError(t, err)
+	importer := NewChainImporter(ch)
+	require.Equal(t, uint64(0), importer.Head().Number.Uint64())
+	require.NoError(t, importer.InsertBlocks(context.Background(), blocks[:2]))
+	require.NoError(t, importer.InsertBlocks(context.Background(), blocks[2:]))
+	require.Equal(t, blocks[4].Hash(), importer.Head().Hash())
+	require.ErrorContains(t, importer.Forkchoice(context.Background(), blocks[4].Hash(), common.Hash{1}, blocks[2].Hash()), "safe block")
+	require.NoError(t, importer.Forkchoice(context.Background(), blocks[4].Hash(), blocks[3].Hash(), blocks[2].Hash()))
+	require.NoError(t, importer.Close())
+
+	// the head state of the imported chain is persisted
+	ch, err = OpenGethDB(dataDir, true)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.Equal(t, blocks[4].Hash(), ch.Blockchain.CurrentBlock().Hash())
+	require.Equal(t, blocks[2].Hash(), ch.Blockchain.CurrentFinalBlock().Hash())
+	headState, err := ch.Blockchain.StateAt(blocks[4].Root())
+	require.NoError(t, err)
+	require.NotZero(t, headState.GetBalance(common.Address{0: 0xc, 19: 4}).Sign())
+}
@@ -0,0 +1,94 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// DayStats aggregates the blocks of a single day (UTC).
+type DayStats struct {
+	Blocks  uint64 `json:"blocks"`
+	Txs     uint64 `json:"txs"`
+	GasUsed uint64 `json:"gasUsed"`
+}
+
+// ChainStatsReport summarizes a range of the canonical chain.
+type ChainStatsReport struct {
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+	Blocks     uint64 `json:"blocks"`
+	Txs        uint64 `json:"txs"`
+	GasUsed    uint64 `json:"gasUsed"`
+	// Fullness is the average ratio of gas used to the gas limit of a block.
+	Fullness      float64 `json:"fullness"`
+	UniqueSenders uint64  `json:"uniqueSenders"`
+	// Days is keyed by date, formatted as YYYY-MM-DD.
+	Days map[string]*DayStats `json:"days"`
+}
+
+// ChainStats computes statistics of the canonical blocks from..to (inclusive) in the database.
+// If to is 0, the range ends at the head block.
+func ChainStats(ctx context.Context, db ethdb.Database, from, to uint64) (*ChainStatsReport, error) {
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	config := rawdb.ReadChainConfig(db, genesisHash)
+	if config == nil {
+		return nil, fmt.Errorf("no chain config found for genesis %s", genesisHash)
+	}
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return nil, fmt.Errorf("no head header found")
+	}
+	if to == 0 || to > head.Number.Uint64() {
+		to = head.Number.Uint64()
+	}
+	if from > to {
+		return nil, fmt.Errorf("range start %d is after range end %d", from, to)
+	}
+	report := &ChainStatsReport{FirstBlock: from, LastBlock: to, Days: make(map[string]*DayStats)}
+	senders := make(map[common.Address]struct{})
+	var fullness float64
+	for n := from; n <= to; n++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hash := rawdb.ReadCanonicalHash(db, n)
+		block := rawdb.ReadBlock(db, hash, n)
+		if block == nil {
+			return nil, fmt.Errorf("canonical block %d (%s) is missing", n, hash)
+		}
+		signer := types.MakeSigner(config, new(big.Int).SetUint64(n), block.Time())
+		for _, tx := range block.Transactions() {
+			sender, err := types.Sender(signer, tx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to recover sender of tx %s in block %d: %w", tx.Hash(), n, err)
+			}
+			senders[sender] = struct{}{}
+		}
+		txs := uint64(len(block.Transactions()))
+		report.Blocks += 1
+		report.Txs += txs
+		report.GasUsed += block.GasUsed()
+		if block.GasLimit() > 0 {
+			fullness += float64(block.GasUsed()) / float64(block.GasLimit())
+		}
+		day := time.Unix(int64(block.Time()), 0).UTC().Format(time.DateOnly)
+		stats, ok := report.Days[day]
+		if !ok {
+			stats = &DayStats{}
+			report.Days[day] = stats
+		}
+		stats.Blocks += 1
+		stats.Txs += txs
+		stats.GasUsed += block.GasUsed()
+	}
+	report.Fullness = fullness / float64(report.Blocks)
+	report.UniqueSenders = uint64(len(senders))
+	return report, nil
+}
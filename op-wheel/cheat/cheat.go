@@ -1,14 +1,15 @@
 package cheat
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"path/filepath"
-	"strings"
 
 	"github.com/ethereum/go-ethereum/core/types"
 
@@ -29,6 +30,9 @@ import (
 
 var HundredETH = big.NewInt(0).Mul(big.NewInt(100), big.NewInt(1000000000000000000))
 
+// ErrDataDirInUse is returned when a database cannot be opened, because its lock is held by another process, e.g. a running node.
+var ErrDataDirInUse = errors.New("data dir is in use by another process")
+
 type Cheater struct {
 	// The database of the chain with the head block that we patch the state-root of, once the state is updated.
 	DB ethdb.Database
@@ -36,6 +40,8 @@ type Cheater struct {
 	Blockchain *core.BlockChain
 	// The Cheater avoids making writes if this is set to True, and opens the DB as readonly.
 	ReadOnly bool
+	// DryRun is set to write the diff of state changes to as JSON, instead of persisting them. See DiffHeadFn.
+	DryRun io.Writer
 }
 
 func OpenGethRawDB(dataDirPath string, readOnly bool) (ethdb.Database, error) {
@@ -49,6 +55,10 @@ func OpenGethRawDB(dataDirPath string, readOnly bool) (ethdb.Database, error) {
 		Handles:           500,
 		ReadOnly:          readOnly,
 	})
+	// like geth, treat the errors of failing to take the file lock as the data dir being in use
+	if isLockError(err) {
+		return nil, fmt.Errorf("failed to open leveldb: %w: %v", ErrDataDirInUse, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open leveldb: %w", err)
 	}
@@ -78,25 +88,45 @@ func (ch *Cheater) Close() error {
 	return ch.DB.Close()
 }
 
-type HeadFn func(headState *state.StateDB) error
+// HeadFn changes or inspects the head state. Long-running functions stop when the context is canceled.
+type HeadFn func(ctx context.Context, headState *state.StateDB) error
 
 // RunAndClose runs the given function on the head-state, and then persists any changes (if not ReadOnly),
 // and updates the blockchain headers indexes to reflect the new state-root, so geth will believe the cheat
 // (unless it ever re-applies the block).
-func (ch *Cheater) RunAndClose(fn HeadFn) error {
+// If the context is canceled, no changes are persisted, and the database is closed cleanly.
+func (ch *Cheater) RunAndClose(ctx context.Context, fn HeadFn) error {
 	preHeader := ch.Blockchain.CurrentBlock()
 	if a, b := preHeader.Number.Uint64(), ch.Blockchain.Genesis().NumberU64(); a <= b {
 		return fmt.Errorf("cheating at genesis (head block %d <= genesis block %d) is not supported", a, b)
 	}
+	if ch.DryRun != nil {
+		diff, err := DiffHeadFn(ctx, ch.Blockchain.StateCache(), preHeader, fn)
+		if err != nil {
+			_ = ch.Close()
+			return err
+		}
+		enc := json.NewEncoder(ch.DryRun)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			_ = ch.Close()
+			return err
+		}
+		return ch.Close()
+	}
 	state, err := ch.Blockchain.StateAt(preHeader.Root)
 	if err != nil {
 		_ = ch.Close()
 		return fmt.Errorf("failed to look up head state: %w", err)
 	}
-	if err := fn(state); err != nil {
+	if err := fn(ctx, state); err != nil {
 		_ = ch.Close()
 		return fmt.Errorf("failed to run state change: %w", err)
 	}
+	if err := ctx.Err(); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("interrupted, state changes were not persisted: %w", err)
+	}
 	if ch.ReadOnly {
 		return ch.Close()
 	}
@@ -171,15 +201,146 @@ func (ch *Cheater) RunAndClose(fn HeadFn) error {
 
 // StorageSet modifies the storage of the given address at the given key to the given value.
 func StorageSet(address common.Address, key common.Hash, value common.Hash) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		headState.SetState(address, key, value)
 		return nil
 	}
 }
 
+// StorageClear deletes all storage of the given address at once, leaving the account with an empty storage root.
+// The balance, nonce and code of the account are kept.
+func StorageClear(address common.Address) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if !headState.Exist(address) {
+			return fmt.Errorf("account %s does not exist", address)
+		}
+		clearStorage(headState, address)
+		return nil
+	}
+}
+
+func clearStorage(headState *state.StateDB, address common.Address) {
+	balance := headState.GetBalance(address)
+	nonce := headState.GetNonce(address)
+	code := headState.GetCode(address)
+	// Delete the account, with its storage, and then recreate it without storage.
+	headState.Suicide(address)
+	headState.Finalise(true)
+	headState.CreateAccount(address)
+	headState.SetBalance(address, balance)
+	headState.SetNonce(address, nonce)
+	headState.SetCode(address, code)
+}
+
+// readStorage reads all storage of the account, by key.
+// All storage keys need a known pre-image, since the trie stores hashed keys only.
+func readStorage(ctx context.Context, headState *state.StateDB, address common.Address) (map[common.Hash]common.Hash, error) {
+	storage, err := headState.StorageTrie(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage trie of addr %s: %w", address, err)
+	}
+	values := make(map[common.Hash]common.Hash)
+	if storage == nil {
+		return values, nil
+	}
+	db := headState.Database().DiskDB()
+	unknown := 0
+	iter := trie.NewIterator(storage.NodeIterator(nil))
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key, ok := storageKeyPreimage(storage, db, iter.Key)
+		if !ok {
+			unknown += 1
+			continue
+		}
+		values[key] = dbValueToHash(iter.Value)
+	}
+	if iter.Err != nil {
+		return nil, fmt.Errorf("failed to iterate storage of %s: %w", address, iter.Err)
+	}
+	if unknown > 0 {
+		return nil, fmt.Errorf("%d storage keys of %s have an unknown pre-image", unknown, address)
+	}
+	return values, nil
+}
+
+// StorageCopy copies all storage of the from account to the to account, which must exist.
+// If replace is set, the existing storage of the to account is deleted first,
+// otherwise the storage is merged, and the copied values take precedence.
+func StorageCopy(from, to common.Address, replace bool) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if from == to {
+			return fmt.Errorf("cannot copy storage of account %s onto itself", from)
+		}
+		if !headState.Exist(to) {
+			return fmt.Errorf("account %s does not exist", to)
+		}
+		values, err := readStorage(ctx, headState, from)
+		if err != nil {
+			return fmt.Errorf("cannot copy the storage: %w", err)
+		}
+		if replace {
+			clearStorage(headState, to)
+		}
+		for key, value := range values {
+			headState.SetState(to, key, value)
+		}
+		return nil
+	}
+}
+
+// DeleteAccount removes the account entirely from the state: its balance, nonce, code and storage,
+// as if it self-destructed, e.g. to reproduce the state before a contract was deployed.
+func DeleteAccount(address common.Address) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if !headState.Exist(address) {
+			return fmt.Errorf("account %s does not exist", address)
+		}
+		headState.Suicide(address)
+		headState.Finalise(true)
+		return nil
+	}
+}
+
+// CloneAccount copies the balance, nonce, code and full storage of the from account to the to account.
+// The to account must not exist, unless overwrite is set, in which case it is replaced entirely.
+// All storage keys need a known pre-image, since the trie stores hashed keys only.
+func CloneAccount(from, to common.Address, overwrite bool) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if from == to {
+			return fmt.Errorf("cannot clone account %s onto itself", from)
+		}
+		if !headState.Exist(from) {
+			return fmt.Errorf("account %s does not exist", from)
+		}
+		if headState.Exist(to) && !overwrite {
+			return fmt.Errorf("account %s already exists", to)
+		}
+		values, err := readStorage(ctx, headState, from)
+		if err != nil {
+			return fmt.Errorf("cannot clone the storage: %w", err)
+		}
+		if headState.Exist(to) {
+			// Delete the existing account first, so none of its storage remains.
+			headState.Suicide(to)
+			headState.Finalise(true)
+		}
+		headState.CreateAccount(to)
+		headState.SetBalance(to, headState.GetBalance(from))
+		headState.SetNonce(to, headState.GetNonce(from))
+		headState.SetCode(to, headState.GetCode(from))
+		for key, value := range values {
+			headState.SetState(to, key, value)
+		}
+		return nil
+	}
+}
+
 // StorageGet just reads the storage of the given address at the given key.
 func StorageGet(address common.Address, key common.Hash, w io.Writer) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		value := headState.GetState(address, key)
 		_, err := io.WriteString(w, value.Hex())
 		return err
@@ -190,8 +351,36 @@ func StorageGet(address common.Address, key common.Hash, w io.Writer) HeadFn {
 // Simply replace the (+) with (-) if you need to apply the diff as removal of values.
 // Combined with StoragePatch this allows for quick surgery of 1 account in one database,
 // to another account (maybe even in a different database!).
-func StorageReadAll(address common.Address, w io.Writer) HeadFn {
-	return func(headState *state.StateDB) error {
+// The sensitive storage values are redacted with the given redactor, if not nil.
+func StorageReadAll(address common.Address, w io.Writer, redact *Redactor) HeadFn {
+	return StorageReadRange(address, common.Hash{}, 0, "patch", w, redact)
+}
+
+// StorageEntry is a storage slot, as written by StorageReadRange in the jsonl format.
+type StorageEntry struct {
+	// Key is the storage key, if its pre-image is known.
+	Key       *common.Hash `json:"key,omitempty"`
+	HashedKey common.Hash  `json:"hashedKey"`
+	Value     common.Hash  `json:"value"`
+}
+
+// StoragePage is the last line of a page of storage in the jsonl format, if there are more slots after the page.
+type StoragePage struct {
+	// Next is the hashed key of the first slot of the next page.
+	Next common.Hash `json:"next"`
+}
+
+// StorageReadRange is like StorageReadAll, but reads the slots in order of their hashed keys from the given start key,
+// up to the given limit of slots, or all slots if 0, to page through the storage of huge contracts.
+// The slots are written as they are iterated, so the memory use does not grow with the number of slots.
+// The format is patch, the (+) diff of StorageReadAll, or jsonl, a StorageEntry per line.
+// If the limit cuts the storage short, the start key of the next page is written last,
+// as "# next <key>" comment of the patch, or as StoragePage line.
+func StorageReadRange(address common.Address, start common.Hash, limit uint64, format string, w io.Writer, redact *Redactor) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if format != "patch" && format != "jsonl" {
+			return fmt.Errorf("unknown storage format %q, expected patch or jsonl", format)
+		}
 		storage, err := headState.StorageTrie(address)
 		if err != nil {
 			return fmt.Errorf("failed to open storage trie of addr %s: %w", address, err)
@@ -199,16 +388,57 @@ func StorageReadAll(address common.Address, w io.Writer) HeadFn {
 		if storage == nil {
 			return fmt.Errorf("no storage trie in state for account %s", address)
 		}
-		iter := trie.NewIterator(storage.NodeIterator(nil))
+		db := headState.Database().DiskDB()
+		enc := json.NewEncoder(w)
+		count := uint64(0)
+		iter := trie.NewIterator(storage.NodeIterator(start[:]))
 		for iter.Next() {
-			if _, err := fmt.Fprintf(w, "+ %x = %x\n", iter.Key, dbValueToHash(iter.Value)); err != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			hashedKey := common.BytesToHash(iter.Key)
+			if limit != 0 && count == limit {
+				if format == "jsonl" {
+					return enc.Encode(StoragePage{Next: hashedKey})
+				}
+				_, err := fmt.Fprintf(w, "# next %s\n", hashedKey)
+				return err
+			}
+			count++
+			value := redact.Value(address, hashedKey, dbValueToHash(iter.Value))
+			if format == "jsonl" {
+				entry := StorageEntry{HashedKey: hashedKey, Value: value}
+				if key, ok := storageKeyPreimage(storage, db, iter.Key); ok {
+					entry.Key = &key
+				}
+				if err := enc.Encode(entry); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "+ %x = %x\n", iter.Key, value); err != nil {
 				return err
 			}
 		}
+		if iter.Err != nil {
+			return fmt.Errorf("failed to iterate storage of %s: %w", address, iter.Err)
+		}
 		return nil
 	}
 }
 
+// storageKeyPreimage looks up the storage key of a hashed key in the storage trie,
+// which knows the keys that were changed in the trie, and in the database pre-images otherwise.
+func storageKeyPreimage(tr state.Trie, db ethdb.KeyValueReader, hashedKey []byte) (common.Hash, bool) {
+	if key := tr.GetKey(hashedKey); len(key) == common.HashLength {
+		return common.BytesToHash(key), true
+	}
+	if key := rawdb.ReadPreimage(db, common.BytesToHash(hashedKey)); len(key) == common.HashLength {
+		return common.BytesToHash(key), true
+	}
+	return common.Hash{}, false
+}
+
 func dbValueToHash(enc []byte) common.Hash {
 	var value common.Hash
 	if len(enc) > 0 {
@@ -221,24 +451,72 @@ func dbValueToHash(enc []byte) common.Hash {
 	return value
 }
 
-// StorageDiff compares the storage of two different accounts, and writes a patch with differences.
-// Each difference is expressed with 1 character + or - to indicate the change from a to b, followed by key = value.
+// StorageDiff writes the storage changes from account A to account B, in the StoragePatch format,
+// so that applying the output as patch to account A results in the storage of account B.
+// Keys are written as their pre-image: changes of keys with unknown pre-image cannot be patched,
+// and are written as comments with the hashed key.
 func StorageDiff(out io.Writer, addressA, addressB common.Address) HeadFn {
-	return func(headState *state.StateDB) error {
-		aStorage, err := headState.StorageTrie(addressA)
+	return storageDiff(&patchV1Writer{out: out}, StorageAt{Address: addressA}, StorageAt{Address: addressB})
+}
+
+// StorageDiffV2 is like StorageDiff, but writes a version 2 patch:
+// every change has the value of account A as precondition, so the patch only applies to unchanged storage.
+func StorageDiffV2(out io.Writer, addressA, addressB common.Address) HeadFn {
+	return storageDiff(&patchV2Writer{out: out}, StorageAt{Address: addressA}, StorageAt{Address: addressB})
+}
+
+// StorageAt is the storage of an account in the state with the given root, or in the head state if the root is zero.
+type StorageAt struct {
+	Address common.Address
+	Root    common.Hash
+}
+
+// StorageDiffAt is like StorageDiff, or StorageDiffV2 with patch version 2, but compares the storage of accounts
+// in any state that is still in the database, e.g. of a single account at two block heights.
+func StorageDiffAt(out io.Writer, version uint, a, b StorageAt) (HeadFn, error) {
+	w, err := newPatchWriter(out, version)
+	if err != nil {
+		return nil, err
+	}
+	return storageDiff(w, a, b), nil
+}
+
+// storageTrieAt opens the storage trie of the account, nil if the account has no storage.
+func storageTrieAt(headState *state.StateDB, at StorageAt) (state.Trie, error) {
+	if at.Root == (common.Hash{}) {
+		return headState.StorageTrie(at.Address)
+	}
+	st, err := state.New(at.Root, headState.Database(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("state %s is not available, it may have been pruned: %w", at.Root, err)
+	}
+	return st.StorageTrie(at.Address)
+}
+
+func storageDiff(w patchWriter, a, b StorageAt) HeadFn {
+	addressA, addressB := a.Address, b.Address
+	return func(ctx context.Context, headState *state.StateDB) error {
+		aStorage, err := storageTrieAt(headState, a)
 		if err != nil {
 			return fmt.Errorf("failed to open storage trie of addr A %s: %w", addressA, err)
 		}
 		if aStorage == nil {
 			return fmt.Errorf("no storage trie in state for account A %s", addressA)
 		}
-		bStorage, err := headState.StorageTrie(addressB)
+		bStorage, err := storageTrieAt(headState, b)
 		if err != nil {
 			return fmt.Errorf("failed to open storage trie of addr B %s: %w", addressB, err)
 		}
 		if bStorage == nil {
 			return fmt.Errorf("no storage trie in state for account B %s", addressB)
 		}
+		db := headState.Database().DiskDB()
+		keyOf := func(tr state.Trie, hashedKey []byte) (common.Hash, bool) {
+			if key, ok := storageKeyPreimage(tr, db, hashedKey); ok {
+				return key, true
+			}
+			return common.BytesToHash(hashedKey), false
+		}
 		aIter := trie.NewIterator(aStorage.NodeIterator(nil))
 		bIter := trie.NewIterator(bStorage.NodeIterator(nil))
 		hasA := aIter.Next()
@@ -247,25 +525,37 @@ func StorageDiff(out io.Writer, addressA, addressB common.Address) HeadFn {
 			if !hasA && !hasB {
 				break
 			}
-			if cmp := bytes.Compare(aIter.Key, bIter.Key); cmp < 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// an exhausted iterator sorts last
+			cmp := 0
+			if !hasB {
+				cmp = -1
+			} else if !hasA {
+				cmp = 1
+			} else {
+				cmp = bytes.Compare(aIter.Key, bIter.Key)
+			}
+			if cmp < 0 {
 				// a is smaller, and thus missing in b. Print and move forward a
-				if _, err := fmt.Fprintf(out, "- %x = %x\n", aIter.Key, dbValueToHash(aIter.Value)); err != nil {
+				key, known := keyOf(aStorage, aIter.Key)
+				if err := w.remove(key, known, dbValueToHash(aIter.Value)); err != nil {
 					return err
 				}
 				hasA = aIter.Next()
 			} else if cmp > 0 {
 				// b is smaller, and thus missing in a. Print and move forward b
-				if _, err := fmt.Fprintf(out, "+ %x = %x\n", bIter.Key, dbValueToHash(bIter.Value)); err != nil {
+				key, known := keyOf(bStorage, bIter.Key)
+				if err := w.add(key, known, dbValueToHash(bIter.Value)); err != nil {
 					return err
 				}
 				hasB = bIter.Next()
 			} else if cmp == 0 {
 				// same key, now check if the values differ
 				if !bytes.Equal(aIter.Value, bIter.Value) {
-					if _, err := fmt.Fprintf(out, "- %x = %x\n", aIter.Key, dbValueToHash(aIter.Value)); err != nil {
-						return err
-					}
-					if _, err := fmt.Fprintf(out, "+ %x = %x\n", bIter.Key, dbValueToHash(bIter.Value)); err != nil {
+					key, known := keyOf(aStorage, aIter.Key)
+					if err := w.replace(key, known, dbValueToHash(aIter.Value), dbValueToHash(bIter.Value)); err != nil {
 						return err
 					}
 				}
@@ -283,37 +573,32 @@ func StorageDiff(out io.Writer, addressA, addressB common.Address) HeadFn {
 // Additions are prefixed with (+).
 // Deletions are prefixed with (-) and overwrite it to a zero value.
 // Comments (#) and empty lines are ignored.
+//
+// A patch that starts with a "version 2" line has one operation per line instead, with preconditions:
+//
+//	set <key> = <value>              unconditional write
+//	add <key> = <value>              the slot must be zero
+//	replace <key> = <old> -> <new>   the slot must be <old>
+//	remove <key> [= <old>]           writes zero; the slot must be <old>, if given
+//
+// Comments (#) may also end a line. All preconditions are checked before any change is made:
+// if the storage drifted since the patch was generated, nothing is changed.
 func StoragePatch(patch io.Reader, address common.Address) HeadFn {
-	return func(headState *state.StateDB) error {
-		s := bufio.NewScanner(patch)
-		i := 0
-		for s.Scan() {
-			line := s.Text()
-			if len(line) < 1 || line[0] == '#' { // skip empty lines and comments
-				continue
-			}
-			parts := strings.Split(line[1:], "=")
-			keyHex := strings.TrimSpace(parts[0])
-			valueHex := strings.TrimSpace(parts[1])
-			var key, value common.Hash
-			if err := key.UnmarshalText([]byte(keyHex)); err != nil {
-				return fmt.Errorf("key %s is malformatted: %w", keyHex, err)
-			}
-			if err := value.UnmarshalText([]byte(valueHex)); err != nil {
-				return fmt.Errorf("key %s has malformatted value %s: %w", keyHex, valueHex, err)
-			}
-			switch line[0] {
-			case '+':
-				headState.SetState(address, key, value)
-			case '-':
-				headState.SetState(address, key, common.Hash{})
-			default:
-				return fmt.Errorf("unrecognized line diff token")
-			}
-			i += 1
-			if i%1000 == 0 { // for every 1000 values, commit to disk
+	return func(ctx context.Context, headState *state.StateDB) error {
+		entries, err := ReadStoragePatch(ctx, patch)
+		if err != nil {
+			return err
+		}
+		if err := CheckPatchPreconditions(entries, func(key common.Hash) (common.Hash, error) {
+			return headState.GetState(address, key), nil
+		}); err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			headState.SetState(address, entry.Key, entry.Value)
+			if (i+1)%1000 == 0 { // for every 1000 values, commit to disk
 				if _, err := headState.Commit(true); err != nil {
-					return fmt.Errorf("failed to commit state to disk after patching %d entries: %w", i, err)
+					return fmt.Errorf("failed to commit state to disk after patching %d entries: %w", i+1, err)
 				}
 			}
 		}
@@ -329,7 +614,7 @@ type OvmOwnersConfig struct {
 }
 
 func OvmOwners(conf *OvmOwnersConfig) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		var addressManager common.Address // Lib_AddressManager
 		var l1SBProxy common.Address      // Proxy__OVM_L1StandardBridge
 		var l1XDMProxy common.Address     // Proxy__OVM_L1CrossDomainMessenger
@@ -374,26 +659,39 @@ func OvmOwners(conf *OvmOwnersConfig) HeadFn {
 }
 
 func SetBalance(addr common.Address, amount *big.Int) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		headState.SetBalance(addr, amount)
 		return nil
 	}
 }
 
 func SetCode(addr common.Address, code hexutil.Bytes) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		headState.SetCode(addr, code)
 		return nil
 	}
 }
 
 func SetNonce(addr common.Address, nonce uint64) HeadFn {
-	return func(headState *state.StateDB) error {
+	return func(ctx context.Context, headState *state.StateDB) error {
 		headState.SetNonce(addr, nonce)
 		return nil
 	}
 }
 
+// SetNonces sets the nonce of all the given accounts, as a single change to the head state.
+func SetNonces(addrs []common.Address, nonce uint64) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		for _, addr := range addrs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			headState.SetNonce(addr, nonce)
+		}
+		return nil
+	}
+}
+
 // blockBodyKey returns the database key to use for storing the body of a block.
 // This function was copied from Geth's core/rawdb/accessors_chain.go.
 func blockBodyKey(number uint64, hash common.Hash) []byte {
@@ -0,0 +1,255 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestState returns an empty state, in memory, that records the preimages of its keys like a geth with preimages enabled.
+func newTestState(t *testing.T) *state.StateDB {
+	db := state.NewDatabaseWithConfig(rawdb.NewMemoryDatabase(), &trie.Config{Preimages: true})
+	headState, err := state.New(types.EmptyRootHash, db, nil)
+	require.NoError(t, err)
+	return headState
+}
+
+func TestOpenGethRawDBInUse(t *testing.T) {
+	dataDir := t.TempDir()
+	db, err := OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = OpenGethRawDB(dataDir, true)
+	require.ErrorIs(t, err, ErrDataDirInUse)
+
+	// other errors are not mistaken for a running node
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err = OpenGethRawDB(file, false)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrDataDirInUse)
+}
+
+func TestStorageClear(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(addr, 3)
+	headState.SetBalance(addr, big.NewInt(42))
+	headState.SetCode(addr, []byte{0x60, 0x00})
+	for i := byte(1); i <= 10; i++ {
+		headState.SetState(addr, common.Hash{31: i}, common.Hash{31: i})
+	}
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, StorageClear(addr)(context.Background(), headState))
+	root, err = headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	storageRoot, err := storageRoot(headState, addr)
+	require.NoError(t, err)
+	require.Equal(t, types.EmptyRootHash, storageRoot)
+	require.Equal(t, common.Hash{}, headState.GetState(addr, common.Hash{31: 1}))
+	require.Equal(t, uint64(3), headState.GetNonce(addr))
+	require.Equal(t, big.NewInt(42), headState.GetBalance(addr))
+	require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(addr))
+}
+
+func TestDeleteAccount(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(addr, 3)
+	headState.SetBalance(addr, big.NewInt(42))
+	headState.SetCode(addr, []byte{0x60, 0x00})
+	headState.SetState(addr, common.Hash{31: 1}, common.Hash{31: 1})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, DeleteAccount(addr)(context.Background(), headState))
+	root, err = headState.Commit(true)
+	require.NoError(t, err)
+	require.Equal(t, types.EmptyRootHash, root, "state without the account is empty")
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	require.False(t, headState.Exist(addr))
+	require.ErrorContains(t, DeleteAccount(addr)(context.Background(), headState), "does not exist")
+}
+
+func TestCloneAccount(t *testing.T) {
+	from, to := common.Address{0: 0xa}, common.Address{0: 0xb}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(from, 3)
+	headState.SetBalance(from, big.NewInt(42))
+	headState.SetCode(from, []byte{0x60, 0x00})
+	for i := byte(1); i <= 10; i++ {
+		headState.SetState(from, common.Hash{31: i}, common.Hash{31: i})
+	}
+	headState.SetNonce(to, 1)
+	headState.SetState(to, common.Hash{31: 0xff}, common.Hash{31: 0xff})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	require.ErrorContains(t, CloneAccount(from, to, false)(context.Background(), headState), "already exists")
+	require.NoError(t, CloneAccount(from, to, true)(context.Background(), headState))
+	root, err = headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), headState.GetNonce(to))
+	require.Equal(t, big.NewInt(42), headState.GetBalance(to))
+	require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(to))
+	fromRoot, err := storageRoot(headState, from)
+	require.NoError(t, err)
+	toRoot, err := storageRoot(headState, to)
+	require.NoError(t, err)
+	require.Equal(t, fromRoot, toRoot, "storage of the existing account must be replaced")
+	require.Equal(t, common.Hash{31: 5}, headState.GetState(to, common.Hash{31: 5}))
+}
+
+func TestStorageCopy(t *testing.T) {
+	from, to := common.Address{0: 0xa}, common.Address{0: 0xb}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(from, 1)
+	headState.SetState(from, common.Hash{31: 1}, common.Hash{31: 1})
+	headState.SetState(from, common.Hash{31: 2}, common.Hash{31: 2})
+	headState.SetNonce(to, 1)
+	headState.SetState(to, common.Hash{31: 2}, common.Hash{31: 0xb})
+	headState.SetState(to, common.Hash{31: 3}, common.Hash{31: 3})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+
+	merged, err := state.New(root, db, nil)
+	require.NoError(t, err)
+	require.NoError(t, StorageCopy(from, to, false)(context.Background(), merged))
+	require.Equal(t, common.Hash{31: 1}, merged.GetState(to, common.Hash{31: 1}))
+	require.Equal(t, common.Hash{31: 2}, merged.GetState(to, common.Hash{31: 2}), "copied values take precedence")
+	require.Equal(t, common.Hash{31: 3}, merged.GetState(to, common.Hash{31: 3}), "other storage is kept")
+
+	replaced, err := state.New(root, db, nil)
+	require.NoError(t, err)
+	require.NoError(t, StorageCopy(from, to, true)(context.Background(), replaced))
+	root, err = replaced.Commit(true)
+	require.NoError(t, err)
+	replaced, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}, replaced.GetState(to, common.Hash{31: 3}), "other storage is deleted")
+	require.Equal(t, uint64(1), replaced.GetNonce(to))
+	fromRoot, err := storageRoot(replaced, from)
+	require.NoError(t, err)
+	toRoot, err := storageRoot(replaced, to)
+	require.NoError(t, err)
+	require.Equal(t, fromRoot, toRoot)
+
+	require.ErrorContains(t, StorageCopy(from, common.Address{0: 0xc}, false)(context.Background(), replaced), "does not exist")
+}
+
+func TestStorageReadRange(t *testing.T) {
+	ctx := context.Background()
+	addr := common.Address{0: 0xa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(addr, 1)
+	for i := byte(1); i <= 5; i++ {
+		headState.SetState(addr, common.Hash{31: i}, common.Hash{31: i})
+	}
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	var all bytes.Buffer
+	require.NoError(t, StorageReadAll(addr, &all, nil)(ctx, headState))
+
+	// page through the patch format, and resume each page at the next key
+	var paged strings.Builder
+	start := common.Hash{}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		var page bytes.Buffer
+		require.NoError(t, StorageReadRange(addr, start, 2, "patch", &page, nil)(ctx, headState))
+		lines := strings.SplitAfter(page.String(), "\n")
+		last := lines[len(lines)-2]
+		if !strings.HasPrefix(last, "# next ") {
+			paged.WriteString(page.String())
+			break
+		}
+		require.Len(t, lines, 4)
+		paged.WriteString(strings.Join(lines[:2], ""))
+		require.NoError(t, start.UnmarshalText([]byte(strings.TrimSpace(strings.TrimPrefix(last, "# next ")))))
+	}
+	require.Equal(t, all.String(), paged.String())
+
+	var out bytes.Buffer
+	require.NoError(t, StorageReadRange(addr, common.Hash{}, 5, "jsonl", &out, nil)(ctx, headState))
+	dec := json.NewDecoder(&out)
+	keys := make(map[common.Hash]bool)
+	for dec.More() {
+		var entry StorageEntry
+		require.NoError(t, dec.Decode(&entry))
+		require.NotNil(t, entry.Key)
+		require.Equal(t, crypto.Keccak256Hash(entry.Key[:]), entry.HashedKey)
+		require.Equal(t, *entry.Key, entry.Value)
+		keys[*entry.Key] = true
+	}
+	require.Len(t, keys, 5)
+
+	out.Reset()
+	require.NoError(t, StorageReadRange(addr, common.Hash{}, 4, "jsonl", &out, nil)(ctx, headState))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 5)
+	var page StoragePage
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &page))
+	out.Reset()
+	require.NoError(t, StorageReadRange(addr, page.Next, 0, "jsonl", &out, nil)(ctx, headState))
+	var entry StorageEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, page.Next, entry.HashedKey)
+
+	require.ErrorContains(t, StorageReadRange(addr, common.Hash{}, 0, "csv", &out, nil)(ctx, headState), "unknown storage format")
+}
+
+func TestSetNonces(t *testing.T) {
+	a, b, other := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(a, 3)
+	headState.SetNonce(other, 5)
+
+	require.NoError(t, SetNonces([]common.Address{a, b}, 7)(context.Background(), headState))
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), headState.GetNonce(a))
+	require.Equal(t, uint64(7), headState.GetNonce(b), "accounts that do not exist yet are created")
+	require.Equal(t, uint64(5), headState.GetNonce(other))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, SetNonces([]common.Address{a}, 0)(ctx, headState), context.Canceled)
+	require.Equal(t, uint64(7), headState.GetNonce(a))
+}
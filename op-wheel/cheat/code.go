@@ -0,0 +1,226 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// SplitMetadata splits the CBOR-encoded compiler metadata from the end of the given bytecode.
+// Solidity (and Vyper) append the metadata, followed by a 2-byte big-endian length of the metadata.
+// If no metadata can be recognized, the code is returned as-is with nil metadata.
+func SplitMetadata(code []byte) (stripped []byte, metadata []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	size := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	if size == 0 || size+2 > len(code) {
+		return code, nil
+	}
+	start := len(code) - 2 - size
+	// CBOR maps with up to 23 entries are encoded with a major-type 5 prefix byte: 0xa0 - 0xb7
+	if code[start] < 0xa0 || code[start] > 0xb7 {
+		return code, nil
+	}
+	return code[:start], code[start:]
+}
+
+// ImmutableRef is a range of bytecode that holds an immutable value, as listed in solc/forge artifacts.
+type ImmutableRef struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// ImmutableDiff is a range in the bytecode where the two compared codes hold different immutable values.
+type ImmutableDiff struct {
+	Offset int           `json:"offset"`
+	A      hexutil.Bytes `json:"a"`
+	B      hexutil.Bytes `json:"b"`
+}
+
+// CodeComparison is the result of a semantic comparison of two bytecodes.
+type CodeComparison struct {
+	// Equal is true if the codes are equal after stripping metadata and ignoring immutables.
+	Equal bool `json:"equal"`
+	// ByteEqual is true if the codes are exactly equal.
+	ByteEqual bool `json:"byteEqual"`
+
+	SizeA     int           `json:"sizeA"`
+	SizeB     int           `json:"sizeB"`
+	MetadataA hexutil.Bytes `json:"metadataA,omitempty"`
+	MetadataB hexutil.Bytes `json:"metadataB,omitempty"`
+
+	// Immutables lists the differences that were ignored, since they are immutable values.
+	Immutables []ImmutableDiff `json:"immutables,omitempty"`
+	// FirstDiff is the offset of the first semantic difference, if the codes are not equal.
+	FirstDiff *int `json:"firstDiff,omitempty"`
+}
+
+// CompareCode compares the code a and b semantically: compiler metadata is ignored, and so are the immutable values
+// at the given refs, e.g. as listed in the artifact of b. Both codes are walked opcode by opcode, so push data is never
+// taken for an opcode, and only the data of a push that exactly covers a ref is ignored: a changed constant is a difference.
+func CompareCode(a, b []byte, refs []ImmutableRef) *CodeComparison {
+	out := &CodeComparison{ByteEqual: bytes.Equal(a, b), SizeA: len(a), SizeB: len(b)}
+	a, out.MetadataA = SplitMetadata(a)
+	b, out.MetadataB = SplitMetadata(b)
+	immutables := make(map[int]int, len(refs))
+	for _, ref := range refs {
+		immutables[ref.Start] = ref.Length
+	}
+	for i := 0; i < len(a) || i < len(b); {
+		if i >= len(a) || i >= len(b) || a[i] != b[i] {
+			diff := i
+			out.FirstDiff = &diff
+			break
+		}
+		size := pushSize(a[i])
+		dataA, dataB := pushData(a, i, size), pushData(b, i, size)
+		if !bytes.Equal(dataA, dataB) {
+			if length, ok := immutables[i+1]; ok && length == size && len(dataA) == size && len(dataB) == size {
+				out.Immutables = append(out.Immutables, ImmutableDiff{
+					Offset: i + 1,
+					A:      common.CopyBytes(dataA),
+					B:      common.CopyBytes(dataB),
+				})
+			} else {
+				diff := i + 1 + firstDiff(dataA, dataB)
+				out.FirstDiff = &diff
+				break
+			}
+		}
+		i += 1 + size
+	}
+	out.Equal = out.FirstDiff == nil
+	return out
+}
+
+// ImmutablePlaceholders returns the ranges of the immutable values in unlinked deployed code, e.g. of the contract bindings,
+// which have no immutable references: solc leaves immutables as the zero data of a PUSH32,
+// and never pushes a zero constant with a PUSH32.
+func ImmutablePlaceholders(code []byte) []ImmutableRef {
+	code, _ = SplitMetadata(code)
+	var refs []ImmutableRef
+	for i := 0; i < len(code); i += 1 + pushSize(code[i]) {
+		if vm.OpCode(code[i]) != vm.PUSH32 {
+			continue
+		}
+		if data := pushData(code, i, 32); len(data) == 32 && common.BytesToHash(data) == (common.Hash{}) {
+			refs = append(refs, ImmutableRef{Start: i + 1, Length: 32})
+		}
+	}
+	return refs
+}
+
+// pushSize returns the size of the push data of the opcode, 0 if it is not a push.
+func pushSize(op byte) int {
+	if vm.OpCode(op) >= vm.PUSH1 && vm.OpCode(op) <= vm.PUSH32 {
+		return int(vm.OpCode(op) - vm.PUSH1 + 1)
+	}
+	return 0
+}
+
+// pushData returns the push data of the opcode at offset i, which is cut short at the end of the code.
+func pushData(code []byte, i int, size int) []byte {
+	end := i + 1 + size
+	if end > len(code) {
+		end = len(code)
+	}
+	return code[i+1 : end]
+}
+
+// firstDiff returns the index of the first byte that differs, or the length of the shorter slice.
+func firstDiff(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// ReadArtifactCode reads the deployed bytecode and immutable references from a forge or hardhat artifact JSON file.
+// Hardhat artifacts list no immutable references, so the immutable placeholders of the code are used instead.
+func ReadArtifactCode(path string) (code []byte, refs []ImmutableRef, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	var artifact struct {
+		DeployedBytecode json.RawMessage `json:"deployedBytecode"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode artifact: %w", err)
+	}
+	// hardhat artifacts have a plain hex string, forge artifacts have an object with immutable references.
+	var hardhatCode hexutil.Bytes
+	if err := json.Unmarshal(artifact.DeployedBytecode, &hardhatCode); err == nil {
+		return hardhatCode, ImmutablePlaceholders(hardhatCode), nil
+	}
+	var forgeCode struct {
+		Object              hexutil.Bytes             `json:"object"`
+		ImmutableReferences map[string][]ImmutableRef `json:"immutableReferences"`
+	}
+	if err := json.Unmarshal(artifact.DeployedBytecode, &forgeCode); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode artifact deployed bytecode: %w", err)
+	}
+	for _, r := range forgeCode.ImmutableReferences {
+		refs = append(refs, r...)
+	}
+	return forgeCode.Object, refs, nil
+}
+
+// CodeCompare compares the code of the given account semantically against the other code,
+// and writes the comparison as JSON to the given writer.
+func CodeCompare(addr common.Address, other []byte, refs []ImmutableRef, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(CompareCode(headState.GetCode(addr), other, refs))
+	}
+}
+
+// CodeCompareAccounts compares the code of the two given accounts semantically,
+// and writes the comparison as JSON to the given writer.
+func CodeCompareAccounts(addrA, addrB common.Address, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		return CodeCompare(addrA, headState.GetCode(addrB), nil, w)(ctx, headState)
+	}
+}
+
+// AccountCode is the deployed code of an account.
+type AccountCode struct {
+	Address  common.Address `json:"address"`
+	CodeHash common.Hash    `json:"codeHash"`
+	Size     int            `json:"size"`
+	Code     hexutil.Bytes  `json:"code,omitempty"`
+}
+
+// GetCode reads the deployed code of the account into out.
+func GetCode(addr common.Address, out *AccountCode) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		code := headState.GetCode(addr)
+		*out = AccountCode{Address: addr, CodeHash: codeHash(headState, addr), Size: len(code), Code: code}
+		return nil
+	}
+}
+
+// CopyCode sets the code of the to account to the code of the from account,
+// e.g. to run an implementation in place of a proxy.
+func CopyCode(from, to common.Address) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		code := headState.GetCode(from)
+		if len(code) == 0 {
+			return fmt.Errorf("account %s has no code to copy", from)
+		}
+		headState.SetCode(to, code)
+		return nil
+	}
+}
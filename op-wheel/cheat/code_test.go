@@ -0,0 +1,110 @@
+package cheat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMetadata(t *testing.T) {
+	code := common.FromHex("0x6080604052")
+	metadata := common.FromHex("0xa264697066735822beef64736f6c6343000813")
+	full := append(append(common.CopyBytes(code), metadata...), 0x00, byte(len(metadata)))
+
+	stripped, meta := SplitMetadata(full)
+	require.Equal(t, code, stripped)
+	require.Equal(t, append(metadata, 0x00, byte(len(metadata))), meta)
+
+	stripped, meta = SplitMetadata(code)
+	require.Equal(t, code, stripped)
+	require.Nil(t, meta)
+}
+
+func TestCompareCode(t *testing.T) {
+	push32 := func(v byte) []byte {
+		out := []byte{0x7f}
+		return append(out, common.Hash{31: v}.Bytes()...)
+	}
+	a := append(append([]byte{0x60, 0x80}, push32(1)...), 0x00)
+	b := append(append([]byte{0x60, 0x80}, push32(2)...), 0x00)
+
+	t.Run("changed constant", func(t *testing.T) {
+		res := CompareCode(a, b, nil)
+		require.False(t, res.Equal)
+		require.False(t, res.ByteEqual)
+		require.Empty(t, res.Immutables)
+		require.Equal(t, 34, *res.FirstDiff)
+	})
+	t.Run("immutable refs", func(t *testing.T) {
+		res := CompareCode(a, b, []ImmutableRef{{Start: 3, Length: 32}})
+		require.True(t, res.Equal)
+		require.Len(t, res.Immutables, 1)
+		require.Equal(t, 3, res.Immutables[0].Offset)
+	})
+	t.Run("ref not on push data", func(t *testing.T) {
+		res := CompareCode(a, b, []ImmutableRef{{Start: 2, Length: 33}})
+		require.False(t, res.Equal)
+		require.Equal(t, 34, *res.FirstDiff)
+	})
+	t.Run("push data is not an opcode", func(t *testing.T) {
+		// the PUSH2 data holds a PUSH32 opcode, of which the following bytes are no push data
+		c := []byte{0x61, 0x7f, 0x01, 0x60, 0x01}
+		d := []byte{0x61, 0x7f, 0x01, 0x60, 0x02}
+		res := CompareCode(c, d, ImmutablePlaceholders(d))
+		require.False(t, res.Equal)
+		require.Equal(t, 4, *res.FirstDiff)
+	})
+	t.Run("immutable placeholders", func(t *testing.T) {
+		unlinked := append(append([]byte{0x60, 0x80}, push32(0)...), 0x00)
+		refs := ImmutablePlaceholders(unlinked)
+		require.Equal(t, []ImmutableRef{{Start: 3, Length: 32}}, refs)
+		require.True(t, CompareCode(a, unlinked, refs).Equal)
+	})
+	t.Run("different code", func(t *testing.T) {
+		c := append(append([]byte{0x60, 0x81}, push32(1)...), 0x00)
+		res := CompareCode(a, c, nil)
+		require.False(t, res.Equal)
+		require.NotNil(t, res.FirstDiff)
+		require.Equal(t, 1, *res.FirstDiff)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		res := CompareCode(a, a[:10], nil)
+		require.False(t, res.Equal)
+		require.Equal(t, 10, *res.FirstDiff)
+	})
+}
+
+func TestGetCode(t *testing.T) {
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	addr, empty := common.Address{0: 0xa}, common.Address{0: 0xb}
+	code := common.FromHex("0x6080604052")
+	headState.SetCode(addr, code)
+
+	var out AccountCode
+	require.NoError(t, GetCode(addr, &out)(context.Background(), headState))
+	require.Equal(t, AccountCode{Address: addr, CodeHash: crypto.Keccak256Hash(code), Size: len(code), Code: code}, out)
+
+	require.NoError(t, GetCode(empty, &out)(context.Background(), headState))
+	require.Equal(t, types.EmptyCodeHash, out.CodeHash)
+	require.Zero(t, out.Size)
+}
+
+func TestCopyCode(t *testing.T) {
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	proxy, impl := common.Address{0: 0xa}, common.Address{0: 0xb}
+	headState.SetCode(proxy, common.FromHex("0x363d3d37"))
+	headState.SetCode(impl, common.FromHex("0x6080604052"))
+
+	require.NoError(t, CopyCode(impl, proxy)(context.Background(), headState))
+	require.Equal(t, headState.GetCode(impl), headState.GetCode(proxy))
+	require.Equal(t, headState.GetCodeHash(impl), headState.GetCodeHash(proxy))
+	require.ErrorContains(t, CopyCode(common.Address{0: 0xc}, proxy)(context.Background(), headState), "no code")
+}
@@ -0,0 +1,51 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// compactionRanges is the number of key-ranges a full compaction is split into, to report progress.
+const compactionRanges = 16
+
+// CompactDB triggers a full compaction of the database, and monitors it by writing progress to the given writer.
+// The key-space is compacted in ranges, split by the first nibble of the key, so progress can be reported in between,
+// and the compaction can be canceled in between ranges.
+func CompactDB(ctx context.Context, db ethdb.Database, w io.Writer) error {
+	if err := writeDBStats(db, w, "before compaction"); err != nil {
+		return err
+	}
+	start := time.Now()
+	for i := 0; i < compactionRanges; i++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("compaction interrupted after %d/%d ranges: %w", i, compactionRanges, err)
+		}
+		var rangeStart, rangeLimit []byte // nil start and limit are the start and end of the key-space
+		if i > 0 {
+			rangeStart = []byte{byte(i << 4)}
+		}
+		if i+1 < compactionRanges {
+			rangeLimit = []byte{byte((i + 1) << 4)}
+		}
+		if err := db.Compact(rangeStart, rangeLimit); err != nil {
+			return fmt.Errorf("failed to compact range %x-%x: %w", rangeStart, rangeLimit, err)
+		}
+		if _, err := fmt.Fprintf(w, "compacted range %d/%d, elapsed: %s\n", i+1, compactionRanges, time.Since(start).Truncate(time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	return writeDBStats(db, w, "after compaction")
+}
+
+func writeDBStats(db ethdb.Database, w io.Writer, label string) error {
+	stats, err := db.Stat("leveldb.stats")
+	if err != nil {
+		return fmt.Errorf("failed to read database stats: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "database stats %s:\n%s\n", label, stats)
+	return err
+}
@@ -0,0 +1,118 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// DirComparison is the outcome of comparing the databases of two data dirs.
+type DirComparison struct {
+	HeadA uint64 `json:"headA"`
+	HeadB uint64 `json:"headB"`
+	// Block is the block number that the canonical chain and the state are compared at.
+	Block uint64 `json:"block"`
+	// Differences lists everything that differs between the two databases, empty if they are identical.
+	Differences []string `json:"differences"`
+}
+
+// CompareDirs compares the chain configs, head blocks, and the canonical block and state root at the given block
+// of the databases of two data dirs. If block is nil, the lowest of the two head blocks is compared.
+// The given accounts are compared in the state at that block, with their storage roots.
+func CompareDirs(ctx context.Context, a, b ethdb.Database, block *uint64, accounts []common.Address) (*DirComparison, error) {
+	cmp := &DirComparison{Differences: []string{}}
+	differ := func(format string, args ...any) {
+		cmp.Differences = append(cmp.Differences, fmt.Sprintf(format, args...))
+	}
+	genesisA, genesisB := rawdb.ReadCanonicalHash(a, 0), rawdb.ReadCanonicalHash(b, 0)
+	if genesisA != genesisB {
+		differ("genesis: a %s, b %s", genesisA, genesisB)
+	}
+	configA, err := json.Marshal(rawdb.ReadChainConfig(a, genesisA))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chain config of a: %w", err)
+	}
+	configB, err := json.Marshal(rawdb.ReadChainConfig(b, genesisB))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chain config of b: %w", err)
+	}
+	if string(configA) != string(configB) {
+		differ("chain config: a %s, b %s", configA, configB)
+	}
+	headA, headB := rawdb.ReadHeadHeader(a), rawdb.ReadHeadHeader(b)
+	if headA == nil || headB == nil {
+		return nil, fmt.Errorf("missing head header (a: %v, b: %v)", headA != nil, headB != nil)
+	}
+	cmp.HeadA, cmp.HeadB = headA.Number.Uint64(), headB.Number.Uint64()
+	if headA.Hash() != headB.Hash() {
+		differ("head block: a %d %s, b %d %s", cmp.HeadA, headA.Hash(), cmp.HeadB, headB.Hash())
+	}
+	if block != nil {
+		cmp.Block = *block
+	} else if cmp.HeadA < cmp.HeadB {
+		cmp.Block = cmp.HeadA
+	} else {
+		cmp.Block = cmp.HeadB
+	}
+	hashA, hashB := rawdb.ReadCanonicalHash(a, cmp.Block), rawdb.ReadCanonicalHash(b, cmp.Block)
+	if hashA != hashB {
+		differ("canonical block %d: a %s, b %s", cmp.Block, hashA, hashB)
+	}
+	headerA, headerB := rawdb.ReadHeader(a, hashA, cmp.Block), rawdb.ReadHeader(b, hashB, cmp.Block)
+	if headerA == nil || headerB == nil {
+		differ("header of block %d is missing (a: %v, b: %v)", cmp.Block, headerA == nil, headerB == nil)
+		return cmp, nil
+	}
+	if headerA.Root != headerB.Root {
+		differ("state root at block %d: a %s, b %s", cmp.Block, headerA.Root, headerB.Root)
+	}
+	if len(accounts) == 0 {
+		return cmp, nil
+	}
+	stateA, errA := state.New(headerA.Root, state.NewDatabase(a), nil)
+	stateB, errB := state.New(headerB.Root, state.NewDatabase(b), nil)
+	if errA != nil || errB != nil {
+		differ("state at block %d is missing, cannot compare accounts (a: %v, b: %v)", cmp.Block, errA, errB)
+		return cmp, nil
+	}
+	for _, addr := range accounts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if x, y := stateA.GetBalance(addr), stateB.GetBalance(addr); x.Cmp(y) != 0 {
+			differ("account %s balance: a %s, b %s", addr, x, y)
+		}
+		if x, y := stateA.GetNonce(addr), stateB.GetNonce(addr); x != y {
+			differ("account %s nonce: a %d, b %d", addr, x, y)
+		}
+		if x, y := codeHash(stateA, addr), codeHash(stateB, addr); x != y {
+			differ("account %s code hash: a %s, b %s", addr, x, y)
+		}
+		x, err := storageRoot(stateA, addr)
+		if err != nil {
+			return nil, err
+		}
+		y, err := storageRoot(stateB, addr)
+		if err != nil {
+			return nil, err
+		}
+		if x != y {
+			differ("account %s storage root: a %s, b %s", addr, x, y)
+		}
+	}
+	return cmp, nil
+}
+
+// codeHash returns the code hash of the account, which is the empty code hash for non-existent accounts.
+func codeHash(headState *state.StateDB, addr common.Address) common.Hash {
+	if h := headState.GetCodeHash(addr); h != (common.Hash{}) {
+		return h
+	}
+	return types.EmptyCodeHash
+}
@@ -0,0 +1,83 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareDirs(t *testing.T) {
+	ctx := context.Background()
+	addr := common.Address{0: 0xa}
+	newDB := func(balance int64) (ethdb.Database, *types.Block) {
+		genesis := &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{addr: {Balance: big.NewInt(balance), Nonce: 1}},
+		}
+		db := rawdb.NewMemoryDatabase()
+		return db, genesis.MustCommit(db)
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		a, _ := newDB(1)
+		b, _ := newDB(1)
+		cmp, err := CompareDirs(ctx, a, b, nil, []common.Address{addr, {0: 0xb}})
+		require.NoError(t, err)
+		require.Equal(t, &DirComparison{Differences: []string{}}, cmp)
+	})
+
+	t.Run("ahead", func(t *testing.T) {
+		a, genesis := newDB(1)
+		b, _ := newDB(1)
+		// a has one more header, on top of the same genesis
+		header := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), Root: genesis.Root(), Difficulty: common.Big0}
+		rawdb.WriteHeader(a, header)
+		rawdb.WriteCanonicalHash(a, header.Hash(), 1)
+		rawdb.WriteHeadHeaderHash(a, header.Hash())
+
+		cmp, err := CompareDirs(ctx, a, b, nil, []common.Address{addr})
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), cmp.HeadA)
+		require.Equal(t, uint64(0), cmp.HeadB)
+		require.Equal(t, uint64(0), cmp.Block, "the lowest head is compared")
+		require.Equal(t, []string{fmt.Sprintf("head block: a 1 %s, b 0 %s", header.Hash(), genesis.Hash())}, cmp.Differences)
+
+		one := uint64(1)
+		cmp, err = CompareDirs(ctx, a, b, &one, []common.Address{addr})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			fmt.Sprintf("head block: a 1 %s, b 0 %s", header.Hash(), genesis.Hash()),
+			fmt.Sprintf("canonical block 1: a %s, b %s", header.Hash(), common.Hash{}),
+			"header of block 1 is missing (a: false, b: true)",
+		}, cmp.Differences)
+	})
+
+	t.Run("other genesis", func(t *testing.T) {
+		a, genesisA := newDB(1)
+		b, genesisB := newDB(2)
+		cmp, err := CompareDirs(ctx, a, b, nil, []common.Address{addr})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			fmt.Sprintf("genesis: a %s, b %s", genesisA.Hash(), genesisB.Hash()),
+			fmt.Sprintf("head block: a 0 %s, b 0 %s", genesisA.Hash(), genesisB.Hash()),
+			fmt.Sprintf("canonical block 0: a %s, b %s", genesisA.Hash(), genesisB.Hash()),
+			fmt.Sprintf("state root at block 0: a %s, b %s", genesisA.Root(), genesisB.Root()),
+			fmt.Sprintf("account %s balance: a 1, b 2", addr),
+		}, cmp.Differences)
+	})
+
+	t.Run("missing head", func(t *testing.T) {
+		a, _ := newDB(1)
+		_, err := CompareDirs(ctx, a, rawdb.NewMemoryDatabase(), nil, nil)
+		require.ErrorContains(t, err, "missing head header (a: true, b: false)")
+	})
+}
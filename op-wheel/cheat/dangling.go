@@ -0,0 +1,79 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// DanglingStorage is an account without code, nonce or balance, that still has a storage trie.
+type DanglingStorage struct {
+	AddressHash common.Hash `json:"addressHash"`
+	// Address is only known if the pre-image of the address hash is in the database.
+	Address     *common.Address `json:"address,omitempty"`
+	StorageRoot common.Hash     `json:"storageRoot"`
+	// Collected is true if the account was deleted, and its storage with it.
+	Collected bool `json:"collected"`
+}
+
+// FindDanglingStorage scans the whole state for accounts that have storage, but no code, nonce or balance:
+// leftovers of past surgeries. Each of these is written as JSON line to the given writer.
+// If gc is true, the found accounts are deleted, so their storage is dropped from the state.
+// Accounts can only be deleted if their address pre-image is known.
+func FindDanglingStorage(w io.Writer, gc bool) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		db := headState.Database()
+		accounts, err := db.OpenTrie(headState.IntermediateRoot(false))
+		if err != nil {
+			return fmt.Errorf("failed to open account trie: %w", err)
+		}
+		enc := json.NewEncoder(w)
+		iter := trie.NewIterator(accounts.NodeIterator(nil))
+		for iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var acc types.StateAccount
+			if err := rlp.DecodeBytes(iter.Value, &acc); err != nil {
+				return fmt.Errorf("failed to decode account %x: %w", iter.Key, err)
+			}
+			if !danglingStorage(&acc) {
+				continue
+			}
+			entry := DanglingStorage{
+				AddressHash: common.BytesToHash(iter.Key),
+				StorageRoot: acc.Root,
+			}
+			if preimage := rawdb.ReadPreimage(db.DiskDB(), entry.AddressHash); len(preimage) == common.AddressLength {
+				addr := common.BytesToAddress(preimage)
+				entry.Address = &addr
+				if gc {
+					headState.Suicide(addr)
+					entry.Collected = true
+				}
+			}
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+		}
+		if iter.Err != nil {
+			return fmt.Errorf("failed to iterate account trie: %w", iter.Err)
+		}
+		return nil
+	}
+}
+
+// danglingStorage returns true if the account has storage, but no code, nonce or balance.
+func danglingStorage(acc *types.StateAccount) bool {
+	return acc.Root != types.EmptyRootHash && acc.Nonce == 0 && acc.Balance.Sign() == 0 &&
+		bytes.Equal(acc.CodeHash, types.EmptyCodeHash[:])
+}
@@ -0,0 +1,142 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/bindings"
+	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/genesis"
+	opstate "github.com/ethereum-optimism/optimism/op-chain-ops/state"
+)
+
+// PredeployConfigValues returns the storage values of the predeploys that follow from the deploy config:
+// the owners and the fee parameters. Genesis storage that changes while the chain runs, e.g. the L1 block info
+// and the message nonces, and constants like the initialization flags, are not included.
+func PredeployConfigValues(config *genesis.DeployConfig) opstate.StorageConfig {
+	storage := opstate.StorageConfig{
+		"ProxyAdmin": {
+			"_owner": config.ProxyAdminOwner,
+		},
+		"L1Block": {
+			"batcherHash":   config.BatchSenderAddress.Hash(),
+			"l1FeeOverhead": config.GasPriceOracleOverhead,
+			"l1FeeScalar":   config.GasPriceOracleScalar,
+		},
+	}
+	if config.EnableGovernance {
+		storage["GovernanceToken"] = opstate.StorageValues{
+			"_name":   config.GovernanceTokenName,
+			"_symbol": config.GovernanceTokenSymbol,
+			"_owner":  config.GovernanceTokenOwner,
+		}
+	}
+	return storage
+}
+
+// PredeployStorageChange is the change of a storage variable of a predeploy, see ApplyPredeployConfig.
+type PredeployStorageChange struct {
+	Predeploy string         `json:"predeploy"`
+	Address   common.Address `json:"address"`
+	Variable  string         `json:"variable"`
+	Slot      common.Hash    `json:"slot"`
+	Old       common.Hash    `json:"old"`
+	New       common.Hash    `json:"new"`
+}
+
+// predeployConfigChanges computes the new value of the slot of every storage variable in the storage config,
+// in the order of the predeploy names and variables.
+// Variables that are packed into a slot with other variables only replace their own bytes of the slot.
+func predeployConfigChanges(headState *state.StateDB, storage opstate.StorageConfig) ([]PredeployStorageChange, error) {
+	names := make([]string, 0, len(storage))
+	for name := range storage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var changes []PredeployStorageChange
+	for _, name := range names {
+		addr, ok := predeploys.Predeploys[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown predeploy %s", name)
+		}
+		if len(headState.GetCode(*addr)) == 0 {
+			return nil, fmt.Errorf("predeploy %s at %s has no code", name, addr)
+		}
+		layout, err := bindings.GetStorageLayout(name)
+		if err != nil {
+			return nil, err
+		}
+		labels := make([]string, 0, len(storage[name]))
+		for label := range storage[name] {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			var entry *PredeployStorageChange
+			for _, e := range layout.Storage {
+				if e.Label != label {
+					continue
+				}
+				typ := layout.Types[e.Type]
+				encoded, err := opstate.EncodeStorage(e, storage[name][label], typ)
+				if err != nil {
+					return nil, fmt.Errorf("cannot encode %s of %s: %w", label, name, err)
+				}
+				if len(encoded) != 1 {
+					return nil, fmt.Errorf("%s of %s is not a single slot", label, name)
+				}
+				mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 8*typ.NumberOfBytes), big.NewInt(1))
+				mask.Lsh(mask, 8*e.Offset)
+				old := headState.GetState(*addr, encoded[0].Key)
+				v := new(big.Int).AndNot(old.Big(), mask)
+				v.Or(v, new(big.Int).And(encoded[0].Value.Big(), mask))
+				entry = &PredeployStorageChange{Predeploy: name, Address: *addr, Variable: label,
+					Slot: encoded[0].Key, Old: old, New: common.BigToHash(v)}
+			}
+			if entry == nil {
+				return nil, fmt.Errorf("storage layout entry for %s of %s not found", label, name)
+			}
+			changes = append(changes, *entry)
+		}
+	}
+	return changes, nil
+}
+
+// ApplyPredeployConfig writes the predeploy storage values that follow from the deploy config,
+// see PredeployConfigValues, and writes the changes of all variables as JSON, also of unchanged variables.
+// Storage is written to the predeploy addresses, i.e. the proxies of proxied predeploys.
+// If check is set, the state is not changed, and an error is returned if any variable differs from the deploy config.
+func ApplyPredeployConfig(config *genesis.DeployConfig, check bool, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		changes, err := predeployConfigChanges(headState, PredeployConfigValues(config))
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			return err
+		}
+		var differ int
+		for _, c := range changes {
+			if c.Old == c.New {
+				continue
+			}
+			differ += 1
+			if !check {
+				headState.SetState(c.Address, c.Slot, c.New)
+			}
+		}
+		if check && differ > 0 {
+			return fmt.Errorf("%d predeploy storage variables differ from the deploy config", differ)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/genesis"
+)
+
+func TestApplyPredeployConfig(t *testing.T) {
+	headState := newTestState(t)
+	headState.SetCode(predeploys.ProxyAdminAddr, []byte{0x60, 0x00})
+	headState.SetCode(predeploys.L1BlockAddr, []byte{0x60, 0x00})
+	// the bytes of the slot that are not part of the owner are kept
+	headState.SetState(predeploys.ProxyAdminAddr, common.Hash{}, common.Hash{0: 0xff, 31: 0x01})
+	headState.SetState(predeploys.L1BlockAddr, common.Hash{31: 5}, common.Hash{31: 188})
+
+	config := &genesis.DeployConfig{
+		ProxyAdminOwner:        common.Address{19: 0xaa},
+		BatchSenderAddress:     common.Address{19: 0xbb},
+		GasPriceOracleOverhead: 188,
+		GasPriceOracleScalar:   684000,
+	}
+	var out bytes.Buffer
+	err := ApplyPredeployConfig(config, true, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "3 predeploy storage variables differ")
+	require.Equal(t, common.Hash{0: 0xff, 31: 0x01}, headState.GetState(predeploys.ProxyAdminAddr, common.Hash{}))
+
+	out.Reset()
+	require.NoError(t, ApplyPredeployConfig(config, false, &out)(context.Background(), headState))
+	require.Contains(t, out.String(), `"variable": "l1FeeOverhead"`)
+	require.Equal(t, common.Hash{0: 0xff, 31: 0xaa}, headState.GetState(predeploys.ProxyAdminAddr, common.Hash{}))
+	require.Equal(t, common.Hash{31: 0xbb}, headState.GetState(predeploys.L1BlockAddr, common.Hash{31: 4}))
+	require.NoError(t, ApplyPredeployConfig(config, true, &out)(context.Background(), headState))
+
+	config.EnableGovernance = true
+	require.ErrorContains(t, ApplyPredeployConfig(config, false, &out)(context.Background(), headState), "GovernanceToken")
+}
@@ -0,0 +1,243 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Change is an old and a new value.
+type Change[T any] struct {
+	Old T `json:"old"`
+	New T `json:"new"`
+}
+
+// SlotChange is the change of a storage slot.
+type SlotChange struct {
+	Key common.Hash `json:"key"`
+	Old common.Hash `json:"old"`
+	New common.Hash `json:"new"`
+}
+
+// AccountDiff is the change of an account. Only the fields that changed are set.
+// Storage that is dropped as a whole, e.g. by clearing or deleting the account, only shows as change of the storage root.
+type AccountDiff struct {
+	Address     common.Address          `json:"address"`
+	Created     bool                    `json:"created,omitempty"`
+	Deleted     bool                    `json:"deleted,omitempty"`
+	Balance     *Change[*hexutil.Big]   `json:"balance,omitempty"`
+	Nonce       *Change[hexutil.Uint64] `json:"nonce,omitempty"`
+	CodeHash    *Change[common.Hash]    `json:"codeHash,omitempty"`
+	StorageRoot *Change[common.Hash]    `json:"storageRoot,omitempty"`
+	Storage     []SlotChange            `json:"storage,omitempty"`
+}
+
+// StateDiff is the change that a cheat makes to the head state, with the state root the head block would get.
+type StateDiff struct {
+	Block        uint64         `json:"block"`
+	OldStateRoot common.Hash    `json:"oldStateRoot"`
+	NewStateRoot common.Hash    `json:"newStateRoot"`
+	Accounts     []*AccountDiff `json:"accounts"`
+}
+
+// diffDatabase records the accounts and storage slots that the state writes to its tries,
+// so the changes can be diffed without iterating the full state.
+type diffDatabase struct {
+	state.Database
+	accounts map[common.Address]*types.StateAccount
+	storage  map[common.Address]map[common.Hash][]byte
+}
+
+func (db *diffDatabase) OpenTrie(root common.Hash) (state.Trie, error) {
+	tr, err := db.Database.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	return &diffTrie{Trie: tr, db: db}, nil
+}
+
+func (db *diffDatabase) OpenStorageTrie(stateRoot common.Hash, addrHash, root common.Hash) (state.Trie, error) {
+	tr, err := db.Database.OpenStorageTrie(stateRoot, addrHash, root)
+	if err != nil {
+		return nil, err
+	}
+	return &diffTrie{Trie: tr, db: db}, nil
+}
+
+func (db *diffDatabase) CopyTrie(tr state.Trie) state.Trie {
+	if t, ok := tr.(*diffTrie); ok {
+		return &diffTrie{Trie: db.Database.CopyTrie(t.Trie), db: db}
+	}
+	return db.Database.CopyTrie(tr)
+}
+
+// diffTrie records the writes to a trie in its diffDatabase.
+type diffTrie struct {
+	state.Trie
+	db *diffDatabase
+}
+
+func (t *diffTrie) UpdateAccount(address common.Address, account *types.StateAccount) error {
+	acc := *account
+	acc.Balance = new(big.Int).Set(account.Balance)
+	acc.CodeHash = common.CopyBytes(account.CodeHash)
+	t.db.accounts[address] = &acc
+	return t.Trie.UpdateAccount(address, account)
+}
+
+func (t *diffTrie) DeleteAccount(address common.Address) error {
+	t.db.accounts[address] = nil
+	return t.Trie.DeleteAccount(address)
+}
+
+func (t *diffTrie) UpdateStorage(addr common.Address, key, value []byte) error {
+	t.slots(addr)[common.BytesToHash(key)] = common.CopyBytes(value)
+	return t.Trie.UpdateStorage(addr, key, value)
+}
+
+func (t *diffTrie) DeleteStorage(addr common.Address, key []byte) error {
+	t.slots(addr)[common.BytesToHash(key)] = nil
+	return t.Trie.DeleteStorage(addr, key)
+}
+
+func (t *diffTrie) slots(addr common.Address) map[common.Hash][]byte {
+	slots, ok := t.db.storage[addr]
+	if !ok {
+		slots = make(map[common.Hash][]byte)
+		t.db.storage[addr] = slots
+	}
+	return slots
+}
+
+// DiffHeadFn runs the given function on the state of the given header, like Cheater.RunAndClose,
+// but instead of committing the changes it returns the diff of the changes and the resulting state root.
+// Nothing is written to the database.
+func DiffHeadFn(ctx context.Context, db state.Database, header *types.Header, fn HeadFn) (*StateDiff, error) {
+	ddb := &diffDatabase{
+		Database: db,
+		accounts: make(map[common.Address]*types.StateAccount),
+		storage:  make(map[common.Address]map[common.Hash][]byte),
+	}
+	headState, err := state.New(header.Root, ddb, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up head state: %w", err)
+	}
+	if err := fn(ctx, headState); err != nil {
+		return nil, fmt.Errorf("failed to run state change: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("interrupted: %w", err)
+	}
+	diff := &StateDiff{
+		Block:        header.Number.Uint64(),
+		OldStateRoot: header.Root,
+		NewStateRoot: headState.IntermediateRoot(true),
+		Accounts:     []*AccountDiff{},
+	}
+	oldTrie, err := db.OpenTrie(header.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state trie: %w", err)
+	}
+	addrs := make(map[common.Address]struct{})
+	for addr := range ddb.accounts {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range ddb.storage {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range addrs {
+		oldAcc, err := oldTrie.GetAccount(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read account %s: %w", addr, err)
+		}
+		newAcc, written := ddb.accounts[addr]
+		if !written {
+			newAcc = oldAcc
+		}
+		accDiff := diffAccount(addr, oldAcc, newAcc)
+		// storage writes to a deleted account do not end up in the state
+		if newAcc != nil {
+			if accDiff.Storage, err = diffStorage(db, header.Root, addr, oldAcc, ddb.storage[addr]); err != nil {
+				return nil, err
+			}
+		}
+		if accDiff.Created || accDiff.Deleted || accDiff.Balance != nil || accDiff.Nonce != nil ||
+			accDiff.CodeHash != nil || accDiff.StorageRoot != nil || len(accDiff.Storage) > 0 {
+			diff.Accounts = append(diff.Accounts, accDiff)
+		}
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Address[:], diff.Accounts[j].Address[:]) < 0
+	})
+	return diff, nil
+}
+
+// diffAccount compares the account fields. A nil account does not exist.
+func diffAccount(addr common.Address, oldAcc, newAcc *types.StateAccount) *AccountDiff {
+	empty := &types.StateAccount{Balance: new(big.Int), Root: types.EmptyRootHash, CodeHash: types.EmptyCodeHash.Bytes()}
+	out := &AccountDiff{Address: addr, Created: oldAcc == nil && newAcc != nil, Deleted: oldAcc != nil && newAcc == nil}
+	if oldAcc == nil {
+		oldAcc = empty
+	}
+	if newAcc == nil {
+		newAcc = empty
+	}
+	if oldAcc.Balance.Cmp(newAcc.Balance) != 0 {
+		out.Balance = &Change[*hexutil.Big]{Old: (*hexutil.Big)(oldAcc.Balance), New: (*hexutil.Big)(newAcc.Balance)}
+	}
+	if oldAcc.Nonce != newAcc.Nonce {
+		out.Nonce = &Change[hexutil.Uint64]{Old: hexutil.Uint64(oldAcc.Nonce), New: hexutil.Uint64(newAcc.Nonce)}
+	}
+	if !bytes.Equal(oldAcc.CodeHash, newAcc.CodeHash) {
+		out.CodeHash = &Change[common.Hash]{Old: common.BytesToHash(oldAcc.CodeHash), New: common.BytesToHash(newAcc.CodeHash)}
+	}
+	if oldAcc.Root != newAcc.Root {
+		out.StorageRoot = &Change[common.Hash]{Old: oldAcc.Root, New: newAcc.Root}
+	}
+	return out
+}
+
+// diffStorage compares the written storage slots, given as RLP-encoded values, or nil if deleted, against the old storage.
+func diffStorage(db state.Database, stateRoot common.Hash, addr common.Address, oldAcc *types.StateAccount, written map[common.Hash][]byte) ([]SlotChange, error) {
+	var oldStorage state.Trie
+	if oldAcc != nil && oldAcc.Root != types.EmptyRootHash {
+		var err error
+		if oldStorage, err = db.OpenStorageTrie(stateRoot, crypto.Keccak256Hash(addr[:]), oldAcc.Root); err != nil {
+			return nil, fmt.Errorf("failed to open storage trie of %s: %w", addr, err)
+		}
+	}
+	var out []SlotChange
+	for key, enc := range written {
+		change := SlotChange{Key: key}
+		if oldStorage != nil {
+			v, err := oldStorage.GetStorage(addr, key[:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read storage slot %s of %s: %w", key, addr, err)
+			}
+			change.Old = common.BytesToHash(v)
+		}
+		if len(enc) > 0 {
+			_, v, _, err := rlp.Split(enc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid storage value of slot %s of %s: %w", key, addr, err)
+			}
+			change.New = common.BytesToHash(v)
+		}
+		if change.Old != change.New {
+			out = append(out, change)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].Key[:], out[j].Key[:]) < 0
+	})
+	return out, nil
+}
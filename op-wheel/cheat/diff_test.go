@@ -0,0 +1,72 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffHeadFn(t *testing.T) {
+	ctx := context.Background()
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	eoa, contract, created := common.Address{1}, common.Address{2}, common.Address{3}
+	pre, err := state.New(types.EmptyRootHash, db, nil)
+	require.NoError(t, err)
+	pre.SetBalance(eoa, big.NewInt(1))
+	pre.SetNonce(contract, 1)
+	pre.SetState(contract, common.Hash{1}, common.Hash{0xa})
+	pre.SetState(contract, common.Hash{2}, common.Hash{0xb})
+	root, err := pre.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, db.TrieDB().Commit(root, false))
+	header := &types.Header{Number: big.NewInt(5), Root: root}
+
+	change := func(ctx context.Context, headState *state.StateDB) error {
+		headState.SetBalance(eoa, big.NewInt(2))
+		headState.SetState(contract, common.Hash{1}, common.Hash{0xc})
+		headState.SetState(contract, common.Hash{2}, common.Hash{})
+		headState.SetState(contract, common.Hash{3}, common.Hash{}) // unchanged
+		headState.SetBalance(created, big.NewInt(5))
+		return nil
+	}
+	diff, err := DiffHeadFn(ctx, db, header, change)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), diff.Block)
+	require.Equal(t, root, diff.OldStateRoot)
+
+	expected, err := state.New(root, db, nil)
+	require.NoError(t, err)
+	require.NoError(t, change(ctx, expected))
+	require.Equal(t, expected.IntermediateRoot(true), diff.NewStateRoot)
+
+	require.Len(t, diff.Accounts, 3)
+	require.Equal(t, eoa, diff.Accounts[0].Address)
+	require.Equal(t, &Change[*hexutil.Big]{Old: (*hexutil.Big)(big.NewInt(1)), New: (*hexutil.Big)(big.NewInt(2))}, diff.Accounts[0].Balance)
+	require.Nil(t, diff.Accounts[0].Nonce)
+	require.Equal(t, contract, diff.Accounts[1].Address)
+	require.Nil(t, diff.Accounts[1].Balance)
+	require.NotNil(t, diff.Accounts[1].StorageRoot)
+	require.Equal(t, []SlotChange{
+		{Key: common.Hash{1}, Old: common.Hash{0xa}, New: common.Hash{0xc}},
+		{Key: common.Hash{2}, Old: common.Hash{0xb}, New: common.Hash{}},
+	}, diff.Accounts[1].Storage)
+	require.Equal(t, created, diff.Accounts[2].Address)
+	require.True(t, diff.Accounts[2].Created)
+
+	// nothing is persisted
+	after, err := state.New(root, db, nil)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(1), after.GetBalance(eoa))
+
+	noop, err := DiffHeadFn(ctx, db, header, func(ctx context.Context, headState *state.StateDB) error { return nil })
+	require.NoError(t, err)
+	require.Empty(t, noop.Accounts)
+	require.Equal(t, root, noop.NewStateRoot)
+}
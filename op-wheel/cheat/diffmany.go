@@ -0,0 +1,137 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+// StoragePair is a pair of accounts to diff the storage of, see StorageDiffMany.
+type StoragePair struct {
+	A common.Address `json:"a"`
+	// B is account A if not set, to diff the storage of an account between two states.
+	B *common.Address `json:"b,omitempty"`
+	// ARoot and BRoot are the state roots to read the storage at, the head state if zero.
+	ARoot common.Hash `json:"aRoot"`
+	BRoot common.Hash `json:"bRoot"`
+}
+
+// ReadStoragePairs reads a JSON list of storage pairs from a file.
+func ReadStoragePairs(path string) ([]StoragePair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage pairs: %w", err)
+	}
+	var pairs []StoragePair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("failed to decode storage pairs: %w", err)
+	}
+	return pairs, nil
+}
+
+// StoragePairDiff is the storage diff of a StoragePair.
+type StoragePairDiff struct {
+	StoragePair
+	// Changes is the number of changed slots.
+	Changes int `json:"changes"`
+	// Patch is the diff in the patch format of StorageDiffAt.
+	Patch string `json:"patch"`
+	Error string `json:"error,omitempty"`
+}
+
+// StorageDiffMany diffs the storage of each pair of accounts, like StorageDiffAt, with up to the given number of
+// pairs at a time, and writes the diffs of all pairs as JSON list in the order of the pairs,
+// e.g. to compare all predeploys between the states before and after an upgrade.
+// A pair that cannot be diffed, e.g. because an account has no storage, does not stop the other pairs:
+// its error is part of its diff, and an error is returned after the diffs are written.
+func StorageDiffMany(pairs []StoragePair, version uint, workers int, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if _, err := newPatchWriter(io.Discard, version); err != nil {
+			return err
+		}
+		if workers < 1 {
+			return fmt.Errorf("need at least 1 worker, got %d", workers)
+		}
+		// each pair is diffed with its own view of the head state, since the state is not safe for concurrent use
+		db := headState.Database()
+		root := headState.IntermediateRoot(false)
+		diffs := make([]StoragePairDiff, len(pairs))
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(workers)
+		for i, pair := range pairs {
+			i, pair := i, pair
+			g.Go(func() error {
+				diff := &diffs[i]
+				diff.StoragePair = pair
+				b := pair.A
+				if pair.B != nil {
+					b = *pair.B
+				}
+				view, err := state.New(root, db, nil)
+				if err != nil {
+					return fmt.Errorf("failed to open head state %s: %w", root, err)
+				}
+				var patch bytes.Buffer
+				pw, _ := newPatchWriter(&patch, version)
+				cw := &countingPatchWriter{patchWriter: pw}
+				err = storageDiff(cw, StorageAt{Address: pair.A, Root: pair.ARoot}, StorageAt{Address: b, Root: pair.BRoot})(gctx, view)
+				if gctx.Err() != nil {
+					return gctx.Err()
+				}
+				if err != nil {
+					diff.Error = err.Error()
+				}
+				diff.Patch = patch.String()
+				diff.Changes = cw.changes
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diffs); err != nil {
+			return err
+		}
+		failed := 0
+		for _, diff := range diffs {
+			if diff.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to diff %d of %d pairs", failed, len(pairs))
+		}
+		return nil
+	}
+}
+
+// countingPatchWriter counts the changed slots, including those with unknown key pre-image.
+type countingPatchWriter struct {
+	patchWriter
+	changes int
+}
+
+func (w *countingPatchWriter) remove(key common.Hash, known bool, old common.Hash) error {
+	w.changes++
+	return w.patchWriter.remove(key, known, old)
+}
+
+func (w *countingPatchWriter) add(key common.Hash, known bool, value common.Hash) error {
+	w.changes++
+	return w.patchWriter.add(key, known, value)
+}
+
+func (w *countingPatchWriter) replace(key common.Hash, known bool, old, value common.Hash) error {
+	w.changes++
+	return w.patchWriter.replace(key, known, old, value)
+}
@@ -0,0 +1,61 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageDiffMany(t *testing.T) {
+	a, b, missing := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(a, 1)
+	headState.SetState(a, common.Hash{31: 1}, common.Hash{31: 1})
+	headState.SetState(a, common.Hash{31: 2}, common.Hash{31: 2})
+	oldRoot, err := headState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, db.TrieDB().Commit(oldRoot, false))
+	headState, err = state.New(oldRoot, db, nil)
+	require.NoError(t, err)
+	headState.SetState(a, common.Hash{31: 2}, common.Hash{31: 0x22})
+	headState.SetNonce(b, 1)
+	headState.SetState(b, common.Hash{31: 1}, common.Hash{31: 1})
+	headRoot, err := headState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, db.TrieDB().Commit(headRoot, false))
+	headState, err = state.New(headRoot, db, nil)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"a": "`+a.Hex()+`", "aRoot": "`+oldRoot.Hex()+`"},
+		{"a": "`+a.Hex()+`", "b": "`+b.Hex()+`"},
+		{"a": "`+a.Hex()+`", "b": "`+missing.Hex()+`"}
+	]`), 0o644))
+	pairs, err := ReadStoragePairs(path)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	err = StorageDiffMany(pairs, 2, 2, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "failed to diff 1 of 3 pairs")
+
+	var diffs []StoragePairDiff
+	require.NoError(t, json.Unmarshal(out.Bytes(), &diffs))
+	require.Len(t, diffs, 3)
+	require.Equal(t, pairs[0], diffs[0].StoragePair)
+	require.Equal(t, 1, diffs[0].Changes)
+	require.Equal(t, "version 2\nreplace "+common.Hash{31: 2}.Hex()+" = "+common.Hash{31: 2}.Hex()+" -> "+common.Hash{31: 0x22}.Hex()+"\n", diffs[0].Patch)
+	require.Empty(t, diffs[0].Error)
+	require.Equal(t, 1, diffs[1].Changes)
+	require.Empty(t, diffs[1].Error)
+	require.Contains(t, diffs[2].Error, "no storage trie")
+
+	require.ErrorContains(t, StorageDiffMany(pairs, 3, 2, &out)(context.Background(), headState), "unknown patch version")
+}
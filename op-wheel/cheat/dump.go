@@ -0,0 +1,128 @@
+package cheat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// DumpAlloc writes the complete state as a Geth genesis alloc JSON object, to turn a cheated state back into a genesis.
+// Accounts are written one at a time, in the order of the account trie, so the state does not have to fit in memory.
+// The addresses and storage keys need a known pre-image, since the trie stores hashed keys only:
+// the dump fails at the first account of which the address or a storage key is unknown.
+// The sensitive addresses and storage values are redacted with the given redactor, if not nil.
+func DumpAlloc(w io.Writer, redact *Redactor) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		db := headState.Database()
+		accounts, err := db.OpenTrie(headState.IntermediateRoot(false))
+		if err != nil {
+			return fmt.Errorf("failed to open account trie: %w", err)
+		}
+		bw := bufio.NewWriter(w)
+		if _, err := bw.WriteString("{"); err != nil {
+			return err
+		}
+		count := 0
+		iter := trie.NewIterator(accounts.NodeIterator(nil))
+		for iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var acc types.StateAccount
+			if err := rlp.DecodeBytes(iter.Value, &acc); err != nil {
+				return fmt.Errorf("failed to decode account %x: %w", iter.Key, err)
+			}
+			preimage := accounts.GetKey(iter.Key)
+			if len(preimage) != common.AddressLength {
+				preimage = rawdb.ReadPreimage(db.DiskDB(), common.BytesToHash(iter.Key))
+			}
+			if len(preimage) != common.AddressLength {
+				return fmt.Errorf("address of account hash %x has an unknown pre-image", iter.Key)
+			}
+			addr := common.BytesToAddress(preimage)
+			dumpAddr, keep := redact.Account(addr)
+			if !keep {
+				continue
+			}
+			storage, err := readStorage(ctx, headState, addr)
+			if err != nil {
+				return err
+			}
+			for key, value := range storage {
+				storage[key] = redact.Value(addr, crypto.Keccak256Hash(key[:]), value)
+			}
+			account := core.GenesisAccount{
+				Code:    headState.GetCode(addr),
+				Balance: acc.Balance,
+				Nonce:   acc.Nonce,
+			}
+			if len(storage) > 0 {
+				account.Storage = storage
+			}
+			key, err := json.Marshal(dumpAddr)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(account)
+			if err != nil {
+				return fmt.Errorf("failed to encode account %s: %w", addr, err)
+			}
+			if count > 0 {
+				if _, err := bw.WriteString(","); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(bw, "\n  %s: %s", key, value); err != nil {
+				return err
+			}
+			count += 1
+		}
+		if iter.Err != nil {
+			return fmt.Errorf("failed to iterate account trie: %w", iter.Err)
+		}
+		if _, err := bw.WriteString("\n}\n"); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+}
+
+// ImportAlloc applies all accounts of a Geth genesis alloc to the state, e.g. a dump of another state.
+// The balance, nonce and code of the accounts are overwritten, and the storage slots of the alloc are set.
+// If replace is set, all other storage of the accounts is deleted first, so the accounts match the alloc exactly,
+// otherwise the storage is merged. Accounts that are not in the alloc are not changed.
+func ImportAlloc(alloc core.GenesisAlloc, replace bool) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		for addr, account := range alloc {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if replace && headState.Exist(addr) {
+				clearStorage(headState, addr)
+			}
+			balance := account.Balance
+			if balance == nil {
+				balance = new(big.Int)
+			}
+			headState.SetBalance(addr, balance)
+			headState.SetNonce(addr, account.Nonce)
+			headState.SetCode(addr, account.Code)
+			for key, value := range account.Storage {
+				headState.SetState(addr, key, value)
+			}
+		}
+		return nil
+	}
+}
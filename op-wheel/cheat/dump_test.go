@@ -0,0 +1,100 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpAlloc(t *testing.T) {
+	alloc := core.GenesisAlloc{
+		common.Address{0: 0xa}: {Balance: big.NewInt(42), Nonce: 3},
+		common.Address{0: 0xb}: {
+			Balance: big.NewInt(1),
+			Nonce:   1,
+			Code:    []byte{0x60, 0x00},
+			Storage: map[common.Hash]common.Hash{{31: 1}: {31: 2}, {0: 0xff}: {31: 3}},
+		},
+	}
+	headState := newTestState(t)
+	db := headState.Database()
+	for addr, account := range alloc {
+		headState.SetBalance(addr, account.Balance)
+		headState.SetNonce(addr, account.Nonce)
+		headState.SetCode(addr, account.Code)
+		for k, v := range account.Storage {
+			headState.SetState(addr, k, v)
+		}
+	}
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, DumpAlloc(&out, nil)(context.Background(), headState))
+	var dumped core.GenesisAlloc
+	require.NoError(t, json.Unmarshal(out.Bytes(), &dumped))
+	require.Equal(t, alloc, dumped)
+
+	// without pre-images, the addresses are unknown
+	db = state.NewDatabase(rawdb.NewMemoryDatabase())
+	headState, err = state.New(types.EmptyRootHash, db, nil)
+	require.NoError(t, err)
+	headState.SetNonce(common.Address{0: 0xa}, 1)
+	root, err = headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, DumpAlloc(&out, nil)(context.Background(), headState), "unknown pre-image")
+}
+
+func TestImportAlloc(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(addr, 7)
+	headState.SetCode(addr, []byte{0x60, 0x01})
+	headState.SetState(addr, common.Hash{31: 1}, common.Hash{31: 1})
+	headState.SetState(addr, common.Hash{31: 2}, common.Hash{31: 2})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+
+	alloc := core.GenesisAlloc{
+		addr: {
+			Balance: big.NewInt(42),
+			Nonce:   3,
+			Code:    []byte{0x60, 0x00},
+			Storage: map[common.Hash]common.Hash{{31: 1}: {31: 0xa}},
+		},
+		common.Address{0: 0xb}: {Balance: big.NewInt(1)},
+	}
+	for _, replace := range []bool{false, true} {
+		headState, err = state.New(root, db, nil)
+		require.NoError(t, err)
+		require.NoError(t, ImportAlloc(alloc, replace)(context.Background(), headState))
+		imported, err := headState.Commit(true)
+		require.NoError(t, err)
+		headState, err = state.New(imported, db, nil)
+		require.NoError(t, err)
+		require.Equal(t, big.NewInt(42), headState.GetBalance(addr))
+		require.Equal(t, uint64(3), headState.GetNonce(addr))
+		require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(addr))
+		require.Equal(t, common.Hash{31: 0xa}, headState.GetState(addr, common.Hash{31: 1}))
+		if replace {
+			require.Equal(t, common.Hash{}, headState.GetState(addr, common.Hash{31: 2}))
+		} else {
+			require.Equal(t, common.Hash{31: 2}, headState.GetState(addr, common.Hash{31: 2}))
+		}
+		require.Equal(t, big.NewInt(1), headState.GetBalance(common.Address{0: 0xb}))
+	}
+}
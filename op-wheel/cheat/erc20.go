@@ -0,0 +1,203 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// balanceOfSelector is the ERC20 balanceOf(address) function selector.
+	balanceOfSelector = crypto.Keccak256([]byte("balanceOf(address)"))[:4]
+	// allowanceSelector is the ERC20 allowance(address,address) function selector.
+	allowanceSelector = crypto.Keccak256([]byte("allowance(address,address)"))[:4]
+)
+
+// ERC20MappingLayout locates a mapping of an ERC20 token in its storage, e.g. the balances or the allowances.
+type ERC20MappingLayout struct {
+	// MappingSlot is the slot of the mapping.
+	MappingSlot common.Hash `json:"mappingSlot"`
+	// Vyper is true if the mapping hashes the slot before the key, like Vyper does, instead of after it, like Solidity.
+	Vyper bool `json:"vyper"`
+}
+
+// valueSlot computes the slot of the value of the key in the mapping at the given slot.
+func (l *ERC20MappingLayout) valueSlot(slot common.Hash, key common.Address) common.Hash {
+	k := common.BytesToHash(key[:])
+	if l.Vyper {
+		return crypto.Keccak256Hash(slot[:], k[:])
+	}
+	return crypto.Keccak256Hash(k[:], slot[:])
+}
+
+// BalanceSlot computes the storage slot of the balance of the holder, if this is the balance mapping.
+func (l *ERC20MappingLayout) BalanceSlot(holder common.Address) common.Hash {
+	return l.valueSlot(l.MappingSlot, holder)
+}
+
+// AllowanceSlot computes the storage slot of allowance[owner][spender], if this is the allowance mapping.
+func (l *ERC20MappingLayout) AllowanceSlot(owner, spender common.Address) common.Hash {
+	return l.valueSlot(l.valueSlot(l.MappingSlot, owner), spender)
+}
+
+// ERC20ValueResult describes the change of a balance or allowance of a token.
+type ERC20ValueResult struct {
+	Token   common.Address     `json:"token"`
+	Holder  common.Address     `json:"holder"`
+	Spender *common.Address    `json:"spender,omitempty"`
+	Layout  ERC20MappingLayout `json:"layout"`
+	Slot    common.Hash        `json:"slot"`
+	Before  *big.Int           `json:"before"`
+	After   *big.Int           `json:"after"`
+}
+
+// erc20Call calls a uint256 getter of the token on a copy of the state, so the call has no side effects.
+func erc20Call(headState *state.StateDB, token common.Address, selector []byte, args ...common.Address) (*big.Int, error) {
+	input := append([]byte{}, selector...)
+	for _, arg := range args {
+		input = append(input, common.LeftPadBytes(arg[:], 32)...)
+	}
+	ret, _, err := runtime.Call(token, input, &runtime.Config{State: headState.Copy(), GasLimit: 10_000_000})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call token %s: %w", token, err)
+	}
+	if len(ret) != 32 {
+		return nil, fmt.Errorf("call of token %s returned %d bytes, expected 32", token, len(ret))
+	}
+	return new(big.Int).SetBytes(ret), nil
+}
+
+func erc20BalanceOf(headState *state.StateDB, token, holder common.Address) (*big.Int, error) {
+	return erc20Call(headState, token, balanceOfSelector, holder)
+}
+
+func erc20Allowance(headState *state.StateDB, token, owner, spender common.Address) (*big.Int, error) {
+	return erc20Call(headState, token, allowanceSelector, owner, spender)
+}
+
+// probeERC20Mapping finds a mapping of the token, by writing a marker value into the candidate slots
+// of the mappings at slots 0 to maxSlot, in a copy of the state, until the getter returns the marker.
+func probeERC20Mapping(headState *state.StateDB, token common.Address, maxSlot uint64,
+	slotOf func(l *ERC20MappingLayout) common.Hash, get func(st *state.StateDB) (*big.Int, error)) (*ERC20MappingLayout, error) {
+	marker := crypto.Keccak256Hash([]byte("op-wheel erc20 mapping probe"))
+	for i := uint64(0); i <= maxSlot; i++ {
+		for _, vyper := range []bool{false, true} {
+			layout := &ERC20MappingLayout{MappingSlot: common.BigToHash(new(big.Int).SetUint64(i)), Vyper: vyper}
+			probe := headState.Copy()
+			probe.SetState(token, slotOf(layout), marker)
+			value, err := get(probe)
+			if err != nil {
+				return nil, err
+			}
+			if common.BigToHash(value) == marker {
+				return layout, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("mapping of token %s not found in slots 0 to %d", token, maxSlot)
+}
+
+// ProbeERC20BalanceLayout finds the balance mapping of the token, by writing a marker balance of the holder
+// into the candidate slots of the mappings at slots 0 to maxSlot, in a copy of the state,
+// until balanceOf returns the marker. Tokens that compute the balance, e.g. rebasing tokens, cannot be probed.
+func ProbeERC20BalanceLayout(headState *state.StateDB, token, holder common.Address, maxSlot uint64) (*ERC20MappingLayout, error) {
+	return probeERC20Mapping(headState, token, maxSlot, func(l *ERC20MappingLayout) common.Hash {
+		return l.BalanceSlot(holder)
+	}, func(st *state.StateDB) (*big.Int, error) {
+		return erc20BalanceOf(st, token, holder)
+	})
+}
+
+// ProbeERC20AllowanceLayout finds the allowance mapping of the token, like ProbeERC20BalanceLayout, with allowance.
+func ProbeERC20AllowanceLayout(headState *state.StateDB, token, owner, spender common.Address, maxSlot uint64) (*ERC20MappingLayout, error) {
+	return probeERC20Mapping(headState, token, maxSlot, func(l *ERC20MappingLayout) common.Hash {
+		return l.AllowanceSlot(owner, spender)
+	}, func(st *state.StateDB) (*big.Int, error) {
+		return erc20Allowance(st, token, owner, spender)
+	})
+}
+
+// setERC20Value writes the value into the slot, verifies it with the getter, and writes the result as JSON.
+func setERC20Value(headState *state.StateDB, result *ERC20ValueResult, value *big.Int, get func(st *state.StateDB) (*big.Int, error), w io.Writer) error {
+	headState.SetState(result.Token, result.Slot, common.BigToHash(value))
+	after, err := get(headState)
+	if err != nil {
+		return err
+	}
+	if after.Cmp(value) != 0 {
+		return fmt.Errorf("token returns %s after writing %s to slot %s, the mapping is not at slot %s",
+			after, value, result.Slot, result.Layout.MappingSlot)
+	}
+	result.After = after
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+func checkERC20Value(headState *state.StateDB, token common.Address, value *big.Int) error {
+	if len(headState.GetCode(token)) == 0 {
+		return fmt.Errorf("token %s has no code", token)
+	}
+	if value.Sign() < 0 || value.BitLen() > 256 {
+		return fmt.Errorf("value %s does not fit a uint256", value)
+	}
+	return nil
+}
+
+// SetERC20Balance writes the balance of the holder into the balance mapping of the token, and writes the result as JSON.
+// If layout is nil, the balance mapping is probed, see ProbeERC20BalanceLayout.
+// The new balance is verified with balanceOf. The total supply is not changed.
+func SetERC20Balance(token, holder common.Address, amount *big.Int, layout *ERC20MappingLayout, maxProbe uint64, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if err := checkERC20Value(headState, token, amount); err != nil {
+			return err
+		}
+		get := func(st *state.StateDB) (*big.Int, error) {
+			return erc20BalanceOf(st, token, holder)
+		}
+		before, err := get(headState)
+		if err != nil {
+			return err
+		}
+		if layout == nil {
+			if layout, err = ProbeERC20BalanceLayout(headState, token, holder, maxProbe); err != nil {
+				return err
+			}
+		}
+		result := &ERC20ValueResult{Token: token, Holder: holder, Layout: *layout, Slot: layout.BalanceSlot(holder), Before: before}
+		return setERC20Value(headState, result, amount, get, w)
+	}
+}
+
+// SetERC20Allowance writes allowance[owner][spender] into the allowance mapping of the token, and writes the result as JSON.
+// If layout is nil, the allowance mapping is probed, see ProbeERC20AllowanceLayout.
+// The new allowance is verified with allowance.
+func SetERC20Allowance(token, owner, spender common.Address, amount *big.Int, layout *ERC20MappingLayout, maxProbe uint64, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if err := checkERC20Value(headState, token, amount); err != nil {
+			return err
+		}
+		get := func(st *state.StateDB) (*big.Int, error) {
+			return erc20Allowance(st, token, owner, spender)
+		}
+		before, err := get(headState)
+		if err != nil {
+			return err
+		}
+		if layout == nil {
+			if layout, err = ProbeERC20AllowanceLayout(headState, token, owner, spender, maxProbe); err != nil {
+				return err
+			}
+		}
+		result := &ERC20ValueResult{Token: token, Holder: owner, Spender: &spender, Layout: *layout,
+			Slot: layout.AllowanceSlot(owner, spender), Before: before}
+		return setERC20Value(headState, result, amount, get, w)
+	}
+}
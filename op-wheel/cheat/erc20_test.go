@@ -0,0 +1,65 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/bindings"
+)
+
+func TestSetERC20Balance(t *testing.T) {
+	token, holder := common.Address{0: 0xa}, common.Address{0: 0xb}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetCode(token, common.FromHex(bindings.ERC20DeployedBin))
+
+	layout, err := ProbeERC20BalanceLayout(headState, token, holder, 10)
+	require.NoError(t, err)
+	require.Equal(t, &ERC20MappingLayout{MappingSlot: common.Hash{}}, layout)
+	require.Equal(t, common.Hash{}, headState.GetState(token, layout.BalanceSlot(holder)), "probe must not change the state")
+
+	var out bytes.Buffer
+	require.NoError(t, SetERC20Balance(token, holder, big.NewInt(1000), nil, 10, &out)(context.Background(), headState))
+	var result ERC20ValueResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	require.Equal(t, big.NewInt(0), result.Before)
+	require.Equal(t, big.NewInt(1000), result.After)
+	require.Equal(t, common.BigToHash(big.NewInt(1000)), headState.GetState(token, result.Slot))
+
+	wrong := &ERC20MappingLayout{MappingSlot: common.Hash{31: 1}}
+	err = SetERC20Balance(token, holder, big.NewInt(5), wrong, 10, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "the mapping is not at slot")
+}
+
+func TestSetERC20Allowance(t *testing.T) {
+	token, owner, spender := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetCode(token, common.FromHex(bindings.ERC20DeployedBin))
+
+	layout, err := ProbeERC20AllowanceLayout(headState, token, owner, spender, 10)
+	require.NoError(t, err)
+	require.Equal(t, &ERC20MappingLayout{MappingSlot: common.Hash{31: 1}}, layout)
+
+	var out bytes.Buffer
+	require.NoError(t, SetERC20Allowance(token, owner, spender, big.NewInt(7), nil, 10, &out)(context.Background(), headState))
+	var result ERC20ValueResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	require.Equal(t, spender, *result.Spender)
+	require.Equal(t, big.NewInt(7), result.After)
+	allowance, err := erc20Allowance(headState, token, owner, spender)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(7), allowance)
+	reverse, err := erc20Allowance(headState, token, spender, owner)
+	require.NoError(t, err)
+	require.Zero(t, reverse.Sign())
+}
@@ -0,0 +1,271 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// Fork prefetches accounts and storage slots from a remote node into the local state,
+// like the fork mode of dev chains, to run cheats against live state without a full archive copy.
+// Fork does not hook into the state reads of cheats: only the accounts and slots that are prefetched explicitly,
+// e.g. with ForkFetch, are in the local state, and cheats that read any other state see the local state only.
+// Accounts that exist locally, and non-zero local storage slots, are never fetched, so repeated runs only fetch what is missing.
+type Fork struct {
+	Remote client.RPC
+	// Block is the remote block number to fetch the state at. All fetches use the same block, for a consistent state.
+	Block uint64
+}
+
+// ForkReport lists what a fork fetched from the remote node.
+type ForkReport struct {
+	Block    uint64           `json:"block"`
+	Accounts []common.Address `json:"accounts"`
+	Slots    int              `json:"slots"`
+	// Cached is the number of requested accounts and non-zero slots that were already in the local state.
+	Cached int `json:"cached"`
+	// Missing are the requested accounts that exist neither in the local state, nor in the remote state.
+	Missing []common.Address `json:"missing,omitempty"`
+	// Incomplete are the accounts that were not fetched, since the remote node does not know the pre-images of their storage keys.
+	Incomplete []common.Address `json:"incomplete,omitempty"`
+}
+
+func (f *Fork) blockTag() string {
+	return hexutil.Uint64(f.Block).String()
+}
+
+// PrefetchAccount fetches the balance, nonce and code of the account, if it does not exist in the local state.
+// It returns whether the account was fetched: not if it exists locally, or does not exist remotely either.
+func (f *Fork) PrefetchAccount(ctx context.Context, headState *state.StateDB, addr common.Address) (bool, error) {
+	if headState.Exist(addr) {
+		return false, nil
+	}
+	var res eth.AccountResult
+	if err := f.Remote.CallContext(ctx, &res, "eth_getProof", addr, []common.Hash{}, f.blockTag()); err != nil {
+		return false, fmt.Errorf("failed to fetch account %s at block %d: %w", addr, f.Block, err)
+	}
+	balance := (*big.Int)(res.Balance)
+	if balance.Sign() == 0 && res.Nonce == 0 && res.CodeHash == types.EmptyCodeHash && res.StorageHash == types.EmptyRootHash {
+		return false, nil // the account does not exist remotely either
+	}
+	headState.SetBalance(addr, balance)
+	headState.SetNonce(addr, uint64(res.Nonce))
+	if res.CodeHash != types.EmptyCodeHash {
+		var code hexutil.Bytes
+		if err := f.Remote.CallContext(ctx, &code, "eth_getCode", addr, f.blockTag()); err != nil {
+			return false, fmt.Errorf("failed to fetch code of %s at block %d: %w", addr, f.Block, err)
+		}
+		headState.SetCode(addr, code)
+	}
+	return true, nil
+}
+
+// PrefetchSlots fetches the storage slots of the account that are zero in the local state, in batches.
+// It returns the number of fetched non-zero slots, and the number of slots that were non-zero locally already.
+func (f *Fork) PrefetchSlots(ctx context.Context, headState *state.StateDB, addr common.Address, keys []common.Hash) (fetched int, cached int, err error) {
+	var missing []common.Hash
+	for _, key := range keys {
+		if headState.GetState(addr, key) == (common.Hash{}) {
+			missing = append(missing, key)
+		}
+	}
+	cached = len(keys) - len(missing)
+	for start := 0; start < len(missing); start += remoteStorageBatchSize {
+		end := start + remoteStorageBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		chunk := missing[start:end]
+		results := make([]common.Hash, len(chunk))
+		batch := make([]rpc.BatchElem, len(chunk))
+		for i, key := range chunk {
+			batch[i] = rpc.BatchElem{Method: "eth_getStorageAt", Args: []any{addr, key, f.blockTag()}, Result: &results[i]}
+		}
+		if err := f.Remote.BatchCallContext(ctx, batch); err != nil {
+			return fetched, cached, fmt.Errorf("failed to fetch storage of %s: %w", addr, err)
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return fetched, cached, fmt.Errorf("failed to fetch storage slot %s of %s: %w", chunk[i], addr, elem.Error)
+			}
+			if results[i] != (common.Hash{}) {
+				headState.SetState(addr, chunk[i], results[i])
+				fetched += 1
+			}
+		}
+	}
+	return fetched, cached, nil
+}
+
+// ForkFetch prefetches the given accounts, and the given storage slots per account, into the local state,
+// if they are missing locally, and writes a JSON report of what was fetched.
+func ForkFetch(f *Fork, addrs []common.Address, slots map[common.Address][]common.Hash, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		report := &ForkReport{Block: f.Block, Accounts: []common.Address{}}
+		ensure := func(addr common.Address) error {
+			if headState.Exist(addr) {
+				report.Cached += 1
+				return nil
+			}
+			fetched, err := f.PrefetchAccount(ctx, headState, addr)
+			if err != nil {
+				return err
+			}
+			if fetched {
+				report.Accounts = append(report.Accounts, addr)
+			} else {
+				report.Missing = append(report.Missing, addr)
+			}
+			return nil
+		}
+		for _, addr := range addrs {
+			if err := ensure(addr); err != nil {
+				return err
+			}
+		}
+		for addr, keys := range slots {
+			if !containsAddr(addrs, addr) {
+				if err := ensure(addr); err != nil {
+					return err
+				}
+			}
+			fetched, cached, err := f.PrefetchSlots(ctx, headState, addr, keys)
+			if err != nil {
+				return err
+			}
+			report.Slots += fetched
+			report.Cached += cached
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+}
+
+func containsAddr(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// forkDumpPageSize is the number of accounts per debug_accountRange call, the maximum that geth serves.
+const forkDumpPageSize = 256
+
+// ForkDump fetches the whole remote state at the fork block, and writes the accounts that do not exist locally
+// into the local state, with their code and storage, to create a local fork of the remote chain without a sync.
+// The accounts are fetched with debug_accountRange, the paginated form of debug_dumpBlock,
+// which is limited to 256 accounts per call. Accounts of which the remote node does not know the address pre-image are skipped.
+// The dump has all storage slots with an unknown key pre-image under the zero key, e.g. slots of genesis predeploys
+// that were written after genesis: accounts with such slots are skipped, and listed as incomplete in the report.
+// The storage root of each fetched account is checked against the remote storage root, which fails if any slot is missing.
+// The storage of each account is fetched in full,
+// so this is meant for small states like devnets: fetch the accounts of interest with ForkFetch instead for large states.
+// A JSON report of what was fetched is written to w.
+func ForkDump(f *Fork, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		report := &ForkReport{Block: f.Block, Accounts: []common.Address{}}
+		var start hexutil.Bytes
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var page state.IteratorDump
+			if err := f.Remote.CallContext(ctx, &page, "debug_accountRange", f.blockTag(), start, forkDumpPageSize, false, false, false); err != nil {
+				return fmt.Errorf("failed to fetch accounts at block %d from %s: %w", f.Block, start, err)
+			}
+			addrs := make([]common.Address, 0, len(page.Accounts))
+			for addr := range page.Accounts {
+				addrs = append(addrs, addr)
+			}
+			sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+			for _, addr := range addrs {
+				if headState.Exist(addr) {
+					report.Cached += 1
+					continue
+				}
+				acc := page.Accounts[addr]
+				if complete, err := f.dumpedSlotZero(ctx, addr, acc.Storage); err != nil {
+					return err
+				} else if !complete {
+					log.Warn("skipping account with storage keys of unknown pre-image", "addr", addr)
+					report.Incomplete = append(report.Incomplete, addr)
+					continue
+				}
+				balance, ok := new(big.Int).SetString(acc.Balance, 10)
+				if !ok {
+					return fmt.Errorf("invalid balance %q of account %s", acc.Balance, addr)
+				}
+				headState.SetBalance(addr, balance)
+				headState.SetNonce(addr, acc.Nonce)
+				if len(acc.Code) > 0 {
+					headState.SetCode(addr, acc.Code)
+				}
+				for key, value := range acc.Storage {
+					headState.SetState(addr, key, common.HexToHash(value))
+				}
+				if len(acc.Storage) > 0 {
+					if err := f.checkStorageRoot(ctx, headState, addr); err != nil {
+						return err
+					}
+				}
+				report.Accounts = append(report.Accounts, addr)
+				report.Slots += len(acc.Storage)
+			}
+			if len(page.Next) == 0 {
+				break
+			}
+			start = page.Next
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+}
+
+// dumpedSlotZero returns false if the dumped storage has a value under the zero key that is not the value of slot 0,
+// but of slots with an unknown key pre-image.
+func (f *Fork) dumpedSlotZero(ctx context.Context, addr common.Address, storage map[common.Hash]string) (bool, error) {
+	value, ok := storage[common.Hash{}]
+	if !ok {
+		return true, nil
+	}
+	var slot common.Hash
+	if err := f.Remote.CallContext(ctx, &slot, "eth_getStorageAt", addr, common.Hash{}, f.blockTag()); err != nil {
+		return false, fmt.Errorf("failed to fetch storage slot 0 of %s: %w", addr, err)
+	}
+	return slot == common.HexToHash(value), nil
+}
+
+// checkStorageRoot checks the storage root of the account in the local state against its remote storage root.
+func (f *Fork) checkStorageRoot(ctx context.Context, headState *state.StateDB, addr common.Address) error {
+	var res eth.AccountResult
+	if err := f.Remote.CallContext(ctx, &res, "eth_getProof", addr, []common.Hash{}, f.blockTag()); err != nil {
+		return fmt.Errorf("failed to fetch account %s at block %d: %w", addr, f.Block, err)
+	}
+	storage, err := headState.StorageTrie(addr)
+	if err != nil {
+		return fmt.Errorf("failed to open storage trie of addr %s: %w", addr, err)
+	}
+	if root := storage.Hash(); root != res.StorageHash {
+		return fmt.Errorf("fetched storage of %s has root %s, but the remote storage root is %s: "+
+			"the remote node does not know the pre-images of some storage keys", addr, root, res.StorageHash)
+	}
+	return nil
+}
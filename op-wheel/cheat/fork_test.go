@@ -0,0 +1,232 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// dumpRemote serves debug_accountRange of a state, like geth, in pages of at most max accounts,
+// and eth_getProof, eth_getCode and eth_getStorageAt, also batched, to check the dumped storage and to prefetch state.
+type dumpRemote struct {
+	state *state.StateDB
+	max   uint64
+	calls int
+	// lostPreimages are the accounts of which the remote does not know the storage key pre-images:
+	// geth dumps all their slots under the zero key.
+	lostPreimages map[common.Address]bool
+}
+
+func (r *dumpRemote) Close() {}
+
+func (r *dumpRemote) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	var res any
+	switch method {
+	case "debug_accountRange":
+		r.calls++
+		dump := r.state.IteratorDump(&state.DumpConfig{Start: args[1].(hexutil.Bytes), Max: r.max, OnlyWithAddresses: true})
+		for addr, acc := range dump.Accounts {
+			if r.lostPreimages[addr] {
+				lost := make(map[common.Hash]string)
+				for _, value := range acc.Storage {
+					lost[common.Hash{}] = value
+				}
+				acc.Storage = lost
+				dump.Accounts[addr] = acc
+			}
+		}
+		res = dump
+	case "eth_getProof":
+		addr := args[0].(common.Address)
+		storageHash := types.EmptyRootHash
+		if tr, err := r.state.StorageTrie(addr); err != nil {
+			return err
+		} else if tr != nil {
+			storageHash = tr.Hash()
+		}
+		codeHash := r.state.GetCodeHash(addr)
+		if codeHash == (common.Hash{}) {
+			codeHash = types.EmptyCodeHash
+		}
+		res = &eth.AccountResult{Address: addr, Balance: (*hexutil.Big)(r.state.GetBalance(addr)),
+			Nonce: hexutil.Uint64(r.state.GetNonce(addr)), CodeHash: codeHash, StorageHash: storageHash}
+	case "eth_getCode":
+		res = hexutil.Bytes(r.state.GetCode(args[0].(common.Address)))
+	case "eth_getStorageAt":
+		res = r.state.GetState(args[0].(common.Address), args[1].(common.Hash))
+	default:
+		return errors.New("not supported")
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (r *dumpRemote) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for i := range b {
+		b[i].Error = r.CallContext(ctx, b[i].Result, b[i].Method, b[i].Args...)
+	}
+	return nil
+}
+
+func (r *dumpRemote) EthSubscribe(ctx context.Context, channel any, args ...any) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestForkDump(t *testing.T) {
+	remoteState := newTestState(t)
+	remoteDB := remoteState.Database()
+	for i := byte(1); i <= 5; i++ {
+		addr := common.Address{0: i}
+		remoteState.SetBalance(addr, big.NewInt(int64(i)))
+		remoteState.SetNonce(addr, uint64(i))
+	}
+	contract := common.Address{0: 3}
+	remoteState.SetCode(contract, []byte{0x60, 0x00})
+	remoteState.SetState(contract, common.Hash{31: 1}, common.Hash{31: 0x11})
+	remoteState.SetState(contract, common.Hash{31: 2}, common.Hash{0: 0x22})
+	root, err := remoteState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, remoteDB.TrieDB().Commit(root, false))
+	remoteState, err = state.New(root, remoteDB, nil)
+	require.NoError(t, err)
+	remote := &dumpRemote{state: remoteState, max: 2}
+
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	local := common.Address{0: 1}
+	headState.SetBalance(local, big.NewInt(100))
+
+	var out bytes.Buffer
+	require.NoError(t, ForkDump(&Fork{Remote: remote, Block: 7}, &out)(context.Background(), headState))
+	require.Equal(t, 3, remote.calls)
+	var report ForkReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Equal(t, uint64(7), report.Block)
+	require.Len(t, report.Accounts, 4)
+	require.Equal(t, 1, report.Cached)
+	require.Equal(t, 2, report.Slots)
+
+	require.Equal(t, big.NewInt(100), headState.GetBalance(local), "local accounts are kept")
+	for i := byte(2); i <= 5; i++ {
+		addr := common.Address{0: i}
+		require.Equal(t, big.NewInt(int64(i)), headState.GetBalance(addr))
+		require.Equal(t, uint64(i), headState.GetNonce(addr))
+	}
+	require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(contract))
+	require.Equal(t, common.Hash{31: 0x11}, headState.GetState(contract, common.Hash{31: 1}))
+	require.Equal(t, common.Hash{0: 0x22}, headState.GetState(contract, common.Hash{31: 2}))
+}
+
+func TestForkDumpUnknownPreimages(t *testing.T) {
+	newRemote := func(t *testing.T, contract common.Address, slots map[common.Hash]common.Hash) *dumpRemote {
+		remoteState := newTestState(t)
+		remoteDB := remoteState.Database()
+		remoteState.SetNonce(contract, 1)
+		for key, value := range slots {
+			remoteState.SetState(contract, key, value)
+		}
+		root, err := remoteState.Commit(true)
+		require.NoError(t, err)
+		require.NoError(t, remoteDB.TrieDB().Commit(root, false))
+		remoteState, err = state.New(root, remoteDB, nil)
+		require.NoError(t, err)
+		return &dumpRemote{state: remoteState, max: 2, lostPreimages: map[common.Address]bool{contract: true}}
+	}
+	newHead := func(t *testing.T) *state.StateDB {
+		headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		require.NoError(t, err)
+		return headState
+	}
+	contract := common.Address{0: 3}
+
+	t.Run("skip", func(t *testing.T) {
+		remote := newRemote(t, contract, map[common.Hash]common.Hash{{31: 1}: {31: 0x11}, {31: 2}: {31: 0x22}})
+		headState := newHead(t)
+		var out bytes.Buffer
+		require.NoError(t, ForkDump(&Fork{Remote: remote, Block: 7}, &out)(context.Background(), headState))
+		var report ForkReport
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		require.Empty(t, report.Accounts)
+		require.Equal(t, []common.Address{contract}, report.Incomplete)
+		require.False(t, headState.Exist(contract), "slot 0 must not be corrupted")
+	})
+	t.Run("root mismatch", func(t *testing.T) {
+		// the lost slot has the same value as slot 0, so only the storage root tells the slot is missing
+		remote := newRemote(t, contract, map[common.Hash]common.Hash{{}: {31: 0x11}, {31: 9}: {31: 0x11}})
+		err := ForkDump(&Fork{Remote: remote, Block: 7}, io.Discard)(context.Background(), newHead(t))
+		require.ErrorContains(t, err, "remote storage root")
+	})
+}
+
+func TestForkFetch(t *testing.T) {
+	remoteState := newTestState(t)
+	remoteDB := remoteState.Database()
+	eoa, contract, local := common.Address{0: 1}, common.Address{0: 2}, common.Address{0: 3}
+	remoteState.SetBalance(eoa, big.NewInt(10))
+	remoteState.SetNonce(eoa, 4)
+	remoteState.SetNonce(contract, 1)
+	remoteState.SetCode(contract, []byte{0x60, 0x00})
+	remoteState.SetState(contract, common.Hash{31: 1}, common.Hash{31: 0x11})
+	remoteState.SetState(contract, common.Hash{31: 2}, common.Hash{31: 0x22})
+	remoteState.SetBalance(local, big.NewInt(1))
+	root, err := remoteState.Commit(true)
+	require.NoError(t, err)
+	remoteState, err = state.New(root, remoteDB, nil)
+	require.NoError(t, err)
+	remote := &dumpRemote{state: remoteState}
+
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetBalance(local, big.NewInt(100))
+	headState.SetNonce(contract, 1)
+	headState.SetState(contract, common.Hash{31: 2}, common.Hash{31: 0xff})
+
+	missing := common.Address{0: 4}
+	slots := map[common.Address][]common.Hash{contract: {{31: 1}, {31: 2}, {31: 3}}}
+	var out bytes.Buffer
+	fetch := ForkFetch(&Fork{Remote: remote, Block: 7}, []common.Address{eoa, local, missing}, slots, &out)
+	require.NoError(t, fetch(context.Background(), headState))
+	var report ForkReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Equal(t, []common.Address{eoa}, report.Accounts)
+	require.Equal(t, []common.Address{missing}, report.Missing, "accounts that do not exist remotely are not cached")
+	// the local account, the local contract, and the local non-zero slot
+	require.Equal(t, 3, report.Cached)
+	require.Equal(t, 1, report.Slots)
+
+	require.Equal(t, big.NewInt(10), headState.GetBalance(eoa))
+	require.Equal(t, uint64(4), headState.GetNonce(eoa))
+	require.Equal(t, big.NewInt(100), headState.GetBalance(local), "local accounts are kept")
+	require.False(t, headState.Exist(missing))
+	require.Nil(t, headState.GetCode(contract), "only the requested slots of existing accounts are fetched")
+	require.Equal(t, common.Hash{31: 0x11}, headState.GetState(contract, common.Hash{31: 1}))
+	require.Equal(t, common.Hash{31: 0xff}, headState.GetState(contract, common.Hash{31: 2}), "local slots are kept")
+
+	fetched, err := (&Fork{Remote: remote, Block: 7}).PrefetchAccount(context.Background(), headState, contract)
+	require.NoError(t, err)
+	require.False(t, fetched, "existing accounts are not fetched")
+	fresh, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	fetched, err = (&Fork{Remote: remote, Block: 7}).PrefetchAccount(context.Background(), fresh, contract)
+	require.NoError(t, err)
+	require.True(t, fetched)
+	require.Equal(t, []byte{0x60, 0x00}, fresh.GetCode(contract))
+}
@@ -0,0 +1,57 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// totalSupplySelector is the ERC20 totalSupply() function selector.
+var totalSupplySelector = crypto.Keccak256([]byte("totalSupply()"))[:4]
+
+// SetNativeViaToken sets the balance of the holder on a chain where the native asset is held as an ERC20 token
+// that wraps it, e.g. the wrapped gas token predeploy of a custom gas token chain, and writes the result as JSON.
+// The token balance of the holder is set, see SetERC20Balance, and the native balance of the token moves by the same amount,
+// so the token stays fully backed. If the total supply of the token matched its native balance before, it must match after,
+// which fails for tokens that keep the total supply in storage.
+// If spender is not nil, the allowance of the spender for the holder is set to the amount too, see SetERC20Allowance,
+// e.g. for the bridge that pulls the tokens on deposits.
+func SetNativeViaToken(token, holder common.Address, amount *big.Int, spender *common.Address, maxProbe uint64, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if err := checkERC20Value(headState, token, amount); err != nil {
+			return err
+		}
+		before, err := erc20BalanceOf(headState, token, holder)
+		if err != nil {
+			return err
+		}
+		backed := tokenBacked(headState, token)
+		backing := new(big.Int).Add(headState.GetBalance(token), new(big.Int).Sub(amount, before))
+		if backing.Sign() < 0 {
+			return fmt.Errorf("token %s holds %s native balance, less than the %s it would lose", token, headState.GetBalance(token), new(big.Int).Sub(before, amount))
+		}
+		headState.SetBalance(token, backing)
+		if err := SetERC20Balance(token, holder, amount, nil, maxProbe, w)(ctx, headState); err != nil {
+			return err
+		}
+		if backed && !tokenBacked(headState, token) {
+			return fmt.Errorf("total supply of token %s no longer matches its native balance %s", token, backing)
+		}
+		if spender != nil {
+			return SetERC20Allowance(token, holder, *spender, amount, nil, maxProbe, w)(ctx, headState)
+		}
+		return nil
+	}
+}
+
+// tokenBacked returns true if the total supply of the token equals its native balance, like WETH9 computes it.
+// Tokens without a total supply are not backed.
+func tokenBacked(headState *state.StateDB, token common.Address) bool {
+	supply, err := erc20Call(headState, token, totalSupplySelector)
+	return err == nil && supply.Cmp(headState.GetBalance(token)) == 0
+}
@@ -0,0 +1,46 @@
+package cheat
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/bindings"
+)
+
+func TestSetNativeViaToken(t *testing.T) {
+	ctx := context.Background()
+	token, holder, bridge := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetCode(token, common.FromHex(bindings.WETH9DeployedBin))
+	require.True(t, tokenBacked(headState, token))
+
+	require.NoError(t, SetNativeViaToken(token, holder, big.NewInt(100), &bridge, 10, io.Discard)(ctx, headState))
+	balance, err := erc20BalanceOf(headState, token, holder)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(100), balance)
+	require.Equal(t, big.NewInt(100), headState.GetBalance(token))
+	require.True(t, tokenBacked(headState, token))
+	allowance, err := erc20Allowance(headState, token, holder, bridge)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(100), allowance)
+	require.Zero(t, headState.GetBalance(holder).Sign(), "the native balance of the holder is not changed")
+
+	require.NoError(t, SetNativeViaToken(token, holder, big.NewInt(40), nil, 10, io.Discard)(ctx, headState))
+	require.Equal(t, big.NewInt(40), headState.GetBalance(token))
+	require.True(t, tokenBacked(headState, token))
+
+	// a token that keeps its total supply in storage cannot stay backed
+	erc20 := common.Address{0: 0xd}
+	headState.SetCode(erc20, common.FromHex(bindings.ERC20DeployedBin))
+	require.True(t, tokenBacked(headState, erc20))
+	require.ErrorContains(t, SetNativeViaToken(erc20, holder, big.NewInt(5), nil, 10, io.Discard)(ctx, headState), "no longer matches")
+}
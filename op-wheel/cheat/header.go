@@ -0,0 +1,95 @@
+package cheat
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// HeaderOverride configures the fields of the head block header to change, see SetHeadHeader.
+// Nil fields are left as-is.
+type HeaderOverride struct {
+	Time      *uint64
+	GasLimit  *uint64
+	ExtraData *[]byte
+	BaseFee   *big.Int
+}
+
+// SetHeaderReport describes the changed head block.
+type SetHeaderReport struct {
+	Number    uint64        `json:"number"`
+	OldHash   common.Hash   `json:"oldHash"`
+	NewHash   common.Hash   `json:"newHash"`
+	Time      uint64        `json:"timestamp"`
+	GasLimit  uint64        `json:"gasLimit"`
+	ExtraData hexutil.Bytes `json:"extraData"`
+	BaseFee   *hexutil.Big  `json:"baseFeePerGas,omitempty"`
+}
+
+// SetHeadHeader changes fields of the head block header in the database, e.g. to reproduce edge-case timestamps.
+// The block is stored under its new hash, with the body and receipts of the old block,
+// and made canonical and head in place of the old block. The fields are not validated against the parent block.
+func SetHeadHeader(db ethdb.Database, override *HeaderOverride) (*SetHeaderReport, error) {
+	hash := rawdb.ReadHeadBlockHash(db)
+	n := rawdb.ReadHeaderNumber(db, hash)
+	if n == nil {
+		return nil, fmt.Errorf("head block %s is unknown", hash)
+	}
+	if *n == 0 {
+		return nil, fmt.Errorf("changing the genesis header is not supported")
+	}
+	if frozen, err := db.Ancients(); err == nil && *n < frozen {
+		return nil, fmt.Errorf("head block %d is in the ancient store (%d blocks), and cannot be changed", *n, frozen)
+	}
+	header := rawdb.ReadHeader(db, hash, *n)
+	if header == nil {
+		return nil, fmt.Errorf("head header %d (%s) is missing", *n, hash)
+	}
+	body := rawdb.ReadBody(db, hash, *n)
+	if body == nil {
+		return nil, fmt.Errorf("body of block %d (%s) is missing", *n, hash)
+	}
+
+	newHeader := types.CopyHeader(header)
+	if override.Time != nil {
+		newHeader.Time = *override.Time
+	}
+	if override.GasLimit != nil {
+		newHeader.GasLimit = *override.GasLimit
+	}
+	if override.ExtraData != nil {
+		newHeader.Extra = common.CopyBytes(*override.ExtraData)
+	}
+	if override.BaseFee != nil {
+		newHeader.BaseFee = new(big.Int).Set(override.BaseFee)
+	}
+	newHash := newHeader.Hash()
+	report := &SetHeaderReport{
+		Number:    *n,
+		OldHash:   hash,
+		NewHash:   newHash,
+		Time:      newHeader.Time,
+		GasLimit:  newHeader.GasLimit,
+		ExtraData: newHeader.Extra,
+		BaseFee:   (*hexutil.Big)(newHeader.BaseFee),
+	}
+	if newHash == hash {
+		return report, nil
+	}
+
+	batch := db.NewBatch()
+	rawdb.WriteBody(batch, newHash, *n, body)
+	if receipts := rawdb.ReadRawReceipts(db, hash, *n); receipts != nil {
+		rawdb.WriteReceipts(batch, newHash, *n, receipts)
+	}
+	replaceCanonicalHeader(db, batch, hash, newHeader)
+	if err := batch.Write(); err != nil {
+		return nil, fmt.Errorf("failed to write block %d: %w", *n, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,53 @@
+package cheat
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHeadHeader(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+	receipt := &types.Receipt{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: common.Big0, Time: 10, GasLimit: 30_000_000, BaseFee: big.NewInt(7)},
+		[]*types.Transaction{tx}, nil, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+	rawdb.WriteBlock(db, block)
+	rawdb.WriteReceipts(db, block.Hash(), 1, types.Receipts{receipt})
+	rawdb.WriteTd(db, block.Hash(), 1, big.NewInt(1))
+	rawdb.WriteCanonicalHash(db, block.Hash(), 1)
+	rawdb.WriteHeadHeaderHash(db, block.Hash())
+	rawdb.WriteHeadBlockHash(db, block.Hash())
+	rawdb.WriteHeadFastBlockHash(db, block.Hash())
+	rawdb.WriteFinalizedBlockHash(db, block.Hash())
+
+	// no changes keep the block as-is
+	report, err := SetHeadHeader(db, &HeaderOverride{})
+	require.NoError(t, err)
+	require.Equal(t, block.Hash(), report.NewHash)
+
+	timestamp, extra := uint64(0), []byte("edge")
+	report, err = SetHeadHeader(db, &HeaderOverride{Time: &timestamp, ExtraData: &extra, BaseFee: big.NewInt(0)})
+	require.NoError(t, err)
+	require.NotEqual(t, block.Hash(), report.NewHash)
+	require.Equal(t, report.NewHash, rawdb.ReadCanonicalHash(db, 1))
+	require.Equal(t, report.NewHash, rawdb.ReadHeadHeaderHash(db))
+	require.Equal(t, report.NewHash, rawdb.ReadHeadBlockHash(db))
+	require.Equal(t, report.NewHash, rawdb.ReadHeadFastBlockHash(db))
+	require.Equal(t, report.NewHash, rawdb.ReadFinalizedBlockHash(db))
+	require.Equal(t, big.NewInt(1), rawdb.ReadTd(db, report.NewHash, 1))
+
+	changed := rawdb.ReadBlock(db, report.NewHash, 1)
+	require.NotNil(t, changed)
+	require.Equal(t, uint64(0), changed.Time())
+	require.Equal(t, uint64(30_000_000), changed.GasLimit(), "unset fields are kept")
+	require.Equal(t, extra, changed.Extra())
+	require.Equal(t, big.NewInt(0), changed.BaseFee())
+	require.Equal(t, tx.Hash(), changed.Transactions()[0].Hash())
+	require.Len(t, rawdb.ReadRawReceipts(db, report.NewHash, 1), 1)
+}
@@ -0,0 +1,109 @@
+package cheat
+
+import (
+	"bytes"
+	"crypto/rand"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+//go:embed genesis.json.tmpl
+var defaultGenesisTemplate []byte
+
+// DefaultGenesisValues are the values of the default genesis template, unless overridden.
+// The prefunded account is the first account of the well-known "test test ... junk" dev mnemonic.
+func DefaultGenesisValues() TemplateValues {
+	return TemplateValues{
+		"ChainID":      "901",
+		"Timestamp":    strconv.FormatInt(time.Now().Unix(), 10),
+		"GasLimit":     "30000000",
+		"Prefund":      "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+		"PrefundEther": "10000",
+	}
+}
+
+// Env describes the files of a bootstrapped op-geth environment.
+type Env struct {
+	Genesis string `json:"genesis"`
+	JWT     string `json:"jwt"`
+	// DataDir is the geth --datadir to run op-geth with.
+	DataDir string `json:"dataDir"`
+	// ChainData is the database within the data dir, to use as --data-dir with the cheat commands.
+	ChainData   string      `json:"chainData"`
+	GenesisHash common.Hash `json:"genesisHash"`
+	ChainID     *big.Int    `json:"chainId"`
+}
+
+// InitEnv lays down a ready-to-run op-geth environment in outDir: a genesis.json rendered from the template
+// (the default template if nil) with the given values, a jwt.txt secret for the Engine API,
+// and a data dir initialized with the genesis, like geth init.
+// An existing JWT secret is kept, and an already initialized data dir must match the genesis.
+func InitEnv(outDir string, genesisTmpl io.Reader, values TemplateValues) (*Env, error) {
+	if genesisTmpl == nil {
+		genesisTmpl = bytes.NewReader(defaultGenesisTemplate)
+	}
+	rendered, err := RenderTemplate(genesisTmpl, values)
+	if err != nil {
+		return nil, err
+	}
+	genesisJSON, err := io.ReadAll(rendered)
+	if err != nil {
+		return nil, err
+	}
+	var genesis core.Genesis
+	if err := json.Unmarshal(genesisJSON, &genesis); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis: %w", err)
+	}
+	env := &Env{
+		Genesis:   filepath.Join(outDir, "genesis.json"),
+		JWT:       filepath.Join(outDir, "jwt.txt"),
+		DataDir:   filepath.Join(outDir, "datadir"),
+		ChainData: filepath.Join(outDir, "datadir", "geth", "chaindata"),
+	}
+	if err := os.MkdirAll(env.ChainData, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+	if _, err := os.Stat(env.JWT); errors.Is(err, fs.ErrNotExist) {
+		var secret [32]byte
+		if _, err := rand.Read(secret[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate jwt secret: %w", err)
+		}
+		if err := os.WriteFile(env.JWT, []byte(hexutil.Encode(secret[:])), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write jwt secret: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check jwt secret: %w", err)
+	}
+
+	db, err := OpenGethRawDB(env.ChainData, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	_, hash, err := core.SetupGenesisBlock(db, trie.NewDatabase(db), &genesis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize data dir with genesis: %w", err)
+	}
+	env.GenesisHash = hash
+	if genesis.Config != nil {
+		env.ChainID = genesis.Config.ChainID
+	}
+	if err := os.WriteFile(env.Genesis, genesisJSON, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write genesis: %w", err)
+	}
+	return env, nil
+}
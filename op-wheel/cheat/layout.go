@@ -0,0 +1,289 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// Kinds of storage slots, as derived from the way the bytecode computes the slot.
+const (
+	// SlotValue is a constant slot, e.g. a state variable.
+	SlotValue = "value"
+	// SlotMapping is a base slot of keccak256(key . slot) slots, i.e. a mapping.
+	SlotMapping = "mapping"
+	// SlotArray is a base slot of keccak256(slot) slots, i.e. the data of a dynamic array, bytes or string.
+	SlotArray = "array"
+)
+
+// wellKnownSlots names the slots of common standards.
+var wellKnownSlots = map[common.Hash]string{
+	EIP1967ImplementationSlot: "eip1967.proxy.implementation",
+	EIP1967AdminSlot:          "eip1967.proxy.admin",
+	EIP1967BeaconSlot:         "eip1967.proxy.beacon",
+}
+
+// LayoutSlot is a storage slot that the bytecode accesses.
+type LayoutSlot struct {
+	Slot common.Hash `json:"slot"`
+	Kind string      `json:"kind"`
+	Name string      `json:"name,omitempty"`
+	// Offsets are the constant offsets that are added to the computed slots of a mapping or array,
+	// e.g. the members of a struct value.
+	Offsets []uint64 `json:"offsets,omitempty"`
+	Reads   uint64   `json:"reads"`
+	Writes  uint64   `json:"writes"`
+}
+
+type absKind uint8
+
+const (
+	absUnknown absKind = iota
+	absConst
+	absKeccak
+)
+
+// absValue is the abstract value of a stack item or memory word, as far as the analysis can tell.
+type absValue struct {
+	kind absKind
+	// c is the value of a constant
+	c uint256.Int
+	// slot, pattern and offset describe a keccak256 result, plus a constant offset
+	slot    common.Hash
+	pattern string
+	offset  uint64
+}
+
+// layoutAnalyzer interprets the bytecode abstractly, one basic block at a time.
+type layoutAnalyzer struct {
+	ops   vm.JumpTable
+	stack []absValue
+	mem   map[uint64]absValue
+	slots map[slotID]*LayoutSlot
+}
+
+type slotID struct {
+	slot common.Hash
+	kind string
+}
+
+func (a *layoutAnalyzer) pop() absValue {
+	if len(a.stack) == 0 {
+		return absValue{}
+	}
+	v := a.stack[len(a.stack)-1]
+	a.stack = a.stack[:len(a.stack)-1]
+	return v
+}
+
+func (a *layoutAnalyzer) push(v absValue) {
+	a.stack = append(a.stack, v)
+}
+
+// peek returns the n-th item from the top of the stack, 1-based.
+func (a *layoutAnalyzer) peek(n int) absValue {
+	if n > len(a.stack) {
+		return absValue{}
+	}
+	return a.stack[len(a.stack)-n]
+}
+
+func (a *layoutAnalyzer) reset() {
+	a.stack = a.stack[:0]
+	a.mem = make(map[uint64]absValue)
+}
+
+func (a *layoutAnalyzer) record(key absValue, write bool) {
+	var slot *LayoutSlot
+	switch key.kind {
+	case absConst:
+		h := common.Hash(key.c.Bytes32())
+		id := slotID{h, SlotValue}
+		if slot = a.slots[id]; slot == nil {
+			slot = &LayoutSlot{Slot: h, Kind: SlotValue, Name: wellKnownSlots[h]}
+			a.slots[id] = slot
+		}
+	case absKeccak:
+		id := slotID{key.slot, key.pattern}
+		if slot = a.slots[id]; slot == nil {
+			slot = &LayoutSlot{Slot: key.slot, Kind: key.pattern}
+			a.slots[id] = slot
+		}
+		if key.offset > 0 {
+			i := sort.Search(len(slot.Offsets), func(i int) bool { return slot.Offsets[i] >= key.offset })
+			if i == len(slot.Offsets) || slot.Offsets[i] != key.offset {
+				slot.Offsets = append(slot.Offsets, 0)
+				copy(slot.Offsets[i+1:], slot.Offsets[i:])
+				slot.Offsets[i] = key.offset
+			}
+		}
+	default:
+		return
+	}
+	if write {
+		slot.Writes += 1
+	} else {
+		slot.Reads += 1
+	}
+}
+
+// keccak derives the abstract result of keccak256 over the memory range at the given offset and size:
+// the slot of a mapping value if the second word is a slot, or the data slot of an array if the only word is a slot.
+func (a *layoutAnalyzer) keccak(offset, size absValue) absValue {
+	if offset.kind != absConst || size.kind != absConst || !offset.c.IsUint64() {
+		return absValue{}
+	}
+	off := offset.c.Uint64()
+	var base absValue
+	var pattern string
+	switch size.c.Uint64() {
+	case 64:
+		base, pattern = a.mem[off+32], SlotMapping
+	case 32:
+		base, pattern = a.mem[off], SlotArray
+	default:
+		return absValue{}
+	}
+	switch base.kind {
+	case absConst:
+		return absValue{kind: absKeccak, slot: base.c.Bytes32(), pattern: pattern}
+	case absKeccak:
+		// a nested mapping, or an array within a mapping, is attributed to the outer base slot
+		return absValue{kind: absKeccak, slot: base.slot, pattern: base.pattern}
+	}
+	return absValue{}
+}
+
+func (a *layoutAnalyzer) step(op vm.OpCode, immediate []byte) {
+	switch {
+	case op == vm.PUSH0:
+		a.push(absValue{kind: absConst})
+	case op.IsPush():
+		v := absValue{kind: absConst}
+		v.c.SetBytes(immediate)
+		a.push(v)
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		a.push(a.peek(int(op-vm.DUP1) + 1))
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		n := int(op-vm.SWAP1) + 2
+		for len(a.stack) < n {
+			a.stack = append([]absValue{{}}, a.stack...)
+		}
+		top, other := len(a.stack)-1, len(a.stack)-n
+		a.stack[top], a.stack[other] = a.stack[other], a.stack[top]
+	case op == vm.JUMPDEST:
+		a.reset()
+	case op == vm.ADD:
+		x, y := a.pop(), a.pop()
+		switch {
+		case x.kind == absConst && y.kind == absConst:
+			var sum absValue
+			sum.kind = absConst
+			sum.c.Add(&x.c, &y.c)
+			a.push(sum)
+		case x.kind == absKeccak && y.kind == absConst && y.c.IsUint64():
+			x.offset += y.c.Uint64()
+			a.push(x)
+		case y.kind == absKeccak && x.kind == absConst && x.c.IsUint64():
+			y.offset += x.c.Uint64()
+			a.push(y)
+		default:
+			a.push(absValue{})
+		}
+	case op == vm.MSTORE:
+		offset, value := a.pop(), a.pop()
+		if offset.kind == absConst && offset.c.IsUint64() {
+			a.mem[offset.c.Uint64()] = value
+		} else {
+			a.mem = make(map[uint64]absValue) // unknown write, forget all of memory
+		}
+	case op == vm.KECCAK256:
+		offset, size := a.pop(), a.pop()
+		a.push(a.keccak(offset, size))
+	case op == vm.SLOAD:
+		a.record(a.pop(), false)
+		a.push(absValue{})
+	case op == vm.SSTORE:
+		a.record(a.pop(), true)
+		a.pop()
+	default:
+		operation := a.ops[op]
+		if operation == nil || !operation.HasCost() { // STOP, or undefined
+			a.reset()
+			return
+		}
+		minStack, maxStack := operation.Stack()
+		pops, pushes := minStack, int(params.StackLimit)+minStack-maxStack
+		for i := 0; i < pops; i++ {
+			a.pop()
+		}
+		for i := 0; i < pushes; i++ {
+			a.push(absValue{})
+		}
+		// the stack remains known on the fall-through of a JUMPI
+		if op == vm.JUMP || op == vm.RETURN || op == vm.REVERT || op == vm.SELFDESTRUCT {
+			a.reset()
+		}
+	}
+}
+
+// AnalyzeStorageLayout derives a best-effort storage layout from bytecode, without source or compiler output:
+// constant SLOAD/SSTORE slots are state variables, and slots that are computed with keccak256
+// from a constant slot are mappings or dynamic arrays. Slots that are computed otherwise are not found.
+func AnalyzeStorageLayout(code []byte) ([]LayoutSlot, error) {
+	ops, err := vm.LookupInstructionSet(params.Rules{IsShanghai: true})
+	if err != nil {
+		return nil, err
+	}
+	a := &layoutAnalyzer{ops: ops, mem: make(map[uint64]absValue), slots: make(map[slotID]*LayoutSlot)}
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		var immediate []byte
+		if op.IsPush() {
+			end := pc + 1 + int(op-vm.PUSH1) + 1
+			if end > len(code) {
+				end = len(code)
+			}
+			immediate = code[pc+1 : end]
+			pc = end - 1
+		}
+		a.step(op, immediate)
+	}
+	out := make([]LayoutSlot, 0, len(a.slots))
+	for _, slot := range a.slots {
+		out = append(out, *slot)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if c := bytes.Compare(out[i].Slot[:], out[j].Slot[:]); c != 0 {
+			return c < 0
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out, nil
+}
+
+// StorageLayout analyzes the code of the given account, and writes the derived storage layout as JSON.
+func StorageLayout(address common.Address, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		code := headState.GetCode(address)
+		if len(code) == 0 {
+			return fmt.Errorf("account %s has no code", address)
+		}
+		layout, err := AnalyzeStorageLayout(code)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(layout)
+	}
+}
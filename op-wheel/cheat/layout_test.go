@@ -0,0 +1,40 @@
+package cheat
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeStorageLayout(t *testing.T) {
+	implSlot := common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	code := []byte{
+		// state variable read: sload(5)
+		byte(vm.PUSH1), 0x05, byte(vm.SLOAD), byte(vm.POP),
+		// mapping write: balances[msg.sender] = 0xaa, with balances at slot 3
+		byte(vm.PUSH1), 0xaa,
+		byte(vm.CALLER), byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x03, byte(vm.PUSH1), 0x20, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x40, byte(vm.PUSH0), byte(vm.KECCAK256), byte(vm.SSTORE),
+		// array element read: sload(keccak256(7) + 2)
+		byte(vm.PUSH1), 0x07, byte(vm.PUSH0), byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH0), byte(vm.KECCAK256),
+		byte(vm.PUSH1), 0x02, byte(vm.SWAP1), byte(vm.ADD), byte(vm.SLOAD),
+		// the stack is unknown after a jump destination
+		byte(vm.JUMPDEST), byte(vm.SLOAD), byte(vm.POP),
+		byte(vm.PUSH32),
+	}
+	code = append(code, implSlot[:]...)
+	code = append(code, byte(vm.SLOAD), byte(vm.STOP))
+
+	layout, err := AnalyzeStorageLayout(code)
+	require.NoError(t, err)
+	require.Equal(t, []LayoutSlot{
+		{Slot: common.Hash{31: 3}, Kind: SlotMapping, Writes: 1},
+		{Slot: common.Hash{31: 5}, Kind: SlotValue, Reads: 1},
+		{Slot: common.Hash{31: 7}, Kind: SlotArray, Offsets: []uint64{2}, Reads: 1},
+		{Slot: implSlot, Kind: SlotValue, Name: "eip1967.proxy.implementation", Reads: 1},
+	}, layout)
+}
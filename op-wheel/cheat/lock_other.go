@@ -0,0 +1,13 @@
+//go:build !windows
+
+package cheat
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isLockError returns whether the error is of failing to take the file lock of a database that is in use.
+func isLockError(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EWOULDBLOCK)
+}
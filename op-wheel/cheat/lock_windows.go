@@ -0,0 +1,15 @@
+//go:build windows
+
+package cheat
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isLockError returns whether the error is of failing to take the file lock of a database that is in use:
+// the lock file cannot be opened while another process has it open, or it is locked.
+func isLockError(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
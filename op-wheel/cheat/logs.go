@@ -0,0 +1,107 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// LogFilter selects event logs, like the filter of eth_getLogs.
+type LogFilter struct {
+	// Addresses to match the emitter of the log with. Any address matches if empty.
+	Addresses []common.Address
+	// Topics are the alternatives to match per topic position. An empty position matches any topic.
+	Topics [][]common.Hash
+}
+
+// Match checks if the log matches the filter.
+func (f *LogFilter) Match(l *types.Log) bool {
+	if len(f.Addresses) > 0 && !containsAddr(f.Addresses, l.Address) {
+		return false
+	}
+	if len(f.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, alternatives := range f.Topics {
+		if len(alternatives) == 0 {
+			continue
+		}
+		match := false
+		for _, topic := range alternatives {
+			if l.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// LogsExportReport summarizes an export of logs.
+type LogsExportReport struct {
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	Receipts  uint64 `json:"receipts"`
+	Logs      uint64 `json:"logs"`
+}
+
+// ExportLogs writes the logs of the canonical blocks from..to (inclusive) that match the filter as JSON lines.
+// The receipts are read from the database, no node is needed. If to is 0, the range ends at the head block.
+func ExportLogs(ctx context.Context, db ethdb.Database, from, to uint64, filter *LogFilter, w io.Writer) (*LogsExportReport, error) {
+	genesisHash := rawdb.ReadCanonicalHash(db, 0)
+	config := rawdb.ReadChainConfig(db, genesisHash)
+	if config == nil {
+		return nil, fmt.Errorf("no chain config found for genesis %s", genesisHash)
+	}
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return nil, fmt.Errorf("no head header found")
+	}
+	if to == 0 || to > head.Number.Uint64() {
+		to = head.Number.Uint64()
+	}
+	if from > to {
+		return nil, fmt.Errorf("range start %d is after range end %d", from, to)
+	}
+	report := &LogsExportReport{FromBlock: from, ToBlock: to}
+	enc := json.NewEncoder(w)
+	for n := from; n <= to; n++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		hash := rawdb.ReadCanonicalHash(db, n)
+		header := rawdb.ReadHeader(db, hash, n)
+		if header == nil {
+			return report, fmt.Errorf("canonical header %d (%s) is missing", n, hash)
+		}
+		if header.ReceiptHash == types.EmptyReceiptsHash {
+			continue
+		}
+		receipts := rawdb.ReadReceipts(db, hash, n, header.Time, config)
+		if receipts == nil {
+			return report, fmt.Errorf("receipts of block %d (%s) are missing", n, hash)
+		}
+		report.Receipts += uint64(len(receipts))
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				if !filter.Match(l) {
+					continue
+				}
+				if err := enc.Encode(l); err != nil {
+					return report, fmt.Errorf("failed to write log %d of block %d: %w", l.Index, n, err)
+				}
+				report.Logs += 1
+			}
+		}
+	}
+	return report, nil
+}
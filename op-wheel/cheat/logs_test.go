@@ -0,0 +1,23 @@
+package cheat
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFilterMatch(t *testing.T) {
+	emitter, other := common.Address{0: 0xa}, common.Address{0: 0xb}
+	sig, arg := common.Hash{0: 1}, common.Hash{0: 2}
+	l := &types.Log{Address: emitter, Topics: []common.Hash{sig, arg}}
+
+	require.True(t, (&LogFilter{}).Match(l))
+	require.True(t, (&LogFilter{Addresses: []common.Address{other, emitter}}).Match(l))
+	require.False(t, (&LogFilter{Addresses: []common.Address{other}}).Match(l))
+	require.True(t, (&LogFilter{Topics: [][]common.Hash{{sig}}}).Match(l))
+	require.True(t, (&LogFilter{Topics: [][]common.Hash{nil, {sig, arg}}}).Match(l))
+	require.False(t, (&LogFilter{Topics: [][]common.Hash{{arg}}}).Match(l))
+	require.False(t, (&LogFilter{Topics: [][]common.Hash{nil, nil, nil}}).Match(l), "log has fewer topics than the filter")
+}
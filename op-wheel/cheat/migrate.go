@@ -0,0 +1,334 @@
+package cheat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// SchemeMigration is the outcome of migrating the head state of a database to another state scheme.
+type SchemeMigration struct {
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	Number    uint64      `json:"number"`
+	Hash      common.Hash `json:"hash"`
+	StateRoot common.Hash `json:"stateRoot"`
+	// Keys is the number of database entries, other than trie nodes, that were copied as they are.
+	Keys         uint64 `json:"keys"`
+	Nodes        uint64 `json:"nodes"`
+	Accounts     uint64 `json:"accounts"`
+	StorageTries uint64 `json:"storageTries"`
+	// GenesisState is set if the state of the genesis block was restored from the genesis alloc in the database.
+	GenesisState bool `json:"genesisState,omitempty"`
+}
+
+// stateScheme detects the state scheme of the database from the storage of the given state root.
+func stateScheme(db ethdb.KeyValueReader, root common.Hash) (string, error) {
+	if blob, hash := rawdb.ReadAccountTrieNode(db, nil); len(blob) > 0 && hash == root {
+		return rawdb.PathScheme, nil
+	}
+	if rawdb.HasLegacyTrieNode(db, root) {
+		return rawdb.HashScheme, nil
+	}
+	return "", fmt.Errorf("state %s is not in the database", root)
+}
+
+// MigrateStateScheme copies the database to an empty database, and stores the head state in the other state scheme:
+// the hash-based scheme of this op-geth version, or the path-based scheme of later op-geth versions.
+// All entries other than trie nodes, e.g. the blocks, code and pre-images, are copied as they are, so the head block is kept.
+// The trie nodes of the head state are copied to the keys of the other scheme, older states are not copied,
+// except for the genesis state in the hash scheme, which is restored from the genesis alloc that geth keeps in the database.
+// The ancient store is not part of the key-value database, see MigrateStateSchemeDir.
+func MigrateStateScheme(ctx context.Context, src ethdb.Database, dst ethdb.Database) (*SchemeMigration, error) {
+	head := rawdb.ReadHeadBlock(src)
+	if head == nil {
+		return nil, errors.New("head block is missing")
+	}
+	from, err := stateScheme(src, head.Root())
+	if err != nil {
+		return nil, err
+	}
+	to := rawdb.PathScheme
+	if from == rawdb.PathScheme {
+		to = rawdb.HashScheme
+	}
+	m := &schemeMigrator{
+		src:   src,
+		batch: dst.NewBatch(),
+		from:  from,
+		to:    to,
+		report: &SchemeMigration{
+			From:      from,
+			To:        to,
+			Number:    head.NumberU64(),
+			Hash:      head.Hash(),
+			StateRoot: head.Root(),
+		},
+	}
+	log.Info("copying database entries", "from", from, "to", to)
+	iter := src.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if isTrieNode(iter.Key(), iter.Value(), from) {
+			continue
+		}
+		if err := m.batch.Put(iter.Key(), iter.Value()); err != nil {
+			return nil, fmt.Errorf("failed to copy entry %x: %w", iter.Key(), err)
+		}
+		m.report.Keys += 1
+		if err := m.flush(false); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate database: %w", err)
+	}
+	log.Info("copying head state", "root", head.Root(), "number", head.NumberU64())
+	err = m.copyNode(ctx, common.Hash{}, nil, head.Root(), func(key []byte, value []byte) error {
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(value, &acc); err != nil {
+			return fmt.Errorf("failed to decode account %x: %w", key, err)
+		}
+		m.report.Accounts += 1
+		if acc.Root == types.EmptyRootHash {
+			return nil
+		}
+		m.report.StorageTries += 1
+		return m.copyNode(ctx, common.BytesToHash(key), nil, acc.Root, func(key []byte, value []byte) error {
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.flush(true); err != nil {
+		return nil, err
+	}
+	if to == rawdb.HashScheme {
+		// geth requires the state of the genesis block in the hash scheme, which the path scheme does not keep
+		genesis := rawdb.ReadCanonicalHash(src, 0)
+		if header := rawdb.ReadHeader(src, genesis, 0); header != nil && !rawdb.HasLegacyTrieNode(dst, header.Root) {
+			if err := core.CommitGenesisState(dst, trie.NewDatabase(dst), genesis); err != nil {
+				log.Warn("failed to restore genesis state, geth must be started with the genesis", "err", err)
+			} else {
+				m.report.GenesisState = true
+			}
+		}
+	}
+	return m.report, nil
+}
+
+// isTrieNode reports if the database entry is a trie node of the given state scheme.
+func isTrieNode(key []byte, value []byte, scheme string) bool {
+	if scheme == rawdb.HashScheme {
+		return rawdb.IsLegacyTrieNode(key, value)
+	}
+	if ok, _ := rawdb.IsAccountTrieNode(key); ok {
+		return true
+	}
+	ok, _, _ := rawdb.IsStorageTrieNode(key)
+	return ok
+}
+
+// schemeMigrator copies the trie nodes of a state from one state scheme to the other.
+type schemeMigrator struct {
+	src      ethdb.KeyValueReader
+	batch    ethdb.Batch
+	from, to string
+	report   *SchemeMigration
+}
+
+func (m *schemeMigrator) flush(force bool) error {
+	if !force && m.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	if err := m.batch.Write(); err != nil {
+		return fmt.Errorf("failed to write to database: %w", err)
+	}
+	m.batch.Reset()
+	return nil
+}
+
+// copyNode copies the stored trie node of the given owner, the account hash of a storage trie or empty for the account trie,
+// at the given path of nibbles, and all of its children. The leaves are passed to onLeaf, with their full key.
+func (m *schemeMigrator) copyNode(ctx context.Context, owner common.Hash, path []byte, hash common.Hash, onLeaf func(key []byte, value []byte) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	blob := rawdb.ReadTrieNode(m.src, owner, path, hash, m.from)
+	if len(blob) == 0 {
+		return fmt.Errorf("trie node %s at path %x of owner %s is missing", hash, path, owner)
+	}
+	rawdb.WriteTrieNode(m.batch, owner, path, hash, blob, m.to)
+	m.report.Nodes += 1
+	if err := m.flush(false); err != nil {
+		return err
+	}
+	return m.walkNode(ctx, owner, path, blob, onLeaf)
+}
+
+// walkNode visits the children of an RLP-encoded trie node: a short node of a key and a value or child,
+// or a full node of 16 children and a value, which is never set in the secure tries of the state.
+func (m *schemeMigrator) walkNode(ctx context.Context, owner common.Hash, path []byte, blob []byte, onLeaf func(key []byte, value []byte) error) error {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return fmt.Errorf("invalid trie node at path %x of owner %s: %w", path, owner, err)
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return fmt.Errorf("invalid trie node at path %x of owner %s: %w", path, owner, err)
+	}
+	switch count {
+	case 2:
+		compact, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return fmt.Errorf("invalid short node key at path %x of owner %s: %w", path, owner, err)
+		}
+		nibbles, leaf := compactToNibbles(compact)
+		childPath := append(append([]byte{}, path...), nibbles...)
+		if leaf {
+			value, _, err := rlp.SplitString(rest)
+			if err != nil {
+				return fmt.Errorf("invalid leaf value at path %x of owner %s: %w", childPath, owner, err)
+			}
+			return onLeaf(nibblesToBytes(childPath), value)
+		}
+		return m.walkChild(ctx, owner, childPath, rest, onLeaf)
+	case 17:
+		for i := byte(0); i < 16; i++ {
+			_, _, rest, err := rlp.Split(elems)
+			if err != nil {
+				return fmt.Errorf("invalid full node at path %x of owner %s: %w", path, owner, err)
+			}
+			if err := m.walkChild(ctx, owner, append(append([]byte{}, path...), i), elems[:len(elems)-len(rest)], onLeaf); err != nil {
+				return err
+			}
+			elems = rest
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid trie node at path %x of owner %s with %d elements", path, owner, count)
+	}
+}
+
+// walkChild follows a reference to a child node: the hash of a stored node, an embedded node, or empty.
+func (m *schemeMigrator) walkChild(ctx context.Context, owner common.Hash, path []byte, ref []byte, onLeaf func(key []byte, value []byte) error) error {
+	kind, content, _, err := rlp.Split(ref)
+	if err != nil {
+		return fmt.Errorf("invalid child reference at path %x of owner %s: %w", path, owner, err)
+	}
+	switch {
+	case kind == rlp.List:
+		return m.walkNode(ctx, owner, path, ref, onLeaf)
+	case len(content) == 0:
+		return nil
+	case len(content) == common.HashLength:
+		return m.copyNode(ctx, owner, path, common.BytesToHash(content), onLeaf)
+	default:
+		return fmt.Errorf("invalid child reference at path %x of owner %s", path, owner)
+	}
+}
+
+// compactToNibbles decodes the hex-prefix encoding of a short node key, and reports if the key is of a leaf.
+// This follows compactToHex of Geth's trie/encoding.go, without the terminator nibble.
+func compactToNibbles(compact []byte) ([]byte, bool) {
+	if len(compact) == 0 {
+		return nil, false
+	}
+	nibbles := make([]byte, 0, len(compact)*2)
+	for _, b := range compact {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	leaf := nibbles[0] >= 2
+	// drop the flag nibble, and the padding nibble of even-length keys
+	return nibbles[2-nibbles[0]&1:], leaf
+}
+
+func nibblesToBytes(nibbles []byte) []byte {
+	out := make([]byte, len(nibbles)/2)
+	for i := range out {
+		out[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return out
+}
+
+// MigrateStateSchemeDir migrates the database of the source data dir into the destination data dir, which must not exist
+// or be empty, with MigrateStateScheme. The ancient store is copied first, as it is not affected by the state scheme.
+// The node using the source data dir must be stopped.
+func MigrateStateSchemeDir(ctx context.Context, srcDir string, dstDir string) (*SchemeMigration, error) {
+	if entries, err := os.ReadDir(dstDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("destination data dir %s is not empty", dstDir)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read destination data dir: %w", err)
+	}
+	if err := copyDir(filepath.Join(srcDir, "ancient"), filepath.Join(dstDir, "ancient")); err != nil {
+		return nil, fmt.Errorf("failed to copy ancient store: %w", err)
+	}
+	src, err := OpenGethRawDB(srcDir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source data dir: %w", err)
+	}
+	defer src.Close()
+	dst, err := OpenGethRawDB(dstDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination data dir: %w", err)
+	}
+	report, err := MigrateStateScheme(ctx, src, dst)
+	if err != nil {
+		_ = dst.Close()
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close destination data dir: %w", err)
+	}
+	return report, nil
+}
+
+// copyDir copies the files of a directory tree, if the source directory exists.
+func copyDir(src string, dst string) error {
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			_ = out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
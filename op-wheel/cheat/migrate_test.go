@@ -0,0 +1,83 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateStateSchemeDir(t *testing.T) {
+	ctx := context.Background()
+	hashDir := t.TempDir()
+	eoa, contract := common.Address{0: 0xa}, common.Address{0: 0xc}
+	storage := make(map[common.Hash]common.Hash)
+	for i := byte(1); i <= 20; i++ {
+		storage[common.Hash{31: i}] = common.Hash{31: i}
+	}
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			eoa:      {Balance: big.NewInt(7)},
+			contract: {Balance: big.NewInt(1), Code: []byte{0x60, 0x00}, Storage: storage},
+		},
+	}
+	db, err := OpenGethRawDB(hashDir, false)
+	require.NoError(t, err)
+	genesis.MustCommit(db)
+	require.NoError(t, db.Close())
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 3, func(i int, gen *core.BlockGen) {})
+	ch, err := OpenGethDB(hashDir, false)
+	require.NoError(t, err)
+	importer := NewChainImporter(ch)
+	require.NoError(t, importer.InsertBlocks(ctx, blocks))
+	require.NoError(t, importer.Close())
+	head := blocks[len(blocks)-1]
+
+	pathDir := filepath.Join(t.TempDir(), "path")
+	report, err := MigrateStateSchemeDir(ctx, hashDir, pathDir)
+	require.NoError(t, err)
+	require.Equal(t, rawdb.HashScheme, report.From)
+	require.Equal(t, rawdb.PathScheme, report.To)
+	require.Equal(t, head.Hash(), report.Hash)
+	require.Equal(t, uint64(1), report.StorageTries)
+	require.GreaterOrEqual(t, report.Accounts, uint64(2))
+	require.NotZero(t, report.Nodes)
+
+	pathDB, err := OpenGethRawDB(pathDir, true)
+	require.NoError(t, err)
+	require.Equal(t, head.Hash(), rawdb.ReadHeadBlockHash(pathDB))
+	_, rootHash := rawdb.ReadAccountTrieNode(pathDB, nil)
+	require.Equal(t, head.Root(), rootHash)
+	require.False(t, rawdb.HasLegacyTrieNode(pathDB, head.Root()), "hash-scheme nodes are not copied")
+	require.NoError(t, pathDB.Close())
+
+	_, err = MigrateStateSchemeDir(ctx, hashDir, pathDir)
+	require.ErrorContains(t, err, "not empty")
+
+	backDir := filepath.Join(t.TempDir(), "hash")
+	report, err = MigrateStateSchemeDir(ctx, pathDir, backDir)
+	require.NoError(t, err)
+	require.Equal(t, rawdb.PathScheme, report.From)
+	require.Equal(t, rawdb.HashScheme, report.To)
+	require.True(t, report.GenesisState)
+
+	ch, err = OpenGethDB(backDir, true)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.Equal(t, head.Hash(), ch.Blockchain.CurrentBlock().Hash())
+	headState, err := ch.Blockchain.StateAt(head.Root())
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(7), headState.GetBalance(eoa))
+	require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(contract))
+	for key, value := range storage {
+		require.Equal(t, value, headState.GetState(contract, key))
+	}
+}
@@ -0,0 +1,258 @@
+package cheat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// patchV2Header is the first line of a version 2 storage patch, see StoragePatch.
+const patchV2Header = "version 2"
+
+// PatchEntry is a change of a single storage slot.
+type PatchEntry struct {
+	// Line is the line number of the entry in the patch, for error messages.
+	Line  int
+	Key   common.Hash
+	Value common.Hash
+	// Expected is the value the slot must have before the change, if not nil.
+	Expected *common.Hash
+}
+
+// ReadStoragePatch parses a storage patch, see StoragePatch for the formats.
+func ReadStoragePatch(ctx context.Context, patch io.Reader) ([]PatchEntry, error) {
+	s := bufio.NewScanner(patch)
+	var entries []PatchEntry
+	version := 0
+	for i := 1; s.Scan(); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		line := s.Text()
+		if version == 2 {
+			// version 2 allows comments at the end of a line
+			if idx := strings.IndexByte(line, '#'); idx >= 0 {
+				line = line[:idx]
+			}
+			line = strings.TrimSpace(line)
+		}
+		if len(line) < 1 || line[0] == '#' { // skip empty lines and comments
+			continue
+		}
+		if version == 0 {
+			if strings.TrimSpace(line) == patchV2Header {
+				version = 2
+				continue
+			}
+			version = 1
+		}
+		var entry PatchEntry
+		var err error
+		if version == 2 {
+			entry, err = parsePatchV2Entry(line)
+		} else {
+			entry, err = parsePatchV1Entry(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+		entry.Line = i
+		entries = append(entries, entry)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+	return entries, nil
+}
+
+func parsePatchHash(name string, v string) (common.Hash, error) {
+	v = strings.TrimSpace(v)
+	var h common.Hash
+	if err := h.UnmarshalText([]byte(v)); err != nil {
+		return common.Hash{}, fmt.Errorf("%s %s is malformatted: %w", name, v, err)
+	}
+	return h, nil
+}
+
+func parsePatchV1Entry(line string) (PatchEntry, error) {
+	keyHex, valueHex, ok := strings.Cut(line[1:], "=")
+	if !ok {
+		return PatchEntry{}, fmt.Errorf("expected key = value")
+	}
+	key, err := parsePatchHash("key", keyHex)
+	if err != nil {
+		return PatchEntry{}, err
+	}
+	value, err := parsePatchHash("value", valueHex)
+	if err != nil {
+		return PatchEntry{}, fmt.Errorf("key %s has malformatted value: %w", key, err)
+	}
+	switch line[0] {
+	case '+':
+	case '-':
+		value = common.Hash{}
+	default:
+		return PatchEntry{}, fmt.Errorf("unrecognized line diff token")
+	}
+	return PatchEntry{Key: key, Value: value}, nil
+}
+
+func parsePatchV2Entry(line string) (PatchEntry, error) {
+	op, rest, _ := strings.Cut(line, " ")
+	keyHex, args, hasArgs := strings.Cut(rest, "=")
+	key, err := parsePatchHash("key", keyHex)
+	if err != nil {
+		return PatchEntry{}, err
+	}
+	entry := PatchEntry{Key: key}
+	switch op {
+	case "set":
+		if !hasArgs {
+			return PatchEntry{}, fmt.Errorf("expected set key = value")
+		}
+		if entry.Value, err = parsePatchHash("value", args); err != nil {
+			return PatchEntry{}, err
+		}
+	case "add":
+		if !hasArgs {
+			return PatchEntry{}, fmt.Errorf("expected add key = value")
+		}
+		if entry.Value, err = parsePatchHash("value", args); err != nil {
+			return PatchEntry{}, err
+		}
+		entry.Expected = new(common.Hash)
+	case "remove":
+		if hasArgs {
+			expected, err := parsePatchHash("old value", args)
+			if err != nil {
+				return PatchEntry{}, err
+			}
+			entry.Expected = &expected
+		}
+	case "replace":
+		oldHex, newHex, ok := strings.Cut(args, "->")
+		if !hasArgs || !ok {
+			return PatchEntry{}, fmt.Errorf("expected replace key = old -> new")
+		}
+		expected, err := parsePatchHash("old value", oldHex)
+		if err != nil {
+			return PatchEntry{}, err
+		}
+		entry.Expected = &expected
+		if entry.Value, err = parsePatchHash("new value", newHex); err != nil {
+			return PatchEntry{}, err
+		}
+	default:
+		return PatchEntry{}, fmt.Errorf("unrecognized operation %q", op)
+	}
+	return entry, nil
+}
+
+// CheckPatchPreconditions checks the expected values of the patch entries against the current storage,
+// including the changes of the earlier entries of the patch, before any change is made.
+// All mismatches are reported, so a drifted database can be inspected at once.
+func CheckPatchPreconditions(entries []PatchEntry, get func(key common.Hash) (common.Hash, error)) error {
+	patched := make(map[common.Hash]common.Hash)
+	var mismatches []string
+	for _, entry := range entries {
+		current, ok := patched[entry.Key]
+		if !ok && entry.Expected != nil {
+			var err error
+			if current, err = get(entry.Key); err != nil {
+				return fmt.Errorf("failed to get current value of key %s: %w", entry.Key, err)
+			}
+		}
+		if entry.Expected != nil && current != *entry.Expected {
+			mismatches = append(mismatches, fmt.Sprintf("line %d: key %s is %s, expected %s", entry.Line, entry.Key, current, *entry.Expected))
+		}
+		patched[entry.Key] = entry.Value
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("storage drifted since the patch was generated, %d preconditions failed:\n%s",
+			len(mismatches), strings.Join(mismatches, "\n"))
+	}
+	return nil
+}
+
+// patchWriter formats the changes of a storage diff as patch entries.
+// Changes of keys with an unknown pre-image are written as comments, with the hashed key.
+type patchWriter interface {
+	// remove writes a change of a slot with the given value to zero.
+	remove(key common.Hash, known bool, old common.Hash) error
+	// add writes a change of a zero slot to the given value.
+	add(key common.Hash, known bool, value common.Hash) error
+	// replace writes a change of the value of a slot.
+	replace(key common.Hash, known bool, old, value common.Hash) error
+}
+
+func newPatchWriter(out io.Writer, version uint) (patchWriter, error) {
+	switch version {
+	case 1:
+		return &patchV1Writer{out: out}, nil
+	case 2:
+		return &patchV2Writer{out: out}, nil
+	default:
+		return nil, fmt.Errorf("unknown patch version %d", version)
+	}
+}
+
+func patchLine(known bool, entry string) string {
+	if known {
+		return entry + "\n"
+	}
+	return "# " + entry + " (unknown key pre-image, hashed key)\n"
+}
+
+type patchV1Writer struct {
+	out io.Writer
+}
+
+func (w *patchV1Writer) remove(key common.Hash, known bool, old common.Hash) error {
+	_, err := io.WriteString(w.out, patchLine(known, fmt.Sprintf("- %s = %s", key, old)))
+	return err
+}
+
+func (w *patchV1Writer) add(key common.Hash, known bool, value common.Hash) error {
+	_, err := io.WriteString(w.out, patchLine(known, fmt.Sprintf("+ %s = %s", key, value)))
+	return err
+}
+
+func (w *patchV1Writer) replace(key common.Hash, known bool, old, value common.Hash) error {
+	if err := w.remove(key, known, old); err != nil {
+		return err
+	}
+	return w.add(key, known, value)
+}
+
+// patchV2Writer writes the version header before the first line, so an empty diff remains empty.
+type patchV2Writer struct {
+	out    io.Writer
+	header bool
+}
+
+func (w *patchV2Writer) write(line string) error {
+	if !w.header {
+		if _, err := fmt.Fprintln(w.out, patchV2Header); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	_, err := io.WriteString(w.out, line)
+	return err
+}
+
+func (w *patchV2Writer) remove(key common.Hash, known bool, old common.Hash) error {
+	return w.write(patchLine(known, fmt.Sprintf("remove %s = %s", key, old)))
+}
+
+func (w *patchV2Writer) add(key common.Hash, known bool, value common.Hash) error {
+	return w.write(patchLine(known, fmt.Sprintf("add %s = %s", key, value)))
+}
+
+func (w *patchV2Writer) replace(key common.Hash, known bool, old, value common.Hash) error {
+	return w.write(patchLine(known, fmt.Sprintf("replace %s = %s -> %s", key, old, value)))
+}
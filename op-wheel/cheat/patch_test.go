@@ -0,0 +1,102 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStoragePatch(t *testing.T) {
+	one, two := common.Hash{31: 1}, common.Hash{31: 2}
+	entries, err := ReadStoragePatch(context.Background(), strings.NewReader(`# generated by a test
+version 2
+set `+one.Hex()+` = `+two.Hex()+` # trailing comment
+add `+two.Hex()+` = `+one.Hex()+`
+
+replace `+one.Hex()+` = `+two.Hex()+` -> `+one.Hex()+`
+remove `+two.Hex()+`
+remove `+one.Hex()+` = `+one.Hex()+`
+`))
+	require.NoError(t, err)
+	require.Equal(t, []PatchEntry{
+		{Line: 3, Key: one, Value: two},
+		{Line: 4, Key: two, Value: one, Expected: &common.Hash{}},
+		{Line: 6, Key: one, Value: one, Expected: &two},
+		{Line: 7, Key: two},
+		{Line: 8, Key: one, Expected: &one},
+	}, entries)
+
+	_, err = ReadStoragePatch(context.Background(), strings.NewReader("version 2\nmove "+one.Hex()+" = "+two.Hex()+"\n"))
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestStoragePatchV2(t *testing.T) {
+	a, b := common.Address{0: 0xa}, common.Address{0: 0xb}
+	headState := newTestState(t)
+	for _, addr := range []common.Address{a, b} {
+		headState.SetNonce(addr, 1)
+		headState.SetState(addr, common.Hash{31: 1}, common.Hash{31: 1})
+		headState.SetState(addr, common.Hash{31: 2}, common.Hash{31: 2})
+	}
+	headState.SetState(b, common.Hash{31: 1}, common.Hash{})
+	headState.SetState(b, common.Hash{31: 2}, common.Hash{31: 0x22})
+	headState.SetState(b, common.Hash{31: 3}, common.Hash{31: 3})
+	_, err := headState.Commit(true)
+	require.NoError(t, err)
+
+	var patch bytes.Buffer
+	require.NoError(t, StorageDiffV2(&patch, a, b)(context.Background(), headState))
+	require.True(t, strings.HasPrefix(patch.String(), "version 2\n"))
+
+	// the storage of A drifted: nothing may change
+	headState.SetState(a, common.Hash{31: 2}, common.Hash{31: 0x99})
+	err = StoragePatch(bytes.NewReader(patch.Bytes()), a)(context.Background(), headState)
+	require.ErrorContains(t, err, "1 preconditions failed")
+	require.Equal(t, common.Hash{31: 1}, headState.GetState(a, common.Hash{31: 1}))
+
+	headState.SetState(a, common.Hash{31: 2}, common.Hash{31: 2})
+	require.NoError(t, StoragePatch(bytes.NewReader(patch.Bytes()), a)(context.Background(), headState))
+	_, err = headState.Commit(true)
+	require.NoError(t, err)
+	var remaining bytes.Buffer
+	require.NoError(t, StorageDiffV2(&remaining, a, b)(context.Background(), headState))
+	require.Empty(t, remaining.String())
+}
+
+func TestStorageDiffAt(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(addr, 1)
+	headState.SetState(addr, common.Hash{31: 1}, common.Hash{31: 1})
+	headState.SetState(addr, common.Hash{31: 2}, common.Hash{31: 2})
+	oldRoot, err := headState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, db.TrieDB().Commit(oldRoot, false))
+	headState, err = state.New(oldRoot, db, nil)
+	require.NoError(t, err)
+	headState.SetState(addr, common.Hash{31: 2}, common.Hash{31: 0x22})
+	headState.SetState(addr, common.Hash{31: 3}, common.Hash{31: 3})
+	headRoot, err := headState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, db.TrieDB().Commit(headRoot, false))
+	headState, err = state.New(headRoot, db, nil)
+	require.NoError(t, err)
+
+	var patch bytes.Buffer
+	fn, err := StorageDiffAt(&patch, 1, StorageAt{Address: addr, Root: oldRoot}, StorageAt{Address: addr})
+	require.NoError(t, err)
+	require.NoError(t, fn(context.Background(), headState))
+	require.Equal(t, "- "+common.Hash{31: 2}.Hex()+" = "+common.Hash{31: 2}.Hex()+"\n"+
+		"+ "+common.Hash{31: 2}.Hex()+" = "+common.Hash{31: 0x22}.Hex()+"\n"+
+		"+ "+common.Hash{31: 3}.Hex()+" = "+common.Hash{31: 3}.Hex()+"\n", patch.String())
+
+	fn, err = StorageDiffAt(&patch, 1, StorageAt{Address: addr, Root: common.Hash{0xff}}, StorageAt{Address: addr})
+	require.NoError(t, err)
+	require.ErrorContains(t, fn(context.Background(), headState), "not available")
+}
@@ -0,0 +1,257 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/bindings"
+	"github.com/ethereum-optimism/optimism/op-bindings/foundry"
+	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/genesis"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/immutables"
+)
+
+// PredeployExpectation is the expected state of a predeploy, for a specific OP Stack version.
+type PredeployExpectation struct {
+	// CodeHash is the expected keccak256 hash of the code, of the implementation if the predeploy is proxied.
+	// If not set, the code is compared semantically against the contract bindings of this build,
+	// ignoring metadata and immutables.
+	CodeHash *common.Hash `json:"codeHash,omitempty"`
+	// Storage lists critical storage values of the predeploy, of the proxy if the predeploy is proxied.
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	// Skip disables the check of the predeploy, e.g. for optional predeploys like the governance token.
+	Skip bool `json:"skip,omitempty"`
+}
+
+// PredeploySpec is the expected state of the predeploys, by predeploy name.
+// Predeploys that are not in the spec are compared against the contract bindings of this build.
+type PredeploySpec map[string]*PredeployExpectation
+
+// ReadPredeploySpec reads a predeploy spec from a JSON file.
+func ReadPredeploySpec(path string) (PredeploySpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read predeploy spec: %w", err)
+	}
+	var spec PredeploySpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to decode predeploy spec: %w", err)
+	}
+	return spec, nil
+}
+
+// PredeployCheck is the outcome of verifying a single predeploy.
+type PredeployCheck struct {
+	Name           string          `json:"name"`
+	Address        common.Address  `json:"address"`
+	Implementation *common.Address `json:"implementation,omitempty"`
+	CodeHash       common.Hash     `json:"codeHash"`
+	Skipped        bool            `json:"skipped,omitempty"`
+	Deviations     []string        `json:"deviations,omitempty"`
+}
+
+// VerifyPredeploys checks the code and critical storage of all standard L2 predeploys against the spec,
+// and writes the outcome of each check as JSON line to the given writer.
+// Proxied predeploys must have the standard proxy code, with the predeploy proxy admin as admin,
+// and an implementation with the expected code.
+// An error is returned if any of the predeploys deviates from the spec.
+func VerifyPredeploys(spec PredeploySpec, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		names := make([]string, 0, len(predeploys.Predeploys))
+		for name := range predeploys.Predeploys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		proxyCode, err := bindings.GetDeployedBytecode("Proxy")
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		deviating := 0
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			addr := *predeploys.Predeploys[name]
+			exp := spec[name]
+			if exp == nil {
+				exp = &PredeployExpectation{}
+			}
+			check := &PredeployCheck{Name: name, Address: addr, Skipped: exp.Skip}
+			if !exp.Skip {
+				check.Deviations = verifyPredeploy(headState, name, addr, exp, proxyCode, check)
+			}
+			if len(check.Deviations) > 0 {
+				deviating += 1
+			}
+			if err := enc.Encode(check); err != nil {
+				return err
+			}
+		}
+		if deviating > 0 {
+			return fmt.Errorf("%d predeploys deviate from the spec", deviating)
+		}
+		return nil
+	}
+}
+
+func verifyPredeploy(headState *state.StateDB, name string, addr common.Address, exp *PredeployExpectation, proxyCode []byte, check *PredeployCheck) (deviations []string) {
+	codeAddr := addr
+	if predeploys.IsProxied(addr) {
+		if cmp := CompareCode(headState.GetCode(addr), proxyCode, nil); !cmp.Equal {
+			deviations = append(deviations, "proxy code does not match the standard proxy")
+		}
+		if admin := headState.GetState(addr, EIP1967AdminSlot); admin != predeploys.ProxyAdminAddr.Hash() {
+			deviations = append(deviations, fmt.Sprintf("proxy admin is %s, expected %s", common.BytesToAddress(admin[:]), predeploys.ProxyAdminAddr))
+		}
+		impl := headState.GetState(addr, EIP1967ImplementationSlot)
+		codeAddr = common.BytesToAddress(impl[:])
+		check.Implementation = &codeAddr
+	}
+	for slot, want := range exp.Storage {
+		if got := headState.GetState(addr, slot); got != want {
+			deviations = append(deviations, fmt.Sprintf("storage slot %s is %s, expected %s", slot, got, want))
+		}
+	}
+	code := headState.GetCode(codeAddr)
+	check.CodeHash = crypto.Keccak256Hash(code)
+	if len(code) == 0 {
+		return append(deviations, fmt.Sprintf("no code at %s", codeAddr))
+	}
+	if exp.CodeHash != nil {
+		if check.CodeHash != *exp.CodeHash {
+			deviations = append(deviations, fmt.Sprintf("code hash is %s, expected %s", check.CodeHash, *exp.CodeHash))
+		}
+		return deviations
+	}
+	expected, err := bindings.GetDeployedBytecode(name)
+	if err != nil {
+		return append(deviations, fmt.Sprintf("no expected code: %v", err))
+	}
+	if cmp := CompareCode(code, expected, ImmutablePlaceholders(expected)); !cmp.Equal {
+		deviations = append(deviations, fmt.Sprintf("code differs from the %s bindings at offset %d", name, *cmp.FirstDiff))
+	}
+	return deviations
+}
+
+// PredeployCode returns the deployed code of a contract by name.
+type PredeployCode func(name string) ([]byte, error)
+
+// EmbeddedPredeployCode returns the deployed code from the contract bindings of this build.
+func EmbeddedPredeployCode(name string) ([]byte, error) {
+	return bindings.GetDeployedBytecode(name)
+}
+
+// PredeployCodeDir returns the deployed code from the Foundry artifacts in the given directory,
+// e.g. the forge-artifacts of the contracts-bedrock package, at <name>.sol/<name>.json, or else at <name>.json.
+func PredeployCodeDir(dir string) PredeployCode {
+	return func(name string) ([]byte, error) {
+		paths := []string{filepath.Join(dir, name+".sol", name+".json"), filepath.Join(dir, name+".json")}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read artifact of %s: %w", name, err)
+			}
+			var artifact foundry.Artifact
+			if err := json.Unmarshal(data, &artifact); err != nil {
+				return nil, fmt.Errorf("failed to decode artifact %s: %w", path, err)
+			}
+			if len(artifact.DeployedBytecode.Object) == 0 {
+				return nil, fmt.Errorf("artifact %s has no deployed bytecode", path)
+			}
+			return artifact.DeployedBytecode.Object, nil
+		}
+		return nil, fmt.Errorf("no artifact of %s in %s", name, dir)
+	}
+}
+
+// PredeployImmutables deploys the predeploys with immutables in a simulated backend,
+// to get their deployed code with the immutables of the deploy config, like the L2 genesis does.
+func PredeployImmutables(config *genesis.DeployConfig) (immutables.DeploymentResults, error) {
+	immutable, err := genesis.NewL2ImmutableConfig(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return immutables.BuildOptimism(immutable)
+}
+
+// PredeployNames returns the names of the standard predeploys, in order, with the governance token only if governance is enabled.
+func PredeployNames(governance bool) []string {
+	names := make([]string, 0, len(predeploys.Predeploys))
+	for name, addr := range predeploys.Predeploys {
+		if *addr != predeploys.GovernanceTokenAddr || governance {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PredeployInstall is the code that InstallPredeploys wrote for a predeploy.
+type PredeployInstall struct {
+	Name           string          `json:"name"`
+	Address        common.Address  `json:"address"`
+	Implementation *common.Address `json:"implementation,omitempty"`
+	CodeHash       common.Hash     `json:"codeHash"`
+	Immutables     bool            `json:"immutables,omitempty"`
+}
+
+// InstallPredeploys writes the given predeploys, by name, at their canonical addresses, like the L2 genesis does:
+// proxied predeploys get the standard proxy code, with the predeploy proxy admin as admin,
+// and an implementation in the code namespace. Other storage of the predeploys is not changed.
+// The code is taken from the deployed results if they have the predeploy, and else from the given code source,
+// which leaves the immutables of the predeploy unset. Each installed predeploy is written as JSON line to the given writer.
+func InstallPredeploys(names []string, code PredeployCode, deployed immutables.DeploymentResults, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		proxyCode, err := code("Proxy")
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			addr, ok := predeploys.Predeploys[name]
+			if !ok {
+				return fmt.Errorf("unknown predeploy %s", name)
+			}
+			install := &PredeployInstall{Name: name, Address: *addr}
+			implCode, ok := deployed[name]
+			install.Immutables = ok
+			if !ok {
+				if implCode, err = code(name); err != nil {
+					return err
+				}
+			}
+			codeAddr := *addr
+			if predeploys.IsProxied(*addr) {
+				if codeAddr, err = genesis.AddressToCodeNamespace(*addr); err != nil {
+					return err
+				}
+				headState.SetCode(*addr, proxyCode)
+				headState.SetState(*addr, EIP1967AdminSlot, predeploys.ProxyAdminAddr.Hash())
+				headState.SetState(*addr, EIP1967ImplementationSlot, codeAddr.Hash())
+				install.Implementation = &codeAddr
+			}
+			headState.SetCode(codeAddr, implCode)
+			install.CodeHash = crypto.Keccak256Hash(implCode)
+			if err := enc.Encode(install); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-bindings/bindings"
+	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/immutables"
+)
+
+func TestVerifyPredeploy(t *testing.T) {
+	headState, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	proxyCode, err := bindings.GetDeployedBytecode("Proxy")
+	require.NoError(t, err)
+	implCode, err := bindings.GetDeployedBytecode("L1Block")
+	require.NoError(t, err)
+
+	addr := predeploys.L1BlockAddr
+	impl := common.HexToAddress("0xc0d3C0d3C0d3c0d3C0d3C0D3c0D3c0d3c0D30015")
+	headState.SetCode(addr, proxyCode)
+	headState.SetState(addr, EIP1967AdminSlot, predeploys.ProxyAdminAddr.Hash())
+	headState.SetState(addr, EIP1967ImplementationSlot, impl.Hash())
+	headState.SetCode(impl, implCode)
+
+	var check PredeployCheck
+	require.Empty(t, verifyPredeploy(headState, "L1Block", addr, &PredeployExpectation{}, proxyCode, &check))
+	require.Equal(t, impl, *check.Implementation)
+
+	wrongHash := common.Hash{1}
+	deviations := verifyPredeploy(headState, "L1Block", addr, &PredeployExpectation{
+		CodeHash: &wrongHash,
+		Storage:  map[common.Hash]common.Hash{{}: {31: 1}},
+	}, proxyCode, &check)
+	require.Len(t, deviations, 2)
+
+	headState.SetState(addr, EIP1967AdminSlot, common.Hash{})
+	headState.SetCode(impl, []byte{0x00})
+	require.Len(t, verifyPredeploy(headState, "L1Block", addr, &PredeployExpectation{}, proxyCode, &check), 2)
+}
+
+func TestInstallPredeploys(t *testing.T) {
+	ctx := context.Background()
+	headState, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	names := PredeployNames(false)
+	require.NotContains(t, names, "GovernanceToken")
+	require.Contains(t, PredeployNames(true), "GovernanceToken")
+
+	vaultCode := []byte{0x60, 0x01}
+	var out bytes.Buffer
+	deployed := immutables.DeploymentResults{"BaseFeeVault": vaultCode}
+	require.NoError(t, InstallPredeploys(names, EmbeddedPredeployCode, deployed, &out)(ctx, headState))
+	require.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), len(names))
+
+	proxyCode, err := bindings.GetDeployedBytecode("Proxy")
+	require.NoError(t, err)
+	for _, name := range names {
+		if name == "BaseFeeVault" {
+			continue
+		}
+		var check PredeployCheck
+		require.Empty(t, verifyPredeploy(headState, name, *predeploys.Predeploys[name], &PredeployExpectation{}, proxyCode, &check), name)
+	}
+	impl := common.HexToAddress("0xc0d3C0d3C0d3c0d3C0d3C0D3c0D3c0d3c0D30019")
+	require.Equal(t, impl.Hash(), headState.GetState(predeploys.BaseFeeVaultAddr, EIP1967ImplementationSlot))
+	require.Equal(t, vaultCode, headState.GetCode(impl))
+	require.Empty(t, headState.GetCode(predeploys.GovernanceTokenAddr))
+
+	require.ErrorContains(t, InstallPredeploys([]string{"Nope"}, EmbeddedPredeployCode, nil, io.Discard)(ctx, headState), "unknown predeploy")
+}
+
+func TestPredeployCodeDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "L1Block.sol"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "L1Block.sol", "L1Block.json"), []byte(`{"deployedBytecode":{"object":"0x6001"}}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Proxy.json"), []byte(`{"deployedBytecode":{"object":"0x6002"}}`), 0o644))
+	code := PredeployCodeDir(dir)
+	l1Block, err := code("L1Block")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x60, 0x01}, l1Block)
+	proxy, err := code("Proxy")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x60, 0x02}, proxy)
+	_, err = code("GasPriceOracle")
+	require.ErrorContains(t, err, "no artifact")
+}
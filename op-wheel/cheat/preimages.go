@@ -0,0 +1,74 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Preimage is a hashed secure-trie key, paired with the original key it was hashed from.
+type Preimage struct {
+	Hash     common.Hash   `json:"hash"`
+	Preimage hexutil.Bytes `json:"preimage"`
+	// Account is set if the pre-image belongs to a storage slot of an account, and left empty for account keys.
+	Account *common.Address `json:"account,omitempty"`
+}
+
+// ExportPreimages writes the pre-images of the given accounts, and all the storage keys of those accounts, as JSON lines.
+// Account pre-images are always known, since the address is given, but storage slot pre-images have to be looked up
+// in the pre-image table of the database, which is only populated if geth ran with pre-image recording enabled.
+// Missing pre-images are skipped. If verify is true, the export fails if any pre-image is missing from the database.
+func ExportPreimages(addresses []common.Address, w io.Writer, verify bool) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		db := headState.Database().DiskDB()
+		enc := json.NewEncoder(w)
+		missing := 0
+		for _, addr := range addresses {
+			addrHash := crypto.Keccak256Hash(addr[:])
+			if rawdb.ReadPreimage(db, addrHash) == nil {
+				missing += 1
+			}
+			if err := enc.Encode(Preimage{Hash: addrHash, Preimage: addr[:]}); err != nil {
+				return err
+			}
+			storage, err := headState.StorageTrie(addr)
+			if err != nil {
+				return fmt.Errorf("failed to open storage trie of addr %s: %w", addr, err)
+			}
+			if storage == nil { // no storage, no slot pre-images to export
+				continue
+			}
+			account := addr
+			iter := trie.NewIterator(storage.NodeIterator(nil))
+			for iter.Next() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				slotHash := common.BytesToHash(iter.Key)
+				preimage := rawdb.ReadPreimage(db, slotHash)
+				if preimage == nil {
+					missing += 1
+					continue
+				}
+				if err := enc.Encode(Preimage{Hash: slotHash, Preimage: preimage, Account: &account}); err != nil {
+					return err
+				}
+			}
+			if iter.Err != nil {
+				return fmt.Errorf("failed to iterate storage trie of addr %s: %w", addr, iter.Err)
+			}
+		}
+		if verify && missing > 0 {
+			return fmt.Errorf("pre-image table is incomplete: %d pre-images are missing", missing)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+var (
+	// EIP1967ImplementationSlot is bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1).
+	EIP1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	// EIP1967AdminSlot is bytes32(uint256(keccak256("eip1967.proxy.admin")) - 1).
+	EIP1967AdminSlot = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+	// EIP1967BeaconSlot is bytes32(uint256(keccak256("eip1967.proxy.beacon")) - 1).
+	EIP1967BeaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+)
+
+// ProxyOverride changes the EIP-1967 implementation and/or beacon of a proxy. Nil addresses are not changed.
+type ProxyOverride struct {
+	Implementation *common.Address
+	Beacon         *common.Address
+}
+
+// ProxySlotChange is a change of an EIP-1967 slot of a proxy.
+type ProxySlotChange struct {
+	Slot common.Hash    `json:"slot"`
+	Name string         `json:"name"`
+	Old  common.Address `json:"old"`
+	New  common.Address `json:"new"`
+}
+
+// changes lists the slots that the override changes.
+func (o *ProxyOverride) changes() []ProxySlotChange {
+	var out []ProxySlotChange
+	if o.Implementation != nil {
+		out = append(out, ProxySlotChange{Slot: EIP1967ImplementationSlot, Name: "implementation", New: *o.Implementation})
+	}
+	if o.Beacon != nil {
+		out = append(out, ProxySlotChange{Slot: EIP1967BeaconSlot, Name: "beacon", New: *o.Beacon})
+	}
+	return out
+}
+
+// Check verifies that the override changes anything, and that the proxy and the new targets have code,
+// with the given code getter.
+func (o *ProxyOverride) Check(proxy common.Address, getCode func(addr common.Address) ([]byte, error)) error {
+	changes := o.changes()
+	if len(changes) == 0 {
+		return fmt.Errorf("no new implementation or beacon given")
+	}
+	code, err := getCode(proxy)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("proxy %s has no code", proxy)
+	}
+	for _, c := range changes {
+		code, err := getCode(c.New)
+		if err != nil {
+			return err
+		}
+		if len(code) == 0 {
+			return fmt.Errorf("new %s %s has no code", c.Name, c.New)
+		}
+	}
+	return nil
+}
+
+// SetProxyImplementation writes the EIP-1967 implementation and/or beacon slot of the proxy,
+// and writes the changed slots with their old and new addresses as JSON.
+// The proxy and the new implementation and beacon must have code.
+func SetProxyImplementation(proxy common.Address, override *ProxyOverride, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if err := override.Check(proxy, func(addr common.Address) ([]byte, error) {
+			return headState.GetCode(addr), nil
+		}); err != nil {
+			return err
+		}
+		changes := override.changes()
+		for i, c := range changes {
+			changes[i].Old = common.BytesToAddress(headState.GetState(proxy, c.Slot).Bytes())
+			headState.SetState(proxy, c.Slot, common.BytesToHash(c.New[:]))
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+}
+
+// checkAdminSlot verifies that the current value of the admin slot is an address, so the slot is not used otherwise.
+// An empty slot is only accepted if allowEmpty is set, since the proxy may not use the EIP-1967 admin slot at all.
+func checkAdminSlot(proxy common.Address, value common.Hash, allowEmpty bool) error {
+	if value == (common.Hash{}) {
+		if allowEmpty {
+			return nil
+		}
+		return fmt.Errorf("admin slot of %s is empty, the proxy may not use the EIP-1967 admin slot", proxy)
+	}
+	if common.BytesToHash(value[12:]) != value {
+		return fmt.Errorf("admin slot of %s contains %s, which is not an address", proxy, value)
+	}
+	return nil
+}
+
+// SetProxyAdmin writes the EIP-1967 admin slot of the proxy, and writes the change as JSON.
+// The proxy must have code, and the admin slot must currently contain an address, see allowEmpty.
+// The new admin may be an account without code.
+func SetProxyAdmin(proxy common.Address, admin common.Address, allowEmpty bool, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if len(headState.GetCode(proxy)) == 0 {
+			return fmt.Errorf("proxy %s has no code", proxy)
+		}
+		old := headState.GetState(proxy, EIP1967AdminSlot)
+		if err := checkAdminSlot(proxy, old, allowEmpty); err != nil {
+			return err
+		}
+		headState.SetState(proxy, EIP1967AdminSlot, common.BytesToHash(admin[:]))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode([]ProxySlotChange{{Slot: EIP1967AdminSlot, Name: "admin", Old: common.BytesToAddress(old[:]), New: admin}})
+	}
+}
@@ -0,0 +1,64 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetProxyImplementation(t *testing.T) {
+	proxy, oldImpl, newImpl, beacon := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}, common.Address{0: 0xd}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	for _, addr := range []common.Address{proxy, oldImpl, newImpl, beacon} {
+		headState.SetCode(addr, []byte{0x60, 0x00})
+	}
+	headState.SetState(proxy, EIP1967ImplementationSlot, common.BytesToHash(oldImpl[:]))
+
+	var out bytes.Buffer
+	override := &ProxyOverride{Implementation: &newImpl, Beacon: &beacon}
+	require.NoError(t, SetProxyImplementation(proxy, override, &out)(context.Background(), headState))
+	var changes []ProxySlotChange
+	require.NoError(t, json.Unmarshal(out.Bytes(), &changes))
+	require.Equal(t, []ProxySlotChange{
+		{Slot: EIP1967ImplementationSlot, Name: "implementation", Old: oldImpl, New: newImpl},
+		{Slot: EIP1967BeaconSlot, Name: "beacon", New: beacon},
+	}, changes)
+	require.Equal(t, common.BytesToHash(newImpl[:]), headState.GetState(proxy, EIP1967ImplementationSlot))
+	require.Equal(t, common.BytesToHash(beacon[:]), headState.GetState(proxy, EIP1967BeaconSlot))
+
+	noCode := common.Address{0: 0xe}
+	err = SetProxyImplementation(proxy, &ProxyOverride{Implementation: &noCode}, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "has no code")
+	require.Equal(t, common.BytesToHash(newImpl[:]), headState.GetState(proxy, EIP1967ImplementationSlot))
+	err = SetProxyImplementation(proxy, &ProxyOverride{}, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "no new implementation or beacon")
+}
+
+func TestSetProxyAdmin(t *testing.T) {
+	proxy, oldAdmin, newAdmin := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetCode(proxy, []byte{0x60, 0x00})
+
+	var out bytes.Buffer
+	err = SetProxyAdmin(proxy, newAdmin, false, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "is empty")
+	headState.SetState(proxy, EIP1967AdminSlot, common.Hash{0: 1})
+	err = SetProxyAdmin(proxy, newAdmin, false, &out)(context.Background(), headState)
+	require.ErrorContains(t, err, "which is not an address")
+
+	headState.SetState(proxy, EIP1967AdminSlot, common.BytesToHash(oldAdmin[:]))
+	require.NoError(t, SetProxyAdmin(proxy, newAdmin, false, &out)(context.Background(), headState))
+	var changes []ProxySlotChange
+	require.NoError(t, json.Unmarshal(out.Bytes(), &changes))
+	require.Equal(t, []ProxySlotChange{{Slot: EIP1967AdminSlot, Name: "admin", Old: oldAdmin, New: newAdmin}}, changes)
+	require.Equal(t, common.BytesToHash(newAdmin[:]), headState.GetState(proxy, EIP1967AdminSlot))
+}
@@ -0,0 +1,100 @@
+package cheat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// RedactConfig lists the sensitive addresses and storage slots to redact from dumps,
+// e.g. to share production-derived state with external auditors.
+type RedactConfig struct {
+	// Addresses are redacted as account of the dump, and as storage value, left-padded like Solidity stores addresses.
+	Addresses []common.Address `json:"addresses,omitempty"`
+	// Slots are the storage slots to redact the values of, by account.
+	Slots map[common.Address][]common.Hash `json:"slots,omitempty"`
+}
+
+// ReadRedactConfig reads a redact config from a JSON file.
+func ReadRedactConfig(path string) (*RedactConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redact config: %w", err)
+	}
+	var cfg RedactConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode redact config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Redactor redacts the values of a RedactConfig. A nil Redactor does not redact anything.
+// Values are replaced by their keccak256 hash, so equal values stay recognizable, and addresses by a pseudonym address,
+// the last 20 bytes of the hash of the address. With zero set, values and addresses are zeroed out instead,
+// and the accounts of the addresses are left out of the dump.
+// Hashes of values with little entropy, e.g. small numbers, can be reversed by guessing: zero these out instead.
+type Redactor struct {
+	zero  bool
+	addrs map[common.Address]struct{}
+	// slots of each account, by hashed key, since the storage tries only know the hashed keys.
+	slots map[common.Address]map[common.Hash]struct{}
+}
+
+func NewRedactor(cfg *RedactConfig, zero bool) *Redactor {
+	r := &Redactor{
+		zero:  zero,
+		addrs: make(map[common.Address]struct{}, len(cfg.Addresses)),
+		slots: make(map[common.Address]map[common.Hash]struct{}, len(cfg.Slots)),
+	}
+	for _, addr := range cfg.Addresses {
+		r.addrs[addr] = struct{}{}
+	}
+	for addr, keys := range cfg.Slots {
+		hashed := make(map[common.Hash]struct{}, len(keys))
+		for _, key := range keys {
+			hashed[crypto.Keccak256Hash(key[:])] = struct{}{}
+		}
+		r.slots[addr] = hashed
+	}
+	return r
+}
+
+// Account returns the address to dump the account of the given address as, and false if the account is left out.
+func (r *Redactor) Account(addr common.Address) (common.Address, bool) {
+	if r == nil {
+		return addr, true
+	}
+	if _, ok := r.addrs[addr]; !ok {
+		return addr, true
+	}
+	if r.zero {
+		return common.Address{}, false
+	}
+	return r.pseudonym(addr), true
+}
+
+// Value returns the value to dump for the storage slot of the given account, by hashed storage key.
+func (r *Redactor) Value(addr common.Address, hashedKey common.Hash, value common.Hash) common.Hash {
+	if r == nil || value == (common.Hash{}) {
+		return value
+	}
+	if _, ok := r.slots[addr][hashedKey]; ok {
+		if r.zero {
+			return common.Hash{}
+		}
+		return crypto.Keccak256Hash(value[:])
+	}
+	// a redacted address as value gets the pseudonym of its account, or is zeroed out
+	if common.BytesToHash(value[:common.HashLength-common.AddressLength]) == (common.Hash{}) {
+		a, _ := r.Account(common.BytesToAddress(value[:]))
+		return common.BytesToHash(a[:])
+	}
+	return value
+}
+
+func (r *Redactor) pseudonym(addr common.Address) common.Address {
+	return common.BytesToAddress(crypto.Keccak256(addr[:]))
+}
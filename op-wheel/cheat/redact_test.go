@@ -0,0 +1,65 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactDump(t *testing.T) {
+	ctx := context.Background()
+	owner, contract := common.Address{0: 0xa}, common.Address{0: 0xb}
+	secret, ownerSlot, public := common.Hash{31: 1}, common.Hash{31: 2}, common.Hash{31: 3}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetBalance(owner, big.NewInt(42))
+	headState.SetNonce(contract, 1)
+	headState.SetState(contract, secret, common.Hash{0: 0xde, 31: 0xad})
+	headState.SetState(contract, ownerSlot, common.BytesToHash(owner[:]))
+	headState.SetState(contract, public, common.Hash{31: 7})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "redact.json")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`{"addresses": ["%s"], "slots": {"%s": ["%s"]}}`, owner, contract, secret)), 0o644))
+	cfg, err := ReadRedactConfig(path)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, DumpAlloc(&out, NewRedactor(cfg, false))(ctx, headState))
+	var dumped core.GenesisAlloc
+	require.NoError(t, json.Unmarshal(out.Bytes(), &dumped))
+	pseudonym := common.BytesToAddress(crypto.Keccak256(owner[:]))
+	require.Len(t, dumped, 2)
+	require.Equal(t, big.NewInt(42), dumped[pseudonym].Balance)
+	require.Equal(t, crypto.Keccak256Hash(common.Hash{0: 0xde, 31: 0xad}.Bytes()), dumped[contract].Storage[secret])
+	require.Equal(t, common.BytesToHash(pseudonym[:]), dumped[contract].Storage[ownerSlot])
+	require.Equal(t, common.Hash{31: 7}, dumped[contract].Storage[public])
+
+	out.Reset()
+	require.NoError(t, DumpAlloc(&out, NewRedactor(cfg, true))(ctx, headState))
+	dumped = nil
+	require.NoError(t, json.Unmarshal(out.Bytes(), &dumped))
+	require.Len(t, dumped, 1)
+	require.Equal(t, common.Hash{}, dumped[contract].Storage[secret])
+	require.Equal(t, common.Hash{}, dumped[contract].Storage[ownerSlot])
+	require.Equal(t, common.Hash{31: 7}, dumped[contract].Storage[public])
+
+	out.Reset()
+	require.NoError(t, StorageReadAll(contract, &out, NewRedactor(cfg, true))(ctx, headState))
+	require.Contains(t, out.String(), fmt.Sprintf("+ %x = %x\n", crypto.Keccak256(secret[:]), common.Hash{}))
+	require.Contains(t, out.String(), fmt.Sprintf("+ %x = %x\n", crypto.Keccak256(public[:]), common.Hash{31: 7}))
+}
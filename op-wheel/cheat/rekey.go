@@ -0,0 +1,149 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// KeyMapping maps a storage key to the key it moves to, see StorageRekey.
+type KeyMapping func(key common.Hash) common.Hash
+
+// XORKeys maps keys by XOR-ing them with the given mask.
+func XORKeys(mask common.Hash) KeyMapping {
+	return func(key common.Hash) (out common.Hash) {
+		for i := range key {
+			out[i] = key[i] ^ mask[i]
+		}
+		return out
+	}
+}
+
+// OffsetKeys maps keys by adding the given offset, which may be negative, modulo 2**256.
+func OffsetKeys(offset *big.Int) KeyMapping {
+	mod := new(big.Int).Lsh(big.NewInt(1), 256)
+	return func(key common.Hash) common.Hash {
+		v := new(big.Int).Add(key.Big(), offset)
+		return common.BigToHash(v.Mod(v, mod))
+	}
+}
+
+// RekeyConfig configures a storage key transformation, see StorageRekey.
+type RekeyConfig struct {
+	Address common.Address
+	Mapping KeyMapping
+	// Start and End bound the keys to move: Start is inclusive, End is exclusive.
+	// A zero End moves all keys from Start onwards.
+	Start common.Hash
+	End   common.Hash
+	// Preview only writes the moves and collisions, without changing the storage.
+	Preview bool
+	// Overwrite allows moves to overwrite existing keys that are not moved themselves.
+	Overwrite bool
+}
+
+func (cfg *RekeyConfig) inRange(key common.Hash) bool {
+	if key.Big().Cmp(cfg.Start.Big()) < 0 {
+		return false
+	}
+	return cfg.End == (common.Hash{}) || key.Big().Cmp(cfg.End.Big()) < 0
+}
+
+// StorageRekey moves storage values of an account to new keys, as given by the key mapping,
+// e.g. to shift the base slot of a struct after a contract upgrade.
+// All moves are written to w, with the existing values they collide with.
+// A move collides if it targets a key with a non-zero value that is not moved itself.
+// Collisions are an error, unless Overwrite is set.
+// All keys of the storage need a known pre-image, since the trie stores hashed keys only.
+func StorageRekey(cfg *RekeyConfig, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		storage, err := headState.StorageTrie(cfg.Address)
+		if err != nil {
+			return fmt.Errorf("failed to open storage trie of addr %s: %w", cfg.Address, err)
+		}
+		if storage == nil {
+			return fmt.Errorf("no storage trie in state for account %s", cfg.Address)
+		}
+		db := headState.Database().DiskDB()
+		values := make(map[common.Hash]common.Hash)
+		var keys []common.Hash
+		unknown := 0
+		iter := trie.NewIterator(storage.NodeIterator(nil))
+		for iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key, ok := storageKeyPreimage(storage, db, iter.Key)
+			if !ok {
+				unknown += 1
+				continue
+			}
+			values[key] = dbValueToHash(iter.Value)
+			keys = append(keys, key)
+		}
+		if unknown > 0 {
+			return fmt.Errorf("%d storage keys of %s have an unknown pre-image, cannot determine which keys to move", unknown, cfg.Address)
+		}
+
+		moved := make(map[common.Hash]common.Hash) // source key -> target key
+		for _, key := range keys {
+			if !cfg.inRange(key) {
+				continue
+			}
+			if target := cfg.Mapping(key); target != key {
+				moved[key] = target
+			}
+		}
+		targets := make(map[common.Hash]struct{}, len(moved))
+		collisions := 0
+		for _, key := range keys {
+			target, ok := moved[key]
+			if !ok {
+				continue
+			}
+			if _, ok := targets[target]; ok {
+				return fmt.Errorf("key mapping is not one-to-one, multiple keys move to %s", target)
+			}
+			targets[target] = struct{}{}
+			line := fmt.Sprintf("%s -> %s = %s", key, target, values[key])
+			if existing, ok := values[target]; ok {
+				if _, alsoMoved := moved[target]; !alsoMoved {
+					collisions += 1
+					line += fmt.Sprintf(" (collides with existing value %s)", existing)
+				}
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# %d keys to move, %d collisions\n", len(moved), collisions); err != nil {
+			return err
+		}
+		if cfg.Preview {
+			return nil
+		}
+		if collisions > 0 && !cfg.Overwrite {
+			return fmt.Errorf("%d moves collide with existing keys, allow overwrites to move anyway", collisions)
+		}
+		// clear all sources first, so moves into keys that are moved themselves do not get lost
+		for key := range moved {
+			headState.SetState(cfg.Address, key, common.Hash{})
+		}
+		i := 0
+		for key, target := range moved {
+			headState.SetState(cfg.Address, target, values[key])
+			i += 1
+			if i%1000 == 0 { // for every 1000 values, commit to disk
+				if _, err := headState.Commit(true); err != nil {
+					return fmt.Errorf("failed to commit state to disk after moving %d keys: %w", i, err)
+				}
+			}
+		}
+		return nil
+	}
+}
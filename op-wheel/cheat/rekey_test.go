@@ -0,0 +1,60 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyMappings(t *testing.T) {
+	require.Equal(t, common.Hash{31: 0x13}, OffsetKeys(big.NewInt(3))(common.Hash{31: 0x10}))
+	require.Equal(t, common.Hash{31: 0x0d}, OffsetKeys(big.NewInt(-3))(common.Hash{31: 0x10}))
+	require.Equal(t, common.Hash{}, OffsetKeys(big.NewInt(1))(common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")))
+	require.Equal(t, common.Hash{0: 0xff, 31: 0x01}, XORKeys(common.Hash{0: 0xff})(common.Hash{31: 0x01}))
+}
+
+func TestStorageRekey(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	newState := func(t *testing.T) *state.StateDB {
+		headState := newTestState(t)
+		headState.SetNonce(addr, 1)
+		for i := byte(1); i <= 4; i++ {
+			headState.SetState(addr, common.Hash{31: i}, common.Hash{31: 0x10 + i})
+		}
+		_, err := headState.Commit(true)
+		require.NoError(t, err)
+		return headState
+	}
+	slot := func(headState *state.StateDB, i byte) common.Hash {
+		return headState.GetState(addr, common.Hash{31: i})
+	}
+
+	t.Run("shift", func(t *testing.T) {
+		headState := newState(t)
+		// slots 2 and 3 move up by one, 3 moves into 4, which is not moved
+		cfg := &RekeyConfig{Address: addr, Mapping: OffsetKeys(big.NewInt(1)), Start: common.Hash{31: 2}, End: common.Hash{31: 4}}
+		var out bytes.Buffer
+		require.ErrorContains(t, StorageRekey(cfg, &out)(context.Background(), headState), "1 moves collide")
+		require.Contains(t, out.String(), "collides with existing value")
+
+		cfg.Overwrite = true
+		require.NoError(t, StorageRekey(cfg, &out)(context.Background(), headState))
+		require.Equal(t, common.Hash{31: 0x11}, slot(headState, 1))
+		require.Equal(t, common.Hash{}, slot(headState, 2))
+		require.Equal(t, common.Hash{31: 0x12}, slot(headState, 3))
+		require.Equal(t, common.Hash{31: 0x13}, slot(headState, 4))
+	})
+	t.Run("preview", func(t *testing.T) {
+		headState := newState(t)
+		cfg := &RekeyConfig{Address: addr, Mapping: XORKeys(common.Hash{0: 0x01}), Preview: true}
+		var out bytes.Buffer
+		require.NoError(t, StorageRekey(cfg, &out)(context.Background(), headState))
+		require.Contains(t, out.String(), "# 4 keys to move, 0 collisions")
+		require.Equal(t, common.Hash{31: 0x11}, slot(headState, 1))
+	})
+}
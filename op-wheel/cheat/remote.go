@@ -0,0 +1,168 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// remoteStorageBatchSize is the number of storage slots that are fetched from the remote node per batch call.
+const remoteStorageBatchSize = 100
+
+// SlotDiff is a storage slot with a different value in the local and remote state.
+type SlotDiff struct {
+	Key    common.Hash `json:"key"`
+	Local  common.Hash `json:"local"`
+	Remote common.Hash `json:"remote"`
+}
+
+// RemoteDiffReport lists the divergences of an account between the local and the remote state.
+type RemoteDiffReport struct {
+	Address common.Address `json:"address"`
+	Block   uint64         `json:"block"`
+	// Divergences describes the differences in the account fields, and the storage root.
+	Divergences []string   `json:"divergences,omitempty"`
+	Slots       []SlotDiff `json:"slots,omitempty"`
+	// UnknownSlots is the number of local storage slots that could not be compared,
+	// since the pre-image of their key is not in the database.
+	UnknownSlots int `json:"unknownSlots,omitempty"`
+}
+
+// RemoteDiff compares the account in the local head state against the view of a live node at the given block,
+// with eth_getProof, and writes the divergences as JSON to the given writer.
+// If the storage roots differ, the local storage slots are compared one by one with eth_getStorageAt,
+// which requires the pre-images of the storage keys. Slots that only exist in the remote state cannot be enumerated,
+// these, and slots without known pre-image, can be compared by listing them in slots.
+func RemoteDiff(remote client.RPC, addr common.Address, block uint64, slots []common.Hash, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		blockTag := hexutil.Uint64(block).String()
+		var res eth.AccountResult
+		if err := remote.CallContext(ctx, &res, "eth_getProof", addr, []common.Hash{}, blockTag); err != nil {
+			return fmt.Errorf("failed to get remote account %s at block %d: %w", addr, block, err)
+		}
+		report := &RemoteDiffReport{Address: addr, Block: block}
+		diverge := func(field string, local, remote any) {
+			report.Divergences = append(report.Divergences, fmt.Sprintf("%s: local %v, remote %v", field, local, remote))
+		}
+		if local, remote := headState.GetBalance(addr), (*big.Int)(res.Balance); local.Cmp(remote) != 0 {
+			diverge("balance", local, remote)
+		}
+		if local, remote := headState.GetNonce(addr), uint64(res.Nonce); local != remote {
+			diverge("nonce", local, remote)
+		}
+		localCodeHash := headState.GetCodeHash(addr)
+		if localCodeHash == (common.Hash{}) { // non-existent account
+			localCodeHash = types.EmptyCodeHash
+		}
+		if localCodeHash != res.CodeHash {
+			diverge("codeHash", localCodeHash, res.CodeHash)
+		}
+		localRoot := types.EmptyRootHash
+		storage, err := headState.StorageTrie(addr)
+		if err != nil {
+			return fmt.Errorf("failed to open storage trie of addr %s: %w", addr, err)
+		}
+		if storage != nil {
+			localRoot = storage.Hash()
+		}
+		if localRoot != res.StorageHash {
+			diverge("storageHash", localRoot, res.StorageHash)
+			if err := diffRemoteStorage(ctx, remote, headState, storage, addr, slots, blockTag, report); err != nil {
+				return err
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+}
+
+// diffRemoteStorage compares the given slots, and the local storage slots with known pre-image, against the remote storage.
+// The local storage trie is nil if the account has no local storage.
+func diffRemoteStorage(ctx context.Context, remote client.RPC, headState *state.StateDB, storage state.Trie, addr common.Address,
+	slots []common.Hash, blockTag string, report *RemoteDiffReport) error {
+	db := headState.Database().DiskDB()
+	var keys []common.Hash
+	var values []common.Hash
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		results := make([]common.Hash, len(keys))
+		batch := make([]rpc.BatchElem, len(keys))
+		for i, key := range keys {
+			batch[i] = rpc.BatchElem{Method: "eth_getStorageAt", Args: []any{addr, key, blockTag}, Result: &results[i]}
+		}
+		if err := remote.BatchCallContext(ctx, batch); err != nil {
+			return fmt.Errorf("failed to get remote storage: %w", err)
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return fmt.Errorf("failed to get remote storage slot %s: %w", keys[i], elem.Error)
+			}
+			if results[i] != values[i] {
+				report.Slots = append(report.Slots, SlotDiff{Key: keys[i], Local: values[i], Remote: results[i]})
+			}
+		}
+		keys, values = keys[:0], values[:0]
+		return nil
+	}
+	// hashed keys of the given slots, which are not compared again, and do not need a pre-image
+	compared := make(map[common.Hash]struct{}, len(slots))
+	for _, key := range slots {
+		keyHash := crypto.Keccak256Hash(key[:])
+		if _, ok := compared[keyHash]; ok {
+			continue
+		}
+		compared[keyHash] = struct{}{}
+		keys = append(keys, key)
+		values = append(values, headState.GetState(addr, key))
+		if len(keys) == remoteStorageBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if storage == nil {
+		return flush()
+	}
+	iter := trie.NewIterator(storage.NodeIterator(nil))
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, ok := compared[common.BytesToHash(iter.Key)]; ok {
+			continue
+		}
+		preimage := rawdb.ReadPreimage(db, common.BytesToHash(iter.Key))
+		if len(preimage) != common.HashLength {
+			report.UnknownSlots += 1
+			continue
+		}
+		keys = append(keys, common.BytesToHash(preimage))
+		values = append(values, dbValueToHash(iter.Value))
+		if len(keys) == remoteStorageBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if iter.Err != nil {
+		return fmt.Errorf("failed to iterate storage trie of addr %s: %w", addr, iter.Err)
+	}
+	return flush()
+}
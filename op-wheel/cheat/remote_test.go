@@ -0,0 +1,86 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// fakeRemote serves eth_getProof and eth_getStorageAt of a single account.
+type fakeRemote struct {
+	account eth.AccountResult
+	storage map[common.Hash]common.Hash
+}
+
+func (f *fakeRemote) Close() {}
+
+func (f *fakeRemote) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	*result.(*eth.AccountResult) = f.account
+	return nil
+}
+
+func (f *fakeRemote) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for _, elem := range b {
+		*elem.Result.(*common.Hash) = f.storage[elem.Args[1].(common.Hash)]
+	}
+	return nil
+}
+
+func (f *fakeRemote) EthSubscribe(ctx context.Context, channel any, args ...any) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestRemoteDiff(t *testing.T) {
+	diskDB := rawdb.NewMemoryDatabase()
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(diskDB), nil)
+	require.NoError(t, err)
+	addr := common.Address{0xa}
+	headState.SetBalance(addr, big.NewInt(1))
+	headState.SetState(addr, common.Hash{1}, common.Hash{0x11})
+	headState.SetState(addr, common.Hash{2}, common.Hash{0x22})
+	headState.SetState(addr, common.Hash{4}, common.Hash{0x44})
+	headState.IntermediateRoot(true)
+	// only the pre-image of slot 2 is known, slot 1 is listed explicitly, and slot 4 cannot be compared
+	key2 := common.Hash{2}
+	rawdb.WritePreimages(diskDB, map[common.Hash][]byte{crypto.Keccak256Hash(key2[:]): key2[:]})
+
+	remote := &fakeRemote{
+		account: eth.AccountResult{
+			Balance:     (*hexutil.Big)(big.NewInt(2)),
+			CodeHash:    types.EmptyCodeHash,
+			StorageHash: common.Hash{0xff},
+		},
+		storage: map[common.Hash]common.Hash{
+			{1}: {0x11},
+			{3}: {0x33},
+		},
+	}
+	var out bytes.Buffer
+	err = RemoteDiff(remote, addr, 1, []common.Hash{{1}, {3}}, &out)(context.Background(), headState)
+	require.NoError(t, err)
+	var report RemoteDiffReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Divergences, 2)
+	require.Contains(t, report.Divergences[0], "balance")
+	require.Contains(t, report.Divergences[1], "storageHash")
+	require.Equal(t, []SlotDiff{
+		{Key: common.Hash{3}, Local: common.Hash{}, Remote: common.Hash{0x33}},
+		{Key: common.Hash{2}, Local: common.Hash{0x22}, Remote: common.Hash{}},
+	}, report.Slots)
+	require.Equal(t, 1, report.UnknownSlots)
+}
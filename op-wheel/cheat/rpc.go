@@ -0,0 +1,170 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// RPCCheater modifies the state of a running node through its dev RPC namespace,
+// so the node does not have to be stopped to open its database.
+// The node must expose <namespace>_setBalance, <namespace>_setCode, <namespace>_setNonce
+// and <namespace>_setStorageAt, as implemented by e.g. the debug namespace of a dev node,
+// or the anvil and hardhat namespaces of the respective dev nodes.
+type RPCCheater struct {
+	Client    client.RPC
+	Namespace string
+}
+
+func NewRPCCheater(client client.RPC, namespace string) *RPCCheater {
+	return &RPCCheater{Client: client, Namespace: namespace}
+}
+
+func (ch *RPCCheater) call(ctx context.Context, method string, args ...any) error {
+	method = ch.Namespace + "_" + method
+	if err := ch.Client.CallContext(ctx, nil, method, args...); err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	return nil
+}
+
+func (ch *RPCCheater) SetBalance(ctx context.Context, addr common.Address, amount *big.Int) error {
+	return ch.call(ctx, "setBalance", addr, (*hexutil.Big)(amount))
+}
+
+func (ch *RPCCheater) SetCode(ctx context.Context, addr common.Address, code hexutil.Bytes) error {
+	return ch.call(ctx, "setCode", addr, code)
+}
+
+// CopyCode sets the code of the to account to the latest code of the from account.
+func (ch *RPCCheater) CopyCode(ctx context.Context, from, to common.Address) error {
+	var code hexutil.Bytes
+	if err := ch.Client.CallContext(ctx, &code, "eth_getCode", from, "latest"); err != nil {
+		return fmt.Errorf("failed to get code of %s: %w", from, err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("account %s has no code to copy", from)
+	}
+	return ch.SetCode(ctx, to, code)
+}
+
+func (ch *RPCCheater) SetNonce(ctx context.Context, addr common.Address, nonce uint64) error {
+	return ch.call(ctx, "setNonce", addr, hexutil.Uint64(nonce))
+}
+
+func (ch *RPCCheater) StorageSet(ctx context.Context, addr common.Address, key common.Hash, value common.Hash) error {
+	return ch.call(ctx, "setStorageAt", addr, key, value)
+}
+
+// StoragePatch applies a storage patch, see the StoragePatch HeadFn for the format, one slot at a time.
+// The preconditions of the patch are checked against the latest state first.
+// The patch is not atomic: if a slot fails to apply, the slots before it remain changed,
+// and the storage may change between the checks and the writes.
+func (ch *RPCCheater) StoragePatch(ctx context.Context, patch io.Reader, addr common.Address) error {
+	entries, err := ReadStoragePatch(ctx, patch)
+	if err != nil {
+		return err
+	}
+	if err := CheckPatchPreconditions(entries, func(key common.Hash) (common.Hash, error) {
+		var value common.Hash
+		err := ch.Client.CallContext(ctx, &value, "eth_getStorageAt", addr, key, "latest")
+		return value, err
+	}); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ch.StorageSet(ctx, addr, entry.Key, entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetProxyImplementation writes the EIP-1967 implementation and/or beacon slot of the proxy,
+// see the SetProxyImplementation HeadFn. The old and new addresses are written as JSON.
+func (ch *RPCCheater) SetProxyImplementation(ctx context.Context, proxy common.Address, override *ProxyOverride, w io.Writer) error {
+	if err := override.Check(proxy, func(addr common.Address) ([]byte, error) {
+		var code hexutil.Bytes
+		if err := ch.Client.CallContext(ctx, &code, "eth_getCode", addr, "latest"); err != nil {
+			return nil, fmt.Errorf("failed to get code of %s: %w", addr, err)
+		}
+		return code, nil
+	}); err != nil {
+		return err
+	}
+	changes := override.changes()
+	for i, c := range changes {
+		var old common.Hash
+		if err := ch.Client.CallContext(ctx, &old, "eth_getStorageAt", proxy, c.Slot, "latest"); err != nil {
+			return fmt.Errorf("failed to get %s slot of %s: %w", c.Name, proxy, err)
+		}
+		changes[i].Old = common.BytesToAddress(old.Bytes())
+		if err := ch.StorageSet(ctx, proxy, c.Slot, common.BytesToHash(c.New[:])); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(changes)
+}
+
+// SetProxyAdmin writes the EIP-1967 admin slot of the proxy, see the SetProxyAdmin HeadFn.
+func (ch *RPCCheater) SetProxyAdmin(ctx context.Context, proxy common.Address, admin common.Address, allowEmpty bool, w io.Writer) error {
+	var code hexutil.Bytes
+	if err := ch.Client.CallContext(ctx, &code, "eth_getCode", proxy, "latest"); err != nil {
+		return fmt.Errorf("failed to get code of %s: %w", proxy, err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("proxy %s has no code", proxy)
+	}
+	var old common.Hash
+	if err := ch.Client.CallContext(ctx, &old, "eth_getStorageAt", proxy, EIP1967AdminSlot, "latest"); err != nil {
+		return fmt.Errorf("failed to get admin slot of %s: %w", proxy, err)
+	}
+	if err := checkAdminSlot(proxy, old, allowEmpty); err != nil {
+		return err
+	}
+	if err := ch.StorageSet(ctx, proxy, EIP1967AdminSlot, common.BytesToHash(admin[:])); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode([]ProxySlotChange{{Slot: EIP1967AdminSlot, Name: "admin", Old: common.BytesToAddress(old[:]), New: admin}})
+}
+
+// ApplyScript applies the steps of a cheat script in order, see the ApplyScript HeadFn.
+// Only the balance, nonce, code and storage ops are supported over RPC, which is checked before any step is applied.
+// The script is not atomic: if a step fails, the steps before it remain applied.
+func (ch *RPCCheater) ApplyScript(ctx context.Context, script *CheatScript) error {
+	for i, step := range script.Steps {
+		switch step.Op {
+		case "balance", "nonce", "code", "storage":
+		default:
+			return fmt.Errorf("step %d: op %s is not supported over RPC", i, step.Op)
+		}
+	}
+	for i, step := range script.Steps {
+		var err error
+		switch step.Op {
+		case "balance":
+			err = ch.SetBalance(ctx, step.Address, (*big.Int)(step.Value))
+		case "nonce":
+			err = ch.SetNonce(ctx, step.Address, (*big.Int)(step.Value).Uint64())
+		case "code":
+			err = ch.SetCode(ctx, step.Address, *step.Code)
+		case "storage":
+			err = ch.StorageSet(ctx, step.Address, common.BigToHash((*big.Int)(step.Key)), common.BigToHash((*big.Int)(step.Value)))
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s %s): %w", i, step.Op, step.Address, err)
+		}
+	}
+	return nil
+}
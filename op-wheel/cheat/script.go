@@ -0,0 +1,131 @@
+package cheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/state"
+	"gopkg.in/yaml.v3"
+)
+
+// CheatScript is a list of cheats, that are applied in order as a single change to the head state.
+type CheatScript struct {
+	Steps []ScriptStep `json:"steps"`
+}
+
+// ScriptStep is a single cheat of a CheatScript. Op selects the cheat, the other fields are its arguments:
+//   - balance: set the balance of the account to Value.
+//   - nonce: set the nonce of the account to Value.
+//   - code: set the code of the account to Code.
+//   - storage: set the storage slot Key of the account to Value.
+//   - storage-clear: delete all storage of the account.
+//   - delete: delete the account.
+//
+// Key and Value are decimal or hex numbers, so storage slots and values can be given as 32-byte hashes or as numbers.
+type ScriptStep struct {
+	Op      string                `json:"op"`
+	Address common.Address        `json:"address"`
+	Key     *math.HexOrDecimal256 `json:"key,omitempty"`
+	Value   *math.HexOrDecimal256 `json:"value,omitempty"`
+	Code    *hexutil.Bytes        `json:"code,omitempty"`
+}
+
+// HeadFn returns the cheat of the step, after checking that the step has the arguments of its op.
+func (s *ScriptStep) HeadFn() (HeadFn, error) {
+	var value *big.Int
+	if s.Value != nil {
+		value = (*big.Int)(s.Value)
+		if value.Sign() < 0 || value.BitLen() > 256 {
+			return nil, fmt.Errorf("value %s does not fit a uint256", value)
+		}
+	}
+	require := func(name string, ok bool) error {
+		if !ok {
+			return fmt.Errorf("op %s requires %s", s.Op, name)
+		}
+		return nil
+	}
+	switch s.Op {
+	case "balance":
+		if err := require("value", value != nil); err != nil {
+			return nil, err
+		}
+		return SetBalance(s.Address, value), nil
+	case "nonce":
+		if err := require("value", value != nil); err != nil {
+			return nil, err
+		}
+		if !value.IsUint64() {
+			return nil, fmt.Errorf("nonce %s does not fit a uint64", value)
+		}
+		return SetNonce(s.Address, value.Uint64()), nil
+	case "code":
+		if err := require("code", s.Code != nil); err != nil {
+			return nil, err
+		}
+		return SetCode(s.Address, *s.Code), nil
+	case "storage":
+		if err := require("key and value", s.Key != nil && value != nil); err != nil {
+			return nil, err
+		}
+		return StorageSet(s.Address, common.BigToHash((*big.Int)(s.Key)), common.BigToHash(value)), nil
+	case "storage-clear":
+		return StorageClear(s.Address), nil
+	case "delete":
+		return DeleteAccount(s.Address), nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", s.Op)
+	}
+}
+
+// ReadCheatScript parses a YAML or JSON cheat script, and checks the arguments of all steps.
+// Numbers can be decimal or 0x-prefixed hex, also if they are not quoted in YAML.
+func ReadCheatScript(r io.Reader) (*CheatScript, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse script: %w", err)
+	}
+	// YAML resolves unquoted hex and decimal numbers to integers, which would lose leading zeroes and large values,
+	// so the scalars are converted to JSON as written, and decoded with the text encoding of the step fields.
+	data, err := json.Marshal(yamlToJSON(&doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert script: %w", err)
+	}
+	var script CheatScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to decode script: %w", err)
+	}
+	for i := range script.Steps {
+		if _, err := script.Steps[i].HeadFn(); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	return &script, nil
+}
+
+// ApplyScript applies the steps of the script in order, as a single change to the head state.
+// If any step fails, none of the changes are persisted.
+func ApplyScript(script *CheatScript) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		for i := range script.Steps {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			step := &script.Steps[i]
+			fn, err := step.HeadFn()
+			if err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+			if err := fn(ctx, headState); err != nil {
+				return fmt.Errorf("step %d (%s %s): %w", i, step.Op, step.Address, err)
+			}
+		}
+		return nil
+	}
+}
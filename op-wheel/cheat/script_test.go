@@ -0,0 +1,56 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyScript(t *testing.T) {
+	script, err := ReadCheatScript(strings.NewReader(`
+steps:
+  - op: balance
+    address: 0x000000000000000000000000000000000000000a
+    value: 1000000000000000000000
+  - op: nonce
+    address: 0x000000000000000000000000000000000000000a
+    value: 0x10
+  - op: code
+    address: 0x000000000000000000000000000000000000000b
+    code: 0x6000
+  - op: storage
+    address: 0x000000000000000000000000000000000000000b
+    key: 0x01
+    value: 0x0000000000000000000000000000000000000000000000000000000000000042
+  - op: delete
+    address: 0x000000000000000000000000000000000000000c
+`))
+	require.NoError(t, err)
+	require.Len(t, script.Steps, 5)
+
+	addrA, addrB, addrC := common.Address{19: 0xa}, common.Address{19: 0xb}, common.Address{19: 0xc}
+	headState := newTestState(t)
+	headState.SetNonce(addrC, 1)
+	require.NoError(t, ApplyScript(script)(context.Background(), headState))
+	balance, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	require.Equal(t, balance, headState.GetBalance(addrA))
+	require.Equal(t, uint64(16), headState.GetNonce(addrA))
+	require.Equal(t, []byte{0x60, 0x00}, headState.GetCode(addrB))
+	require.Equal(t, common.Hash{31: 0x42}, headState.GetState(addrB, common.Hash{31: 1}))
+	require.False(t, headState.Exist(addrC))
+}
+
+func TestReadCheatScriptJSON(t *testing.T) {
+	script, err := ReadCheatScript(strings.NewReader(`{"steps": [{"op": "nonce", "address": "0x000000000000000000000000000000000000000a", "value": 3}]}`))
+	require.NoError(t, err)
+	require.Equal(t, "nonce", script.Steps[0].Op)
+
+	_, err = ReadCheatScript(strings.NewReader(`{"steps": [{"op": "nonce", "address": "0x000000000000000000000000000000000000000a"}]}`))
+	require.ErrorContains(t, err, "step 0: op nonce requires value")
+	_, err = ReadCheatScript(strings.NewReader(`{"steps": [{"op": "selfdestruct", "address": "0x000000000000000000000000000000000000000a"}]}`))
+	require.ErrorContains(t, err, `unknown op "selfdestruct"`)
+}
@@ -0,0 +1,75 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// StorageMatch is a storage slot that contains the searched value, see StorageSearch.
+type StorageMatch struct {
+	// Key is the storage key, if its pre-image is known.
+	Key       *common.Hash `json:"key,omitempty"`
+	HashedKey common.Hash  `json:"hashedKey"`
+	Value     common.Hash  `json:"value"`
+	// Offset is the number of bytes after the value in the slot, like the offset of a variable that Solidity packs into a slot.
+	Offset int `json:"offset"`
+}
+
+// StorageSearch iterates the storage trie of the given account, and writes each slot that contains the value as JSON line,
+// e.g. to find where a parameter lives before patching it. A value shorter than 32 bytes, e.g. an address,
+// is left-padded to 32 bytes, like Solidity stores it. If packed is set, the value is also found at any other offset
+// within a slot instead, where Solidity packs smaller variables together.
+func StorageSearch(address common.Address, value []byte, packed bool, w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		if len(value) == 0 || len(value) > common.HashLength {
+			return fmt.Errorf("value must be 1 to 32 bytes, got %d", len(value))
+		}
+		storage, err := headState.StorageTrie(address)
+		if err != nil {
+			return fmt.Errorf("failed to open storage trie of addr %s: %w", address, err)
+		}
+		if storage == nil {
+			return fmt.Errorf("no storage trie in state for account %s", address)
+		}
+		padded := common.BytesToHash(value)
+		db := headState.Database().DiskDB()
+		enc := json.NewEncoder(w)
+		iter := trie.NewIterator(storage.NodeIterator(nil))
+		for iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			slot := dbValueToHash(iter.Value)
+			offset := -1
+			if slot == padded {
+				offset = 0
+			} else if packed {
+				// search from the right, the offset of the first packed variable
+				if i := bytes.LastIndex(slot[:], value); i >= 0 {
+					offset = common.HashLength - len(value) - i
+				}
+			}
+			if offset < 0 {
+				continue
+			}
+			match := &StorageMatch{HashedKey: common.BytesToHash(iter.Key), Value: slot, Offset: offset}
+			if key, ok := storageKeyPreimage(storage, db, iter.Key); ok {
+				match.Key = &key
+			}
+			if err := enc.Encode(match); err != nil {
+				return err
+			}
+		}
+		if iter.Err != nil {
+			return fmt.Errorf("failed to iterate storage of %s: %w", address, iter.Err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageSearch(t *testing.T) {
+	ctx := context.Background()
+	contract, owner := common.Address{0: 0xc}, common.Address{0: 0xbb, 19: 0xaa}
+	headState := newTestState(t)
+	db := headState.Database()
+	headState.SetNonce(contract, 1)
+	headState.SetState(contract, common.Hash{31: 1}, common.BytesToHash(owner[:]))
+	// the owner packed after a bool, like `bool initialized; address owner;`
+	var packed common.Hash
+	copy(packed[11:31], owner[:])
+	packed[31] = 1
+	headState.SetState(contract, common.Hash{31: 2}, packed)
+	headState.SetState(contract, common.Hash{31: 3}, common.Hash{31: 7})
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, db, nil)
+	require.NoError(t, err)
+
+	search := func(value []byte, packed bool) []StorageMatch {
+		var out bytes.Buffer
+		require.NoError(t, StorageSearch(contract, value, packed, &out)(ctx, headState))
+		var matches []StorageMatch
+		dec := json.NewDecoder(strings.NewReader(out.String()))
+		for dec.More() {
+			var m StorageMatch
+			require.NoError(t, dec.Decode(&m))
+			matches = append(matches, m)
+		}
+		return matches
+	}
+	matches := search(owner[:], false)
+	require.Len(t, matches, 1)
+	require.Equal(t, common.Hash{31: 1}, *matches[0].Key)
+	require.Equal(t, 0, matches[0].Offset)
+
+	matches = search(owner[:], true)
+	require.Len(t, matches, 2)
+	for _, m := range matches {
+		if *m.Key == (common.Hash{31: 2}) {
+			require.Equal(t, 1, m.Offset)
+		}
+	}
+
+	require.Len(t, search([]byte{7}, false), 1)
+	require.Empty(t, search([]byte{8}, false))
+	require.Error(t, StorageSearch(contract, nil, false, &bytes.Buffer{})(ctx, headState))
+}
@@ -0,0 +1,131 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	selftestReference = common.Address{0: 0xa}
+	selftestMutated   = common.Address{0: 0xb}
+	selftestPatched   = common.Address{0: 0xc}
+)
+
+// SelftestConfig configures the storage surgery self-test, see Selftest.
+type SelftestConfig struct {
+	Rounds int
+	// Slots is the number of storage slots of the reference account, and the maximum number of mutations.
+	Slots int
+	Seed  int64
+}
+
+// Selftest verifies that StorageDiff and StoragePatch round-trip, with randomized storage mutations.
+// Each round, in a fresh in-memory state, a reference account with random storage is cloned,
+// the clone is mutated (changed, deleted and added slots), and the diff from the reference to the clone
+// is applied as patch to another clone of the reference, which must then equal the mutated clone.
+// No data dir is touched. The seed makes a failing round reproducible.
+func Selftest(ctx context.Context, cfg *SelftestConfig) error {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	for i := 0; i < cfg.Rounds; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := selftestRound(ctx, rng, cfg.Slots); err != nil {
+			return fmt.Errorf("round %d with seed %d failed: %w", i, cfg.Seed, err)
+		}
+	}
+	return nil
+}
+
+func selftestRound(ctx context.Context, rng *rand.Rand, slots int) error {
+	db := state.NewDatabaseWithConfig(rawdb.NewMemoryDatabase(), &trie.Config{Preimages: true})
+	headState, err := state.New(types.EmptyRootHash, db, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create state: %w", err)
+	}
+	randomHash := func() (h common.Hash) {
+		rng.Read(h[:])
+		// small keys and values are common in contract storage, and encoded differently
+		if rng.Intn(2) == 0 {
+			h = common.BigToHash(new(big.Int).SetBytes(h[:4]))
+		}
+		return h
+	}
+	// accounts without nonce, balance and code are deleted on commit
+	for _, addr := range []common.Address{selftestReference, selftestMutated, selftestPatched} {
+		headState.SetNonce(addr, 1)
+	}
+	// keys are kept in order, so a round is reproducible with the same seed
+	keys := make([]common.Hash, 1+rng.Intn(slots))
+	for i := range keys {
+		keys[i] = randomHash()
+		value := randomHash()
+		for _, addr := range []common.Address{selftestReference, selftestMutated, selftestPatched} {
+			headState.SetState(addr, keys[i], value)
+		}
+	}
+	for _, key := range keys {
+		switch rng.Intn(4) {
+		case 0:
+			headState.SetState(selftestMutated, key, randomHash())
+		case 1:
+			headState.SetState(selftestMutated, key, common.Hash{})
+		}
+	}
+	for i := 0; i < rng.Intn(slots); i++ {
+		headState.SetState(selftestMutated, randomHash(), randomHash())
+	}
+	if _, err := headState.Commit(true); err != nil {
+		return fmt.Errorf("failed to commit mutations: %w", err)
+	}
+
+	var patch bytes.Buffer
+	if err := StorageDiff(&patch, selftestReference, selftestMutated)(ctx, headState); err != nil {
+		return fmt.Errorf("failed to diff: %w", err)
+	}
+	if err := StoragePatch(bytes.NewReader(patch.Bytes()), selftestPatched)(ctx, headState); err != nil {
+		return fmt.Errorf("failed to patch: %w", err)
+	}
+	if _, err := headState.Commit(true); err != nil {
+		return fmt.Errorf("failed to commit patch: %w", err)
+	}
+	var remaining bytes.Buffer
+	if err := StorageDiff(&remaining, selftestMutated, selftestPatched)(ctx, headState); err != nil {
+		return fmt.Errorf("failed to diff patched account: %w", err)
+	}
+	if remaining.Len() > 0 {
+		return fmt.Errorf("patched account differs from mutated account:\n%s\npatch:\n%s", remaining.String(), patch.String())
+	}
+	mutatedRoot, err := storageRoot(headState, selftestMutated)
+	if err != nil {
+		return err
+	}
+	patchedRoot, err := storageRoot(headState, selftestPatched)
+	if err != nil {
+		return err
+	}
+	if mutatedRoot != patchedRoot {
+		return fmt.Errorf("storage root of patched account %s does not match mutated account %s", patchedRoot, mutatedRoot)
+	}
+	return nil
+}
+
+func storageRoot(headState *state.StateDB, addr common.Address) (common.Hash, error) {
+	storage, err := headState.StorageTrie(addr)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to open storage trie of addr %s: %w", addr, err)
+	}
+	if storage == nil {
+		return types.EmptyRootHash, nil
+	}
+	return storage.Hash(), nil
+}
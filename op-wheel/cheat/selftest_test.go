@@ -0,0 +1,12 @@
+package cheat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelftest(t *testing.T) {
+	require.NoError(t, Selftest(context.Background(), &SelftestConfig{Rounds: 50, Slots: 40, Seed: 1234}))
+}
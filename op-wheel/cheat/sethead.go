@@ -0,0 +1,106 @@
+package cheat
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// SetHeadReport describes a rewind of the canonical chain.
+type SetHeadReport struct {
+	OldNumber uint64      `json:"oldNumber"`
+	OldHash   common.Hash `json:"oldHash"`
+	Number    uint64      `json:"number"`
+	Hash      common.Hash `json:"hash"`
+	// StateNumber and StateHash are of the new head block: the latest block up to the new head header with its state.
+	StateNumber uint64      `json:"stateNumber"`
+	StateHash   common.Hash `json:"stateHash"`
+	// Removed is the number of canonical blocks that were deleted.
+	Removed   uint64      `json:"removed"`
+	Finalized common.Hash `json:"finalized"`
+}
+
+// SetHead rewinds the canonical chain to the canonical block with the given hash, like debug_setHead, but offline.
+// The blocks after it are deleted, and it becomes the head header. Like geth, the head block is the latest block
+// up to it of which the state is in the database, and the finalized block is moved back to the head block if it is after it.
+// The state snapshot is dropped if the head block changes, for geth to regenerate it when it next opens the database for writing.
+// The node using the database must be stopped.
+func SetHead(db ethdb.Database, hash common.Hash) (*SetHeadReport, error) {
+	n := rawdb.ReadHeaderNumber(db, hash)
+	if n == nil {
+		return nil, fmt.Errorf("block %s is unknown", hash)
+	}
+	if canonical := rawdb.ReadCanonicalHash(db, *n); canonical != hash {
+		return nil, fmt.Errorf("block %d (%s) is not canonical, canonical block is %s", *n, hash, canonical)
+	}
+	header := rawdb.ReadHeader(db, hash, *n)
+	if header == nil {
+		return nil, fmt.Errorf("header %d (%s) is missing", *n, hash)
+	}
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return nil, fmt.Errorf("head header is missing")
+	}
+	if head.Number.Uint64() < *n {
+		return nil, fmt.Errorf("block %d is after the head block %d, cannot rewind forward", *n, head.Number.Uint64())
+	}
+	if frozen, err := db.Ancients(); err == nil && *n+1 < frozen {
+		return nil, fmt.Errorf("blocks after %d are in the ancient store (%d blocks), and cannot be removed", *n, frozen)
+	}
+	stateHeader := header
+	for !rawdb.HasLegacyTrieNode(db, stateHeader.Root) {
+		number := stateHeader.Number.Uint64()
+		if number == 0 {
+			return nil, fmt.Errorf("no state of block %d or any of its ancestors is in the database", *n)
+		}
+		if stateHeader = rawdb.ReadHeader(db, stateHeader.ParentHash, number-1); stateHeader == nil {
+			return nil, fmt.Errorf("header %d is missing", number-1)
+		}
+	}
+	report := &SetHeadReport{
+		OldNumber:   head.Number.Uint64(),
+		OldHash:     head.Hash(),
+		Number:      *n,
+		Hash:        hash,
+		StateNumber: stateHeader.Number.Uint64(),
+		StateHash:   stateHeader.Hash(),
+		Finalized:   rawdb.ReadFinalizedBlockHash(db),
+	}
+	if finalized := rawdb.ReadHeaderNumber(db, report.Finalized); finalized != nil && *finalized > report.StateNumber {
+		report.Finalized = report.StateHash
+	}
+
+	batch := db.NewBatch()
+	for i := *n + 1; i <= head.Number.Uint64(); i++ {
+		h := rawdb.ReadCanonicalHash(db, i)
+		if h == (common.Hash{}) {
+			continue
+		}
+		if body := rawdb.ReadBody(db, h, i); body != nil {
+			txs := make([]common.Hash, len(body.Transactions))
+			for j, tx := range body.Transactions {
+				txs[j] = tx.Hash()
+			}
+			rawdb.DeleteTxLookupEntries(batch, txs)
+		}
+		rawdb.DeleteBlock(batch, h, i)
+		rawdb.DeleteCanonicalHash(batch, i)
+		report.Removed++
+	}
+	rawdb.WriteHeadHeaderHash(batch, hash)
+	rawdb.WriteHeadFastBlockHash(batch, hash)
+	rawdb.WriteHeadBlockHash(batch, report.StateHash)
+	// the snapshot journal may have layers up to the old head block, that geth cannot load for an earlier head
+	if rawdb.ReadHeadBlockHash(db) != report.StateHash {
+		rawdb.DeleteSnapshotRoot(batch)
+	}
+	if report.Finalized != rawdb.ReadFinalizedBlockHash(db) {
+		rawdb.WriteFinalizedBlockHash(batch, report.Finalized)
+	}
+	if err := batch.Write(); err != nil {
+		return nil, fmt.Errorf("failed to set head to block %d: %w", *n, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,74 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHead(t *testing.T) {
+	dataDir := t.TempDir()
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db, err := OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	genesis.MustCommit(db)
+	require.NoError(t, db.Close())
+	signer := types.LatestSigner(genesis.Config)
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 5, func(i int, gen *core.BlockGen) {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{
+			Nonce: gen.TxNonce(sender), To: &common.Address{0: 0xa}, Value: big.NewInt(1), Gas: 21000, GasPrice: gen.BaseFee(),
+		})
+		gen.AddTx(tx)
+	})
+	ch, err := OpenGethDB(dataDir, false)
+	require.NoError(t, err)
+	importer := NewChainImporter(ch)
+	require.NoError(t, importer.InsertBlocks(context.Background(), blocks))
+	require.NoError(t, importer.Close())
+
+	db, err = OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	rawdb.WriteFinalizedBlockHash(db, blocks[3].Hash())
+	_, err = SetHead(db, common.Hash{0: 0xff})
+	require.ErrorContains(t, err, "unknown")
+	// only the state of the genesis and head blocks are written
+	report, err := SetHead(db, blocks[1].Hash())
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), report.OldNumber)
+	require.Equal(t, uint64(2), report.Number)
+	require.Equal(t, uint64(0), report.StateNumber)
+	require.Equal(t, uint64(3), report.Removed)
+	require.Equal(t, report.StateHash, report.Finalized)
+	require.Equal(t, common.Hash{}, rawdb.ReadCanonicalHash(db, 3))
+	require.Nil(t, rawdb.ReadHeader(db, blocks[2].Hash(), 3))
+	require.Nil(t, rawdb.ReadTxLookupEntry(db, blocks[2].Transactions()[0].Hash()))
+	require.NotNil(t, rawdb.ReadTxLookupEntry(db, blocks[1].Transactions()[0].Hash()))
+	require.Equal(t, blocks[1].Hash(), rawdb.ReadHeadHeaderHash(db))
+	require.Equal(t, common.Hash{}, rawdb.ReadSnapshotRoot(db))
+	require.NoError(t, db.Close())
+
+	// geth regenerates the dropped state snapshot
+	ch, err = OpenGethDB(dataDir, false)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.Equal(t, report.StateHash, ch.Blockchain.CurrentBlock().Hash())
+	require.Equal(t, blocks[1].Hash(), ch.Blockchain.CurrentHeader().Hash())
+	headState, err := ch.Blockchain.StateAt(ch.Blockchain.CurrentBlock().Root)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), headState.GetNonce(sender))
+}
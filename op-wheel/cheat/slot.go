@@ -0,0 +1,173 @@
+package cheat
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SlotStep is a step from a storage slot to the slot of a member of the value at that slot, see ParseSlotStep.
+type SlotStep struct {
+	Text string
+	// key is the encoded mapping key, if this step looks up a mapping key.
+	key []byte
+	// index is the element index of a dynamic array, or the slot of a struct field.
+	index *big.Int
+	// size is the number of slots per array element.
+	size uint64
+	// offset is the byte offset of a packed struct field in its slot.
+	offset uint64
+	kind   string
+}
+
+// ParseSlotStep parses a step of a storage path, one of:
+//
+//	map:<type>:<key>          the value of the key in the mapping, with type address, bool, uintN, intN, bytesN, string or bytes
+//	array:<index>[:<slots>]   the element of the dynamic array, of the given number of slots per element, 1 by default
+//	field:<slot>[:<offset>]   the field of the struct, at the slot and byte offset within the struct, as in a storage layout
+func ParseSlotStep(s string) (SlotStep, error) {
+	step := SlotStep{Text: s}
+	parts := strings.SplitN(s, ":", 3)
+	step.kind = parts[0]
+	switch step.kind {
+	case "map":
+		if len(parts) != 3 {
+			return step, fmt.Errorf("mapping step %q must be map:<type>:<key>", s)
+		}
+		key, err := encodeMappingKey(parts[1], parts[2])
+		if err != nil {
+			return step, fmt.Errorf("invalid key of mapping step %q: %w", s, err)
+		}
+		step.key = key
+	case "array", "field":
+		if len(parts) < 2 || parts[1] == "" {
+			return step, fmt.Errorf("%s step %q needs an index", step.kind, s)
+		}
+		index, ok := math.ParseBig256(parts[1])
+		if !ok {
+			return step, fmt.Errorf("invalid index of %s step %q", step.kind, s)
+		}
+		step.index = index
+		step.size = 1
+		if len(parts) == 3 {
+			n, err := strconv.ParseUint(parts[2], 0, 64)
+			if err != nil {
+				return step, fmt.Errorf("invalid %s step %q: %w", step.kind, s, err)
+			}
+			if step.kind == "array" {
+				if n == 0 {
+					return step, fmt.Errorf("array step %q needs at least 1 slot per element", s)
+				}
+				step.size = n
+			} else {
+				if n >= common.HashLength {
+					return step, fmt.Errorf("byte offset of field step %q must be less than 32", s)
+				}
+				step.offset = n
+			}
+		}
+	default:
+		return step, fmt.Errorf("unknown step %q, expected map, array or field", s)
+	}
+	return step, nil
+}
+
+// encodeMappingKey encodes a mapping key like Solidity does before hashing it with the slot of the mapping:
+// value types are padded to 32 bytes, strings and bytes are not padded.
+func encodeMappingKey(typ string, value string) ([]byte, error) {
+	switch {
+	case typ == "address":
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		return common.LeftPadBytes(common.HexToAddress(value).Bytes(), 32), nil
+	case typ == "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return common.LeftPadBytes([]byte{1}, 32), nil
+		}
+		return make([]byte, 32), nil
+	case typ == "string":
+		return []byte(value), nil
+	case typ == "bytes":
+		return hexutil.Decode(value)
+	case strings.HasPrefix(typ, "bytes"):
+		b, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > common.HashLength {
+			return nil, fmt.Errorf("%s key is %d bytes", typ, len(b))
+		}
+		return common.RightPadBytes(b, 32), nil
+	case strings.HasPrefix(typ, "uint"):
+		v, ok := math.ParseBig256(value)
+		if !ok || v.Sign() < 0 || v.BitLen() > 256 {
+			return nil, fmt.Errorf("invalid %s %q", typ, value)
+		}
+		return math.U256Bytes(v), nil
+	case strings.HasPrefix(typ, "int"):
+		v, ok := new(big.Int).SetString(value, 0)
+		if !ok || v.BitLen() > 255 {
+			return nil, fmt.Errorf("invalid %s %q", typ, value)
+		}
+		return math.U256Bytes(v), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", typ)
+}
+
+// SlotPathEntry is the slot after a step of a storage path.
+type SlotPathEntry struct {
+	Step string      `json:"step"`
+	Slot common.Hash `json:"slot"`
+}
+
+// SlotResult is the storage slot of a storage path.
+type SlotResult struct {
+	Base common.Hash     `json:"base"`
+	Slot common.Hash     `json:"slot"`
+	Path []SlotPathEntry `json:"path"`
+	// Offset is the byte offset of a packed struct field in the slot, counted from the right like in a storage layout.
+	Offset uint64 `json:"offset"`
+}
+
+// ComputeSlot computes the storage slot of a value, from the slot of the variable that contains it, and the steps to the value.
+// Mapping keys are hashed after the slot, like Solidity does, or before it if vyper is set, like Vyper does.
+// Only the last step may be a packed struct field with a byte offset.
+func ComputeSlot(base common.Hash, steps []SlotStep, vyper bool) (*SlotResult, error) {
+	result := &SlotResult{Base: base, Path: []SlotPathEntry{}}
+	slot := base
+	for i, step := range steps {
+		if result.Offset != 0 {
+			return nil, fmt.Errorf("step %q follows packed field %q, which cannot contain other values", step.Text, steps[i-1].Text)
+		}
+		switch step.kind {
+		case "map":
+			if vyper {
+				slot = crypto.Keccak256Hash(slot[:], step.key)
+			} else {
+				slot = crypto.Keccak256Hash(step.key, slot[:])
+			}
+		case "array":
+			start := new(big.Int).SetBytes(crypto.Keccak256(slot[:]))
+			offset := new(big.Int).Mul(step.index, new(big.Int).SetUint64(step.size))
+			slot = common.BigToHash(math.U256(start.Add(start, offset)))
+		case "field":
+			v := new(big.Int).SetBytes(slot[:])
+			slot = common.BigToHash(math.U256(v.Add(v, step.index)))
+			result.Offset = step.offset
+		}
+		result.Path = append(result.Path, SlotPathEntry{Step: step.Text, Slot: slot})
+	}
+	result.Slot = slot
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package cheat
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeSlot(t *testing.T) {
+	owner, spender := common.Address{0: 0xa}, common.Address{0: 0xb}
+	parse := func(args ...string) []SlotStep {
+		steps := make([]SlotStep, len(args))
+		for i, arg := range args {
+			step, err := ParseSlotStep(arg)
+			require.NoError(t, err)
+			steps[i] = step
+		}
+		return steps
+	}
+
+	// nested mappings, like the allowances of an ERC20 token
+	for _, vyper := range []bool{false, true} {
+		layout := &ERC20MappingLayout{MappingSlot: common.Hash{31: 1}, Vyper: vyper}
+		result, err := ComputeSlot(layout.MappingSlot, parse("map:address:"+owner.Hex(), "map:address:"+spender.Hex()), vyper)
+		require.NoError(t, err)
+		require.Equal(t, layout.AllowanceSlot(owner, spender), result.Slot)
+		require.Len(t, result.Path, 2)
+		require.Equal(t, layout.BalanceSlot(owner), result.Path[0].Slot)
+	}
+
+	// the second slot of the struct of the third element of a dynamic array of two-slot structs
+	result, err := ComputeSlot(common.Hash{31: 5}, parse("array:2:2", "field:1:20"), false)
+	require.NoError(t, err)
+	start := new(big.Int).SetBytes(crypto.Keccak256(common.Hash{31: 5}.Bytes()))
+	require.Equal(t, common.BigToHash(start.Add(start, big.NewInt(5))), result.Slot)
+	require.Equal(t, uint64(20), result.Offset)
+
+	// string keys are not padded, and value types are
+	result, err = ComputeSlot(common.Hash{}, parse("map:string:abc", "map:uint256:0x10", "map:int8:-1", "map:bool:true", "map:bytes4:0x12345678"), false)
+	require.NoError(t, err)
+	slot := crypto.Keccak256Hash([]byte("abc"), common.Hash{}.Bytes())
+	slot = crypto.Keccak256Hash(common.Hash{31: 0x10}.Bytes(), slot[:])
+	slot = crypto.Keccak256Hash(common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").Bytes(), slot[:])
+	slot = crypto.Keccak256Hash(common.Hash{31: 1}.Bytes(), slot[:])
+	slot = crypto.Keccak256Hash(common.Hash{0: 0x12, 1: 0x34, 2: 0x56, 3: 0x78}.Bytes(), slot[:])
+	require.Equal(t, slot, result.Slot)
+
+	_, err = ComputeSlot(common.Hash{}, parse("field:0:4", "map:bool:true"), false)
+	require.ErrorContains(t, err, "packed field")
+	for _, invalid := range []string{"map:address", "map:address:0x12", "map:uint8:-1", "array:", "array:1:0", "field:1:32", "slot:1"} {
+		_, err := ParseSlotStep(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,182 @@
+package cheat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// snapshotPrefix is the database key prefix of the snapshots, followed by the snapshot name.
+// The first byte must not be a prefix of Geth's core/rawdb/schema.go: e.g. "o" is the prefix of the storage snapshot.
+var snapshotPrefix = []byte("wheel-snapshot-")
+
+// Snapshot is a checkpoint of the head of a database: the head block and the chain pointers.
+// Cheats replace the head block with a block with a new state root, see Cheater.RunAndClose,
+// and the state of the snapshot is kept in the database, so the head can be rolled back without a copy of the data dir.
+type Snapshot struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+
+	Number    uint64      `json:"number"`
+	Hash      common.Hash `json:"hash"`
+	StateRoot common.Hash `json:"stateRoot"`
+	Finalized common.Hash `json:"finalized"`
+
+	// Header, Body and Receipts are the database encodings of the head block, which are replaced by cheats.
+	Header   hexutil.Bytes `json:"header"`
+	Body     hexutil.Bytes `json:"body"`
+	Receipts hexutil.Bytes `json:"receipts"`
+	TD       *hexutil.Big  `json:"td"`
+}
+
+// SnapshotInfo describes a snapshot, without the block data.
+type SnapshotInfo struct {
+	Name      string      `json:"name"`
+	Created   time.Time   `json:"created"`
+	Number    uint64      `json:"number"`
+	Hash      common.Hash `json:"hash"`
+	StateRoot common.Hash `json:"stateRoot"`
+}
+
+func snapshotKey(name string) []byte {
+	return append(append([]byte{}, snapshotPrefix...), name...)
+}
+
+// blockReceiptsKey returns the database key to use for storing the receipts of a block.
+// This function was copied from Geth's core/rawdb/schema.go.
+func blockReceiptsKey(number uint64, hash common.Hash) []byte {
+	return append(append([]byte("r"), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// CreateSnapshot checkpoints the head of the database under the given name, and stores the snapshot in the database.
+// The head block must be the head of the headers and the fast-sync pointer too, as with a synced, stopped node.
+// An existing snapshot with the same name is only replaced if overwrite is set.
+func CreateSnapshot(db ethdb.Database, name string, overwrite bool) (*Snapshot, error) {
+	if name == "" {
+		return nil, errors.New("snapshot name must not be empty")
+	}
+	if has, err := db.Has(snapshotKey(name)); err != nil {
+		return nil, fmt.Errorf("failed to check for snapshot %q: %w", name, err)
+	} else if has && !overwrite {
+		return nil, fmt.Errorf("snapshot %q already exists", name)
+	}
+	hash := rawdb.ReadHeadBlockHash(db)
+	if h := rawdb.ReadHeadHeaderHash(db); h != hash {
+		return nil, fmt.Errorf("head header %s is not the head block %s, the node may be syncing", h, hash)
+	}
+	if h := rawdb.ReadHeadFastBlockHash(db); h != hash {
+		return nil, fmt.Errorf("head fast block %s is not the head block %s, the node may be syncing", h, hash)
+	}
+	number := rawdb.ReadHeaderNumber(db, hash)
+	if number == nil {
+		return nil, fmt.Errorf("head block %s has no number", hash)
+	}
+	header := rawdb.ReadHeader(db, hash, *number)
+	if header == nil {
+		return nil, fmt.Errorf("head header %s is missing", hash)
+	}
+	td := rawdb.ReadTd(db, hash, *number)
+	if td == nil {
+		return nil, fmt.Errorf("total difficulty of head block %s is missing", hash)
+	}
+	snap := &Snapshot{
+		Name:      name,
+		Created:   time.Now().UTC(),
+		Number:    *number,
+		Hash:      hash,
+		StateRoot: header.Root,
+		Finalized: rawdb.ReadFinalizedBlockHash(db),
+		Header:    hexutil.Bytes(rawdb.ReadHeaderRLP(db, hash, *number)),
+		Body:      hexutil.Bytes(rawdb.ReadBodyRLP(db, hash, *number)),
+		Receipts:  hexutil.Bytes(rawdb.ReadReceiptsRLP(db, hash, *number)),
+		TD:        (*hexutil.Big)(td),
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := db.Put(snapshotKey(name), data); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot %q: %w", name, err)
+	}
+	return snap, nil
+}
+
+// ReadSnapshot reads the snapshot with the given name from the database.
+func ReadSnapshot(db ethdb.KeyValueReader, name string) (*Snapshot, error) {
+	data, err := db.Get(snapshotKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %q not found: %w", name, err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %q: %w", name, err)
+	}
+	return &snap, nil
+}
+
+// ListSnapshots reads all snapshots from the database, in order of their names.
+func ListSnapshots(db ethdb.Iteratee) ([]*Snapshot, error) {
+	iter := db.NewIterator(snapshotPrefix, nil)
+	defer iter.Release()
+	var out []*Snapshot
+	for iter.Next() {
+		var snap Snapshot
+		if err := json.Unmarshal(iter.Value(), &snap); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot %q: %w", iter.Key()[len(snapshotPrefix):], err)
+		}
+		out = append(out, &snap)
+	}
+	return out, iter.Error()
+}
+
+// RestoreSnapshot makes the head block of the snapshot the head of the database again, with its state.
+// Canonical blocks after the snapshot block are no longer canonical, like with a geth rewind.
+// The state of the snapshot must still be in the database: pruning or trimming the state may remove it.
+// The node using the database must be stopped.
+func RestoreSnapshot(db ethdb.Database, snap *Snapshot) error {
+	if !rawdb.HasLegacyTrieNode(db, snap.StateRoot) {
+		return fmt.Errorf("state %s of snapshot %q is no longer in the database", snap.StateRoot, snap.Name)
+	}
+	var header types.Header
+	if err := rlp.DecodeBytes(snap.Header, &header); err != nil {
+		return fmt.Errorf("failed to decode header of snapshot %q: %w", snap.Name, err)
+	}
+	if header.Hash() != snap.Hash {
+		return fmt.Errorf("header of snapshot %q has hash %s, expected %s", snap.Name, header.Hash(), snap.Hash)
+	}
+	batch := db.NewBatch()
+	head := rawdb.ReadHeadHeader(db)
+	if head != nil && head.Number.Uint64() >= snap.Number {
+		for n := snap.Number; n <= head.Number.Uint64(); n++ {
+			if hash := rawdb.ReadCanonicalHash(db, n); hash != (common.Hash{}) && hash != snap.Hash {
+				rawdb.DeleteHeaderNumber(batch, hash)
+				rawdb.DeleteCanonicalHash(batch, n)
+			}
+		}
+	}
+	rawdb.WriteHeader(batch, &header)
+	rawdb.WriteBodyRLP(batch, snap.Hash, snap.Number, rlp.RawValue(snap.Body))
+	if len(snap.Receipts) > 0 {
+		if err := batch.Put(blockReceiptsKey(snap.Number, snap.Hash), snap.Receipts); err != nil {
+			return fmt.Errorf("failed to write receipts: %w", err)
+		}
+	}
+	rawdb.WriteTd(batch, snap.Hash, snap.Number, snap.TD.ToInt())
+	rawdb.WriteCanonicalHash(batch, snap.Hash, snap.Number)
+	rawdb.WriteHeadHeaderHash(batch, snap.Hash)
+	rawdb.WriteHeadFastBlockHash(batch, snap.Hash)
+	rawdb.WriteHeadBlockHash(batch, snap.Hash)
+	rawdb.WriteFinalizedBlockHash(batch, snap.Finalized)
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to restore snapshot %q: %w", snap.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	addr := common.Address{0: 0xa}
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{addr: {Balance: big.NewInt(1)}},
+	}
+	db, err := OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	genesis.MustCommit(db)
+	require.NoError(t, db.Close())
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), 3, func(i int, gen *core.BlockGen) {})
+	ch, err := OpenGethDB(dataDir, false)
+	require.NoError(t, err)
+	importer := NewChainImporter(ch)
+	require.NoError(t, importer.InsertBlocks(context.Background(), blocks))
+	require.NoError(t, importer.Close())
+
+	db, err = OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	snap, err := CreateSnapshot(db, "before", false)
+	require.NoError(t, err)
+	require.Equal(t, blocks[2].Hash(), snap.Hash)
+	_, err = CreateSnapshot(db, "before", false)
+	require.ErrorContains(t, err, "already exists")
+	require.NoError(t, db.Close())
+
+	ch, err = OpenGethDB(dataDir, false)
+	require.NoError(t, err)
+	require.NoError(t, ch.RunAndClose(context.Background(), SetBalance(addr, big.NewInt(42))))
+
+	db, err = OpenGethRawDB(dataDir, false)
+	require.NoError(t, err)
+	snaps, err := ListSnapshots(db)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	require.NoError(t, RestoreSnapshot(db, snaps[0]))
+	require.NoError(t, db.Close())
+
+	ch, err = OpenGethDB(dataDir, true)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.Equal(t, blocks[2].Hash(), ch.Blockchain.CurrentBlock().Hash())
+	require.NotNil(t, ch.Blockchain.GetBlockByHash(blocks[2].Hash()))
+	headState, err := ch.Blockchain.StateAt(ch.Blockchain.CurrentBlock().Root)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(1), headState.GetBalance(addr))
+}
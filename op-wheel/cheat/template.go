@@ -0,0 +1,194 @@
+package cheat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateValues are the variables that a cheat template can refer to, e.g. {{ .Deployer }}.
+type TemplateValues map[string]any
+
+// ReadTemplateValues reads template values from a JSON or YAML file, and then applies the key=value overrides.
+// The path may be empty, to only use the overrides. Numbers are kept as written, not as float64,
+// so large integers are exact: JSON numbers are decoded as json.Number, and YAML scalars as strings.
+func ReadTemplateValues(path string, overrides []string) (TemplateValues, error) {
+	values := make(TemplateValues)
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template values: %w", err)
+		}
+		defer f.Close()
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			var doc yaml.Node
+			if err := yaml.NewDecoder(f).Decode(&doc); err != nil {
+				return nil, fmt.Errorf("failed to decode template values: %w", err)
+			}
+			m, ok := yamlToJSON(&doc).(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("template values must be a mapping")
+			}
+			values = m
+		} else {
+			dec := json.NewDecoder(f)
+			dec.UseNumber()
+			if err := dec.Decode(&values); err != nil {
+				return nil, fmt.Errorf("failed to decode template values: %w", err)
+			}
+		}
+	}
+	for _, kv := range overrides {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("template value %q is not formatted as key=value", kv)
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return values, nil
+}
+
+// RenderTemplate renders the Go template read from r with the given values.
+// Referencing a value that is not defined is an error.
+// Besides the standard template functions, these are available:
+//   - ether, gwei: convert a decimal amount to wei, formatted as 32-byte hex word.
+//   - word: left-pad a number, address or hex value to a 32-byte hex word.
+//   - keccak: hash the concatenation of the hex-decoded arguments.
+func RenderTemplate(r io.Reader, values TemplateValues) (io.Reader, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New("cheat").Option("missingkey=error").Funcs(templateFuncs).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return &out, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"ether": func(v any) (string, error) {
+		return denominated(v, params.Ether)
+	},
+	"gwei": func(v any) (string, error) {
+		return denominated(v, params.GWei)
+	},
+	"word": func(v any) (string, error) {
+		b, err := templateBytes(v)
+		if err != nil {
+			return "", err
+		}
+		if len(b) > common.HashLength {
+			return "", fmt.Errorf("value %v is larger than 32 bytes", v)
+		}
+		return common.BytesToHash(b).Hex(), nil
+	},
+	"keccak": func(args ...any) (string, error) {
+		var data []byte
+		for _, v := range args {
+			b, err := templateBytes(v)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, b...)
+		}
+		return crypto.Keccak256Hash(data).Hex(), nil
+	},
+}
+
+// denominated multiplies the decimal amount v with the given unit, and formats it as 32-byte hex word.
+func denominated(v any, unit int64) (string, error) {
+	amount, ok := new(big.Rat).SetString(fmt.Sprint(v))
+	if !ok {
+		return "", fmt.Errorf("invalid amount: %v", v)
+	}
+	amount.Mul(amount, new(big.Rat).SetInt64(unit))
+	if !amount.IsInt() {
+		return "", fmt.Errorf("amount %v is not a whole number of wei", v)
+	}
+	wei := amount.Num()
+	if wei.Sign() < 0 || wei.BitLen() > 256 {
+		return "", fmt.Errorf("amount out of range: %v", v)
+	}
+	return common.BigToHash(wei).Hex(), nil
+}
+
+// templateBytes interprets a template value as bytes: hex strings are decoded, decimal strings and integers
+// are converted to their big-endian representation. Numbers that are not integers are rejected.
+func templateBytes(v any) ([]byte, error) {
+	switch x := v.(type) {
+	case string:
+		if strings.HasPrefix(x, "0x") {
+			return hexutil.Decode(x)
+		}
+		n, ok := new(big.Int).SetString(x, 10)
+		if !ok {
+			return nil, fmt.Errorf("value %q is not hex or decimal", x)
+		}
+		return n.Bytes(), nil
+	case json.Number:
+		n, ok := new(big.Int).SetString(x.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("number %s is not an integer", x)
+		}
+		if n.Sign() < 0 {
+			return nil, fmt.Errorf("number %s is negative", x)
+		}
+		return n.Bytes(), nil
+	case int:
+		return big.NewInt(int64(x)).Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// yamlToJSON converts a YAML node to the values of JSON decoding. Null and bool scalars are decoded,
+// other scalars are kept as strings, so numbers stay exact.
+func yamlToJSON(n *yaml.Node) any {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return yamlToJSON(n.Content[0])
+	case yaml.AliasNode:
+		return yamlToJSON(n.Alias)
+	case yaml.MappingNode:
+		out := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			out[n.Content[i].Value] = yamlToJSON(n.Content[i+1])
+		}
+		return out
+	case yaml.SequenceNode:
+		out := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			out = append(out, yamlToJSON(c))
+		}
+		return out
+	default:
+		switch n.ShortTag() {
+		case "!!null":
+			return nil
+		case "!!bool":
+			return n.Value == "true"
+		default:
+			return n.Value
+		}
+	}
+}
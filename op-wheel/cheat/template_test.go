@@ -0,0 +1,59 @@
+package cheat
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	values, err := ReadTemplateValues("", []string{"Deployer=0x1234", "Slot = 3"})
+	require.NoError(t, err)
+
+	out, err := RenderTemplate(strings.NewReader("+ {{ word .Slot }} = {{ word .Deployer }}\n+ 0x01 = {{ ether 1.5 }}"), values)
+	require.NoError(t, err)
+	data, err := io.ReadAll(out)
+	require.NoError(t, err)
+	require.Equal(t, "+ 0x0000000000000000000000000000000000000000000000000000000000000003 = 0x0000000000000000000000000000000000000000000000000000000000001234\n"+
+		"+ 0x01 = 0x00000000000000000000000000000000000000000000000014d1120d7b160000", string(data))
+
+	_, err = RenderTemplate(strings.NewReader("{{ .Missing }}"), values)
+	require.ErrorContains(t, err, "Missing")
+
+	_, err = RenderTemplate(strings.NewReader("{{ gwei 0.0000000001 }}"), values)
+	require.ErrorContains(t, err, "whole number")
+}
+
+func TestReadTemplateValuesNumbers(t *testing.T) {
+	dir := t.TempDir()
+	render := func(t *testing.T, file, content string) (string, error) {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		values, err := ReadTemplateValues(path, nil)
+		require.NoError(t, err)
+		out, err := RenderTemplate(strings.NewReader("{{ word .Amount }}"), values)
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(out)
+		require.NoError(t, err)
+		return string(data), nil
+	}
+	// 2**64 + 1 is not exact as float64
+	const exact = "0x0000000000000000000000000000000000000000000000010000000000000001"
+	out, err := render(t, "values.json", `{"Amount": 18446744073709551617}`)
+	require.NoError(t, err)
+	require.Equal(t, exact, out)
+	out, err = render(t, "values.yaml", "Amount: 18446744073709551617\n")
+	require.NoError(t, err)
+	require.Equal(t, exact, out)
+
+	_, err = render(t, "fraction.json", `{"Amount": 1.5}`)
+	require.ErrorContains(t, err, "not an integer")
+	_, err = render(t, "exponent.json", `{"Amount": 1e3}`)
+	require.ErrorContains(t, err, "not an integer")
+}
@@ -0,0 +1,175 @@
+package cheat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// TrimmedRoot is the state root of a block whose state is no longer available after a trim.
+type TrimmedRoot struct {
+	Number uint64      `json:"number"`
+	Root   common.Hash `json:"root"`
+}
+
+// TrimHistoryReport describes the removal of historical state.
+type TrimHistoryReport struct {
+	Head uint64 `json:"head"`
+	// FirstKept is the first block of which the state is kept.
+	FirstKept    uint64        `json:"firstKept"`
+	KeptNodes    uint64        `json:"keptNodes"`
+	DeletedNodes uint64        `json:"deletedNodes"`
+	DeletedBytes uint64        `json:"deletedBytes"`
+	DeletedRoots []TrimmedRoot `json:"deletedRoots"`
+	DryRun       bool          `json:"dryRun"`
+}
+
+// markTrie adds the hashes of all nodes of the trie to the keep set,
+// and calls onLeaf for every leaf that was not marked before.
+// Sub-tries that are already marked are skipped, since the states of consecutive blocks share most nodes.
+func markTrie(ctx context.Context, tr state.Trie, keep map[common.Hash]struct{}, onLeaf func(value []byte) error) error {
+	it := tr.NodeIterator(nil)
+	descend := true
+	for it.Next(descend) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		descend = true
+		if h := it.Hash(); h != (common.Hash{}) {
+			if _, ok := keep[h]; ok {
+				descend = false
+				continue
+			}
+			keep[h] = struct{}{}
+		}
+		if it.Leaf() && onLeaf != nil {
+			if err := onLeaf(it.LeafBlob()); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+// markState adds the hashes of all account and storage trie nodes of the state to the keep set.
+func markState(ctx context.Context, sdb state.Database, root common.Hash, keep map[common.Hash]struct{}) error {
+	accounts, err := sdb.OpenTrie(root)
+	if err != nil {
+		return fmt.Errorf("failed to open account trie %s: %w", root, err)
+	}
+	return markTrie(ctx, accounts, keep, func(value []byte) error {
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(value, &acc); err != nil {
+			return fmt.Errorf("failed to decode account: %w", err)
+		}
+		if acc.Root == types.EmptyRootHash {
+			return nil
+		}
+		if _, ok := keep[acc.Root]; ok {
+			return nil
+		}
+		// The storage trie nodes are keyed by hash only, so the owner does not matter to read them.
+		storage, err := trie.NewStateTrie(trie.StorageTrieID(root, common.Hash{}, acc.Root), sdb.TrieDB())
+		if err != nil {
+			return fmt.Errorf("failed to open storage trie %s: %w", acc.Root, err)
+		}
+		return markTrie(ctx, storage, keep, nil)
+	})
+}
+
+// TrimHistory removes the state trie nodes of a hash-based database that are not part of the state
+// of the last keep blocks or of the genesis block, like the state pruning of a full node.
+// Blocks, receipts, code and snapshots are kept. If dryRun is set, only the report is made.
+func TrimHistory(ctx context.Context, db ethdb.Database, keep uint64, dryRun bool) (*TrimHistoryReport, error) {
+	if keep == 0 {
+		return nil, fmt.Errorf("must keep the state of at least the head block")
+	}
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return nil, fmt.Errorf("no head header found")
+	}
+	if !rawdb.HasLegacyTrieNode(db, head.Root) {
+		return nil, fmt.Errorf("head state %s is not stored by hash, only hash-based databases can be trimmed", head.Root)
+	}
+	report := &TrimHistoryReport{Head: head.Number.Uint64(), DryRun: dryRun}
+	if report.Head+1 > keep {
+		report.FirstKept = report.Head + 1 - keep
+	}
+
+	keepNodes := make(map[common.Hash]struct{})
+	sdb := state.NewDatabase(db)
+	roots := []uint64{0}
+	for n := report.FirstKept; n <= report.Head; n++ {
+		roots = append(roots, n)
+	}
+	for _, n := range roots {
+		header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, n), n)
+		if header == nil {
+			return nil, fmt.Errorf("canonical header %d is missing", n)
+		}
+		if !rawdb.HasLegacyTrieNode(db, header.Root) {
+			continue // not all blocks of a non-archive node have their state
+		}
+		if err := markState(ctx, sdb, header.Root, keepNodes); err != nil {
+			return nil, fmt.Errorf("failed to mark state of block %d: %w", n, err)
+		}
+	}
+	report.KeptNodes = uint64(len(keepNodes))
+
+	for n := uint64(1); n < report.FirstKept; n++ {
+		header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, n), n)
+		if header == nil {
+			continue
+		}
+		if _, ok := keepNodes[header.Root]; ok {
+			continue
+		}
+		if rawdb.HasLegacyTrieNode(db, header.Root) {
+			report.DeletedRoots = append(report.DeletedRoots, TrimmedRoot{Number: n, Root: header.Root})
+		}
+	}
+
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	batch := db.NewBatch()
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key, value := iter.Key(), iter.Value()
+		if !rawdb.IsLegacyTrieNode(key, value) {
+			continue
+		}
+		if _, ok := keepNodes[common.BytesToHash(key)]; ok {
+			continue
+		}
+		report.DeletedNodes += 1
+		report.DeletedBytes += uint64(len(key) + len(value))
+		if dryRun {
+			continue
+		}
+		if err := batch.Delete(key); err != nil {
+			return nil, err
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return nil, fmt.Errorf("failed to delete trie nodes: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate database: %w", err)
+	}
+	if err := batch.Write(); err != nil {
+		return nil, fmt.Errorf("failed to delete trie nodes: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,61 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimHistory(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	sdb := state.NewDatabase(db)
+	root := types.EmptyRootHash
+	parent := common.Hash{}
+	var roots []common.Hash
+	for n := int64(0); n <= 5; n++ {
+		headState, err := state.New(root, sdb, nil)
+		require.NoError(t, err)
+		addr := common.Address{0: byte(n + 1)}
+		headState.SetBalance(addr, big.NewInt(n+1))
+		headState.SetNonce(common.Address{0: 0xff}, 1)
+		headState.SetState(common.Address{0: 0xff}, common.Hash{31: byte(n)}, common.Hash{31: 1})
+		root, err = headState.Commit(true)
+		require.NoError(t, err)
+		require.NoError(t, sdb.TrieDB().Commit(root, false))
+		roots = append(roots, root)
+		header := &types.Header{Number: big.NewInt(n), Root: root, ParentHash: parent, Difficulty: common.Big0}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), uint64(n))
+		rawdb.WriteHeadHeaderHash(db, header.Hash())
+		parent = header.Hash()
+	}
+
+	report, err := TrimHistory(context.Background(), db, 2, true)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), report.FirstKept)
+	require.Len(t, report.DeletedRoots, 3)
+	require.NotZero(t, report.DeletedNodes)
+	require.True(t, rawdb.HasLegacyTrieNode(db, roots[2]), "dry run must not delete")
+
+	report, err = TrimHistory(context.Background(), db, 2, false)
+	require.NoError(t, err)
+	require.Equal(t, []TrimmedRoot{{1, roots[1]}, {2, roots[2]}, {3, roots[3]}}, report.DeletedRoots)
+	for n, root := range roots {
+		require.Equal(t, n == 0 || n >= 4, rawdb.HasLegacyTrieNode(db, root), "state of block %d", n)
+	}
+	// the kept states must be complete
+	sdb = state.NewDatabase(db)
+	for _, n := range []int{0, 4, 5} {
+		headState, err := state.New(roots[n], sdb, nil)
+		require.NoError(t, err)
+		require.Equal(t, big.NewInt(int64(n+1)), headState.GetBalance(common.Address{0: byte(n + 1)}))
+		require.Equal(t, common.Hash{31: 1}, headState.GetState(common.Address{0: 0xff}, common.Hash{31: byte(n)}))
+		require.NoError(t, headState.Error())
+	}
+}
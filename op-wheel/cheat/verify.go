@@ -0,0 +1,166 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// StateIssue is a corruption of the state found by VerifyState.
+type StateIssue struct {
+	// Kind is one of missing-node, invalid-node, invalid-account, missing-code or dangling-storage.
+	Kind string `json:"kind"`
+	// AddressHash is the account of the issue, unset for issues of the account trie itself.
+	AddressHash *common.Hash `json:"addressHash,omitempty"`
+	// Hash is the hash of the missing or invalid trie node, or of the missing code.
+	Hash  common.Hash `json:"hash"`
+	Error string      `json:"error,omitempty"`
+}
+
+// StateReport summarizes a VerifyState walk.
+type StateReport struct {
+	Root     common.Hash `json:"root"`
+	Nodes    uint64      `json:"nodes"`
+	Accounts uint64      `json:"accounts"`
+	Slots    uint64      `json:"slots"`
+	Codes    uint64      `json:"codes"`
+	Issues   uint64      `json:"issues"`
+}
+
+// VerifyState walks the account trie and every storage trie of the head state, like geth snapshot traverse-rawstate,
+// to find the corruption an interrupted cheat may leave behind: trie nodes that are missing from the database,
+// or that do not hash to the hash they are stored under, accounts that fail to decode, missing contract code,
+// and dangling storage, see FindDanglingStorage. Each issue is written as JSON line, and the StateReport last.
+// A missing node of the account trie stops the walk, since the accounts below it cannot be reached.
+// An error is returned if any issue is found.
+func VerifyState(w io.Writer) HeadFn {
+	return func(ctx context.Context, headState *state.StateDB) error {
+		db := headState.Database()
+		root := headState.IntermediateRoot(false)
+		report := &StateReport{Root: root}
+		enc := json.NewEncoder(w)
+		issue := func(i StateIssue) error {
+			report.Issues++
+			return enc.Encode(i)
+		}
+		accounts, err := db.OpenTrie(root)
+		if err != nil {
+			return fmt.Errorf("failed to open account trie: %w", err)
+		}
+		it := accounts.NodeIterator(nil)
+		for it.Next(true) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			report.Nodes++
+			if err := verifyNode(db.DiskDB(), it.Hash(), nil, issue); err != nil {
+				return err
+			}
+			if !it.Leaf() {
+				continue
+			}
+			report.Accounts++
+			addrHash := common.BytesToHash(it.LeafKey())
+			var acc types.StateAccount
+			if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+				if err := issue(StateIssue{Kind: "invalid-account", AddressHash: &addrHash, Error: err.Error()}); err != nil {
+					return err
+				}
+				continue
+			}
+			if acc.Root != types.EmptyRootHash {
+				if err := verifyStorage(ctx, db, root, addrHash, acc.Root, report, issue); err != nil {
+					return err
+				}
+			}
+			if !bytes.Equal(acc.CodeHash, types.EmptyCodeHash[:]) {
+				codeHash := common.BytesToHash(acc.CodeHash)
+				if !rawdb.HasCode(db.DiskDB(), codeHash) {
+					if err := issue(StateIssue{Kind: "missing-code", AddressHash: &addrHash, Hash: codeHash}); err != nil {
+						return err
+					}
+				} else {
+					report.Codes++
+				}
+			}
+			if danglingStorage(&acc) {
+				if err := issue(StateIssue{Kind: "dangling-storage", AddressHash: &addrHash, Hash: acc.Root}); err != nil {
+					return err
+				}
+			}
+		}
+		if it.Error() != nil {
+			if err := iteratorIssue(it.Error(), nil, issue); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		if report.Issues > 0 {
+			return fmt.Errorf("found %d issues in state %s", report.Issues, root)
+		}
+		return nil
+	}
+}
+
+// verifyStorage walks the storage trie of an account, and reports its missing and invalid nodes.
+func verifyStorage(ctx context.Context, db state.Database, stateRoot, addrHash, root common.Hash, report *StateReport, issue func(StateIssue) error) error {
+	storage, err := db.OpenStorageTrie(stateRoot, addrHash, root)
+	if err != nil {
+		return iteratorIssue(err, &addrHash, issue)
+	}
+	it := storage.NodeIterator(nil)
+	for it.Next(true) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Nodes++
+		if err := verifyNode(db.DiskDB(), it.Hash(), &addrHash, issue); err != nil {
+			return err
+		}
+		if it.Leaf() {
+			report.Slots++
+		}
+	}
+	if it.Error() != nil {
+		return iteratorIssue(it.Error(), &addrHash, issue)
+	}
+	return nil
+}
+
+// verifyNode checks that the trie node is stored under its hash. Nodes embedded in their parent have no hash of their own.
+func verifyNode(db ethdb.KeyValueReader, hash common.Hash, addrHash *common.Hash, issue func(StateIssue) error) error {
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	blob := rawdb.ReadLegacyTrieNode(db, hash)
+	if len(blob) == 0 {
+		return issue(StateIssue{Kind: "missing-node", AddressHash: addrHash, Hash: hash})
+	}
+	if got := crypto.Keccak256Hash(blob); got != hash {
+		return issue(StateIssue{Kind: "invalid-node", AddressHash: addrHash, Hash: hash, Error: fmt.Sprintf("node hashes to %s", got)})
+	}
+	return nil
+}
+
+// iteratorIssue reports the error that stopped the walk of a trie, a missing node or a node that fails to decode.
+func iteratorIssue(err error, addrHash *common.Hash, issue func(StateIssue) error) error {
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		return issue(StateIssue{Kind: "missing-node", AddressHash: addrHash, Hash: missing.NodeHash, Error: err.Error()})
+	}
+	return issue(StateIssue{Kind: "invalid-node", AddressHash: addrHash, Error: err.Error()})
+}
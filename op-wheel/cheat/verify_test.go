@@ -0,0 +1,86 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyState(t *testing.T) {
+	ctx := context.Background()
+	contract, user := common.Address{0: 0xa}, common.Address{0: 0xb}
+	code := []byte{0x60, 0x00, 0x56}
+	kv := rawdb.NewMemoryDatabase()
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(kv), nil)
+	require.NoError(t, err)
+	headState.SetBalance(user, big.NewInt(42))
+	headState.SetCode(contract, code)
+	for i := byte(1); i <= 20; i++ {
+		headState.SetState(contract, common.Hash{31: i}, common.Hash{0: 0xff, 31: i})
+	}
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	require.NoError(t, headState.Database().TrieDB().Commit(root, false))
+	storage, err := headState.StorageTrie(contract)
+	require.NoError(t, err)
+	storageRoot := storage.Hash()
+
+	verify := func() ([]StateIssue, *StateReport, error) {
+		headState, err := state.New(root, state.NewDatabase(kv), nil)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		verr := VerifyState(&out)(ctx, headState)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var issues []StateIssue
+		for _, line := range lines[:len(lines)-1] {
+			var i StateIssue
+			require.NoError(t, json.Unmarshal([]byte(line), &i))
+			issues = append(issues, i)
+		}
+		var report StateReport
+		require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &report))
+		return issues, &report, verr
+	}
+
+	issues, report, err := verify()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+	require.Equal(t, root, report.Root)
+	require.Equal(t, uint64(2), report.Accounts)
+	require.Equal(t, uint64(20), report.Slots)
+	require.Equal(t, uint64(1), report.Codes)
+
+	// a node stored under the wrong hash
+	child := rawdb.ReadLegacyTrieNode(kv, storageRoot)
+	rawdb.WriteLegacyTrieNode(kv, storageRoot, append(child, 0))
+	issues, _, err = verify()
+	require.Error(t, err)
+	require.NotEmpty(t, issues)
+	require.Equal(t, "invalid-node", issues[0].Kind)
+	require.Equal(t, storageRoot, issues[0].Hash)
+	contractHash := crypto.Keccak256Hash(contract[:])
+	require.Equal(t, &contractHash, issues[0].AddressHash)
+	rawdb.WriteLegacyTrieNode(kv, storageRoot, child)
+
+	// missing storage and code, the walk continues with the other accounts
+	rawdb.DeleteLegacyTrieNode(kv, storageRoot)
+	rawdb.DeleteCode(kv, crypto.Keccak256Hash(code))
+	issues, report, err = verify()
+	require.Error(t, err)
+	require.Len(t, issues, 2)
+	require.Equal(t, "missing-node", issues[0].Kind)
+	require.Equal(t, storageRoot, issues[0].Hash)
+	require.Equal(t, "missing-code", issues[1].Kind)
+	require.Equal(t, uint64(2), report.Accounts)
+	require.Equal(t, uint64(2), report.Issues)
+}
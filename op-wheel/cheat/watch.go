@@ -0,0 +1,166 @@
+package cheat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// WatchFile is a cheat file in a watched directory: a cheat script (.yaml, .yml or .json), see ReadCheatScript,
+// or a storage patch (.patch) of the account that its name ends with, e.g. 001-0x4200000000000000000000000000000000000016.patch.
+type WatchFile struct {
+	Path string
+	// Patch is true for storage patches, false for cheat scripts.
+	Patch bool
+}
+
+// ParseWatchFile returns the cheat file at the given path, or false if the path is not a cheat file.
+// Hidden files and other extensions, e.g. .tmp, are ignored, so cheat files can be written and then renamed into place.
+func ParseWatchFile(path string) (WatchFile, bool) {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return WatchFile{}, false
+	}
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return WatchFile{Path: path}, true
+	case ".patch":
+		return WatchFile{Path: path, Patch: true}, true
+	default:
+		return WatchFile{}, false
+	}
+}
+
+// address returns the account of a storage patch, that the file name ends with.
+func (f WatchFile) address() (common.Address, error) {
+	name := filepath.Base(f.Path)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.LastIndexAny(stem, "-_."); i >= 0 {
+		stem = stem[i+1:]
+	}
+	if !common.IsHexAddress(stem) {
+		return common.Address{}, fmt.Errorf("storage patch %q does not end with the address of the account to patch", name)
+	}
+	return common.HexToAddress(stem), nil
+}
+
+// PendingWatchFiles lists the cheat files in the directory, in order of their names.
+// Files are no longer pending once they are marked as applied or failed, see MarkWatchFile.
+func PendingWatchFiles(dir string) ([]WatchFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watched directory: %w", err)
+	}
+	var out []WatchFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if f, ok := ParseWatchFile(filepath.Join(dir, entry.Name())); ok {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+// MarkWatchFile renames the cheat file to <name>.applied, or to <name>.failed if it failed to apply,
+// with the error in <name>.failed.err, so it is no longer pending.
+func MarkWatchFile(f WatchFile, applyErr error) error {
+	if applyErr == nil {
+		return os.Rename(f.Path, f.Path+".applied")
+	}
+	if err := os.WriteFile(f.Path+".failed.err", []byte(applyErr.Error()+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write error of %s: %w", f.Path, err)
+	}
+	return os.Rename(f.Path, f.Path+".failed")
+}
+
+// HeadFn reads the cheat file, and returns the cheat to apply it to the head state.
+func (f WatchFile) HeadFn(ctx context.Context) (HeadFn, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cheat file: %w", err)
+	}
+	if f.Patch {
+		addr, err := f.address()
+		if err != nil {
+			return nil, err
+		}
+		// the patch is parsed upfront, so a malformed patch fails before the data dir is opened
+		if _, err := ReadStoragePatch(ctx, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		return StoragePatch(bytes.NewReader(data), addr), nil
+	}
+	script, err := ReadCheatScript(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ApplyScript(script), nil
+}
+
+// ApplyRPC applies the cheat file to the state of a running node.
+func (f WatchFile) ApplyRPC(ctx context.Context, ch *RPCCheater) error {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read cheat file: %w", err)
+	}
+	if f.Patch {
+		addr, err := f.address()
+		if err != nil {
+			return err
+		}
+		return ch.StoragePatch(ctx, bytes.NewReader(data), addr)
+	}
+	script, err := ReadCheatScript(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return ch.ApplyScript(ctx, script)
+}
+
+// ErrWatchDeferred is returned by the apply function of ApplyWatchDir to keep the file pending, e.g. while the data dir is in use.
+var ErrWatchDeferred = errors.New("cheat file deferred")
+
+// ApplyWatchDir applies the pending cheat files of the directory in order with the given function, and marks them.
+// Files that fail to apply are marked as failed, and the next files are still applied.
+// If apply returns ErrWatchDeferred, the file and the files after it stay pending, to be applied later.
+// It returns the number of applied files.
+func ApplyWatchDir(ctx context.Context, logger log.Logger, dir string, apply func(ctx context.Context, f WatchFile) error) (int, error) {
+	files, err := PendingWatchFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+		applyErr := apply(ctx, f)
+		if errors.Is(applyErr, ErrWatchDeferred) {
+			return applied, nil
+		}
+		if applyErr != nil && ctx.Err() != nil {
+			return applied, ctx.Err() // interrupted, the file is not marked as failed
+		}
+		if err := MarkWatchFile(f, applyErr); err != nil {
+			return applied, fmt.Errorf("failed to mark cheat file %s: %w", f.Path, err)
+		}
+		if applyErr != nil {
+			logger.Error("failed to apply cheat file", "file", f.Path, "err", applyErr)
+			continue
+		}
+		logger.Info("applied cheat file", "file", f.Path)
+		applied++
+	}
+	return applied, nil
+}
@@ -0,0 +1,72 @@
+package cheat
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyWatchDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	addr := common.Address{0: 0xa}
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("001-balance.yaml", "steps:\n  - {op: balance, address: "+addr.Hex()+", value: 42}\n")
+	patch := "+" + common.Hash{31: 1}.Hex() + " = " + common.Hash{31: 2}.Hex() + "\n"
+	write("002-"+addr.Hex()+".patch", patch)
+	write("003-unknown.patch", patch)
+	write("004-nonce.json", `{"steps": [{"op": "nonce", "address": "`+addr.Hex()+`", "value": 7}]}`)
+	write("005-later.yaml.tmp", "steps: []\n")
+	write(".hidden.yaml", "steps: []\n")
+
+	files, err := PendingWatchFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+	require.True(t, files[1].Patch)
+
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	apply := func(ctx context.Context, f WatchFile) error {
+		fn, err := f.HeadFn(ctx)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, headState)
+	}
+	// the data dir is not available: the files stay pending
+	applied, err := ApplyWatchDir(ctx, log.New(), dir, func(ctx context.Context, f WatchFile) error {
+		return ErrWatchDeferred
+	})
+	require.NoError(t, err)
+	require.Zero(t, applied)
+	files, err = PendingWatchFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+
+	applied, err = ApplyWatchDir(ctx, log.New(), dir, apply)
+	require.NoError(t, err)
+	require.Equal(t, 3, applied)
+	require.Equal(t, big.NewInt(42), headState.GetBalance(addr))
+	require.Equal(t, common.Hash{31: 2}, headState.GetState(addr, common.Hash{31: 1}))
+	require.Equal(t, uint64(7), headState.GetNonce(addr))
+
+	require.FileExists(t, filepath.Join(dir, "001-balance.yaml.applied"))
+	require.FileExists(t, filepath.Join(dir, "003-unknown.patch.failed"))
+	msg, err := os.ReadFile(filepath.Join(dir, "003-unknown.patch.failed.err"))
+	require.NoError(t, err)
+	require.Contains(t, string(msg), "does not end with the address")
+	files, err = PendingWatchFiles(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
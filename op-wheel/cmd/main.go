@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -13,6 +17,9 @@ import (
 	wheel "github.com/ethereum-optimism/optimism/op-wheel"
 )
 
+// timeoutGrace is the time a command has to stop after its timeout expired, before the process exits.
+const timeoutGrace = 30 * time.Second
+
 var (
 	Version   = ""
 	GitCommit = ""
@@ -25,27 +32,54 @@ func main() {
 	app.Name = "op-wheel"
 	app.Usage = "Optimism Wheel is a CLI tool for the execution engine"
 	app.Description = "Optimism Wheel is a CLI tool to direct the engine one way or the other with DB cheats and Engine API routines."
-	app.Flags = []cli.Flag{wheel.GlobalGethLogLvlFlag}
+	app.Flags = []cli.Flag{wheel.GlobalGethLogLvlFlag, wheel.GlobalTimeoutFlag}
+	cancelTimeout := context.CancelFunc(func() {})
+	defer func() { cancelTimeout() }()
 	app.Before = func(c *cli.Context) error {
 		log.Root().SetHandler(
 			log.LvlFilterHandler(
 				oplog.Level(c.String(wheel.GlobalGethLogLvlFlag.Name)),
-				log.StreamHandler(os.Stdout, log.TerminalFormat(true)),
+				log.MultiHandler(
+					log.StreamHandler(os.Stdout, log.TerminalFormat(true)),
+					wheel.ForensicLogs,
+				),
 			),
 		)
+		if timeout := c.Duration(wheel.GlobalTimeoutFlag.Name); timeout > 0 {
+			// Sub-commands inherit the context, so all their operations are bound by the deadline.
+			c.Context, cancelTimeout = context.WithTimeout(c.Context, timeout)
+			// Operations that do not honor the context must not hang CI jobs forever either.
+			time.AfterFunc(timeout+timeoutGrace, func() {
+				log.Crit("Command did not stop after the timeout", "timeout", timeout)
+			})
+		}
 		return nil
 	}
 	app.Action = cli.ActionFunc(func(c *cli.Context) error {
-		return errors.New("see 'cheat' and 'engine' subcommands and --help")
+		return errors.New("see 'init', 'cheat', 'engine' and 'node' subcommands and --help")
 	})
 	app.Writer = os.Stdout
 	app.ErrWriter = os.Stderr
 	app.Commands = []*cli.Command{
+		wheel.InitCmd,
 		wheel.CheatCmd,
 		wheel.EngineCmd,
+		wheel.NodeCmd,
+		wheel.ExplorerCmd,
+		wheel.MockEngineCmd,
+		wheel.DescribeCmd,
+		wheel.ApplyPlanCmd,
+		wheel.JobsCmd,
+		wheel.VerifyManifestCmd,
+		wheel.PreflightCmd,
+		wheel.DrillCmd,
+		wheel.VersionCmd,
 	}
 
-	err := app.Run(os.Args)
+	// Interrupts cancel the context of the running command, so it can stop cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Crit("Application failed", "message", err)
 	}
@@ -1,37 +1,69 @@
 package wheel
 
 import (
+	"bytes"
 	"context"
 	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/urfave/cli/v2"
 
+	"github.com/ethereum-optimism/optimism/op-bindings/predeploys"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/genesis"
+	"github.com/ethereum-optimism/optimism/op-chain-ops/immutables"
 	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	opservice "github.com/ethereum-optimism/optimism/op-service"
+	opcrypto "github.com/ethereum-optimism/optimism/op-service/crypto"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+	opsigner "github.com/ethereum-optimism/optimism/op-signer/client"
 	"github.com/ethereum-optimism/optimism/op-wheel/cheat"
 	"github.com/ethereum-optimism/optimism/op-wheel/engine"
 )
 
 const envVarPrefix = "OP_WHEEL"
 
+// ForensicLogs records the most recent logs, to attach to forensic bundles.
+var ForensicLogs = engine.NewLogRecorder(1000)
+
 func prefixEnvVars(name string) []string {
 	return []string{envVarPrefix + "_" + name}
 }
 
+// newStreamLogger creates a logger like oplog.NewLogger, and sets it as root logger too, but writes to w instead of stdout.
+func newStreamLogger(cfg oplog.CLIConfig, w io.Writer) log.Logger {
+	handler := log.StreamHandler(w, oplog.Format(cfg.Format, cfg.Color))
+	handler = log.SyncHandler(handler)
+	handler = log.LvlFilterHandler(oplog.Level(cfg.Level), handler)
+	log.Root().SetHandler(handler)
+	l := log.New()
+	l.SetHandler(handler)
+	return l
+}
+
 var (
 	GlobalGethLogLvlFlag = &cli.StringFlag{
 		Name:    "geth-log-level",
@@ -39,13 +71,44 @@ var (
 		EnvVars: prefixEnvVars("GETH_LOG_LEVEL"),
 		Value:   "error",
 	}
-	DataDirFlag = &cli.StringFlag{
-		Name:      "data-dir",
-		Usage:     "Geth data dir location.",
+	GlobalTimeoutFlag = &cli.DurationFlag{
+		Name: "timeout",
+		Usage: "Deadline of the command: database operations and RPC calls are canceled when it expires, " +
+			"and the process exits if the command does not stop shortly after. Disabled if 0.",
+		EnvVars: prefixEnvVars("TIMEOUT"),
+	}
+	DataDirFlag = &cli.StringSliceFlag{
+		Name: "data-dir",
+		Usage: "Geth data dir location. Can be repeated, comma-separated, or a glob pattern, " +
+			"to apply the same cheat to each data dir in turn.",
 		Required:  true,
 		TakesFile: true,
 		EnvVars:   prefixEnvVars("DATA_DIR"),
 	}
+	// OptDataDirFlag is the DataDirFlag for cheats that can also be applied to a running node, see ViaFlag.
+	OptDataDirFlag = &cli.StringSliceFlag{
+		Name:      DataDirFlag.Name,
+		Usage:     "Geth data dir location. Required with --via=db. Can be repeated, like with the other cheats.",
+		TakesFile: true,
+		EnvVars:   DataDirFlag.EnvVars,
+	}
+	ViaFlag = &cli.StringFlag{
+		Name:    "via",
+		Usage:   "How to apply the cheat: 'db' opens the data dir of a stopped node, 'rpc' changes the state of a running node over its RPC.",
+		EnvVars: prefixEnvVars("VIA"),
+		Value:   "db",
+	}
+	CheatRPCFlag = &cli.StringFlag{
+		Name:    "rpc",
+		Usage:   "RPC endpoint of the running node to apply the cheat to with --via=rpc, can be HTTP/WS/IPC",
+		EnvVars: prefixEnvVars("RPC"),
+	}
+	CheatRPCNamespaceFlag = &cli.StringFlag{
+		Name:    "rpc.namespace",
+		Usage:   "RPC namespace with the setBalance/setCode/setNonce/setStorageAt methods, e.g. debug, anvil or hardhat",
+		EnvVars: prefixEnvVars("RPC_NAMESPACE"),
+		Value:   "debug",
+	}
 	EngineEndpoint = &cli.StringFlag{
 		Name:     "engine",
 		Usage:    "Engine API RPC endpoint, can be HTTP/WS/IPC",
@@ -59,6 +122,24 @@ var (
 		TakesFile: true,
 		EnvVars:   prefixEnvVars("ENGINE_JWT_SECRET"),
 	}
+	ExpectChainIDFlag = &cli.Uint64Flag{
+		Name:    "expect-chain-id",
+		Usage:   "Chain ID the engine is expected to be on, checked on connect. Disabled if 0.",
+		EnvVars: prefixEnvVars("EXPECT_CHAIN_ID"),
+	}
+	RollupConfigFlag = &cli.StringFlag{
+		Name:      "rollup-config",
+		Usage:     "Path to a rollup config JSON file, to check the chain ID and genesis block of the engine against on connect.",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("ROLLUP_CONFIG"),
+	}
+	ForensicsDirFlag = &cli.StringFlag{
+		Name:      "forensics-dir",
+		Usage:     "Directory to write a forensic bundle to when the engine responds with an INVALID status. Disabled if empty.",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("FORENSICS_DIR"),
+		Value:     filepath.Join(os.TempDir(), "op-wheel-forensics"),
+	}
 	FeeRecipientFlag = &cli.GenericFlag{
 		Name:    "fee-recipient",
 		Usage:   "fee-recipient of the block building",
@@ -71,6 +152,19 @@ var (
 		EnvVars: prefixEnvVars("RANDAO"),
 		Value:   &TextFlag[*common.Hash]{Value: &common.Hash{1: 0x13, 2: 0x37}},
 	}
+	RandaoSourceFlag = &cli.StringFlag{
+		Name: "randao-source",
+		Usage: "L1 RPC to take the prevRandao of built blocks from, instead of the randao flag: " +
+			"of the L1 origin with an L1 origin, else of the latest L1 block.",
+		EnvVars: prefixEnvVars("RANDAO_SOURCE"),
+	}
+	NoTxPoolFlag = &cli.GenericFlag{
+		Name: "no-tx-pool",
+		Usage: "Blocks to build with only the forced transactions, even if the tx-pool has transactions, like a sequencer during derivation-only periods: " +
+			"comma-separated block numbers and ranges, e.g. 10,20-30,40-, or all",
+		EnvVars: prefixEnvVars("NO_TX_POOL"),
+		Value:   &TextFlag[*engine.BlockSet]{Value: new(engine.BlockSet)},
+	}
 	BlockTimeFlag = &cli.Uint64Flag{
 		Name:    "block-time",
 		Usage:   "block time, interval of timestamps between blocks to build, in seconds",
@@ -83,6 +177,89 @@ var (
 		EnvVars: prefixEnvVars("BUILDING_TIME"),
 		Value:   time.Second * 6,
 	}
+	CompactFlag = &cli.BoolFlag{
+		Name:    "compact",
+		Usage:   "Compact the database after applying the cheat, recommended after large surgeries.",
+		EnvVars: prefixEnvVars("COMPACT"),
+	}
+	DryRunFlag = &cli.BoolFlag{
+		Name:    "dry-run",
+		Usage:   "Print the diff of the state change, with the new state root, instead of applying the cheat. The database is opened read-only.",
+		EnvVars: prefixEnvVars("DRY_RUN"),
+	}
+	TxFileFlag = &cli.StringFlag{
+		Name:      "tx-file",
+		Usage:     "Path to a file with hex-encoded signed raw transactions, one per line, to force into the block. Requires op-geth.",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("TX_FILE"),
+	}
+	TxSimFlag = &cli.StringFlag{
+		Name:    "tx-sim",
+		Usage:   "Simulate the --tx-file transactions before inclusion: off, drop (drop failing txs), fail (abort on failing txs)",
+		EnvVars: prefixEnvVars("TX_SIM"),
+		Value:   "off",
+	}
+	TemplateFlag = &cli.BoolFlag{
+		Name:    "template",
+		Usage:   "Render the input as Go template before applying it. Implied by --values and --set.",
+		EnvVars: prefixEnvVars("TEMPLATE"),
+	}
+	TemplateValuesFlag = &cli.StringFlag{
+		Name:      "values",
+		Usage:     "Path to a JSON or YAML file with values for the template variables.",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("VALUES"),
+	}
+	TemplateSetFlag = &cli.StringSliceFlag{
+		Name:    "set",
+		Usage:   "Template variable as key=value, overrides the values file. Can be repeated.",
+		EnvVars: prefixEnvVars("SET"),
+	}
+	L1OriginFlag = &cli.StringFlag{
+		Name: "l1-origin",
+		Usage: "Build OP Stack L2 blocks with an L1 info deposit: L1 RPC to follow the L1 chain with, " +
+			"or path to a JSON L1 header file to use as fixed origin. Requires the rollup config.",
+		EnvVars: prefixEnvVars("L1_ORIGIN"),
+	}
+	OutputFlag = &cli.StringFlag{
+		Name:    "output",
+		Usage:   "Output format: 'default', or 'l2-block-ref' for op-node L2 block refs, with the L1 origin. The latter requires the rollup config.",
+		EnvVars: prefixEnvVars("OUTPUT"),
+		Value:   "default",
+	}
+	MinPriorityFeeFlag = &cli.GenericFlag{
+		Name:    "min-priority-fee",
+		Usage:   "Minimum priority fee in wei of the tx pool transactions to include in built blocks, set with the miner API of the engine on connect",
+		EnvVars: prefixEnvVars("MIN_PRIORITY_FEE"),
+		Value:   &TextFlag[*big.Int]{Value: new(big.Int)},
+	}
+	MinerRPCFlag = &cli.StringFlag{
+		Name:    "miner-rpc",
+		Usage:   "RPC with the miner API of the engine, to apply the miner settings with. The engine endpoint if not set.",
+		EnvVars: prefixEnvVars("MINER_RPC"),
+	}
+	ERC20MappingSlotFlag = &cli.Uint64Flag{
+		Name:    "mapping-slot",
+		Usage:   "Slot of the token mapping to write. Probed if not set.",
+		EnvVars: prefixEnvVars("MAPPING_SLOT"),
+	}
+	ERC20VyperFlag = &cli.BoolFlag{
+		Name:    "vyper",
+		Usage:   "The mapping at the mapping-slot uses the Vyper storage layout, instead of the Solidity one",
+		EnvVars: prefixEnvVars("VYPER"),
+	}
+	ERC20MaxProbeFlag = &cli.Uint64Flag{
+		Name:    "max-probe",
+		Usage:   "Highest slot to probe for the token mapping",
+		EnvVars: prefixEnvVars("MAX_PROBE"),
+		Value:   50,
+	}
+	RollupRPCFlag = &cli.StringFlag{
+		Name:     "rollup-rpc",
+		Usage:    "Rollup RPC of the op-node that drives the engine",
+		EnvVars:  prefixEnvVars("ROLLUP_RPC"),
+		Required: true,
+	}
 	AllowGaps = &cli.BoolFlag{
 		Name:    "allow-gaps",
 		Usage:   "allow gaps in block building, like missed slots on the beacon chain.",
@@ -90,35 +267,376 @@ var (
 	}
 )
 
+// SignerFlags configure the account to send transactions with, for the commands that need to do so.
+var SignerFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:    "private-key",
+		Usage:   "Hex-encoded private key to sign transactions with",
+		EnvVars: prefixEnvVars("PRIVATE_KEY"),
+	},
+	&cli.StringFlag{
+		Name:    "mnemonic",
+		Usage:   "Mnemonic to derive the key to sign transactions with",
+		EnvVars: prefixEnvVars("MNEMONIC"),
+	},
+	&cli.StringFlag{
+		Name:    "hd-path",
+		Usage:   "HD derivation path of the key to derive from the mnemonic",
+		EnvVars: prefixEnvVars("HD_PATH"),
+		Value:   "m/44'/60'/0'/0/0",
+	},
+	&cli.StringFlag{
+		Name:      "keystore",
+		Usage:     "Path to an encrypted keystore file with the key to sign transactions with",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("KEYSTORE"),
+	},
+	&cli.StringFlag{
+		Name:      "keystore.password-file",
+		Usage:     "Path to the file with the password to decrypt the keystore file with",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("KEYSTORE_PASSWORD_FILE"),
+	},
+}, opsigner.CLIFlags(envVarPrefix)...)
+
+// ParseSigner creates the transaction signer configured with the SignerFlags.
+// A remote signer (e.g. clef, web3signer or op-signer) takes precedence over a keystore,
+// which takes precedence over a mnemonic or private key.
+func ParseSigner(ctx *cli.Context) (opcrypto.SignerFactory, common.Address, error) {
+	signerCfg := opsigner.ReadCLIConfig(ctx)
+	if err := signerCfg.Check(); err != nil {
+		return nil, common.Address{}, fmt.Errorf("invalid remote signer config: %w", err)
+	}
+	privateKey := ctx.String("private-key")
+	if path := ctx.String("keystore"); path != "" && !signerCfg.Enabled() {
+		keyJSON, err := os.ReadFile(path)
+		if err != nil {
+			return nil, common.Address{}, fmt.Errorf("failed to read keystore file: %w", err)
+		}
+		var password []byte
+		if passwordPath := ctx.String("keystore.password-file"); passwordPath != "" {
+			password, err = os.ReadFile(passwordPath)
+			if err != nil {
+				return nil, common.Address{}, fmt.Errorf("failed to read keystore password file: %w", err)
+			}
+		}
+		key, err := keystore.DecryptKey(keyJSON, strings.TrimRight(string(password), "\r\n"))
+		if err != nil {
+			return nil, common.Address{}, fmt.Errorf("failed to decrypt keystore file: %w", err)
+		}
+		privateKey = hexutil.Encode(crypto.FromECDSA(key.PrivateKey))
+	}
+	mnemonic := ctx.String("mnemonic")
+	if !signerCfg.Enabled() && privateKey == "" && mnemonic == "" {
+		return nil, common.Address{}, errors.New("no signer configured: need a private key, mnemonic, keystore or remote signer")
+	}
+	return opcrypto.SignerFactoryFromConfig(log.Root(), privateKey, mnemonic, ctx.String("hd-path"), signerCfg)
+}
+
 func ParseBuildingArgs(ctx *cli.Context) *engine.BlockBuildingSettings {
-	return &engine.BlockBuildingSettings{
+	settings := &engine.BlockBuildingSettings{
 		BlockTime:    ctx.Uint64(BlockTimeFlag.Name),
 		AllowGaps:    ctx.Bool(AllowGaps.Name),
 		Random:       hashFlagValue(RandaoFlag.Name, ctx),
 		FeeRecipient: addrFlagValue(FeeRecipientFlag.Name, ctx),
 		BuildTime:    ctx.Duration(BuildingTime.Name),
 	}
+	if ctx.IsSet(NoTxPoolFlag.Name) {
+		settings.NoTxPool = *ctx.Generic(NoTxPoolFlag.Name).(*TextFlag[*engine.BlockSet]).Value
+	}
+	return settings
+}
+
+// ParseRandaoSource dials the L1 RPC to take the prevRandao of built blocks from,
+// or returns nil if no randao source is configured.
+func ParseRandaoSource(ctx *cli.Context) (*engine.L1Randao, error) {
+	endpoint := ctx.String(RandaoSourceFlag.Name)
+	if endpoint == "" {
+		return nil, nil
+	}
+	if ctx.IsSet(RandaoFlag.Name) {
+		return nil, fmt.Errorf("cannot use both --%s and --%s", RandaoFlag.Name, RandaoSourceFlag.Name)
+	}
+	return dialRandaoSource(ctx.Context, endpoint)
+}
+
+func dialRandaoSource(ctx context.Context, endpoint string) (*engine.L1Randao, error) {
+	l1, err := dialRPC(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial randao source: %w", err)
+	}
+	return &engine.L1Randao{Client: l1, Endpoint: endpoint}, nil
+}
+
+// ParseFeeRecipientSource parses the flags of a contract to read the fee recipient of each block from, if any.
+func ParseFeeRecipientSource(ctx *cli.Context) (*engine.FeeRecipientSource, error) {
+	if !ctx.IsSet("fee-recipients.contract") {
+		if ctx.IsSet("fee-recipients.slot") || ctx.IsSet("fee-recipients.call") {
+			return nil, errors.New("--fee-recipients.slot and --fee-recipients.call require --fee-recipients.contract")
+		}
+		return nil, nil
+	}
+	if ctx.IsSet("fee-recipients") || ctx.IsSet("fee-recipients.schedule") {
+		return nil, errors.New("cannot use both a fee recipients contract and fee-recipients or a fee recipient schedule")
+	}
+	src := &engine.FeeRecipientSource{Contract: addrFlagValue("fee-recipients.contract", ctx)}
+	switch {
+	case ctx.IsSet("fee-recipients.slot") && ctx.IsSet("fee-recipients.call"):
+		return nil, errors.New("cannot use both --fee-recipients.slot and --fee-recipients.call")
+	case ctx.IsSet("fee-recipients.slot"):
+		slot := hashFlagValue("fee-recipients.slot", ctx)
+		src.Slot = &slot
+	case ctx.IsSet("fee-recipients.call"):
+		src.Data = crypto.Keccak256([]byte(ctx.String("fee-recipients.call")))[:4]
+	default:
+		return nil, errors.New("--fee-recipients.contract requires --fee-recipients.slot or --fee-recipients.call")
+	}
+	return src, nil
+}
+
+// applyMinerSettings configures the tx pool block building of the engine, if any miner flags are set.
+func applyMinerSettings(ctx *cli.Context, engineClient client.RPC) error {
+	if !ctx.IsSet(MinPriorityFeeFlag.Name) {
+		return nil
+	}
+	minerClient := engineClient
+	if endpoint := ctx.String(MinerRPCFlag.Name); endpoint != "" {
+		var err error
+		if minerClient, err = dialRPC(ctx.Context, endpoint); err != nil {
+			return fmt.Errorf("failed to dial miner RPC: %w", err)
+		}
+		defer minerClient.Close()
+	}
+	return engine.SetMinPriorityFee(ctx.Context, minerClient, bigFlagValue(MinPriorityFeeFlag.Name, ctx))
+}
+
+// checkAutoState returns an error if any building flag is set explicitly to a value that differs from the persisted state,
+// so a restart from stale shell history cannot silently change the block production.
+func checkAutoState(ctx *cli.Context, state *engine.AutoState, settings *engine.BlockBuildingSettings) error {
+	persisted := *settings
+	if err := state.Apply(&persisted); err != nil {
+		return err
+	}
+	conflicts := []struct {
+		flag     string
+		set, old any
+	}{
+		{BlockTimeFlag.Name, settings.BlockTime, persisted.BlockTime},
+		{AllowGaps.Name, settings.AllowGaps, persisted.AllowGaps},
+		{RandaoFlag.Name, settings.Random, persisted.Random},
+		{FeeRecipientFlag.Name, settings.FeeRecipient, persisted.FeeRecipient},
+		{"fee-recipients", settings.FeeRecipients, persisted.FeeRecipients},
+		{"fee-recipients.schedule", settings.FeeRecipients, persisted.FeeRecipients},
+		{"fee-recipients.contract", settings.FeeRecipientSource, persisted.FeeRecipientSource},
+		{"fee-recipients.slot", settings.FeeRecipientSource, persisted.FeeRecipientSource},
+		{"fee-recipients.call", settings.FeeRecipientSource, persisted.FeeRecipientSource},
+		{BuildingTime.Name, settings.BuildTime, persisted.BuildTime},
+	}
+	for _, c := range conflicts {
+		if ctx.IsSet(c.flag) && fmt.Sprint(c.set) != fmt.Sprint(c.old) {
+			return fmt.Errorf("--%s=%v conflicts with the persisted value %v, remove the state file to change it", c.flag, c.set, c.old)
+		}
+	}
+	return nil
+}
+
+// ParseL1Origin reads the L1 origin settings for building OP Stack L2 blocks,
+// or returns nil if no L1 origin is configured.
+func ParseL1Origin(ctx *cli.Context) (*engine.L1OriginSettings, error) {
+	origin := ctx.String(L1OriginFlag.Name)
+	if origin == "" {
+		return nil, nil
+	}
+	path := ctx.String(RollupConfigFlag.Name)
+	if path == "" {
+		return nil, fmt.Errorf("--%s requires --%s", L1OriginFlag.Name, RollupConfigFlag.Name)
+	}
+	rollupCfg, err := loadRollupConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	settings := &engine.L1OriginSettings{Rollup: rollupCfg}
+	if info, err := os.Stat(origin); err == nil && info.Mode().IsRegular() {
+		if settings.Source, err = engine.ReadL1OriginFile(origin); err != nil {
+			return nil, err
+		}
+		return settings, nil
+	}
+	l1, err := dialRPC(ctx.Context, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial L1 RPC: %w", err)
+	}
+	settings.Source = &engine.RPCL1Origin{Client: l1}
+	return settings, nil
+}
+
+// dataDirs returns the data dirs of the DataDirFlag, with the glob patterns expanded, in the given order.
+func dataDirs(ctx *cli.Context) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]struct{})
+	for _, v := range ctx.StringSlice(DataDirFlag.Name) {
+		matches := []string{v}
+		if strings.ContainsAny(v, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(v); err != nil {
+				return nil, fmt.Errorf("invalid data dir pattern %q: %w", v, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("data dir pattern %q matches no data dirs", v)
+			}
+		}
+		for _, dir := range matches {
+			if _, ok := seen[dir]; !ok {
+				seen[dir] = struct{}{}
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// DataDirResult is the outcome of a cheat on one of multiple data dirs.
+type DataDirResult struct {
+	DataDir string `json:"dataDir"`
+	Err     string `json:"error,omitempty"`
+}
+
+// forEachDataDir runs fn on each data dir of the DataDirFlag, one at a time.
+// With multiple data dirs, a failure on one data dir does not stop the others:
+// the result of each data dir is written as JSON line after its own output, and the action fails if any data dir failed.
+func forEachDataDir(ctx *cli.Context, fn func(dataDir string) error) error {
+	dirs, err := dataDirs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 1 {
+		return fn(dirs[0])
+	}
+	enc := json.NewEncoder(ctx.App.Writer)
+	// the input is read at most once, and each data dir reads all of it
+	input := &replayInput{src: ctx.App.Reader}
+	defer func(r io.Reader) { ctx.App.Reader = r }(ctx.App.Reader)
+	var failed []string
+	for i, dir := range dirs {
+		if err := ctx.Context.Err(); err != nil {
+			return fmt.Errorf("interrupted before data dir %s, %d of %d data dirs were not cheated: %w", dir, len(dirs)-i, len(dirs), err)
+		}
+		log.Info("cheating data dir", "data_dir", dir, "index", i+1, "total", len(dirs))
+		ctx.App.Reader = input.reader()
+		result := DataDirResult{DataDir: dir}
+		if err := fn(dir); err != nil {
+			log.Error("cheat failed", "data_dir", dir, "err", err)
+			result.Err = err.Error()
+			failed = append(failed, dir)
+		}
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cheat failed on %d of %d data dirs: %s", len(failed), len(dirs), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// replayInput reads its source on first use, and then replays it to each of its readers,
+// so the cheats of all data dirs get the same input.
+type replayInput struct {
+	src  io.Reader
+	data []byte
+	err  error
+	read bool
+}
+
+func (in *replayInput) reader() io.Reader {
+	return &replayReader{in: in}
+}
+
+type replayReader struct {
+	in *replayInput
+	r  *bytes.Reader
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		if !r.in.read {
+			r.in.data, r.in.err = io.ReadAll(r.in.src)
+			r.in.read = true
+		}
+		if r.in.err != nil {
+			return 0, r.in.err
+		}
+		r.r = bytes.NewReader(r.in.data)
+	}
+	return r.r.Read(p)
 }
 
 func CheatAction(readOnly bool, fn func(ctx *cli.Context, ch *cheat.Cheater) error) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
-		dataDir := ctx.String(DataDirFlag.Name)
-		ch, err := cheat.OpenGethDB(dataDir, readOnly)
-		if err != nil {
-			return fmt.Errorf("failed to open geth db: %w", err)
+		dryRun := !readOnly && ctx.Bool(DryRunFlag.Name)
+		return forEachDataDir(ctx, func(dataDir string) error {
+			ch, err := cheat.OpenGethDB(dataDir, readOnly || dryRun)
+			if err != nil {
+				return fmt.Errorf("failed to open geth db: %w", err)
+			}
+			if dryRun {
+				ch.DryRun = ctx.App.Writer
+			}
+			if err := fn(ctx, ch); err != nil {
+				return err
+			}
+			if !readOnly && !dryRun && ctx.Bool(CompactFlag.Name) {
+				db, err := cheat.OpenGethRawDB(dataDir, false)
+				if err != nil {
+					return fmt.Errorf("failed to open raw geth db for compaction: %w", err)
+				}
+				defer db.Close()
+				return cheat.CompactDB(ctx.Context, db, ctx.App.Writer)
+			}
+			return nil
+		})
+	}
+}
+
+// CheatViaAction runs the online variant of a cheat against a running node if --via=rpc,
+// and the offline variant against the data dir otherwise.
+func CheatViaAction(offline func(ctx *cli.Context, ch *cheat.Cheater) error, online func(ctx *cli.Context, ch *cheat.RPCCheater) error) cli.ActionFunc {
+	dbAction := CheatAction(false, offline)
+	return func(ctx *cli.Context) error {
+		switch via := ctx.String(ViaFlag.Name); via {
+		case "db":
+			if len(ctx.StringSlice(DataDirFlag.Name)) == 0 {
+				return fmt.Errorf("--%s is required with --%s=db", DataDirFlag.Name, ViaFlag.Name)
+			}
+			return dbAction(ctx)
+		case "rpc":
+			endpoint := ctx.String(CheatRPCFlag.Name)
+			if endpoint == "" {
+				return fmt.Errorf("--%s is required with --%s=rpc", CheatRPCFlag.Name, ViaFlag.Name)
+			}
+			if ctx.Bool(DryRunFlag.Name) {
+				return fmt.Errorf("--%s is not supported with --%s=rpc", DryRunFlag.Name, ViaFlag.Name)
+			}
+			cl, err := dialRPC(ctx.Context, endpoint)
+			if err != nil {
+				return fmt.Errorf("failed to dial RPC endpoint %q: %w", endpoint, err)
+			}
+			return online(ctx, cheat.NewRPCCheater(cl, ctx.String(CheatRPCNamespaceFlag.Name)))
+		default:
+			return fmt.Errorf("unknown --%s mode: %q", ViaFlag.Name, via)
 		}
-		return fn(ctx, ch)
 	}
 }
 
 func CheatRawDBAction(readOnly bool, fn func(ctx *cli.Context, db ethdb.Database) error) cli.ActionFunc {
 	return func(ctx *cli.Context) error {
-		dataDir := ctx.String(DataDirFlag.Name)
-		db, err := cheat.OpenGethRawDB(dataDir, readOnly)
-		if err != nil {
-			return fmt.Errorf("failed to open raw geth db: %w", err)
-		}
-		return fn(ctx, db)
+		return forEachDataDir(ctx, func(dataDir string) error {
+			db, err := cheat.OpenGethRawDB(dataDir, readOnly)
+			if err != nil {
+				return fmt.Errorf("failed to open raw geth db: %w", err)
+			}
+			return fn(ctx, db)
+		})
 	}
 }
 
@@ -130,12 +648,153 @@ func EngineAction(fn func(ctx *cli.Context, client client.RPC) error) cli.Action
 		}
 		secret := common.HexToHash(strings.TrimSpace(string(jwtData)))
 		endpoint := ctx.String(EngineEndpoint.Name)
-		client, err := engine.DialClient(context.Background(), endpoint, secret)
+		client, err := engine.DialClient(ctx.Context, endpoint, secret)
 		if err != nil {
 			return fmt.Errorf("failed to dial Engine API endpoint %q: %w", endpoint, err)
 		}
-		return fn(ctx, client)
+		expected, err := ParseChainExpectation(ctx)
+		if err != nil {
+			return err
+		}
+		if err := engine.CheckChain(ctx.Context, client, expected); err != nil {
+			return fmt.Errorf("engine %q failed chain sanity check: %w", endpoint, err)
+		}
+		err = fn(ctx, client)
+		var invalid *engine.InvalidStatusError
+		if dir := ctx.String(ForensicsDirFlag.Name); dir != "" && errors.As(err, &invalid) {
+			path, bundleErr := engine.WriteForensicBundle(context.Background(), client, invalid, ForensicLogs, dir)
+			if bundleErr != nil {
+				return fmt.Errorf("%w (and failed to write forensic bundle: %v)", err, bundleErr)
+			}
+			return fmt.Errorf("%w (forensic bundle written to %s)", err, path)
+		}
+		return err
+	}
+}
+
+// templateInput renders the input as template, if templating is enabled by any of the template flags.
+func templateInput(ctx *cli.Context, r io.Reader) (io.Reader, error) {
+	valuesPath := ctx.String(TemplateValuesFlag.Name)
+	overrides := ctx.StringSlice(TemplateSetFlag.Name)
+	if !ctx.Bool(TemplateFlag.Name) && valuesPath == "" && len(overrides) == 0 {
+		return r, nil
+	}
+	values, err := cheat.ReadTemplateValues(valuesPath, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return cheat.RenderTemplate(r, values)
+}
+
+// simulateTxs simulates the transactions if enabled by the tx-sim flag, reports the outcome per tx,
+// and filters or fails on the transactions that are expected to fail.
+func simulateTxs(ctx *cli.Context, client client.RPC, txs []*types.Transaction) ([]*types.Transaction, error) {
+	mode := ctx.String(TxSimFlag.Name)
+	switch mode {
+	case "off":
+		return txs, nil
+	case "drop", "fail":
+	default:
+		return nil, fmt.Errorf("unknown tx simulation mode: %q", mode)
+	}
+	enc := json.NewEncoder(ctx.App.ErrWriter)
+	out := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		res := engine.SimulateTx(ctx.Context, client, tx)
+		if err := enc.Encode(res); err != nil {
+			return nil, err
+		}
+		if res.OK() {
+			out = append(out, tx)
+		} else if mode == "fail" {
+			return nil, fmt.Errorf("tx %s is expected to fail: %s", res.Hash, res.Err)
+		}
+	}
+	return out, nil
+}
+
+// dialRPC dials a regular unauthenticated JSON RPC endpoint, can be HTTP/WS/IPC.
+func dialRPC(ctx context.Context, endpoint string) (client.RPC, error) {
+	rpcClient, err := rpc.DialOptions(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewBaseRPCClient(rpcClient), nil
+}
+
+// erc20LayoutFlagValue returns the mapping layout of the ERC20MappingSlotFlag, or nil to probe it.
+func erc20LayoutFlagValue(ctx *cli.Context) *cheat.ERC20MappingLayout {
+	if !ctx.IsSet(ERC20MappingSlotFlag.Name) {
+		return nil
+	}
+	return &cheat.ERC20MappingLayout{
+		MappingSlot: common.BigToHash(new(big.Int).SetUint64(ctx.Uint64(ERC20MappingSlotFlag.Name))),
+		Vyper:       ctx.Bool(ERC20VyperFlag.Name),
+	}
+}
+
+// proxyOverrideFlagValue returns the new implementation and beacon of the proxy set-implementation flags that are set.
+func proxyOverrideFlagValue(ctx *cli.Context) *cheat.ProxyOverride {
+	var override cheat.ProxyOverride
+	if ctx.IsSet("implementation") {
+		impl := addrFlagValue("implementation", ctx)
+		override.Implementation = &impl
+	}
+	if ctx.IsSet("beacon") {
+		beacon := addrFlagValue("beacon", ctx)
+		override.Beacon = &beacon
+	}
+	return &override
+}
+
+// l2Output returns whether the output format is op-node L2 block refs, see OutputFlag.
+func l2Output(ctx *cli.Context) bool {
+	return ctx.String(OutputFlag.Name) == "l2-block-ref"
+}
+
+// parseRollupGenesis reads the genesis of the rollup config, required to extract L2 block refs.
+func parseRollupGenesis(ctx *cli.Context) (*rollup.Genesis, error) {
+	path := ctx.String(RollupConfigFlag.Name)
+	if path == "" {
+		return nil, fmt.Errorf("--%s=l2-block-ref requires --%s", OutputFlag.Name, RollupConfigFlag.Name)
+	}
+	cfg, err := loadRollupConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg.Genesis, nil
+}
+
+// ParseChainExpectation reads the chain ID and genesis the engine is expected to be on,
+// from the rollup config and chain ID flags. The explicit chain ID flag takes precedence.
+func ParseChainExpectation(ctx *cli.Context) (*engine.ChainExpectation, error) {
+	var expected engine.ChainExpectation
+	if path := ctx.String(RollupConfigFlag.Name); path != "" {
+		cfg, err := loadRollupConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		expected.ChainID = cfg.L2ChainID
+		expected.Genesis = &cfg.Genesis.L2
+	}
+	if id := ctx.Uint64(ExpectChainIDFlag.Name); id != 0 {
+		expected.ChainID = new(big.Int).SetUint64(id)
+	}
+	return &expected, nil
+}
+
+func loadRollupConfig(path string) (*rollup.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollup config: %w", err)
+	}
+	defer file.Close()
+
+	var rollupConfig rollup.Config
+	if err := json.NewDecoder(file).Decode(&rollupConfig); err != nil {
+		return nil, fmt.Errorf("failed to decode rollup config: %w", err)
 	}
+	return &rollupConfig, nil
 }
 
 type Text interface {
@@ -196,6 +855,101 @@ func bigFlag(name string, usage string) *cli.GenericFlag {
 	return textFlag[*big.Int](name, usage, new(big.Int))
 }
 
+// withDefaultSubcommand makes the command group run the given subcommand if no subcommand is named,
+// so the invocations from before the group replaced a single command keep working.
+// urfave/cli checks the required flags of a group before it picks the subcommand,
+// so the group takes optional copies of the flags of the subcommand, and checks the required ones itself.
+func withDefaultSubcommand(group *cli.Command, sub *cli.Command) *cli.Command {
+	var required []string
+	for _, f := range sub.Flags {
+		if rf, ok := f.(cli.RequiredFlag); ok && rf.IsRequired() {
+			gf, ok := f.(*cli.GenericFlag)
+			if !ok {
+				panic(fmt.Errorf("unsupported required flag %s of default subcommand %s", f.Names()[0], sub.Name))
+			}
+			opt := *gf
+			opt.Required = false
+			f = &opt
+			required = append(required, gf.Name)
+		}
+		group.Flags = append(group.Flags, f)
+	}
+	group.Action = func(ctx *cli.Context) error {
+		for _, name := range required {
+			if !ctx.IsSet(name) {
+				return fmt.Errorf("required flag %q not set, or name a subcommand", name)
+			}
+		}
+		return sub.Action(ctx)
+	}
+	return group
+}
+
+// AddressList is a comma-separated list of addresses, usable as TextFlag value.
+type AddressList []common.Address
+
+func (l *AddressList) UnmarshalText(text []byte) error {
+	*l = (*l)[:0]
+	for _, v := range strings.Split(string(text), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		var addr common.Address
+		if err := addr.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid address %q: %w", v, err)
+		}
+		*l = append(*l, addr)
+	}
+	return nil
+}
+
+func (l *AddressList) String() string {
+	out := make([]string, 0, len(*l))
+	for _, addr := range *l {
+		out = append(out, addr.String())
+	}
+	return strings.Join(out, ",")
+}
+
+type HashList []common.Hash
+
+func (l *HashList) UnmarshalText(text []byte) error {
+	*l = (*l)[:0]
+	for _, v := range strings.Split(string(text), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		var h common.Hash
+		if err := h.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("invalid hash %q: %w", v, err)
+		}
+		*l = append(*l, h)
+	}
+	return nil
+}
+
+func (l *HashList) String() string {
+	out := make([]string, 0, len(*l))
+	for _, h := range *l {
+		out = append(out, h.String())
+	}
+	return strings.Join(out, ",")
+}
+
+func hashListFlagValue(name string, ctx *cli.Context) []common.Hash {
+	return *ctx.Generic(name).(*TextFlag[*HashList]).Value
+}
+
+func addrListFlag(name string, usage string) *cli.GenericFlag {
+	return textFlag[*AddressList](name, usage, new(AddressList))
+}
+
+func addrListFlagValue(name string, ctx *cli.Context) []common.Address {
+	return *ctx.Generic(name).(*TextFlag[*AddressList]).Value
+}
+
 func addrFlagValue(name string, ctx *cli.Context) common.Address {
 	return *ctx.Generic(name).(*TextFlag[*common.Address]).Value
 }
@@ -204,6 +958,31 @@ func bytesFlagValue(name string, ctx *cli.Context) hexutil.Bytes {
 	return *ctx.Generic(name).(*TextFlag[*hexutil.Bytes]).Value
 }
 
+// stateRootFlagValue resolves a flag of a block number or state root to a state root,
+// or the zero hash, for the head state, if the flag is not set.
+func stateRootFlagValue(ctx *cli.Context, name string, ch *cheat.Cheater) (common.Hash, error) {
+	v := ctx.String(name)
+	if v == "" {
+		return common.Hash{}, nil
+	}
+	if len(v) == 2+2*common.HashLength {
+		var root common.Hash
+		if err := root.UnmarshalText([]byte(v)); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid state root of --%s: %w", name, err)
+		}
+		return root, nil
+	}
+	n, err := strconv.ParseUint(v, 0, 64)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("--%s must be a block number or state root: %w", name, err)
+	}
+	header := ch.Blockchain.GetHeaderByNumber(n)
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("block %d of --%s is not in the canonical chain", n, name)
+	}
+	return header.Root, nil
+}
+
 func hashFlagValue(name string, ctx *cli.Context) common.Hash {
 	return *ctx.Generic(name).(*TextFlag[*common.Hash]).Value
 }
@@ -212,6 +991,74 @@ func bigFlagValue(name string, ctx *cli.Context) *big.Int {
 	return ctx.Generic(name).(*TextFlag[*big.Int]).Value
 }
 
+// codeInput reads the code for a code cheat: from the code flag, the file flag, or else hex encoded from the input.
+func codeInput(ctx *cli.Context) (hexutil.Bytes, error) {
+	if ctx.IsSet("code") {
+		return bytesFlagValue("code", ctx), nil
+	}
+	if path := ctx.String("file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read code file: %w", err)
+		}
+		if code, err := decodeHexInput(data); err == nil {
+			return code, nil
+		}
+		return data, nil
+	}
+	data, err := io.ReadAll(ctx.App.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code from input: %w", err)
+	}
+	code, err := decodeHexInput(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode code from input: %w", err)
+	}
+	return code, nil
+}
+
+// decodeHexInput decodes hex encoded input, with or without 0x prefix and surrounding whitespace.
+func decodeHexInput(data []byte) (hexutil.Bytes, error) {
+	return hexutil.Decode("0x" + strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+}
+
+// parseKeyMapping parses the storage key mapping of the xor or offset flag.
+func parseKeyMapping(ctx *cli.Context) (cheat.KeyMapping, error) {
+	switch {
+	case ctx.IsSet("xor") && ctx.IsSet("offset"):
+		return nil, errors.New("cannot both XOR and offset keys")
+	case ctx.IsSet("xor"):
+		return cheat.XORKeys(hashFlagValue("xor", ctx)), nil
+	case ctx.IsSet("offset"):
+		offset, ok := new(big.Int).SetString(ctx.String("offset"), 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid key offset: %q", ctx.String("offset"))
+		}
+		return cheat.OffsetKeys(offset), nil
+	default:
+		return nil, errors.New("expected a key mapping, either xor or offset")
+	}
+}
+
+// parseTopicFilter parses the topic flag values: each value is a topic position,
+// with alternatives separated by '|'. An empty value or '*' matches any topic.
+func parseTopicFilter(values []string) ([][]common.Hash, error) {
+	topics := make([][]common.Hash, len(values))
+	for i, v := range values {
+		if v == "" || v == "*" {
+			continue
+		}
+		for _, alt := range strings.Split(v, "|") {
+			var topic common.Hash
+			if err := topic.UnmarshalText([]byte(strings.TrimSpace(alt))); err != nil {
+				return nil, fmt.Errorf("invalid topic %d %q: %w", i, alt, err)
+			}
+			topics[i] = append(topics[i], topic)
+		}
+	}
+	return topics, nil
+}
+
 var (
 	CheatStorageGetCmd = &cli.Command{
 		Name:    "get",
@@ -222,45 +1069,382 @@ var (
 			hashFlag("key", "key in storage of address to read value"),
 		},
 		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.StorageGet(addrFlagValue("address", ctx), hashFlagValue("key", ctx), ctx.App.Writer))
+			return ch.RunAndClose(ctx.Context, cheat.StorageGet(addrFlagValue("address", ctx), hashFlagValue("key", ctx), ctx.App.Writer))
 		}),
 	}
 	CheatStorageSetCmd = &cli.Command{
 		Name:    "set",
 		Aliases: []string{"write"},
 		Flags: []cli.Flag{
-			DataDirFlag,
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
 			addrFlag("address", "Address to write storage of"),
 			hashFlag("key", "key in storage of address to set value of"),
 			hashFlag("value", "the value to write"),
 		},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.StorageSet(addrFlagValue("address", ctx), hashFlagValue("key", ctx), hashFlagValue("value", ctx)))
-		}),
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.StorageSet(addrFlagValue("address", ctx), hashFlagValue("key", ctx), hashFlagValue("value", ctx)))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			return ch.StorageSet(ctx.Context, addrFlagValue("address", ctx), hashFlagValue("key", ctx), hashFlagValue("value", ctx))
+		})),
 	}
-	CheatStorageReadAll = &cli.Command{
-		Name:    "read-all",
-		Aliases: []string{"get-all"},
-		Usage:   "Read all storage of the given account",
-		Flags:   []cli.Flag{DataDirFlag, addrFlag("address", "Address to read all storage of")},
-		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.StorageReadAll(addrFlagValue("address", ctx), ctx.App.Writer))
+	CheatStorageClearCmd = &cli.Command{
+		Name:  "clear",
+		Usage: "Delete all storage of the given account at once, keeping its balance, nonce and code",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("address", "Address to clear storage of"),
+			&cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "Confirm that all storage of the account is to be deleted. Required, the storage cannot be restored. Only read from the command line, not the environment.",
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			if !ctx.Bool("confirm") {
+				return fmt.Errorf("clearing all storage of %s cannot be undone, add --confirm to proceed", addrFlagValue("address", ctx))
+			}
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.StorageClear(addrFlagValue("address", ctx)))
+			})(ctx)
 		}),
 	}
-	CheatStorageDiffCmd = &cli.Command{
+	CheatStorageCopyCmd = &cli.Command{
+		Name:  "copy",
+		Usage: "Copy all storage of an account into another existing account, e.g. for proxy and implementation migration experiments",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("from", "Address to copy the storage of"),
+			addrFlag("to", "Address to copy the storage into"),
+			&cli.StringFlag{
+				Name:    "mode",
+				Usage:   "merge: keep the other storage of the destination, the copied values take precedence. replace: delete all storage of the destination first.",
+				EnvVars: prefixEnvVars("MODE"),
+				Value:   "merge",
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			var replace bool
+			switch mode := ctx.String("mode"); mode {
+			case "merge":
+			case "replace":
+				replace = true
+			default:
+				return fmt.Errorf("unknown storage copy mode %q, expected merge or replace", mode)
+			}
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.StorageCopy(addrFlagValue("from", ctx), addrFlagValue("to", ctx), replace))
+			})(ctx)
+		}),
+	}
+	CheatStorageLayoutCmd = &cli.Command{
+		Name:  "layout",
+		Usage: "Derive a best-effort storage layout from the bytecode of an account, when the source layout is unavailable",
+		Description: "Finds the constant slots that the code reads and writes, and the base slots of mappings and dynamic arrays, " +
+			"from keccak256 patterns. Slots that are computed in other ways are not found. Outputs the layout as JSON.",
+		Flags: []cli.Flag{DataDirFlag, addrFlag("address", "Address of the account to analyze the code of")},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.StorageLayout(addrFlagValue("address", ctx), ctx.App.Writer))
+		}),
+	}
+	CheatStorageSearchCmd = &cli.Command{
+		Name:  "search",
+		Usage: "Find the storage slots of an account that contain a value, e.g. to locate a parameter before patching it",
+		Description: "Iterates the storage trie of the account. Values shorter than 32 bytes, e.g. addresses, are left-padded like Solidity stores them, " +
+			"or with --packed found at any offset within a slot. Each matching slot is written as JSON line, " +
+			"with the storage key if its pre-image is known.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			addrFlag("address", "Address of the account to search the storage of"),
+			bytesFlag("value", "Value to search for, up to 32 bytes"),
+			&cli.BoolFlag{
+				Name:    "packed",
+				Usage:   "Also find values shorter than 32 bytes that are packed into a slot with other variables",
+				EnvVars: prefixEnvVars("PACKED"),
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.StorageSearch(addrFlagValue("address", ctx), bytesFlagValue("value", ctx), ctx.Bool("packed"), ctx.App.Writer))
+		}),
+	}
+	CheatStorageReadAll = &cli.Command{
+		Name:    "read-all",
+		Aliases: []string{"get-all"},
+		Usage:   "Read all storage of the given account",
+		Description: "The slots are streamed in order of their hashed keys, as patch lines (+ key = value), or with --format=jsonl as JSON lines. " +
+			"With --limit, the storage is read in pages: if there are more slots, the hashed key to start the next page at with --start-key " +
+			"is written last, as '# next <key>' comment, or as {\"next\": key} JSON line.",
+		Flags: []cli.Flag{
+			DataDirFlag, addrFlag("address", "Address to read all storage of"), GzipFlag, RedactFlag, RedactZeroFlag, ManifestFlag,
+			&cli.StringFlag{
+				Name:      "out",
+				Usage:     "File to write the storage to, instead of stdout. Required to write a manifest.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("OUT"),
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Usage:   "Format of the slots: patch, or jsonl with the storage key pre-images where known",
+				EnvVars: prefixEnvVars("FORMAT"),
+				Value:   "patch",
+			},
+			&cli.Uint64Flag{
+				Name:    "limit",
+				Usage:   "Maximum number of slots to read. All slots if 0.",
+				EnvVars: prefixEnvVars("LIMIT"),
+			},
+			&cli.GenericFlag{
+				Name:    "start-key",
+				Usage:   "Hashed storage key to start reading at, e.g. the next key of the previous page",
+				EnvVars: prefixEnvVars("START_KEY"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			redact, err := redactor(ctx)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			path := ctx.String("out")
+			if path == "" && ctx.IsSet(ManifestFlag.Name) {
+				_ = ch.Close()
+				return errors.New("a manifest requires the storage to be written to a file")
+			}
+			out, err := openOutput(ctx, path)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			defer out.Close()
+			var start common.Hash
+			if ctx.IsSet("start-key") {
+				start = hashFlagValue("start-key", ctx)
+			}
+			chainID, head := ch.Blockchain.Config().ChainID, ch.Blockchain.CurrentBlock().Number.Uint64()
+			fn := cheat.StorageReadRange(addrFlagValue("address", ctx), start, ctx.Uint64("limit"), ctx.String("format"), out, redact)
+			if err := ch.RunAndClose(ctx.Context, fn); err != nil {
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+			if path == "" {
+				return nil
+			}
+			return WriteManifest(ctx, chainID, &head, &head, path)
+		}),
+	}
+	CheatStorageDiffCmd = &cli.Command{
 		Name:  "diff",
-		Usage: "Diff the storage of accounts A and B",
-		Flags: []cli.Flag{DataDirFlag, hashFlag("a", "address of account A"), hashFlag("b", "address of account B")},
+		Usage: "Diff the storage of accounts A and B, as patch with pre-image keys that turns the storage of A into B",
+		Description: "The storage is read from the head state, or with --a.at and --b.at from the state of a block number or state root, " +
+			"e.g. to diff the storage of a single account between two block heights. Older states may have been pruned. " +
+			"The diff is written with the pre-images of the storage keys, not the hashed keys of earlier versions, so it can be applied with storage patch: " +
+			"changes of keys with an unknown pre-image are written as comments with the hashed key.",
+		Flags: []cli.Flag{
+			DataDirFlag, addrFlag("a", "address of account A"),
+			&cli.GenericFlag{
+				Name:    "b",
+				Usage:   "address of account B, account A if not set",
+				EnvVars: prefixEnvVars("B"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.StringFlag{
+				Name:    "a.at",
+				Usage:   "Block number or state root to read the storage of account A at, instead of the head state",
+				EnvVars: prefixEnvVars("A_AT"),
+			},
+			&cli.StringFlag{
+				Name:    "b.at",
+				Usage:   "Block number or state root to read the storage of account B at, instead of the head state",
+				EnvVars: prefixEnvVars("B_AT"),
+			},
+			&cli.UintFlag{
+				Name: "patch-version",
+				Usage: "Version of the patch format to write. Version 2 has the storage of account A as precondition, " +
+					"so the patch is not applied if the storage changed in the meantime.",
+				EnvVars: prefixEnvVars("PATCH_VERSION"),
+				Value:   1,
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			a := cheat.StorageAt{Address: addrFlagValue("a", ctx)}
+			b := cheat.StorageAt{Address: a.Address}
+			if ctx.IsSet("b") {
+				b.Address = addrFlagValue("b", ctx)
+			}
+			var err error
+			if a.Root, err = stateRootFlagValue(ctx, "a.at", ch); err != nil {
+				_ = ch.Close()
+				return err
+			}
+			if b.Root, err = stateRootFlagValue(ctx, "b.at", ch); err != nil {
+				_ = ch.Close()
+				return err
+			}
+			if a == b {
+				_ = ch.Close()
+				return errors.New("account A and B are the same, set --b, or --a.at and --b.at, to diff")
+			}
+			fn, err := cheat.StorageDiffAt(ctx.App.Writer, ctx.Uint("patch-version"), a, b)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			return ch.RunAndClose(ctx.Context, fn)
+		}),
+	}
+	CheatStorageDiffManyCmd = &cli.Command{
+		Name:  "diff-many",
+		Usage: "Diff the storage of many pairs of accounts concurrently, and write a combined JSON report",
+		Description: "The pairs file is a JSON list of {\"a\": address, \"b\": address, \"aRoot\": root, \"bRoot\": root}, " +
+			"where b defaults to a, and the roots to --a.at and --b.at, or the head state, " +
+			"e.g. to compare all predeploys between the states before and after an upgrade.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.PathFlag{
+				Name:      "pairs",
+				Usage:     "Path to the JSON list of account pairs to diff",
+				EnvVars:   prefixEnvVars("PAIRS"),
+				TakesFile: true,
+				Required:  true,
+			},
+			&cli.IntFlag{
+				Name:    "workers",
+				Usage:   "Number of pairs to diff at a time",
+				EnvVars: prefixEnvVars("WORKERS"),
+				Value:   4,
+			},
+			&cli.StringFlag{
+				Name:    "a.at",
+				Usage:   "Block number or state root to read the storage of account A at, for pairs without aRoot",
+				EnvVars: prefixEnvVars("A_AT"),
+			},
+			&cli.StringFlag{
+				Name:    "b.at",
+				Usage:   "Block number or state root to read the storage of account B at, for pairs without bRoot",
+				EnvVars: prefixEnvVars("B_AT"),
+			},
+			&cli.UintFlag{
+				Name:    "patch-version",
+				Usage:   "Version of the patch format of the diffs, see the diff command",
+				EnvVars: prefixEnvVars("PATCH_VERSION"),
+				Value:   1,
+			},
+		},
 		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.StorageDiff(ctx.App.Writer, addrFlagValue("a", ctx), addrFlagValue("b", ctx)))
+			pairs, err := cheat.ReadStoragePairs(ctx.Path("pairs"))
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			aRoot, err := stateRootFlagValue(ctx, "a.at", ch)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			bRoot, err := stateRootFlagValue(ctx, "b.at", ch)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			for i := range pairs {
+				if pairs[i].ARoot == (common.Hash{}) {
+					pairs[i].ARoot = aRoot
+				}
+				if pairs[i].BRoot == (common.Hash{}) {
+					pairs[i].BRoot = bRoot
+				}
+			}
+			return ch.RunAndClose(ctx.Context, cheat.StorageDiffMany(pairs, ctx.Uint("patch-version"), ctx.Int("workers"), ctx.App.Writer))
 		}),
 	}
 	CheatStoragePatchCmd = &cli.Command{
 		Name:  "patch",
 		Usage: "Apply storage patch from STDIN to the given account address",
-		Flags: []cli.Flag{DataDirFlag, addrFlag("address", "Address to patch storage of")},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.StoragePatch(os.Stdin, addrFlagValue("address", ctx)))
+		Description: "Version 2 patches can have preconditions on the current storage: " +
+			"if any precondition fails, nothing is changed.",
+		Flags: []cli.Flag{
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
+			addrFlag("address", "Address to patch storage of"),
+			TemplateFlag, TemplateValuesFlag, TemplateSetFlag, VerifyManifestFlag,
+		},
+		Action: ManifestInputAction(PlanAction(true, func(ctx *cli.Context) error {
+			// the patch is read and rendered once, so all data dirs get the same patch
+			rendered, err := templateInput(ctx, ctx.App.Reader)
+			if err != nil {
+				return err
+			}
+			patch, err := io.ReadAll(rendered)
+			if err != nil {
+				return fmt.Errorf("failed to read patch: %w", err)
+			}
+			return CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.StoragePatch(bytes.NewReader(patch), addrFlagValue("address", ctx)))
+			}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+				return ch.StoragePatch(ctx.Context, bytes.NewReader(patch), addrFlagValue("address", ctx))
+			})(ctx)
+		})),
+	}
+	CheatStorageRekeyCmd = &cli.Command{
+		Name:  "rekey",
+		Usage: "Move storage of the given account to new keys, by XOR or offset of the keys",
+		Description: "Moves all storage keys in the [start, end) range, e.g. to shift the base slot of a struct after an upgrade. " +
+			"All moves, and collisions with existing keys, are written to the output. All storage keys need a known pre-image.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("address", "Address to move storage of"),
+			&cli.GenericFlag{
+				Name:    "xor",
+				Usage:   "Move keys by XOR-ing them with this 32 byte mask",
+				EnvVars: prefixEnvVars("XOR"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+			&cli.StringFlag{
+				Name:    "offset",
+				Usage:   "Move keys by adding this offset, may be negative and hex (0x) or decimal, modulo 2**256",
+				EnvVars: prefixEnvVars("OFFSET"),
+			},
+			&cli.GenericFlag{
+				Name:    "start",
+				Usage:   "First key to move",
+				EnvVars: prefixEnvVars("START"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+			&cli.GenericFlag{
+				Name:    "end",
+				Usage:   "Key to stop moving at, exclusive. All keys from start onwards are moved if not set.",
+				EnvVars: prefixEnvVars("END"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+			&cli.BoolFlag{
+				Name:    "preview",
+				Usage:   "Only write the moves and collisions, without changing the storage. The database is opened read-only.",
+				EnvVars: prefixEnvVars("PREVIEW"),
+			},
+			&cli.BoolFlag{
+				Name:    "overwrite",
+				Usage:   "Allow moves to overwrite existing keys that are not moved themselves",
+				EnvVars: prefixEnvVars("OVERWRITE"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			// a preview changes nothing, so it neither needs write access, nor compacts the database
+			return CheatAction(ctx.Bool("preview"), func(ctx *cli.Context, ch *cheat.Cheater) error {
+				mapping, err := parseKeyMapping(ctx)
+				if err != nil {
+					_ = ch.Close()
+					return err
+				}
+				cfg := &cheat.RekeyConfig{
+					Address:   addrFlagValue("address", ctx),
+					Mapping:   mapping,
+					Start:     hashFlagValue("start", ctx),
+					End:       hashFlagValue("end", ctx),
+					Preview:   ctx.Bool("preview"),
+					Overwrite: ctx.Bool("overwrite"),
+				}
+				return ch.RunAndClose(ctx.Context, cheat.StorageRekey(cfg, ctx.App.Writer))
+			})(ctx)
 		}),
 	}
 	CheatStorageCmd = &cli.Command{
@@ -268,48 +1452,392 @@ var (
 		Subcommands: []*cli.Command{
 			CheatStorageGetCmd,
 			CheatStorageSetCmd,
+			CheatStorageClearCmd,
+			CheatStorageCopyCmd,
 			CheatStorageReadAll,
 			CheatStorageDiffCmd,
+			CheatStorageDiffManyCmd,
 			CheatStoragePatchCmd,
+			CheatStorageRekeyCmd,
+			CheatStorageLayoutCmd,
+			CheatStorageSearchCmd,
+		},
+	}
+	CheatSlotCmd = &cli.Command{
+		Name:      "slot",
+		Usage:     "Compute the storage slot of a value in mappings, dynamic arrays and structs, e.g. before storage set",
+		ArgsUsage: "[step...]",
+		Description: "Starts at the base slot of the state variable, and follows the steps to the value: " +
+			"map:<type>:<key> for the value of a mapping key, with type address, bool, uintN, intN, bytesN, string or bytes, " +
+			"array:<index>[:<slots>] for an element of a dynamic array, with the given number of slots per element, " +
+			"and field:<slot>[:<offset>] for a field of a struct, at the slot and byte offset of a storage layout. " +
+			"E.g. 'map:address:0x.. field:1' for the second slot of the struct of an address in a mapping at the base slot. " +
+			"Outputs the slot after each step as JSON, with the byte offset of the value in the final slot.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "base",
+				Usage:    "Slot of the state variable, as decimal or hex number",
+				EnvVars:  prefixEnvVars("BASE"),
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:    "vyper",
+				Usage:   "Hash mapping keys like Vyper, before the slot, instead of like Solidity",
+				EnvVars: prefixEnvVars("VYPER"),
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			base, ok := math.ParseBig256(ctx.String("base"))
+			if !ok {
+				return fmt.Errorf("invalid base slot %q", ctx.String("base"))
+			}
+			steps := make([]cheat.SlotStep, 0, ctx.NArg())
+			for _, arg := range ctx.Args().Slice() {
+				step, err := cheat.ParseSlotStep(arg)
+				if err != nil {
+					return err
+				}
+				steps = append(steps, step)
+			}
+			result, err := cheat.ComputeSlot(common.BigToHash(base), steps, ctx.Bool("vyper"))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(result)
 		},
 	}
 	CheatSetBalanceCmd = &cli.Command{
 		Name: "balance",
+		Description: "With --native-via-token, on custom gas token chains, the balance is set as balance of the ERC20 token " +
+			"that wraps the native asset, the WETH9 predeploy by default, and the native balance of the token moves along, " +
+			"so the token stays fully backed. Outputs the token balance change as JSON.",
 		Flags: []cli.Flag{
-			DataDirFlag,
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
 			addrFlag("address", "Address to change balance of"),
 			bigFlag("balance", "New balance of the account"),
+			&cli.BoolFlag{
+				Name:    "native-via-token",
+				Usage:   "Set the balance as balance of the token that wraps the native asset, keeping the token backed by its native balance",
+				EnvVars: prefixEnvVars("NATIVE_VIA_TOKEN"),
+			},
+			&cli.GenericFlag{
+				Name:    "native-via-token.address",
+				Usage:   "Address of the token that wraps the native asset, the WETH9 predeploy if not set",
+				EnvVars: prefixEnvVars("NATIVE_VIA_TOKEN_ADDRESS"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.GenericFlag{
+				Name:    "native-via-token.spender",
+				Usage:   "Also set the token allowance of this spender for the address to the balance, e.g. of the bridge that pulls the tokens on deposits",
+				EnvVars: prefixEnvVars("NATIVE_VIA_TOKEN_SPENDER"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			ERC20MaxProbeFlag,
+		},
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			if ctx.Bool("native-via-token") {
+				token := predeploys.WETH9Addr
+				if ctx.IsSet("native-via-token.address") {
+					token = addrFlagValue("native-via-token.address", ctx)
+				}
+				var spender *common.Address
+				if ctx.IsSet("native-via-token.spender") {
+					s := addrFlagValue("native-via-token.spender", ctx)
+					spender = &s
+				}
+				return ch.RunAndClose(ctx.Context, cheat.SetNativeViaToken(token, addrFlagValue("address", ctx),
+					bigFlagValue("balance", ctx), spender, ctx.Uint64(ERC20MaxProbeFlag.Name), ctx.App.Writer))
+			}
+			return ch.RunAndClose(ctx.Context, cheat.SetBalance(addrFlagValue("address", ctx), bigFlagValue("balance", ctx)))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			if ctx.Bool("native-via-token") {
+				return fmt.Errorf("--native-via-token is not supported with --%s=rpc", ViaFlag.Name)
+			}
+			return ch.SetBalance(ctx.Context, addrFlagValue("address", ctx), bigFlagValue("balance", ctx))
+		})),
+	}
+	CheatERC20BalanceCmd = &cli.Command{
+		Name:  "balance",
+		Usage: "Set the ERC20 token balance of a holder, by writing the slot of the holder in the balance mapping",
+		Description: "The balance mapping is probed if its slot is not given: a marker balance is written to the candidate slots " +
+			"of the first mappings, until balanceOf returns it. The new balance is verified with balanceOf, and the total supply is not changed. " +
+			"Outputs the used slot as JSON.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("token", "Address of the ERC20 token"),
+			addrFlag("holder", "Address of the holder to set the balance of"),
+			bigFlag("amount", "New token balance of the holder, in the smallest unit of the token"),
+			ERC20MappingSlotFlag, ERC20VyperFlag, ERC20MaxProbeFlag,
+		},
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.SetERC20Balance(addrFlagValue("token", ctx), addrFlagValue("holder", ctx),
+				bigFlagValue("amount", ctx), erc20LayoutFlagValue(ctx), ctx.Uint64(ERC20MaxProbeFlag.Name), ctx.App.Writer))
+		})),
+	}
+	CheatERC20AllowanceCmd = &cli.Command{
+		Name:  "allowance",
+		Usage: "Set the ERC20 allowance[owner][spender] of a token, by writing its slot in the nested allowance mapping",
+		Description: "The allowance mapping is probed if its slot is not given, like the balance mapping of erc20 balance. " +
+			"The new allowance is verified with allowance. Outputs the used slot as JSON.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("token", "Address of the ERC20 token"),
+			addrFlag("owner", "Address of the owner of the tokens"),
+			addrFlag("spender", "Address of the spender that is allowed to transfer the tokens"),
+			bigFlag("amount", "New allowance, in the smallest unit of the token"),
+			ERC20MappingSlotFlag, ERC20VyperFlag, ERC20MaxProbeFlag,
+		},
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.SetERC20Allowance(addrFlagValue("token", ctx), addrFlagValue("owner", ctx),
+				addrFlagValue("spender", ctx), bigFlagValue("amount", ctx), erc20LayoutFlagValue(ctx), ctx.Uint64(ERC20MaxProbeFlag.Name), ctx.App.Writer))
+		})),
+	}
+	CheatERC20Cmd = &cli.Command{
+		Name:  "erc20",
+		Usage: "Cheats on ERC20 tokens",
+		Subcommands: []*cli.Command{
+			CheatERC20BalanceCmd,
+			CheatERC20AllowanceCmd,
+		},
+	}
+	CheatProxySetImplementationCmd = &cli.Command{
+		Name:  "set-implementation",
+		Usage: "Point an EIP-1967 proxy to a new implementation and/or beacon, by writing the EIP-1967 slots",
+		Description: "The proxy and the new implementation and beacon must have code. " +
+			"Outputs the changed slots, with the old and new addresses, as JSON.",
+		Flags: []cli.Flag{
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
+			addrFlag("proxy", "Address of the proxy"),
+			&cli.GenericFlag{
+				Name:    "implementation",
+				Usage:   "Address of the new implementation, written to the EIP-1967 implementation slot",
+				EnvVars: prefixEnvVars("IMPLEMENTATION"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.GenericFlag{
+				Name:    "beacon",
+				Usage:   "Address of the new beacon, written to the EIP-1967 beacon slot, for beacon proxies",
+				EnvVars: prefixEnvVars("BEACON"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+		},
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.SetProxyImplementation(addrFlagValue("proxy", ctx), proxyOverrideFlagValue(ctx), ctx.App.Writer))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			return ch.SetProxyImplementation(ctx.Context, addrFlagValue("proxy", ctx), proxyOverrideFlagValue(ctx), ctx.App.Writer)
+		})),
+	}
+	CheatProxySetAdminCmd = &cli.Command{
+		Name:  "set-admin",
+		Usage: "Change the admin of an EIP-1967 proxy, by writing the EIP-1967 admin slot",
+		Description: "The admin slot must currently contain an address, so a slot that the proxy uses otherwise is not overwritten. " +
+			"Outputs the changed slot, with the old and new admin, as JSON.",
+		Flags: []cli.Flag{
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
+			addrFlag("proxy", "Address of the proxy"),
+			addrFlag("admin", "Address of the new admin"),
+			&cli.BoolFlag{
+				Name:    "allow-empty",
+				Usage:   "Also write the admin slot if it is empty, e.g. if the proxy has no admin yet",
+				EnvVars: prefixEnvVars("ALLOW_EMPTY"),
+			},
+		},
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.SetProxyAdmin(addrFlagValue("proxy", ctx), addrFlagValue("admin", ctx), ctx.Bool("allow-empty"), ctx.App.Writer))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			return ch.SetProxyAdmin(ctx.Context, addrFlagValue("proxy", ctx), addrFlagValue("admin", ctx), ctx.Bool("allow-empty"), ctx.App.Writer)
+		})),
+	}
+	CheatProxyCmd = &cli.Command{
+		Name:  "proxy",
+		Usage: "Cheats on EIP-1967 proxies",
+		Subcommands: []*cli.Command{
+			CheatProxySetImplementationCmd,
+			CheatProxySetAdminCmd,
+		},
+	}
+	CheatCodeCmd = withDefaultSubcommand(&cli.Command{
+		Name:  "code",
+		Usage: "Cheats on the code of accounts. Without a subcommand, sets the code like 'code set'.",
+		Subcommands: []*cli.Command{
+			CheatCodeSetCmd,
+			CheatCodeGetCmd,
+			CheatCodeCopyCmd,
+		},
+	}, CheatCodeSetCmd)
+	CheatCodeSetCmd = &cli.Command{
+		Name:        "set",
+		Usage:       "Set the code of an account, e.g. to patch a predeploy on a devnet without regenesis",
+		Description: "The code is read from --code, from --file (raw bytes, or hex), or else as hex from STDIN.",
+		Flags: []cli.Flag{
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
+			addrFlag("address", "Address to change code of"),
+			&cli.GenericFlag{
+				Name:    "code",
+				Usage:   "New code of the account, hex encoded",
+				EnvVars: prefixEnvVars("CODE"),
+				Value:   &TextFlag[*hexutil.Bytes]{Value: new(hexutil.Bytes)},
+			},
+			&cli.StringFlag{
+				Name:      "file",
+				Usage:     "File with the new code of the account, as raw bytes or hex",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("FILE"),
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			readsInput := !ctx.IsSet("code") && ctx.String("file") == ""
+			return PlanAction(readsInput, func(ctx *cli.Context) error {
+				// the code is read once, for all data dirs
+				code, err := codeInput(ctx)
+				if err != nil {
+					return err
+				}
+				return CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+					return ch.RunAndClose(ctx.Context, cheat.SetCode(addrFlagValue("address", ctx), code))
+				}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+					return ch.SetCode(ctx.Context, addrFlagValue("address", ctx), code)
+				})(ctx)
+			})(ctx)
+		},
+	}
+	CheatCodeGetCmd = &cli.Command{
+		Name:  "get",
+		Usage: "Print the deployed code and code hash of an account as JSON",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			addrFlag("address", "Address to get the code of"),
+			&cli.StringFlag{
+				Name:      "out",
+				Usage:     "File to write the raw code to. The JSON output then omits the code.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("OUT"),
+			},
 		},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.SetBalance(addrFlagValue("address", ctx), bigFlagValue("balance", ctx)))
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			var code cheat.AccountCode
+			if err := ch.RunAndClose(ctx.Context, cheat.GetCode(addrFlagValue("address", ctx), &code)); err != nil {
+				return err
+			}
+			if out := ctx.String("out"); out != "" {
+				if err := os.WriteFile(out, code.Code, 0o644); err != nil {
+					return fmt.Errorf("failed to write code file: %w", err)
+				}
+				code.Code = nil
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(code)
 		}),
 	}
-	CheatSetCodeCmd = &cli.Command{
-		Name: "code",
+	CheatCodeCopyCmd = &cli.Command{
+		Name:  "copy",
+		Usage: "Copy the code of an account onto another account, e.g. to bypass a proxy when testing an implementation",
+		Flags: []cli.Flag{
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
+			addrFlag("from", "Address to copy the code of"),
+			addrFlag("to", "Address to change the code of"),
+		},
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.CopyCode(addrFlagValue("from", ctx), addrFlagValue("to", ctx)))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			return ch.CopyCode(ctx.Context, addrFlagValue("from", ctx), addrFlagValue("to", ctx))
+		})),
+	}
+	CheatCodeCompareCmd = &cli.Command{
+		Name:  "code-compare",
+		Usage: "Compare the code of an account against another account or an artifact, ignoring metadata and the immutables of the artifact",
+		Description: "Only the immutables the artifact references are ignored, or for hardhat artifacts, the immutable placeholders of the code: " +
+			"any other difference, such as a changed constant, is reported. Codes of two accounts are compared without ignoring immutables.",
 		Flags: []cli.Flag{
 			DataDirFlag,
-			addrFlag("address", "Address to change code of"),
-			bytesFlag("code", "New code of the account"),
+			addrFlag("address", "Address of the account to compare the code of"),
+			&cli.GenericFlag{
+				Name:    "other",
+				Usage:   "Address of the account to compare against",
+				EnvVars: prefixEnvVars("OTHER"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.StringFlag{
+				Name:      "artifact",
+				Usage:     "Path to a forge or hardhat artifact JSON file to compare the deployed bytecode against",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("ARTIFACT"),
+			},
 		},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.SetCode(addrFlagValue("address", ctx), bytesFlagValue("code", ctx)))
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			addr := addrFlagValue("address", ctx)
+			if path := ctx.String("artifact"); path != "" {
+				code, refs, err := cheat.ReadArtifactCode(path)
+				if err != nil {
+					return err
+				}
+				return ch.RunAndClose(ctx.Context, cheat.CodeCompare(addr, code, refs, ctx.App.Writer))
+			}
+			if !ctx.IsSet("other") {
+				return fmt.Errorf("either an --other account or an --artifact is required to compare against")
+			}
+			return ch.RunAndClose(ctx.Context, cheat.CodeCompareAccounts(addr, addrFlagValue("other", ctx), ctx.App.Writer))
 		}),
 	}
+	CheatNonceResetManyCmd = &cli.Command{
+		Name:  "reset-many",
+		Usage: "Set the nonce of all accounts in a JSON file with an array of addresses, in a single change",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.StringFlag{
+				Name:      "file",
+				Usage:     "Path to a JSON file with the array of addresses of the accounts to change the nonce of",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("FILE"),
+			},
+			&cli.Uint64Flag{
+				Name:    "value",
+				Usage:   "New nonce of the accounts",
+				EnvVars: prefixEnvVars("VALUE"),
+			},
+		},
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			data, err := os.ReadFile(ctx.String("file"))
+			if err != nil {
+				return fmt.Errorf("failed to read accounts file: %w", err)
+			}
+			var addrs []common.Address
+			if err := json.Unmarshal(data, &addrs); err != nil {
+				return fmt.Errorf("failed to decode accounts file: %w", err)
+			}
+			return ch.RunAndClose(ctx.Context, cheat.SetNonces(addrs, ctx.Uint64("value")))
+		})),
+	}
 	CheatSetNonceCmd = &cli.Command{
-		Name: "nonce",
+		Name:    "set",
+		Aliases: []string{"write"},
 		Flags: []cli.Flag{
-			DataDirFlag,
+			OptDataDirFlag, CompactFlag, DryRunFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag, PlanFlag,
 			addrFlag("address", "Address to change nonce of"),
 			bigFlag("nonce", "New nonce of the account"),
 		},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
-			return ch.RunAndClose(cheat.SetNonce(addrFlagValue("address", ctx), bigFlagValue("balance", ctx).Uint64()))
-		}),
+		Action: PlanAction(false, CheatViaAction(func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.SetNonce(addrFlagValue("address", ctx), bigFlagValue("nonce", ctx).Uint64()))
+		}, func(ctx *cli.Context, ch *cheat.RPCCheater) error {
+			return ch.SetNonce(ctx.Context, addrFlagValue("address", ctx), bigFlagValue("nonce", ctx).Uint64())
+		})),
 	}
+	CheatNonceCmd = withDefaultSubcommand(&cli.Command{
+		Name:  "nonce",
+		Usage: "Cheats on the nonce of accounts. Without a subcommand, sets the nonce like 'nonce set'.",
+		Subcommands: []*cli.Command{
+			CheatSetNonceCmd,
+			CheatNonceResetManyCmd,
+		},
+	}, CheatSetNonceCmd)
 	CheatOvmOwnersCmd = &cli.Command{
 		Name: "ovm-owners",
 		Flags: []cli.Flag{
-			DataDirFlag,
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
 			&cli.StringFlag{
 				Name:     "config",
 				Usage:    "Path to JSON config of OVM address replacements to apply.",
@@ -318,144 +1846,2398 @@ var (
 				Value:    "ovm-owners.json",
 			},
 		},
-		Action: CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
 			confData, err := os.ReadFile(ctx.String("config"))
 			if err != nil {
-				return fmt.Errorf("failed to read OVM owners JSON config file: %w", err)
-			}
-			var conf cheat.OvmOwnersConfig
-			if err := json.Unmarshal(confData, &conf); err != nil {
+				return fmt.Errorf("failed to read OVM owners JSON config file: %w", err)
+			}
+			var conf cheat.OvmOwnersConfig
+			if err := json.Unmarshal(confData, &conf); err != nil {
+				return err
+			}
+			return ch.RunAndClose(ctx.Context, cheat.OvmOwners(&conf))
+		})),
+	}
+	CheatGenAccessListCmd = &cli.Command{
+		Name:  "gen-access-list",
+		Usage: "Generate an EIP-2930 access list of accounts and their storage keys from the head state, e.g. for transactions of tests",
+		Description: "Without --slots each account lists all of its storage keys, which need a known pre-image, like with state dump. " +
+			"With --slots each account lists the given storage keys, whether set or not.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			addrListFlag("addresses", "Comma-separated addresses of accounts to list"),
+			&cli.GenericFlag{
+				Name:    "slots",
+				Usage:   "Comma-separated storage keys to list for each account, instead of all their storage keys",
+				EnvVars: prefixEnvVars("SLOTS"),
+				Value:   &TextFlag[*HashList]{Value: new(HashList)},
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.GenAccessList(addrListFlagValue("addresses", ctx), hashListFlagValue("slots", ctx), ctx.App.Writer))
+		}),
+	}
+	CheatPreimagesCmd = &cli.Command{
+		Name:  "preimages",
+		Usage: "Export the key pre-images of the given accounts and their storage as JSON lines",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			addrListFlag("addresses", "Comma-separated addresses of accounts to export the pre-images of"),
+			&cli.BoolFlag{
+				Name:    "verify",
+				Usage:   "Fail if any pre-image of the accounts or their storage is missing from the database",
+				EnvVars: prefixEnvVars("VERIFY"),
+			},
+			&cli.StringFlag{
+				Name:      "out",
+				Usage:     "File to write the pre-images to, instead of stdout. Required to write a manifest.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("OUT"),
+			},
+			ManifestFlag,
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			out := ctx.String("out")
+			if out == "" {
+				if ctx.IsSet(ManifestFlag.Name) {
+					_ = ch.Close()
+					return errors.New("a manifest requires the pre-images to be written to a file")
+				}
+				return ch.RunAndClose(ctx.Context, cheat.ExportPreimages(addrListFlagValue("addresses", ctx), ctx.App.Writer, ctx.Bool("verify")))
+			}
+			f, err := os.Create(out)
+			if err != nil {
+				_ = ch.Close()
+				return fmt.Errorf("failed to create pre-images file: %w", err)
+			}
+			defer f.Close()
+			chainID, head := ch.Blockchain.Config().ChainID, ch.Blockchain.CurrentBlock().Number.Uint64()
+			if err := ch.RunAndClose(ctx.Context, cheat.ExportPreimages(addrListFlagValue("addresses", ctx), f, ctx.Bool("verify"))); err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write pre-images file: %w", err)
+			}
+			return WriteManifest(ctx, chainID, &head, &head, out)
+		}),
+	}
+	CheatCompactDBCmd = &cli.Command{
+		Name:  "compact-db",
+		Usage: "Trigger a full compaction of the database, and monitor its progress",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+		},
+		Action: PlanAction(false, CheatRawDBAction(false, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			return cheat.CompactDB(c.Context, db, c.App.Writer)
+		})),
+	}
+	CheatTrimHistoryCmd = &cli.Command{
+		Name:  "trim-history",
+		Usage: "Remove the historical state of all but the last N blocks from an archive data dir, like the state pruning of a full node",
+		Description: "Only hash-based databases are supported. The state of the genesis block is kept. " +
+			"Outputs a JSON report with the state roots that were deleted. Run compact-db afterwards to reclaim the space.",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+			&cli.Uint64Flag{
+				Name:    "keep",
+				Usage:   "Number of most recent blocks to keep the state of",
+				EnvVars: prefixEnvVars("KEEP"),
+				Value:   128,
+			},
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Usage:   "Only report what would be deleted, without deleting anything.",
+				EnvVars: prefixEnvVars("DRY_RUN"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			return CheatRawDBAction(ctx.Bool("dry-run"), func(c *cli.Context, db ethdb.Database) error {
+				defer db.Close()
+				report, err := cheat.TrimHistory(c.Context, db, c.Uint64("keep"), c.Bool("dry-run"))
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(c.App.Writer)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			})(ctx)
+		}),
+	}
+	CheatStateDumpCmd = &cli.Command{
+		Name:  "dump",
+		Usage: "Export the complete head state as a Geth genesis alloc JSON object",
+		Description: "The accounts are streamed one by one, so large states can be dumped. " +
+			"All addresses and storage keys need a known pre-image: run geth with pre-image recording enabled. " +
+			"With --redact, sensitive addresses and storage values are hashed or zeroed out, e.g. to share production-derived state.",
+		Flags: []cli.Flag{
+			DataDirFlag, GzipFlag, RedactFlag, RedactZeroFlag,
+			&cli.StringFlag{
+				Name:      "out",
+				Usage:     "File to write the alloc to, instead of stdout. Required to write a manifest.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("OUT"),
+			},
+			ManifestFlag,
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			redact, err := redactor(ctx)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			path := ctx.String("out")
+			if path == "" && ctx.IsSet(ManifestFlag.Name) {
+				_ = ch.Close()
+				return errors.New("a manifest requires the alloc to be written to a file")
+			}
+			out, err := openOutput(ctx, path)
+			if err != nil {
+				_ = ch.Close()
+				return err
+			}
+			defer out.Close()
+			chainID, head := ch.Blockchain.Config().ChainID, ch.Blockchain.CurrentBlock().Number.Uint64()
+			if err := ch.RunAndClose(ctx.Context, cheat.DumpAlloc(out, redact)); err != nil {
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+			if path == "" {
+				return nil
+			}
+			return WriteManifest(ctx, chainID, &head, &head, path)
+		}),
+	}
+	CheatStateImportCmd = &cli.Command{
+		Name:  "import",
+		Usage: "Apply all accounts of a Geth genesis alloc JSON file to the head state, e.g. the output of state dump",
+		Description: "The balance, nonce, code and storage of the accounts in the alloc are set, and committed as new head state. " +
+			"Accounts that are not in the alloc are not changed.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag, VerifyManifestFlag,
+			&cli.PathFlag{
+				Name:      "alloc",
+				Usage:     "Genesis alloc JSON file to import, optionally gzip-compressed",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("ALLOC"),
+			},
+			&cli.StringFlag{
+				Name:    "mode",
+				Usage:   "replace: delete all other storage of the imported accounts first, so they match the alloc exactly. merge: keep it.",
+				EnvVars: prefixEnvVars("MODE"),
+				Value:   "replace",
+			},
+		},
+		Action: ManifestFileAction("alloc", PlanAction(false, func(ctx *cli.Context) error {
+			var replace bool
+			switch mode := ctx.String("mode"); mode {
+			case "merge":
+			case "replace":
+				replace = true
+			default:
+				return fmt.Errorf("unknown state import mode %q, expected merge or replace", mode)
+			}
+			f, err := openInput(ctx.Path("alloc"))
+			if err != nil {
+				return fmt.Errorf("failed to open alloc file: %w", err)
+			}
+			defer f.Close()
+			var alloc core.GenesisAlloc
+			if err := json.NewDecoder(f).Decode(&alloc); err != nil {
+				return fmt.Errorf("failed to decode alloc file: %w", err)
+			}
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.ImportAlloc(alloc, replace))
+			})(ctx)
+		})),
+	}
+	CheatStateCmd = &cli.Command{
+		Name:  "state",
+		Usage: "Commands on the state as a whole",
+		Subcommands: []*cli.Command{
+			CheatStateDumpCmd,
+			CheatStateImportCmd,
+		},
+	}
+	CheatApplyCmd = &cli.Command{
+		Name:  "apply",
+		Usage: "Apply a YAML or JSON script of cheats to the head state, in a single change",
+		Description: "The script has a list of steps, each with an op and an address, applied in order: " +
+			"balance (value), nonce (value), code (code), storage (key, value), storage-clear and delete. " +
+			"All steps are checked before the data dir is opened, and the changes are committed as a single new head state, " +
+			"or not at all if any step fails. For example:\n" +
+			"  steps:\n" +
+			"    - {op: balance, address: 0x..., value: 1000000000000000000}\n" +
+			"    - {op: storage, address: 0x..., key: 0, value: 0x2a}",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.PathFlag{
+				Name:      "script",
+				Usage:     "YAML or JSON cheat script to apply",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("SCRIPT"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			f, err := os.Open(ctx.Path("script"))
+			if err != nil {
+				return fmt.Errorf("failed to open script: %w", err)
+			}
+			defer f.Close()
+			script, err := cheat.ReadCheatScript(f)
+			if err != nil {
+				return err
+			}
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				if err := ch.RunAndClose(ctx.Context, cheat.ApplyScript(script)); err != nil {
+					return err
+				}
+				log.Info("applied cheat script", "steps", len(script.Steps))
+				return nil
+			})(ctx)
+		}),
+	}
+	CheatWatchCmd = &cli.Command{
+		Name:  "watch",
+		Usage: "Watch a directory for cheat scripts and storage patches, and apply them as they appear",
+		Description: "Cheat scripts (.yaml, .yml, .json, see the apply command) and storage patches (.patch, named after the account to patch, " +
+			"e.g. 001-0x4200000000000000000000000000000000000016.patch) are applied in order of their names, " +
+			"and then renamed to <name>.applied, or to <name>.failed with the error in <name>.failed.err. " +
+			"Write files under another extension, e.g. .tmp, and rename them into place, so they are not applied half-written. " +
+			"With --via=db files are only applied while the data dir is not in use: while the node is running they stay pending. " +
+			"With --via=rpc they are applied to the running node; to apply them between the blocks of auto, see its --cheat.watch-dir.",
+		Flags: []cli.Flag{
+			OptDataDirFlag, ViaFlag, CheatRPCFlag, CheatRPCNamespaceFlag,
+			&cli.PathFlag{
+				Name:      "dir",
+				Usage:     "Directory to watch for cheat files",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("WATCH_DIR"),
+			},
+			&cli.DurationFlag{
+				Name:    "interval",
+				Usage:   "Interval to check the directory for new cheat files at",
+				EnvVars: prefixEnvVars("WATCH_INTERVAL"),
+				Value:   2 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:    "once",
+				Usage:   "Apply the pending cheat files once, and exit",
+				EnvVars: prefixEnvVars("WATCH_ONCE"),
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			var apply func(ctx context.Context, f cheat.WatchFile) error
+			switch via := ctx.String(ViaFlag.Name); via {
+			case "db":
+				dirs, err := dataDirs(ctx)
+				if err != nil {
+					return err
+				}
+				if len(dirs) != 1 {
+					return fmt.Errorf("watch takes a single --%s with --%s=db, got %d", DataDirFlag.Name, ViaFlag.Name, len(dirs))
+				}
+				apply = func(ctx context.Context, f cheat.WatchFile) error {
+					fn, err := f.HeadFn(ctx)
+					if err != nil {
+						return err
+					}
+					ch, err := cheat.OpenGethDB(dirs[0], false)
+					if errors.Is(err, cheat.ErrDataDirInUse) {
+						log.Warn("data dir is in use, the node may be running, retrying later", "file", f.Path, "err", err)
+						return cheat.ErrWatchDeferred
+					} else if err != nil {
+						return err
+					}
+					return ch.RunAndClose(ctx, fn)
+				}
+			case "rpc":
+				endpoint := ctx.String(CheatRPCFlag.Name)
+				if endpoint == "" {
+					return fmt.Errorf("--%s is required with --%s=rpc", CheatRPCFlag.Name, ViaFlag.Name)
+				}
+				cl, err := dialRPC(ctx.Context, endpoint)
+				if err != nil {
+					return fmt.Errorf("failed to dial RPC endpoint %q: %w", endpoint, err)
+				}
+				defer cl.Close()
+				ch := cheat.NewRPCCheater(cl, ctx.String(CheatRPCNamespaceFlag.Name))
+				apply = func(ctx context.Context, f cheat.WatchFile) error {
+					return f.ApplyRPC(ctx, ch)
+				}
+			default:
+				return fmt.Errorf("unknown --%s mode: %q", ViaFlag.Name, via)
+			}
+			dir := ctx.Path("dir")
+			log.Info("watching for cheat files", "dir", dir)
+			for {
+				if _, err := cheat.ApplyWatchDir(ctx.Context, log.Root(), dir, apply); err != nil {
+					if ctx.Context.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				if ctx.Bool("once") {
+					return nil
+				}
+				select {
+				case <-ctx.Context.Done():
+					return nil
+				case <-time.After(ctx.Duration("interval")):
+				}
+			}
+		},
+	}
+	CheatSnapshotCreateCmd = &cli.Command{
+		Name:  "create",
+		Usage: "Checkpoint the head block and chain pointers of the data dir under a name, before destructive cheats",
+		Description: "The snapshot is stored in the database itself, and is small: the state of the head block stays in the database, " +
+			"since cheats write a new state root instead of changing the state in place.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Name of the snapshot",
+				Required: true,
+				EnvVars:  prefixEnvVars("SNAPSHOT_NAME"),
+			},
+			&cli.BoolFlag{
+				Name:    "overwrite",
+				Usage:   "Replace an existing snapshot with the same name",
+				EnvVars: prefixEnvVars("SNAPSHOT_OVERWRITE"),
+			},
+		},
+		Action: CheatRawDBAction(false, func(ctx *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			snap, err := cheat.CreateSnapshot(db, ctx.String("name"), ctx.Bool("overwrite"))
+			if err != nil {
+				return err
+			}
+			log.Info("created snapshot", "name", snap.Name, "number", snap.Number, "hash", snap.Hash, "state_root", snap.StateRoot)
+			return nil
+		}),
+	}
+	CheatSnapshotListCmd = &cli.Command{
+		Name:  "list",
+		Usage: "List the snapshots of the data dir as JSON lines, with their head block and state root",
+		Flags: []cli.Flag{DataDirFlag},
+		Action: CheatRawDBAction(true, func(ctx *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			snaps, err := cheat.ListSnapshots(db)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			for _, snap := range snaps {
+				if err := enc.Encode(cheat.SnapshotInfo{
+					Name: snap.Name, Created: snap.Created, Number: snap.Number, Hash: snap.Hash, StateRoot: snap.StateRoot,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}
+	CheatSnapshotRestoreCmd = &cli.Command{
+		Name:  "restore",
+		Usage: "Roll the data dir back to a snapshot, making its head block and state the head again",
+		Description: "Canonical blocks after the snapshot block are no longer canonical, like with a geth rewind. " +
+			"The state of the snapshot must still be in the database: pruning or trimming the state may have removed it.",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Name of the snapshot to restore",
+				Required: true,
+				EnvVars:  prefixEnvVars("SNAPSHOT_NAME"),
+			},
+		},
+		Action: PlanAction(false, CheatRawDBAction(false, func(ctx *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			snap, err := cheat.ReadSnapshot(db, ctx.String("name"))
+			if err != nil {
+				return err
+			}
+			if err := cheat.RestoreSnapshot(db, snap); err != nil {
+				return err
+			}
+			log.Info("restored snapshot", "name", snap.Name, "number", snap.Number, "hash", snap.Hash, "state_root", snap.StateRoot)
+			return nil
+		})),
+	}
+	CheatSnapshotCmd = &cli.Command{
+		Name:  "snapshot",
+		Usage: "Checkpoint the head of a data dir, and roll back to it, to make cheats recoverable without a copy of the data dir",
+		Subcommands: []*cli.Command{
+			CheatSnapshotCreateCmd,
+			CheatSnapshotListCmd,
+			CheatSnapshotRestoreCmd,
+		},
+	}
+	CheatSetHeadCmd = &cli.Command{
+		Name:    "set-head",
+		Aliases: []string{"rewind"},
+		Usage:   "Rewind the canonical chain of a data dir to an earlier block, like debug_setHead but offline",
+		Description: "The blocks after the given block are deleted, and it becomes the head header. " +
+			"Like with geth, the head block is the latest block up to it of which the state is still in the database, " +
+			"and the safe and finalized blocks are moved back to the head block if they are after it.",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+			&cli.Uint64Flag{
+				Name:    "number",
+				Usage:   "Number of the canonical block to rewind to",
+				EnvVars: prefixEnvVars("NUMBER"),
+			},
+			&cli.GenericFlag{
+				Name:    "hash",
+				Usage:   "Hash of the canonical block to rewind to",
+				EnvVars: prefixEnvVars("HASH"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+		},
+		Action: PlanAction(false, CheatRawDBAction(false, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			var hash common.Hash
+			switch {
+			case c.IsSet("number") && c.IsSet("hash"):
+				return errors.New("cannot use both --number and --hash")
+			case c.IsSet("number"):
+				n := c.Uint64("number")
+				if hash = rawdb.ReadCanonicalHash(db, n); hash == (common.Hash{}) {
+					return fmt.Errorf("no canonical block %d", n)
+				}
+			case c.IsSet("hash"):
+				hash = hashFlagValue("hash", c)
+			default:
+				return errors.New("expected --number or --hash of the block to rewind to")
+			}
+			report, err := cheat.SetHead(db, hash)
+			if err != nil {
+				return err
+			}
+			if report.StateNumber != report.Number {
+				log.Warn("state of the block is not available, head block is rewound further", "number", report.Number, "state_number", report.StateNumber)
+			}
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})),
+	}
+	CheatDanglingStorageCmd = &cli.Command{
+		Name:  "dangling-storage",
+		Usage: "Find storage of accounts without code, nonce or balance, and optionally garbage-collect it",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.BoolFlag{
+				Name:    "gc",
+				Usage:   "Delete the found accounts, and thus their storage. Requires the address pre-images to be known.",
+				EnvVars: prefixEnvVars("GC"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			gc := ctx.Bool("gc")
+			return CheatAction(!gc, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.FindDanglingStorage(ctx.App.Writer, gc))
+			})(ctx)
+		}),
+	}
+	CheatVerifyCmd = &cli.Command{
+		Name:  "verify",
+		Usage: "Walk the state trie of the head block, and report missing or invalid trie nodes, missing code and dangling storage",
+		Description: "Checks for corruption that an interrupted cheat may leave behind. " +
+			"Each issue is written as JSON line, followed by a summary, and the command fails if any issue is found.",
+		Flags: []cli.Flag{DataDirFlag},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.VerifyState(ctx.App.Writer))
+		}),
+	}
+	CheatRemoteDiffCmd = &cli.Command{
+		Name:    "remote-diff",
+		Aliases: []string{"diff-remote"},
+		Usage:   "Compare an account in the data dir against the state of a live node",
+		Description: "Compares the balance, nonce, code hash and storage root, and if the storage roots differ, the storage slots: " +
+			"the local slots with a known key pre-image, and the slots of --slots, which can also list slots that only exist remotely.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			addrFlag("address", "Address of the account to compare"),
+			&cli.GenericFlag{
+				Name:    "slots",
+				Usage:   "Comma-separated storage keys to compare, in addition to the local storage slots with known pre-image",
+				EnvVars: prefixEnvVars("SLOTS"),
+				Value:   &TextFlag[*HashList]{Value: new(HashList)},
+			},
+			&cli.StringFlag{
+				Name:     "rpc",
+				Usage:    "RPC endpoint of the live node to compare against, can be HTTP/WS/IPC",
+				Required: true,
+				EnvVars:  prefixEnvVars("REMOTE_RPC"),
+			},
+			&cli.Uint64Flag{
+				Name:    "block",
+				Usage:   "Block number to compare the remote state at. The local head block number if not set.",
+				EnvVars: prefixEnvVars("BLOCK"),
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			remote, err := dialRPC(ctx.Context, ctx.String("rpc"))
+			if err != nil {
+				return fmt.Errorf("failed to dial remote RPC: %w", err)
+			}
+			defer remote.Close()
+			block := ch.Blockchain.CurrentBlock().Number.Uint64()
+			if ctx.IsSet("block") {
+				block = ctx.Uint64("block")
+			}
+			return ch.RunAndClose(ctx.Context, cheat.RemoteDiff(remote, addrFlagValue("address", ctx), block, hashListFlagValue("slots", ctx), ctx.App.Writer))
+		}),
+	}
+	CheatForkCmd = &cli.Command{
+		Name:  "fork",
+		Usage: "Fetch accounts and storage slots that are missing in the data dir from a live node",
+		Description: "Prefetches state from a remote archive node into the local state, like the fork mode of dev chains: " +
+			"only the requested accounts that do not exist locally, and the requested slots that are zero locally, are fetched. " +
+			"Other state is not fetched when cheats read it later, so request all accounts and slots the cheats need. " +
+			"The fetched state is cached in the data dir, so later runs only fetch what is still missing. " +
+			"With --all the whole remote state is fetched with debug_accountRange, to create a local fork of a small chain, e.g. a devnet, without a sync. " +
+			"Accounts with storage keys the remote node has no pre-image of are skipped, and listed as incomplete.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.StringFlag{
+				Name:     "rpc",
+				Usage:    "RPC endpoint of the remote archive node to fetch state from, can be HTTP/WS/IPC",
+				Required: true,
+				EnvVars:  prefixEnvVars("REMOTE_RPC"),
+			},
+			&cli.Uint64Flag{
+				Name:    "block",
+				Usage:   "Block number to fetch the remote state at. The local head block number if not set.",
+				EnvVars: prefixEnvVars("BLOCK"),
+			},
+			&cli.GenericFlag{
+				Name:    "addresses",
+				Usage:   "Comma-separated addresses of accounts to fetch",
+				EnvVars: prefixEnvVars("ADDRESSES"),
+				Value:   &TextFlag[*AddressList]{Value: new(AddressList)},
+			},
+			&cli.StringFlag{
+				Name:      "slots",
+				Usage:     "Path to a JSON file with an object of addresses to the arrays of storage keys to fetch",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("SLOTS"),
+			},
+			&cli.BoolFlag{
+				Name:    "all",
+				Usage:   "Fetch all remote accounts that do not exist locally, with their code and storage, instead of the given addresses and slots",
+				EnvVars: prefixEnvVars("ALL"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			slots := make(map[common.Address][]common.Hash)
+			if path := ctx.String("slots"); path != "" {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read slots file: %w", err)
+				}
+				if err := json.Unmarshal(data, &slots); err != nil {
+					return fmt.Errorf("failed to decode slots file: %w", err)
+				}
+			}
+			addrs := addrListFlagValue("addresses", ctx)
+			all := ctx.Bool("all")
+			if all && (len(addrs) > 0 || len(slots) > 0) {
+				return errors.New("cannot use --all with addresses or slots to fetch")
+			}
+			if !all && len(addrs) == 0 && len(slots) == 0 {
+				return errors.New("expected addresses or slots to fetch, or --all")
+			}
+			remote, err := dialRPC(ctx.Context, ctx.String("rpc"))
+			if err != nil {
+				return fmt.Errorf("failed to dial remote RPC: %w", err)
+			}
+			defer remote.Close()
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				fork := &cheat.Fork{Remote: remote, Block: ch.Blockchain.CurrentBlock().Number.Uint64()}
+				if ctx.IsSet("block") {
+					fork.Block = ctx.Uint64("block")
+				}
+				if all {
+					return ch.RunAndClose(ctx.Context, cheat.ForkDump(fork, ctx.App.Writer))
+				}
+				return ch.RunAndClose(ctx.Context, cheat.ForkFetch(fork, addrs, slots, ctx.App.Writer))
+			})(ctx)
+		}),
+	}
+	CheatVerifyPredeploysCmd = &cli.Command{
+		Name:  "verify-predeploys",
+		Usage: "Verify the code and critical storage of the standard L2 predeploys",
+		Description: "Each predeploy is checked against the spec, or against the contract bindings of this build if it is not in the spec. " +
+			"The outcome of each check is written as JSON line, and the command fails if any predeploy deviates.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.StringFlag{
+				Name:      "spec",
+				Usage:     "Path to a JSON file with the expected code hashes and storage values of the predeploys, by name, for a specific OP Stack version",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("SPEC"),
+			},
+		},
+		Action: CheatAction(true, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			spec := make(cheat.PredeploySpec)
+			if path := ctx.String("spec"); path != "" {
+				var err error
+				if spec, err = cheat.ReadPredeploySpec(path); err != nil {
+					return err
+				}
+			}
+			return ch.RunAndClose(ctx.Context, cheat.VerifyPredeploys(spec, ctx.App.Writer))
+		}),
+	}
+	CheatPredeployConfigCmd = &cli.Command{
+		Name:  "predeploy-config",
+		Usage: "Write the predeploy storage values that follow from an OP Stack deploy config, e.g. owners and fee parameters",
+		Description: "The ProxyAdmin owner, the L1Block batcher hash and fee parameters, and the GovernanceToken name, symbol and owner " +
+			"if governance is enabled, are encoded with the storage layouts of the contract bindings of this build. " +
+			"Runtime values of the genesis storage, like the L1 block info, are not changed. " +
+			"All variables are written as JSON, with their old and new slot values.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.PathFlag{
+				Name:      "deploy-config",
+				Usage:     "Path to the deploy config JSON file",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DEPLOY_CONFIG"),
+			},
+			&cli.BoolFlag{
+				Name:    "check",
+				Usage:   "Only compare the predeploy storage against the deploy config, and fail if it differs",
+				EnvVars: prefixEnvVars("CHECK"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			config, err := genesis.NewDeployConfig(ctx.Path("deploy-config"))
+			if err != nil {
+				return err
+			}
+			check := ctx.Bool("check")
+			return CheatAction(check, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.ApplyPredeployConfig(config, check, ctx.App.Writer))
+			})(ctx)
+		}),
+	}
+	CheatPredeploysCmd = &cli.Command{
+		Name: "predeploys",
+		Subcommands: []*cli.Command{
+			CheatPredeploysInstallCmd,
+		},
+	}
+	CheatPredeploysInstallCmd = &cli.Command{
+		Name:  "install",
+		Usage: "Write the standard OP Stack predeploys at their canonical addresses, e.g. to turn a plain Geth DB into an L2 devnet",
+		Description: "Proxied predeploys get the standard proxy, with the predeploy proxy admin as admin, " +
+			"and their implementation in the code namespace, like the L2 genesis. Other storage is not changed, " +
+			"see predeploy-config to write the owners and fee parameters. " +
+			"The code is taken from the contract bindings of this build, or from the Foundry artifacts in --artifacts. " +
+			"Immutables, e.g. of the fee vaults, are only set with --deploy-config. Each installed predeploy is written as JSON line.",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			&cli.StringSliceFlag{
+				Name:    "predeploy",
+				Usage:   "Name of a predeploy to install, e.g. L1Block. All predeploys if not set, the GovernanceToken only if governance is enabled in the deploy config.",
+				EnvVars: prefixEnvVars("PREDEPLOY"),
+			},
+			&cli.PathFlag{
+				Name:      "artifacts",
+				Usage:     "Directory with the Foundry artifacts to take the code from, e.g. the forge-artifacts of contracts-bedrock",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("ARTIFACTS"),
+			},
+			&cli.PathFlag{
+				Name:      "deploy-config",
+				Usage:     "Path to the deploy config JSON file, to deploy the predeploys with immutables with the immutables of the config",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DEPLOY_CONFIG"),
+			},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			code := cheat.PredeployCode(cheat.EmbeddedPredeployCode)
+			if dir := ctx.Path("artifacts"); dir != "" {
+				code = cheat.PredeployCodeDir(dir)
+			}
+			governance := false
+			var deployed immutables.DeploymentResults
+			if path := ctx.Path("deploy-config"); path != "" {
+				config, err := genesis.NewDeployConfig(path)
+				if err != nil {
+					return err
+				}
+				if deployed, err = cheat.PredeployImmutables(config); err != nil {
+					return fmt.Errorf("failed to deploy predeploys with immutables: %w", err)
+				}
+				governance = config.EnableGovernance
+			}
+			names := ctx.StringSlice("predeploy")
+			if len(names) == 0 {
+				names = cheat.PredeployNames(governance)
+			}
+			return CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+				return ch.RunAndClose(ctx.Context, cheat.InstallPredeploys(names, code, deployed, ctx.App.Writer))
+			})(ctx)
+		}),
+	}
+	CheatLogsCmd = &cli.Command{
+		Name: "logs",
+		Subcommands: []*cli.Command{
+			CheatLogsExportCmd,
+		},
+	}
+	CheatLogsExportCmd = &cli.Command{
+		Name:  "export",
+		Usage: "Export the event logs of a range of canonical blocks as JSON lines, read from the receipts in the database",
+		Description: "Like eth_getLogs, without a node or indexer. The data dir is opened read-only, " +
+			"the node using it must be stopped.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.GenericFlag{
+				Name:    "address",
+				Usage:   "Comma-separated addresses of the emitters of the logs to export. Any emitter if not set.",
+				EnvVars: prefixEnvVars("ADDRESS"),
+				Value:   &TextFlag[*AddressList]{Value: new(AddressList)},
+			},
+			&cli.StringSliceFlag{
+				Name: "topic",
+				Usage: "Topic to match, repeated per topic position, starting at the event signature. " +
+					"Alternatives are separated by '|', an empty value or '*' matches any topic.",
+				EnvVars: prefixEnvVars("TOPIC"),
+			},
+			&cli.Uint64Flag{
+				Name:    "from-block",
+				Usage:   "First block of the range",
+				EnvVars: prefixEnvVars("FROM_BLOCK"),
+			},
+			&cli.Uint64Flag{
+				Name:    "to-block",
+				Usage:   "Last block of the range. The head block if 0.",
+				EnvVars: prefixEnvVars("TO_BLOCK"),
+			},
+			&cli.StringFlag{
+				Name:      "out",
+				Usage:     "File to write the logs to, instead of stdout. Required to write a manifest.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("OUT"),
+			},
+			ManifestFlag, GzipFlag,
+		},
+		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			topics, err := parseTopicFilter(c.StringSlice("topic"))
+			if err != nil {
+				return err
+			}
+			filter := &cheat.LogFilter{Addresses: addrListFlagValue("address", c), Topics: topics}
+			path := c.String("out")
+			if path == "" && c.IsSet(ManifestFlag.Name) {
+				return errors.New("a manifest requires the logs to be written to a file")
+			}
+			out, err := openOutput(c, path)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			report, err := cheat.ExportLogs(c.Context, db, c.Uint64("from-block"), c.Uint64("to-block"), filter, out)
+			if err != nil {
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+			if path == "" {
+				return nil
+			}
+			log.Info("exported logs", "from", report.FromBlock, "to", report.ToBlock, "receipts", report.Receipts, "logs", report.Logs)
+			genesisHash := rawdb.ReadCanonicalHash(db, 0)
+			var chainID *big.Int
+			if config := rawdb.ReadChainConfig(db, genesisHash); config != nil {
+				chainID = config.ChainID
+			}
+			return WriteManifest(c, chainID, &report.FromBlock, &report.ToBlock, path)
+		}),
+	}
+	CheatAccountCmd = &cli.Command{
+		Name: "account",
+		Subcommands: []*cli.Command{
+			CheatAccountDeleteCmd,
+			CheatAccountCloneCmd,
+		},
+	}
+	CheatAccountDeleteCmd = &cli.Command{
+		Name:  "delete",
+		Usage: "Remove an account entirely from the state: balance, nonce, code and storage, like a self-destruct",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("address", "Address of the account to delete"),
+		},
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.DeleteAccount(addrFlagValue("address", ctx)))
+		})),
+	}
+	CheatAccountCloneCmd = &cli.Command{
+		Name:  "clone",
+		Usage: "Copy the balance, nonce, code and full storage of an account to another address, e.g. to duplicate a token contract",
+		Flags: []cli.Flag{
+			DataDirFlag, CompactFlag, DryRunFlag, PlanFlag,
+			addrFlag("from", "Address of the account to clone"),
+			addrFlag("to", "Address to clone the account to"),
+			&cli.BoolFlag{
+				Name:    "overwrite",
+				Usage:   "Replace the account at the destination address entirely, if it exists",
+				EnvVars: prefixEnvVars("OVERWRITE"),
+			},
+		},
+		Action: PlanAction(false, CheatAction(false, func(ctx *cli.Context, ch *cheat.Cheater) error {
+			return ch.RunAndClose(ctx.Context, cheat.CloneAccount(addrFlagValue("from", ctx), addrFlagValue("to", ctx), ctx.Bool("overwrite")))
+		})),
+	}
+	CheatBlockCmd = &cli.Command{
+		Name: "block",
+		Subcommands: []*cli.Command{
+			CheatBlockInsertTxCmd,
+		},
+	}
+	CheatBlockInsertTxCmd = &cli.Command{
+		Name:  "insert-tx",
+		Usage: "Append or replace a transaction in the body of a stored canonical block, for negative testing of verifiers",
+		Description: "The transaction is not executed. By default the header is left as-is, so the block is inconsistent. " +
+			"With --tx-root or --receipts the header is updated, and the block is stored and made canonical under its new hash: " +
+			"any descendant blocks then no longer connect to it.",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+			&cli.Uint64Flag{
+				Name:     "block",
+				Usage:    "Number of the canonical block to change",
+				Required: true,
+				EnvVars:  prefixEnvVars("BLOCK"),
+			},
+			bytesFlag("tx", "Transaction to insert, in its binary (RLP or typed) encoding"),
+			&cli.Uint64Flag{
+				Name:    "replace",
+				Usage:   "Index of the transaction to replace. The transaction is appended if not set.",
+				EnvVars: prefixEnvVars("REPLACE"),
+			},
+			&cli.BoolFlag{
+				Name:    "tx-root",
+				Usage:   "Recompute the transactions root of the header",
+				EnvVars: prefixEnvVars("TX_ROOT"),
+			},
+			&cli.BoolFlag{
+				Name:    "receipts",
+				Usage:   "Store a placeholder (failed, no gas) receipt of the transaction, and recompute the receipts root and bloom of the header",
+				EnvVars: prefixEnvVars("RECEIPTS"),
+			},
+		},
+		Action: PlanAction(false, CheatRawDBAction(false, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			var tx types.Transaction
+			if err := tx.UnmarshalBinary(bytesFlagValue("tx", c)); err != nil {
+				return fmt.Errorf("failed to decode transaction: %w", err)
+			}
+			cfg := &cheat.InsertTxConfig{
+				Number:         c.Uint64("block"),
+				Tx:             &tx,
+				UpdateTxRoot:   c.Bool("tx-root"),
+				UpdateReceipts: c.Bool("receipts"),
+			}
+			if c.IsSet("replace") {
+				index := c.Uint64("replace")
+				cfg.Replace = &index
+			}
+			report, err := cheat.InsertTx(db, cfg)
+			if err != nil {
+				return err
+			}
+			if report.Orphaned {
+				log.Warn("block hash changed, descendant blocks no longer connect to the canonical chain", "number", report.Number, "hash", report.NewHash)
+			}
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})),
+	}
+	CheatHeaderCmd = &cli.Command{
+		Name: "header",
+		Subcommands: []*cli.Command{
+			CheatHeaderSetCmd,
+		},
+	}
+	CheatHeaderSetCmd = &cli.Command{
+		Name:  "set",
+		Usage: "Change fields of the head block header, e.g. to reproduce edge-case timestamps on devnets",
+		Description: "The fields are not validated. The head block is stored under its new hash, with the same body and receipts, " +
+			"and the canonical, head and finalized block mappings are moved to it.",
+		Flags: []cli.Flag{
+			DataDirFlag, PlanFlag,
+			&cli.Uint64Flag{
+				Name:    "timestamp",
+				Usage:   "New timestamp of the head block",
+				EnvVars: prefixEnvVars("TIMESTAMP"),
+			},
+			&cli.Uint64Flag{
+				Name:    "gas-limit",
+				Usage:   "New gas limit of the head block",
+				EnvVars: prefixEnvVars("GAS_LIMIT"),
+			},
+			&cli.GenericFlag{
+				Name:    "extra-data",
+				Usage:   "New extra-data of the head block, hex encoded",
+				EnvVars: prefixEnvVars("EXTRA_DATA"),
+				Value:   &TextFlag[*hexutil.Bytes]{Value: new(hexutil.Bytes)},
+			},
+			&cli.GenericFlag{
+				Name:    "base-fee",
+				Usage:   "New base fee of the head block, in wei",
+				EnvVars: prefixEnvVars("BASE_FEE"),
+				Value:   &TextFlag[*big.Int]{Value: new(big.Int)},
+			},
+		},
+		Action: PlanAction(false, CheatRawDBAction(false, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			var override cheat.HeaderOverride
+			if c.IsSet("timestamp") {
+				v := c.Uint64("timestamp")
+				override.Time = &v
+			}
+			if c.IsSet("gas-limit") {
+				v := c.Uint64("gas-limit")
+				override.GasLimit = &v
+			}
+			if c.IsSet("extra-data") {
+				v := []byte(bytesFlagValue("extra-data", c))
+				override.ExtraData = &v
+			}
+			if c.IsSet("base-fee") {
+				override.BaseFee = bigFlagValue("base-fee", c)
+			}
+			if override == (cheat.HeaderOverride{}) {
+				return fmt.Errorf("no header field to set, expected at least one of --timestamp, --gas-limit, --extra-data or --base-fee")
+			}
+			report, err := cheat.SetHeadHeader(db, &override)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})),
+	}
+	CheatChainStatsCmd = &cli.Command{
+		Name:  "chain-stats",
+		Usage: "Compute statistics of the canonical chain: blocks, txs, gas used per day, block fullness and unique senders",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.Uint64Flag{
+				Name:    "from",
+				Usage:   "First block of the range",
+				EnvVars: prefixEnvVars("FROM"),
+			},
+			&cli.Uint64Flag{
+				Name:    "to",
+				Usage:   "Last block of the range. The head block if 0.",
+				EnvVars: prefixEnvVars("TO"),
+			},
+		},
+		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
+			defer db.Close()
+			report, err := cheat.ChainStats(c.Context, db, c.Uint64("from"), c.Uint64("to"))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}),
+	}
+	CheatMigrateStateCmd = &cli.Command{
+		Name:  "migrate-state",
+		Usage: "Copy a data dir into a new data dir, with the head state in the other state scheme: hash-based or path-based",
+		Description: "The state scheme of the data dir is detected, and the head state is written in the other scheme, " +
+			"to carry databases forward to op-geth versions with path-based state storage, or back. " +
+			"The blocks and all other data are copied as they are, states other than the head state are not copied. " +
+			"The node using the data dir must be stopped. Writes the outcome as JSON. " +
+			"The migration is not journaled: to retry an interrupted migration, remove the partial destination data dir and start over.",
+		Flags: []cli.Flag{
+			DataDirFlag,
+			&cli.StringFlag{
+				Name:      "dest.data-dir",
+				Usage:     "New data dir to write the migrated database to, must not exist or be empty",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DEST_DATA_DIR"),
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			dirs, err := dataDirs(ctx)
+			if err != nil {
+				return err
+			}
+			if len(dirs) != 1 {
+				return fmt.Errorf("migrate-state takes a single --%s, got %d", DataDirFlag.Name, len(dirs))
+			}
+			report, err := cheat.MigrateStateSchemeDir(ctx.Context, dirs[0], ctx.String("dest.data-dir"))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		},
+	}
+	CheatCompareDirsCmd = &cli.Command{
+		Name:  "compare-dirs",
+		Usage: "Compare the chain configs, head blocks, state roots and selected accounts of the databases of two data dirs",
+		Description: "Writes the comparison as JSON, and fails if the databases differ. " +
+			"Both data dirs are opened read-only, the nodes using them must be stopped.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      "a",
+				Usage:     "Geth data dir A",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DATA_DIR_A"),
+			},
+			&cli.StringFlag{
+				Name:      "b",
+				Usage:     "Geth data dir B",
+				Required:  true,
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DATA_DIR_B"),
+			},
+			&cli.Uint64Flag{
+				Name:    "block",
+				Usage:   "Block number to compare the canonical chain and state at. The lowest of the two head blocks if not set.",
+				EnvVars: prefixEnvVars("BLOCK"),
+			},
+			&cli.GenericFlag{
+				Name:    "accounts",
+				Usage:   "Comma-separated addresses of accounts to compare the state of",
+				EnvVars: prefixEnvVars("ACCOUNTS"),
+				Value:   &TextFlag[*AddressList]{Value: new(AddressList)},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			a, err := cheat.OpenGethRawDB(ctx.String("a"), true)
+			if err != nil {
+				return fmt.Errorf("failed to open data dir a: %w", err)
+			}
+			defer a.Close()
+			b, err := cheat.OpenGethRawDB(ctx.String("b"), true)
+			if err != nil {
+				return fmt.Errorf("failed to open data dir b: %w", err)
+			}
+			defer b.Close()
+			var block *uint64
+			if ctx.IsSet("block") {
+				n := ctx.Uint64("block")
+				block = &n
+			}
+			cmp, err := cheat.CompareDirs(ctx.Context, a, b, block, addrListFlagValue("accounts", ctx))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(cmp); err != nil {
+				return err
+			}
+			if len(cmp.Differences) > 0 {
+				return fmt.Errorf("data dirs differ in %d ways", len(cmp.Differences))
+			}
+			return nil
+		},
+	}
+	CheatSelftestCmd = &cli.Command{
+		Name:  "selftest",
+		Usage: "Verify that storage diff and storage patch round-trip, with randomized storage mutations in an in-memory state",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "rounds",
+				Usage:   "Number of randomized rounds to run",
+				EnvVars: prefixEnvVars("ROUNDS"),
+				Value:   100,
+			},
+			&cli.IntFlag{
+				Name:    "slots",
+				Usage:   "Maximum number of storage slots of the reference account, and of mutations, per round",
+				EnvVars: prefixEnvVars("SLOTS"),
+				Value:   100,
+			},
+			&cli.Int64Flag{
+				Name:    "seed",
+				Usage:   "Seed of the randomized mutations, to reproduce a failure. Time-based if 0.",
+				EnvVars: prefixEnvVars("SEED"),
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			cfg := &cheat.SelftestConfig{
+				Rounds: ctx.Int("rounds"),
+				Slots:  ctx.Int("slots"),
+				Seed:   ctx.Int64("seed"),
+			}
+			if cfg.Rounds <= 0 || cfg.Slots <= 0 {
+				return errors.New("rounds and slots must be positive")
+			}
+			if cfg.Seed == 0 {
+				cfg.Seed = time.Now().UnixNano()
+			}
+			if err := cheat.Selftest(ctx.Context, cfg); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(ctx.App.Writer, "selftest passed: %d rounds with seed %d\n", cfg.Rounds, cfg.Seed)
+			return err
+		},
+	}
+	CheatPrintHeadBlock = &cli.Command{
+		Name:  "head-block",
+		Usage: "dump head block as JSON",
+		Flags: []cli.Flag{
+			DataDirFlag,
+		},
+		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("  ", "  ")
+			block := rawdb.ReadHeadBlock(db)
+			if block == nil {
+				return enc.Encode(nil)
+			}
+			return enc.Encode(engine.RPCBlock{
+				Header:       *block.Header(),
+				Transactions: block.Transactions(),
+			})
+		}),
+	}
+	CheatPrintHeadHeader = &cli.Command{
+		Name:  "head-header",
+		Usage: "dump head header as JSON",
+		Flags: []cli.Flag{
+			DataDirFlag,
+		},
+		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
+			enc := json.NewEncoder(c.App.Writer)
+			enc.SetIndent("  ", "  ")
+			return enc.Encode(rawdb.ReadHeadHeader(db))
+		}),
+	}
+	EngineBlockCmd = &cli.Command{
+		Name:  "block",
+		Usage: "build the next block using the Engine API",
+		Flags: []cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag,
+			FeeRecipientFlag, RandaoFlag, RandaoSourceFlag, BlockTimeFlag, BuildingTime, AllowGaps,
+			TxFileFlag, TxSimFlag, L1OriginFlag, PlanFlag, OutputFlag, MinPriorityFeeFlag, MinerRPCFlag, NoTxPoolFlag,
+		},
+		// TODO: reorg flag
+		// TODO: finalize/safe flag
+
+		Action: PlanAction(false, EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			if err := applyMinerSettings(ctx, client); err != nil {
+				return err
+			}
+			settings := ParseBuildingArgs(ctx)
+			l1Origin, err := ParseL1Origin(ctx)
+			if err != nil {
+				return err
+			}
+			settings.L1Origin = l1Origin
+			if settings.RandaoSource, err = ParseRandaoSource(ctx); err != nil {
+				return err
+			}
+			if path := ctx.String(TxFileFlag.Name); path != "" {
+				txs, err := engine.ReadTxFile(path)
+				if err != nil {
+					return err
+				}
+				txs, err = simulateTxs(ctx, client, txs)
+				if err != nil {
+					return err
+				}
+				settings.Transactions, err = engine.EncodeTxs(txs)
+				if err != nil {
+					return err
+				}
+			}
+			status, err := engine.Status(ctx.Context, client)
+			if err != nil {
+				return err
+			}
+			payload, err := engine.BuildBlock(ctx.Context, client, status, settings)
+			if err != nil {
+				return err
+			}
+			if l2Output(ctx) {
+				genesis, err := parseRollupGenesis(ctx)
+				if err != nil {
+					return err
+				}
+				ref, err := engine.L2BlockRef(ctx.Context, client, payload.BlockHash.String(), genesis)
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(ctx.App.Writer)
+				enc.SetIndent("", "  ")
+				return enc.Encode(ref)
+			}
+			_, err = io.WriteString(ctx.App.Writer, payload.BlockHash.String())
+			return err
+		})),
+	}
+	EngineAutoCmd = &cli.Command{
+		Name:        "auto",
+		Usage:       "Run a proof-of-nothing chain with fixed block time.",
+		Description: "The block time can be changed. The execution engine must be synced to a post-Merge state first.",
+		Flags: append(append([]cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag,
+			FeeRecipientFlag, RandaoFlag, RandaoSourceFlag, BlockTimeFlag, BuildingTime, AllowGaps, L1OriginFlag, PlanFlag,
+			MinPriorityFeeFlag, MinerRPCFlag, NoTxPoolFlag,
+			&cli.StringFlag{
+				Name:    "backpressure.http",
+				Usage:   "HTTP endpoint that responds with the latest block number processed downstream, to pause block production on lag",
+				EnvVars: prefixEnvVars("BACKPRESSURE_HTTP"),
+			},
+			&cli.StringFlag{
+				Name:    "backpressure.rollup-rpc",
+				Usage:   "op-node rollup RPC, to pause block production when the op-node L1 derivation lags",
+				EnvVars: prefixEnvVars("BACKPRESSURE_ROLLUP_RPC"),
+			},
+			&cli.Uint64Flag{
+				Name:    "backpressure.max-lag",
+				Usage:   "Maximum number of blocks downstream may lag behind, before block production is paused",
+				EnvVars: prefixEnvVars("BACKPRESSURE_MAX_LAG"),
+				Value:   10,
+			},
+			&cli.IntFlag{
+				Name:    "engine.max-concurrent-calls",
+				Usage:   "Maximum number of concurrent engine calls. Block production calls take priority over background queries.",
+				EnvVars: prefixEnvVars("ENGINE_MAX_CONCURRENT_CALLS"),
+				Value:   4,
+			},
+			&cli.Float64Flag{
+				Name:    "engine.background-rate",
+				Usage:   "Maximum number of background engine queries per second. Block production calls are not rate-limited. Unlimited if 0.",
+				EnvVars: prefixEnvVars("ENGINE_BACKGROUND_RATE"),
+				Value:   100,
+			},
+			&cli.DurationFlag{
+				Name:    "misbehave.withhold-payload",
+				Usage:   "Withhold each built payload for this long before inserting it, to simulate a misbehaving sequencer. Disabled if 0.",
+				EnvVars: prefixEnvVars("MISBEHAVE_WITHHOLD_PAYLOAD"),
+			},
+			&cli.DurationFlag{
+				Name:    "misbehave.delay-forkchoice",
+				Usage:   "Delay the forkchoice update after each inserted payload by this long, to simulate a misbehaving sequencer. Disabled if 0.",
+				EnvVars: prefixEnvVars("MISBEHAVE_DELAY_FORKCHOICE"),
+			},
+			&cli.StringFlag{
+				Name:    "events",
+				Usage:   "Emit chain events as JSON lines: '-' for stdout, with the logs on stderr, or the path of a unix socket to serve them on. Disabled if empty.",
+				EnvVars: prefixEnvVars("EVENTS"),
+			},
+			&cli.BoolFlag{
+				Name:    "manual-trigger",
+				Usage:   "Only build a block on SIGUSR1 (not on Windows), or on a POST to the manual-trigger.http endpoint, instead of following the block time",
+				EnvVars: prefixEnvVars("MANUAL_TRIGGER"),
+			},
+			&cli.StringFlag{
+				Name:    "manual-trigger.http",
+				Usage:   "Listen address of the HTTP endpoint to trigger blocks with in manual-trigger mode, e.g. 127.0.0.1:8560. Disabled if empty.",
+				EnvVars: prefixEnvVars("MANUAL_TRIGGER_HTTP"),
+			},
+			&cli.GenericFlag{
+				Name:    "fee-recipients",
+				Usage:   "Comma-separated fee recipients to rotate per block, round-robin, instead of the fee-recipient",
+				EnvVars: prefixEnvVars("FEE_RECIPIENTS"),
+				Value:   &TextFlag[*AddressList]{Value: new(AddressList)},
+			},
+			&cli.StringFlag{
+				Name:      "fee-recipients.schedule",
+				Usage:     "Path to a JSON array of {\"address\", \"weight\"} fee recipients to rotate per block, weighted round-robin",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("FEE_RECIPIENTS_SCHEDULE"),
+			},
+			&cli.GenericFlag{
+				Name:    "fee-recipients.contract",
+				Usage:   "Contract to read the fee recipient of each block from, at the parent block, e.g. a fee vault config contract",
+				EnvVars: prefixEnvVars("FEE_RECIPIENTS_CONTRACT"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.GenericFlag{
+				Name:    "fee-recipients.slot",
+				Usage:   "Storage slot of the fee recipients contract that holds the fee recipient",
+				EnvVars: prefixEnvVars("FEE_RECIPIENTS_SLOT"),
+				Value:   &TextFlag[*common.Hash]{Value: new(common.Hash)},
+			},
+			&cli.StringFlag{
+				Name:    "fee-recipients.call",
+				Usage:   "Signature of the view function of the fee recipients contract that returns the fee recipient, e.g. 'RECIPIENT()'",
+				EnvVars: prefixEnvVars("FEE_RECIPIENTS_CALL"),
+			},
+			&cli.StringFlag{
+				Name: "state-file",
+				Usage: "Persist the building settings and the next block number to this JSON file, and restore them on restart. " +
+					"Building flags that conflict with the persisted settings are rejected; remove the file to change them. " +
+					"Fails if the engine head does not continue where block production stopped, see state-file.force.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("STATE_FILE"),
+			},
+			&cli.BoolFlag{
+				Name:    "state-file.force",
+				Usage:   "Continue block production from the persisted state, even if the engine head does not continue where it stopped",
+				EnvVars: prefixEnvVars("STATE_FILE_FORCE"),
+			},
+			&cli.StringFlag{
+				Name: "replay.dir",
+				Usage: "Directory of recorded raw transactions to force into the blocks, e.g. captured traffic. Requires op-geth. " +
+					"Each file has hex-encoded signed transactions, one per line; files are replayed in the order of their names.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("REPLAY_DIR"),
+			},
+			&cli.IntFlag{
+				Name:    "replay.txs-per-block",
+				Usage:   "Number of replayed transactions to force into each block",
+				EnvVars: prefixEnvVars("REPLAY_TXS_PER_BLOCK"),
+				Value:   10,
+			},
+			&cli.StringFlag{
+				Name: "cheat.watch-dir",
+				Usage: "Directory to watch for cheat scripts and storage patches, applied to the engine over cheat.rpc between blocks, " +
+					"see the cheat watch command. Disabled if empty.",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("CHEAT_WATCH_DIR"),
+			},
+			&cli.StringFlag{
+				Name:    "cheat.rpc",
+				Usage:   "RPC endpoint of the engine to apply the cheat files of cheat.watch-dir with, can be HTTP/WS/IPC",
+				EnvVars: prefixEnvVars("CHEAT_RPC"),
+			},
+			&cli.StringFlag{
+				Name:    "cheat.rpc.namespace",
+				Usage:   CheatRPCNamespaceFlag.Usage,
+				EnvVars: prefixEnvVars("CHEAT_RPC_NAMESPACE"),
+				Value:   CheatRPCNamespaceFlag.Value,
+			},
+		}, append(ServiceFlags, oplog.CLIFlags(envVarPrefix)...)...), opmetrics.CLIFlags(envVarPrefix)...),
+		Action: PlanAction(false, EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			logCfg := oplog.ReadCLIConfig(ctx)
+			if err := logCfg.Check(); err != nil {
+				return fmt.Errorf("failed to parse log configuration: %w", err)
+			}
+			var l log.Logger
+			if ctx.String("events") == "-" {
+				// the events are the output on stdout, so they are not interleaved with the logs
+				l = newStreamLogger(logCfg, ctx.App.ErrWriter)
+			} else {
+				l = oplog.NewLogger(logCfg)
+			}
+			l.SetHandler(log.MultiHandler(l.GetHandler(), ForensicLogs))
+			if err := applyMinerSettings(ctx, client); err != nil {
+				return err
+			}
+			client = engine.NewScheduledRPC(client, ctx.Int("engine.max-concurrent-calls"), ctx.Float64("engine.background-rate"))
+
+			settings := ParseBuildingArgs(ctx)
+			l1Origin, err := ParseL1Origin(ctx)
+			if err != nil {
+				return err
+			}
+			settings.L1Origin = l1Origin
+			if settings.RandaoSource, err = ParseRandaoSource(ctx); err != nil {
+				return err
+			}
+			settings.WithholdPayload = ctx.Duration("misbehave.withhold-payload")
+			settings.DelayForkchoice = ctx.Duration("misbehave.delay-forkchoice")
+			if path := ctx.String("fee-recipients.schedule"); path != "" {
+				if ctx.IsSet("fee-recipients") {
+					return errors.New("cannot use both fee-recipients and a fee recipient schedule")
+				}
+				if settings.FeeRecipients, err = engine.ReadFeeRecipientSchedule(path); err != nil {
+					return err
+				}
+			} else if addrs := addrListFlagValue("fee-recipients", ctx); len(addrs) > 0 {
+				settings.FeeRecipients = engine.RoundRobin(addrs)
+			}
+			if settings.FeeRecipientSource, err = ParseFeeRecipientSource(ctx); err != nil {
+				return err
+			}
+			// TODO: finalize/safe flag
+			var opts []engine.AutoOption
+			if path := ctx.String("state-file"); path != "" {
+				state, err := engine.ReadAutoState(path)
+				if err != nil {
+					return err
+				}
+				if state != nil {
+					if state.RandaoSource != "" && settings.RandaoSource == nil && !ctx.IsSet(RandaoFlag.Name) {
+						// restore the randao source, which the state only has the endpoint of
+						if settings.RandaoSource, err = dialRandaoSource(ctx.Context, state.RandaoSource); err != nil {
+							return err
+						}
+					}
+					if err := checkAutoState(ctx, state, settings); err != nil {
+						return err
+					}
+					if err := state.Apply(settings); err != nil {
+						return err
+					}
+					l.Info("restored building settings", "path", path, "block_time", settings.BlockTime,
+						"fee_recipient", settings.FeeRecipient, "next_block", state.NextBlock)
+				}
+				opts = append(opts, engine.WithStateFile(path, ctx.Bool("state-file.force")))
+			}
+
+			metricsCfg := opmetrics.ReadCLIConfig(ctx)
+
+			if dir := ctx.String(ForensicsDirFlag.Name); dir != "" {
+				opts = append(opts, engine.WithForensics(dir, ForensicLogs))
+			}
+			maxLag := ctx.Uint64("backpressure.max-lag")
+			if url := ctx.String("backpressure.http"); url != "" {
+				opts = append(opts, engine.WithBackpressure(&engine.HTTPLagSignal{URL: url}, maxLag))
+			} else if url := ctx.String("backpressure.rollup-rpc"); url != "" {
+				rollupClient, err := dialRPC(ctx.Context, url)
+				if err != nil {
+					return fmt.Errorf("failed to dial rollup RPC: %w", err)
+				}
+				opts = append(opts, engine.WithBackpressure(&engine.RollupNodeLagSignal{Client: rollupClient}, maxLag))
+			}
+			switch events := ctx.String("events"); events {
+			case "":
+			case "-":
+				opts = append(opts, engine.WithEvents(engine.NewEventWriter(ctx.App.Writer)))
+			default:
+				sock, err := engine.ListenEventSocket(events)
+				if err != nil {
+					return err
+				}
+				defer sock.Close()
+				opts = append(opts, engine.WithEvents(sock))
+			}
+			if dir := ctx.String("replay.dir"); dir != "" {
+				perBlock := ctx.Int("replay.txs-per-block")
+				if perBlock <= 0 {
+					return fmt.Errorf("replay.txs-per-block must be positive, got %d", perBlock)
+				}
+				corpus, err := engine.OpenTxCorpus(dir)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, engine.WithReplay(corpus, perBlock))
+			}
+			if dir := ctx.String("cheat.watch-dir"); dir != "" {
+				endpoint := ctx.String("cheat.rpc")
+				if endpoint == "" {
+					return errors.New("cheat.rpc is required with cheat.watch-dir")
+				}
+				cl, err := dialRPC(ctx.Context, endpoint)
+				if err != nil {
+					return fmt.Errorf("failed to dial cheat RPC: %w", err)
+				}
+				defer cl.Close()
+				ch := cheat.NewRPCCheater(cl, ctx.String("cheat.rpc.namespace"))
+				opts = append(opts, engine.WithBetweenBlocks(func(ctx context.Context) error {
+					_, err := cheat.ApplyWatchDir(ctx, l, dir, func(ctx context.Context, f cheat.WatchFile) error {
+						return f.ApplyRPC(ctx, ch)
+					})
+					return err
+				}))
+			}
+			manualTrigger := ctx.Bool("manual-trigger")
+			triggerAddr := ctx.String("manual-trigger.http")
+			triggers := make(chan *engine.Trigger)
+			if manualTrigger {
+				opts = append(opts, engine.WithManualTrigger(triggers))
+			}
+
+			var health *engine.Health
+			if ctx.Bool(ServiceFlag.Name) {
+				health = engine.NewHealth(ctx.Duration(ServiceLivenessTimeoutFlag.Name))
+				opts = append(opts, engine.WithHealth(health))
+			}
+
+			cmdCtx := ctx.Context
+			run := func(ctx context.Context, shutdown <-chan struct{}) error {
+				ctx, cancel := withDeadlineOf(ctx, cmdCtx)
+				defer cancel()
+				if manualTrigger {
+					if err := notifySignalTrigger(ctx, triggers); err != nil {
+						if triggerAddr == "" {
+							return fmt.Errorf("%w, trigger blocks with --manual-trigger.http instead", err)
+						}
+						l.Info("building blocks on manual trigger only", "http", triggerAddr)
+					} else {
+						l.Info("building blocks on manual trigger only", "signal", "SIGUSR1", "http", triggerAddr)
+					}
+					if triggerAddr != "" {
+						srv := &http.Server{Addr: triggerAddr, Handler: &engine.TriggerHandler{Triggers: triggers}}
+						go func() {
+							if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+								l.Error("failed to serve manual trigger endpoint", "err", err)
+							}
+						}()
+						defer srv.Close()
+						l.Info("serving manual trigger endpoint", "addr", triggerAddr)
+					}
+				}
+				registry := opmetrics.NewRegistry()
+				metrics := engine.NewMetrics("wheel", registry)
+				if metricsCfg.Enabled {
+					l.Info("starting metrics server", "addr", metricsCfg.ListenAddr, "port", metricsCfg.ListenPort)
+					go func() {
+						if err := opmetrics.ListenAndServe(ctx, registry, metricsCfg.ListenAddr, metricsCfg.ListenPort); err != nil {
+							l.Error("error starting metrics server", err)
+						}
+					}()
+				}
+				return engine.Auto(ctx, metrics, client, l, shutdown, settings, opts...)
+			}
+			if health != nil {
+				return ServiceAction(l, ReadServiceConfig(ctx), health, run)
+			}
+			return opservice.CloseAction(run)
+		})),
+	}
+	EngineBenchCmd = &cli.Command{
+		Name:        "bench",
+		Usage:       "Benchmark block building throughput and call latencies of the engine.",
+		Description: "Builds the given number of blocks back-to-back, optionally under generated transaction load, and outputs a JSON report.",
+		Flags: append([]cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag,
+			FeeRecipientFlag, RandaoFlag, BlockTimeFlag, BuildingTime, AllowGaps, PlanFlag,
+			&cli.Uint64Flag{
+				Name:    "blocks",
+				Usage:   "Number of blocks to build",
+				EnvVars: prefixEnvVars("BLOCKS"),
+				Value:   100,
+			},
+			&cli.StringFlag{
+				Name:    "tx-gen",
+				Usage:   "Transaction load generator to use before each block: none, transfer",
+				EnvVars: prefixEnvVars("TX_GEN"),
+				Value:   "none",
+			},
+			&cli.Uint64Flag{
+				Name:    "tx-gen.count",
+				Usage:   "Number of transactions to generate per block",
+				EnvVars: prefixEnvVars("TX_GEN_COUNT"),
+				Value:   100,
+			},
+		}, SignerFlags...),
+		Action: PlanAction(false, EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			settings := ParseBuildingArgs(ctx)
+			var gen engine.TxGenerator
+			switch kind := ctx.String("tx-gen"); kind {
+			case "none":
+			case "transfer":
+				signer, from, err := ParseSigner(ctx)
+				if err != nil {
+					return err
+				}
+				gen = &engine.TransferTxGenerator{
+					Signer:    signer,
+					From:      from,
+					Recipient: common.Address{1: 0x13, 2: 0x37},
+					Count:     ctx.Uint64("tx-gen.count"),
+				}
+			default:
+				return fmt.Errorf("unknown tx generator: %q", kind)
+			}
+			report, err := engine.Bench(ctx.Context, client, ctx.Uint64("blocks"), gen, settings)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})),
+	}
+	EngineSpamBlocksCmd = &cli.Command{
+		Name:  "spam-blocks",
+		Usage: "Build blocks filled with garbage transactions at a sustained rate, to stress storage growth and indexing.",
+		Description: "Blocks are built at the given rate regardless of the block time, so the chain may run ahead of the wall-clock. " +
+			"The garbage transactions are sent by the signer, and forced into the blocks, which requires op-geth. Outputs a JSON report.",
+		Flags: append([]cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag,
+			FeeRecipientFlag, RandaoFlag, BlockTimeFlag, BuildingTime, PlanFlag,
+			&cli.Float64Flag{
+				Name:    "rate",
+				Usage:   "Number of blocks to build per second",
+				EnvVars: prefixEnvVars("RATE"),
+				Value:   1,
+			},
+			&cli.Uint64Flag{
+				Name:    "size",
+				Usage:   "Amount of garbage calldata per block, in bytes. Limited by the block gas limit.",
+				EnvVars: prefixEnvVars("SIZE"),
+				Value:   100_000,
+			},
+			&cli.Uint64Flag{
+				Name:    "blocks",
+				Usage:   "Number of blocks to build. Builds blocks until interrupted if 0.",
+				EnvVars: prefixEnvVars("BLOCKS"),
+			},
+		}, SignerFlags...),
+		Action: PlanAction(false, EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			signer, from, err := ParseSigner(ctx)
+			if err != nil {
+				return err
+			}
+			report, err := engine.SpamBlocks(ctx.Context, client, &engine.SpamConfig{
+				Signer: signer,
+				From:   from,
+				Rate:   ctx.Float64("rate"),
+				Size:   ctx.Uint64("size"),
+				Blocks: ctx.Uint64("blocks"),
+			}, ParseBuildingArgs(ctx))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})),
+	}
+	EngineStatusCmd = &cli.Command{
+		Name:  "status",
+		Flags: []cli.Flag{EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag, OutputFlag},
+		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			var stat any
+			var err error
+			if l2Output(ctx) {
+				genesis, err := parseRollupGenesis(ctx)
+				if err != nil {
+					return err
+				}
+				stat, err = engine.L2Status(ctx.Context, client, genesis)
+				if err != nil {
+					return err
+				}
+			} else if stat, err = engine.Status(ctx.Context, client); err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stat)
+		}),
+	}
+	EngineResetToFinalizedCmd = &cli.Command{
+		Name:        "reset-to-finalized",
+		Usage:       "Reset the engine head and safe block to the finalized block.",
+		Description: "First-aid for a replica with a corrupted unsafe chain: the forkchoice is updated to make unsafe = safe = finalized.",
+		Flags: []cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag, PlanFlag,
+			&cli.BoolFlag{
+				Name:    "dry-run",
+				Usage:   "Only print what would change, without updating the forkchoice.",
+				EnvVars: prefixEnvVars("DRY_RUN"),
+			},
+		},
+		Action: PlanAction(false, EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			plan, err := engine.ResetToFinalized(ctx.Context, client, ctx.Bool("dry-run"))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(plan)
+		})),
+	}
+	EngineProxyCmd = &cli.Command{
+		Name:  "proxy",
+		Usage: "Serve read-only access to the engine blocks, without authentication, for tooling that cannot use the JWT secret.",
+		Description: "Serves eth_chainId, eth_blockNumber, eth_getBlockByNumber and eth_getBlockByHash, " +
+			"forwarded over the authenticated engine connection. All other methods are unavailable.",
+		Flags: []cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag,
+			&cli.StringFlag{
+				Name:    "listen",
+				Usage:   "Address to serve the read-only RPC on",
+				EnvVars: prefixEnvVars("LISTEN"),
+				Value:   "127.0.0.1:8545",
+			},
+		},
+		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			rpcSrv, err := engine.NewReadProxy(client)
+			if err != nil {
 				return err
 			}
-			return ch.RunAndClose(cheat.OvmOwners(&conf))
+			defer rpcSrv.Stop()
+			srv := &http.Server{Addr: ctx.String("listen"), Handler: rpcSrv}
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- srv.ListenAndServe()
+			}()
+			log.Info("serving read-only engine proxy", "addr", srv.Addr)
+			select {
+			case err := <-errCh:
+				return fmt.Errorf("failed to serve engine proxy: %w", err)
+			case <-ctx.Done():
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				return srv.Shutdown(shutdownCtx)
+			}
 		}),
 	}
-	CheatPrintHeadBlock = &cli.Command{
-		Name:  "head-block",
-		Usage: "dump head block as JSON",
+	EngineSubscribeReorgsCmd = &cli.Command{
+		Name:  "subscribe-reorgs",
+		Usage: "Watch the head of the engine, and print every reorg as JSON line, with its depth and the old and new branch.",
+		Description: "A reorg is a new head that does not build on the previous head, including a rewind of the head. " +
+			"Runs until interrupted, or until the global timeout.",
 		Flags: []cli.Flag{
-			DataDirFlag,
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag,
+			&cli.DurationFlag{
+				Name:    "poll-interval",
+				Usage:   "Interval to check the head at",
+				EnvVars: prefixEnvVars("POLL_INTERVAL"),
+				Value:   time.Second,
+			},
+			&cli.Uint64Flag{
+				Name:    "min-depth",
+				Usage:   "Only print reorgs of at least this depth",
+				EnvVars: prefixEnvVars("MIN_DEPTH"),
+				Value:   1,
+			},
+			&cli.Uint64Flag{
+				Name:    "max-depth",
+				Usage:   "Maximum number of blocks to walk back to find the common ancestor of a reorg",
+				EnvVars: prefixEnvVars("MAX_DEPTH"),
+				Value:   1000,
+			},
 		},
-		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
-			enc := json.NewEncoder(c.App.Writer)
-			enc.SetIndent("  ", "  ")
-			block := rawdb.ReadHeadBlock(db)
-			if block == nil {
-				return enc.Encode(nil)
-			}
-			return enc.Encode(engine.RPCBlock{
-				Header:       *block.Header(),
-				Transactions: block.Transactions(),
+		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			minDepth := ctx.Uint64("min-depth")
+			enc := json.NewEncoder(ctx.App.Writer)
+			err := engine.WatchReorgs(ctx.Context, log.Root(), client, ctx.Duration("poll-interval"), ctx.Uint64("max-depth"), func(r *engine.Reorg) error {
+				if r.Depth < minDepth {
+					return nil
+				}
+				return enc.Encode(r)
 			})
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
 		}),
 	}
-	CheatPrintHeadHeader = &cli.Command{
-		Name:  "head-header",
-		Usage: "dump head header as JSON",
+	EngineReplayAttributesCmd = &cli.Command{
+		Name:  "replay-attributes",
+		Usage: "Build blocks with the payload attributes of op-node debug logs, to reproduce sequencing decisions.",
+		Description: "Parses the attributes of the \"Adding next safe attributes\" lines of op-node debug logs, " +
+			"in the terminal, logfmt or JSON log format, and builds a block with each of them on the engine head, in order. " +
+			"The engine must be at the safe head of the first logged attributes. Prints every built block as JSON line.",
 		Flags: []cli.Flag{
-			DataDirFlag,
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, BuildingTime,
+			&cli.PathFlag{
+				Name:     "logs",
+				Usage:    "op-node log file to replay the payload attributes of, may be gzip-compressed",
+				EnvVars:  prefixEnvVars("LOGS"),
+				Required: true,
+			},
 		},
-		Action: CheatRawDBAction(true, func(c *cli.Context, db ethdb.Database) error {
-			enc := json.NewEncoder(c.App.Writer)
-			enc.SetIndent("  ", "  ")
-			return enc.Encode(rawdb.ReadHeadHeader(db))
+		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
+			f, err := openInput(ctx.Path("logs"))
+			if err != nil {
+				return fmt.Errorf("failed to open logs: %w", err)
+			}
+			defer f.Close()
+			attrs, err := engine.ParseAttributesLogs(f)
+			if err != nil {
+				return fmt.Errorf("failed to parse logs: %w", err)
+			}
+			if len(attrs) == 0 {
+				return errors.New("no payload attributes found in logs")
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			return engine.ReplayAttributes(ctx.Context, log.Root(), client, attrs, ctx.Duration(BuildingTime.Name), func(r *engine.ReplayedAttributes) error {
+				return enc.Encode(r)
+			})
 		}),
 	}
-	EngineBlockCmd = &cli.Command{
-		Name:  "block",
-		Usage: "build the next block using the Engine API",
+	EngineAncestryCmd = &cli.Command{
+		Name:  "ancestry",
+		Usage: "Confirm or refute that one block is an ancestor of the other, by walking the parent hashes.",
+		Description: "Prints the path length between the blocks, and fails if neither block is an ancestor of the other. " +
+			"A check before forkchoice updates that may reorg the chain.",
 		Flags: []cli.Flag{
-			EngineEndpoint, EngineJWTPath,
-			FeeRecipientFlag, RandaoFlag, BlockTimeFlag, BuildingTime, AllowGaps,
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag,
+			hashFlag("from", "Hash of the first block"),
+			hashFlag("to", "Hash of the second block"),
 		},
-		// TODO: maybe support transaction and tx pool engine flags, since we use op-geth?
-		// TODO: reorg flag
-		// TODO: finalize/safe flag
-
 		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
-			settings := ParseBuildingArgs(ctx)
-			status, err := engine.Status(context.Background(), client)
+			result, err := engine.CheckAncestry(ctx.Context, client, hashFlagValue("from", ctx), hashFlagValue("to", ctx))
 			if err != nil {
 				return err
 			}
-			payload, err := engine.BuildBlock(context.Background(), client, status, settings)
-			if err != nil {
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
 				return err
 			}
-			_, err = io.WriteString(ctx.App.Writer, payload.BlockHash.String())
-			return err
-		}),
-	}
-	EngineAutoCmd = &cli.Command{
-		Name:        "auto",
-		Usage:       "Run a proof-of-nothing chain with fixed block time.",
-		Description: "The block time can be changed. The execution engine must be synced to a post-Merge state first.",
-		Flags: append(append([]cli.Flag{
-			EngineEndpoint, EngineJWTPath,
-			FeeRecipientFlag, RandaoFlag, BlockTimeFlag, BuildingTime, AllowGaps,
-		}, oplog.CLIFlags(envVarPrefix)...), opmetrics.CLIFlags(envVarPrefix)...),
-		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
-			logCfg := oplog.ReadCLIConfig(ctx)
-			if err := logCfg.Check(); err != nil {
-				return fmt.Errorf("failed to parse log configuration: %w", err)
+			if !result.Related {
+				return fmt.Errorf("blocks %s and %s are not on the same chain", result.From, result.To)
 			}
-			l := oplog.NewLogger(logCfg)
-
-			settings := ParseBuildingArgs(ctx)
-			// TODO: finalize/safe flag
-
-			metricsCfg := opmetrics.ReadCLIConfig(ctx)
-
-			return opservice.CloseAction(func(ctx context.Context, shutdown <-chan struct{}) error {
-				registry := opmetrics.NewRegistry()
-				metrics := engine.NewMetrics("wheel", registry)
-				if metricsCfg.Enabled {
-					l.Info("starting metrics server", "addr", metricsCfg.ListenAddr, "port", metricsCfg.ListenPort)
-					go func() {
-						if err := opmetrics.ListenAndServe(ctx, registry, metricsCfg.ListenAddr, metricsCfg.ListenPort); err != nil {
-							l.Error("error starting metrics server", err)
-						}
-					}()
-				}
-				return engine.Auto(ctx, metrics, client, l, shutdown, settings)
-			})
+			return nil
 		}),
 	}
-	EngineStatusCmd = &cli.Command{
-		Name:  "status",
-		Flags: []cli.Flag{EngineEndpoint, EngineJWTPath},
+	EngineFeesCmd = &cli.Command{
+		Name:  "fees",
+		Usage: "Report the base fee trajectory, priority fees and gas usage of the last blocks.",
+		Description: "Reads the last blocks up to the head, and prints the base fee and its change, the gas used ratio, " +
+			"and the priority fee percentiles of each block, with a summary of all blocks. " +
+			"Useful to tune the EIP-1559 parameters of a chain.",
+		Flags: []cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag,
+			&cli.Uint64Flag{
+				Name:    "last",
+				Usage:   "Number of blocks up to the head to report",
+				EnvVars: prefixEnvVars("LAST"),
+				Value:   20,
+			},
+		},
 		Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
-			stat, err := engine.Status(context.Background(), client)
+			report, err := engine.Fees(ctx.Context, client, ctx.Uint64("last"))
 			if err != nil {
 				return err
 			}
 			enc := json.NewEncoder(ctx.App.Writer)
 			enc.SetIndent("", "  ")
-			return enc.Encode(stat)
+			return enc.Encode(report)
 		}),
 	}
 	EngineCopyCmd = &cli.Command{
 		Name: "copy",
+		Description: "Without transforms, the source head block is inserted as-is, and the destination can sync the chain from there. " +
+			"With any of the transform flags, the transformed source head block is rebuilt on top of the destination head instead. " +
+			"With --from-block, all source blocks from that block up to the head are inserted, fetched ahead within the buffer bounds. " +
+			"With --dest.data-dir, the blocks are imported into the data dir of a stopped engine instead, like geth import does, " +
+			"from --from-block or the block after the data dir head, which is much faster for bulk imports and needs no engine. " +
+			"With --journal.dir, the last inserted block of a range copy is journaled, so an interrupted copy can continue after it with --resume. " +
+			"With --verify-manifest, the source must serve the chain ID and block range of the manifest, and the range copy starts at its first block.",
 		Flags: []cli.Flag{
-			EngineEndpoint, EngineJWTPath,
+			&cli.StringFlag{
+				Name:    EngineEndpoint.Name,
+				Usage:   EngineEndpoint.Usage + ". Required, unless --dest.data-dir is set.",
+				EnvVars: EngineEndpoint.EnvVars,
+			},
+			&cli.StringFlag{
+				Name:      EngineJWTPath.Name,
+				Usage:     EngineJWTPath.Usage + " Required, unless --dest.data-dir is set.",
+				TakesFile: true,
+				EnvVars:   EngineJWTPath.EnvVars,
+			},
+			ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag, PlanFlag, JournalDirFlag, ResumeFlag, VerifyManifestFlag,
 			&cli.StringFlag{
 				Name:     "source",
 				Usage:    "Unauthenticated regular eth JSON RPC to pull block data from, can be HTTP/WS/IPC.",
 				Required: true,
 				EnvVars:  prefixEnvVars("ENGINE"),
 			},
+			&cli.StringFlag{
+				Name:      "dest.data-dir",
+				Usage:     "Data dir of a stopped engine to import the blocks into, instead of inserting them into a running engine",
+				TakesFile: true,
+				EnvVars:   prefixEnvVars("DEST_DATA_DIR"),
+			},
+			&cli.BoolFlag{
+				Name:    "transform.drop-blob-txs",
+				Usage:   "Drop blob transactions from the copied block",
+				EnvVars: prefixEnvVars("TRANSFORM_DROP_BLOB_TXS"),
+			},
+			&cli.GenericFlag{
+				Name:    "transform.fee-recipient",
+				Usage:   "Rewrite the fee recipient of the copied block",
+				EnvVars: prefixEnvVars("TRANSFORM_FEE_RECIPIENT"),
+				Value:   &TextFlag[*common.Address]{Value: new(common.Address)},
+			},
+			&cli.Uint64Flag{
+				Name:    "transform.gas-limit",
+				Usage:   "Clamp the gas limit of the copied block, dropping transactions that exceed it. Disabled if 0.",
+				EnvVars: prefixEnvVars("TRANSFORM_GAS_LIMIT"),
+			},
+			&cli.Uint64Flag{
+				Name:    "from-block",
+				Usage:   "Copy all source blocks from this block number up to the source head, instead of only the head block. The destination must know the parent block. Disabled if 0.",
+				EnvVars: prefixEnvVars("FROM_BLOCK"),
+			},
+			&cli.IntFlag{
+				Name:    "max-buffered-blocks",
+				Usage:   "Maximum number of blocks to fetch ahead of the destination, when copying a range of blocks",
+				EnvVars: prefixEnvVars("MAX_BUFFERED_BLOCKS"),
+				Value:   16,
+			},
+			&cli.Uint64Flag{
+				Name:    "max-buffered-bytes",
+				Usage:   "Maximum total size of the blocks to fetch ahead of the destination, when copying a range of blocks",
+				EnvVars: prefixEnvVars("MAX_BUFFERED_BYTES"),
+				Value:   64 << 20,
+			},
 		},
-		Action: EngineAction(func(ctx *cli.Context, dest client.RPC) error {
-			rpcClient, err := rpc.DialOptions(context.Background(), ctx.String("source"))
+		Action: PlanAction(false, JournalAction(func(ctx *cli.Context, j *Journal) error {
+			source, err := dialRPC(ctx.Context, ctx.String("source"))
 			if err != nil {
 				return fmt.Errorf("failed to dial engine source endpoint: %w", err)
 			}
-			source := client.NewBaseRPCClient(rpcClient)
-			return engine.Copy(context.Background(), source, dest)
-		}),
+			expected, err := ParseChainExpectation(ctx)
+			if err != nil {
+				return err
+			}
+			if err := engine.CheckChain(ctx.Context, source, expected); err != nil {
+				return fmt.Errorf("engine source failed chain sanity check: %w", err)
+			}
+			var transforms []engine.BlockTransform
+			if ctx.Bool("transform.drop-blob-txs") {
+				transforms = append(transforms, engine.DropBlobTxs())
+			}
+			if ctx.IsSet("transform.fee-recipient") {
+				transforms = append(transforms, engine.RewriteFeeRecipient(addrFlagValue("transform.fee-recipient", ctx)))
+			}
+			if max := ctx.Uint64("transform.gas-limit"); max != 0 {
+				transforms = append(transforms, engine.ClampGasLimit(max))
+			}
+			fromBlock := ctx.Uint64("from-block")
+			if len(transforms) > 0 && (fromBlock != 0 || ctx.IsSet("dest.data-dir")) {
+				return errors.New("transforms are not supported when copying a range of blocks")
+			}
+			bufCfg := engine.CopyBufferConfig{
+				MaxBlocks: ctx.Int("max-buffered-blocks"),
+				MaxBytes:  ctx.Uint64("max-buffered-bytes"),
+			}
+			if path := ctx.String(VerifyManifestFlag.Name); path != "" {
+				m, err := ReadManifest(path)
+				if err != nil {
+					return err
+				}
+				if fromBlock, err = verifyCopyManifest(ctx.Context, source, m, fromBlock); err != nil {
+					return fmt.Errorf("source does not match manifest %s: %w", path, err)
+				}
+			}
+			if (fromBlock != 0 || ctx.IsSet("dest.data-dir")) && bufCfg.MaxBlocks < 1 {
+				return errors.New("at least 1 block must be buffered")
+			}
+			if fromBlock != 0 || ctx.IsSet("dest.data-dir") {
+				var last uint64
+				if ok, err := j.Restore("copy", &last); err != nil {
+					return err
+				} else if ok && last+1 > fromBlock {
+					log.Info("resuming copy after the last journaled block", "last", last)
+					fromBlock = last + 1
+				}
+			}
+			var stats engine.CopyStats
+			var copyErr error
+			if dataDir := ctx.String("dest.data-dir"); dataDir != "" {
+				copyErr = copyToDataDir(ctx.Context, source, dataDir, expected, fromBlock, bufCfg, &stats, j)
+			} else {
+				if !ctx.IsSet(EngineEndpoint.Name) || !ctx.IsSet(EngineJWTPath.Name) {
+					return errors.New("the destination engine and its JWT secret are required, unless --dest.data-dir is set")
+				}
+				copyErr = EngineAction(func(ctx *cli.Context, dest client.RPC) error {
+					if len(transforms) > 0 {
+						return engine.CopyTransformed(ctx.Context, source, dest, transforms, &stats)
+					} else if fromBlock != 0 {
+						destination, err := engine.NewEngineDestination(ctx.Context, dest)
+						if err != nil {
+							return err
+						}
+						return engine.CopyRangeTo(ctx.Context, source, &journaledDestination{destination, j}, fromBlock, bufCfg, &stats)
+					}
+					return engine.Copy(ctx.Context, source, dest, &stats)
+				})(ctx)
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(stats.Report()); err != nil {
+				return fmt.Errorf("failed to write copy report: %w", err)
+			}
+			return copyErr
+		})),
 	}
 )
 
+// journaledDestination journals the last block that is inserted into the destination of a range copy,
+// so the copy can be resumed after it.
+type journaledDestination struct {
+	engine.CopyDestination
+	j *Journal
+}
+
+func (d *journaledDestination) InsertBlocks(ctx context.Context, blocks []*types.Block) error {
+	if err := d.CopyDestination.InsertBlocks(ctx, blocks); err != nil {
+		return err
+	}
+	return d.j.Checkpoint("copy", blocks[len(blocks)-1].NumberU64())
+}
+
+// verifyCopyManifest checks that the copy source serves the chain ID and the block range of the manifest,
+// and returns the first block to copy: the first block of the manifest, unless another first block is set.
+func verifyCopyManifest(ctx context.Context, source client.RPC, m *Manifest, from uint64) (uint64, error) {
+	if m.ChainID != nil {
+		var chainID hexutil.Big
+		if err := source.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+			return 0, fmt.Errorf("failed to get chain ID: %w", err)
+		}
+		if chainID.ToInt().Cmp(m.ChainID.ToInt()) != 0 {
+			return 0, fmt.Errorf("chain ID %d differs from %d", chainID.ToInt(), m.ChainID.ToInt())
+		}
+	}
+	if m.FromBlock != nil {
+		if from != 0 && from != uint64(*m.FromBlock) {
+			return 0, fmt.Errorf("first block %d differs from %d", from, uint64(*m.FromBlock))
+		}
+		from = uint64(*m.FromBlock)
+	}
+	if m.ToBlock != nil {
+		var head struct {
+			Number hexutil.Uint64 `json:"number"`
+		}
+		if err := source.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+			return 0, fmt.Errorf("failed to get head block: %w", err)
+		}
+		if head.Number < *m.ToBlock {
+			return 0, fmt.Errorf("head block %d is before the last block %d", uint64(head.Number), uint64(*m.ToBlock))
+		}
+	}
+	return from, nil
+}
+
+// copyToDataDir imports the source blocks from the given block, or the block after the head of the data dir if 0,
+// into the data dir of a stopped engine. The imported blocks are journaled to the given journal.
+func copyToDataDir(ctx context.Context, source client.RPC, dataDir string, expected *engine.ChainExpectation,
+	from uint64, bufCfg engine.CopyBufferConfig, stats *engine.CopyStats, j *Journal) error {
+	ch, err := cheat.OpenGethDB(dataDir, false)
+	if err != nil {
+		return fmt.Errorf("failed to open geth db: %w", err)
+	}
+	importer := cheat.NewChainImporter(ch)
+	defer importer.Close()
+	if id := ch.Blockchain.Config().ChainID; expected.ChainID != nil && (id == nil || id.Cmp(expected.ChainID) != 0) {
+		return fmt.Errorf("data dir has chain ID %v, expected %v", id, expected.ChainID)
+	}
+	if g := ch.Blockchain.Genesis(); expected.Genesis != nil && (g.Hash() != expected.Genesis.Hash || g.NumberU64() != expected.Genesis.Number) {
+		return fmt.Errorf("data dir has genesis %s:%d, expected %s", g.Hash(), g.NumberU64(), expected.Genesis)
+	}
+	if from == 0 {
+		from = importer.Head().Number.Uint64() + 1
+	}
+	return engine.CopyRangeTo(ctx, source, &journaledDestination{importer, j}, from, bufCfg, stats)
+}
+
+var EngineBackfillCmd = &cli.Command{
+	Name:  "backfill",
+	Usage: "Insert historical block bodies and receipts from a source node into the data dir of a stopped engine.",
+	Description: "For engines that only snap-synced recent state, e.g. replicas built from copies, to serve historical blocks and receipts. " +
+		"The data is fetched with debug_getRawBlock and debug_getRawReceipts, and verified against the local headers. " +
+		"The engine must be stopped: geth has no API to insert historical bodies into a running node. " +
+		"With --journal.dir, the last backfilled block of each data dir is journaled, so an interrupted backfill can continue after it with --resume.",
+	Flags: []cli.Flag{
+		DataDirFlag, PlanFlag, JournalDirFlag, ResumeFlag,
+		&cli.StringFlag{
+			Name:     "source",
+			Usage:    "RPC of the node to fetch historical block data from, with the debug namespace enabled. Can be HTTP/WS/IPC.",
+			Required: true,
+			EnvVars:  prefixEnvVars("SOURCE"),
+		},
+		&cli.Uint64Flag{
+			Name:     "from",
+			Usage:    "First block to backfill",
+			Required: true,
+			EnvVars:  prefixEnvVars("FROM"),
+		},
+		&cli.Uint64Flag{
+			Name:     "to",
+			Usage:    "Last block to backfill",
+			Required: true,
+			EnvVars:  prefixEnvVars("TO"),
+		},
+	},
+	Action: PlanAction(false, JournalAction(func(ctx *cli.Context, j *Journal) error {
+		source, err := dialRPC(ctx.Context, ctx.String("source"))
+		if err != nil {
+			return fmt.Errorf("failed to dial source RPC: %w", err)
+		}
+		defer source.Close()
+		return forEachDataDir(ctx, func(dataDir string) error {
+			step := dataDirStep("backfill", dataDir)
+			from := ctx.Uint64("from")
+			var last uint64
+			if ok, err := j.Restore(step, &last); err != nil {
+				return err
+			} else if ok && last+1 > from {
+				log.Info("resuming backfill after the last journaled block", "data_dir", dataDir, "last", last)
+				from = last + 1
+			}
+			if from > ctx.Uint64("to") {
+				return nil
+			}
+			db, err := cheat.OpenGethRawDB(dataDir, false)
+			if err != nil {
+				return fmt.Errorf("failed to open raw geth db: %w", err)
+			}
+			defer db.Close()
+			report, err := cheat.Backfill(ctx.Context, db, source, from, ctx.Uint64("to"), func(n uint64) error {
+				return j.Checkpoint(step, n)
+			})
+			if report != nil {
+				enc := json.NewEncoder(ctx.App.Writer)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return fmt.Errorf("failed to write backfill report: %w", err)
+				}
+			}
+			return err
+		})
+	})),
+}
+
+var InitCmd = &cli.Command{
+	Name:  "init",
+	Usage: "Bootstrap an op-geth environment: genesis, Engine API JWT secret and initialized data dir.",
+	Description: "Renders the genesis template with the template values, and initializes a data dir with it, " +
+		"so a devnet can be started with op-geth and driven with 'engine auto'. " +
+		"The default template has the variables ChainID, Timestamp, GasLimit, Prefund and PrefundEther.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:      "out-dir",
+			Usage:     "Directory to create the environment in",
+			Required:  true,
+			TakesFile: true,
+			EnvVars:   prefixEnvVars("OUT_DIR"),
+		},
+		&cli.StringFlag{
+			Name:      "genesis-template",
+			Usage:     "Path to a genesis.json Go template to use instead of the default template",
+			TakesFile: true,
+			EnvVars:   prefixEnvVars("GENESIS_TEMPLATE"),
+		},
+		TemplateValuesFlag, TemplateSetFlag, ManifestFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		values, err := cheat.ReadTemplateValues(ctx.String(TemplateValuesFlag.Name), ctx.StringSlice(TemplateSetFlag.Name))
+		if err != nil {
+			return err
+		}
+		for k, v := range cheat.DefaultGenesisValues() {
+			if _, ok := values[k]; !ok {
+				values[k] = v
+			}
+		}
+		var tmpl io.Reader
+		if path := ctx.String("genesis-template"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to open genesis template: %w", err)
+			}
+			defer f.Close()
+			tmpl = f
+		}
+		env, err := cheat.InitEnv(ctx.String("out-dir"), tmpl, values)
+		if err != nil {
+			return err
+		}
+		genesisBlock := uint64(0)
+		if err := WriteManifest(ctx, env.ChainID, &genesisBlock, &genesisBlock, env.Genesis); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(env)
+	},
+}
+
+var ExplorerCmd = &cli.Command{
+	Name:  "explorer",
+	Usage: "Serve a minimal block explorer web UI for devnets, backed by the engine RPC.",
+	Description: "Shows the latest blocks, blocks, transactions and accounts, with storage slot lookups. " +
+		"With a data dir of a stopped copy of the node, all storage of accounts is listed as well.",
+	Flags: []cli.Flag{
+		EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag,
+		&cli.StringFlag{
+			Name:    "listen",
+			Usage:   "Address to serve the explorer on",
+			EnvVars: prefixEnvVars("LISTEN"),
+			Value:   ":8080",
+		},
+		&cli.StringFlag{
+			Name:      DataDirFlag.Name,
+			Usage:     "Geth data dir location, to list all storage of accounts. Must not be in use by a running node. Optional.",
+			TakesFile: true,
+			EnvVars:   DataDirFlag.EnvVars,
+		},
+	},
+	Action: EngineAction(func(ctx *cli.Context, client client.RPC) error {
+		var storage engine.StorageLister
+		if dataDir := ctx.String(DataDirFlag.Name); dataDir != "" {
+			var mu sync.Mutex // the database can only be opened once at a time
+			storage = func(reqCtx context.Context, addr common.Address, w io.Writer) error {
+				mu.Lock()
+				defer mu.Unlock()
+				ch, err := cheat.OpenGethDB(dataDir, true)
+				if err != nil {
+					return fmt.Errorf("failed to open geth db: %w", err)
+				}
+				return ch.RunAndClose(reqCtx, cheat.StorageReadAll(addr, w, nil))
+			}
+		}
+		srv := &http.Server{Addr: ctx.String("listen"), Handler: engine.NewExplorer(client, storage)}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- srv.ListenAndServe()
+		}()
+		log.Info("serving explorer", "addr", srv.Addr)
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("failed to serve explorer: %w", err)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		}
+	}),
+}
+
+var MockEngineCmd = &cli.Command{
+	Name:  "mock-engine",
+	Usage: "Serve an in-memory mock of the Engine API, to test Engine API tools without a real engine.",
+	Description: "Implements engine_forkchoiceUpdatedV2, engine_getPayloadV2 and engine_newPayloadV2, " +
+		"and the eth methods to read the chain, without authentication. " +
+		"Blocks are built with the given transactions, but the transactions are not executed.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "listen",
+			Usage:   "Address to serve the mock engine on",
+			EnvVars: prefixEnvVars("LISTEN"),
+			Value:   ":8551",
+		},
+		&cli.Uint64Flag{
+			Name:    "chain-id",
+			Usage:   "Chain ID to report",
+			EnvVars: prefixEnvVars("CHAIN_ID"),
+			Value:   901,
+		},
+		&cli.DurationFlag{
+			Name:    "delay",
+			Usage:   "Time every Engine API call takes before it responds",
+			EnvVars: prefixEnvVars("DELAY"),
+		},
+		&cli.Uint64Flag{
+			Name:    "invalid-every",
+			Usage:   "Respond INVALID to every n-th new payload. Disabled if 0.",
+			EnvVars: prefixEnvVars("INVALID_EVERY"),
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		mock := engine.NewMockEngine(engine.MockEngineConfig{
+			ChainID:      new(big.Int).SetUint64(ctx.Uint64("chain-id")),
+			Delay:        ctx.Duration("delay"),
+			InvalidEvery: ctx.Uint64("invalid-every"),
+		})
+		rpcSrv, err := mock.Server()
+		if err != nil {
+			return err
+		}
+		defer rpcSrv.Stop()
+		srv := &http.Server{Addr: ctx.String("listen"), Handler: rpcSrv}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- srv.ListenAndServe()
+		}()
+		log.Info("serving mock engine", "addr", srv.Addr, "genesis", mock.Head().Hash())
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("failed to serve mock engine: %w", err)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		}
+	},
+}
+
+var DrillSequencerFailoverCmd = &cli.Command{
+	Name:  "sequencer-failover",
+	Usage: "Drill a sequencer failover between two engines, and report the timings of each step.",
+	Description: "Stops production on the first engine (after the optional warmup blocks), verifies that its head is stable, " +
+		"hands the chain over to the second engine, and continues production on it from the head of the first engine. " +
+		"Outputs a JSON report, and fails if any step fails. The engines share the JWT secret.",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:     "engines",
+			Usage:    "Engine API RPC endpoints of the active and the standby sequencer, comma-separated: a,b",
+			Required: true,
+			EnvVars:  prefixEnvVars("ENGINES"),
+		},
+		EngineJWTPath, FeeRecipientFlag, RandaoFlag, BlockTimeFlag, BuildingTime, AllowGaps,
+		&cli.Uint64Flag{
+			Name:    "warmup-blocks",
+			Usage:   "Number of blocks to build on the active engine before the failover, to simulate its sequencer",
+			EnvVars: prefixEnvVars("WARMUP_BLOCKS"),
+		},
+		&cli.DurationFlag{
+			Name:    "stability-window",
+			Usage:   "How long the head of the active engine must remain unchanged once production stopped",
+			EnvVars: prefixEnvVars("STABILITY_WINDOW"),
+			Value:   6 * time.Second,
+		},
+		&cli.Uint64Flag{
+			Name:    "blocks",
+			Usage:   "Number of blocks to build on the standby engine after the failover",
+			EnvVars: prefixEnvVars("BLOCKS"),
+			Value:   3,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		endpoints := ctx.StringSlice("engines")
+		if len(endpoints) != 2 {
+			return fmt.Errorf("expected 2 engines, got %d", len(endpoints))
+		}
+		secret, err := readJWTSecret(ctx.String(EngineJWTPath.Name))
+		if err != nil {
+			return err
+		}
+		var clients []client.RPC
+		for _, endpoint := range endpoints {
+			cl, err := engine.DialClient(ctx.Context, endpoint, secret)
+			if err != nil {
+				return fmt.Errorf("failed to dial Engine API endpoint %q: %w", endpoint, err)
+			}
+			defer cl.Close()
+			clients = append(clients, cl)
+		}
+		report, err := engine.SequencerFailoverDrill(ctx.Context, log.Root(), clients[0], clients[1], &engine.FailoverDrillConfig{
+			Settings:        ParseBuildingArgs(ctx),
+			WarmupBlocks:    ctx.Uint64("warmup-blocks"),
+			StabilityWindow: ctx.Duration("stability-window"),
+			PollInterval:    500 * time.Millisecond,
+			Blocks:          ctx.Uint64("blocks"),
+		})
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			return encErr
+		}
+		return err
+	},
+}
+
+var DrillCmd = &cli.Command{
+	Name:  "drill",
+	Usage: "Scripted operational drills, to rehearse runbooks reproducibly.",
+	Subcommands: []*cli.Command{
+		DrillSequencerFailoverCmd,
+	},
+}
+
 var CheatCmd = &cli.Command{
 	Name:  "cheat",
 	Usage: "Cheating commands to modify a Geth database.",
@@ -463,10 +4245,38 @@ var CheatCmd = &cli.Command{
 		"The Geth node will live in its own false reality, other nodes cannot sync the cheated state if they process the blocks.",
 	Subcommands: []*cli.Command{
 		CheatStorageCmd,
+		CheatSlotCmd,
 		CheatSetBalanceCmd,
-		CheatSetCodeCmd,
-		CheatSetNonceCmd,
+		CheatCodeCmd,
+		CheatCodeCompareCmd,
+		CheatNonceCmd,
+		CheatAccountCmd,
+		CheatStateCmd,
+		CheatERC20Cmd,
+		CheatProxyCmd,
+		CheatApplyCmd,
+		CheatWatchCmd,
+		CheatSnapshotCmd,
+		CheatSetHeadCmd,
 		CheatOvmOwnersCmd,
+		CheatPreimagesCmd,
+		CheatGenAccessListCmd,
+		CheatLogsCmd,
+		CheatBlockCmd,
+		CheatHeaderCmd,
+		CheatCompactDBCmd,
+		CheatTrimHistoryCmd,
+		CheatDanglingStorageCmd,
+		CheatVerifyCmd,
+		CheatChainStatsCmd,
+		CheatVerifyPredeploysCmd,
+		CheatPredeployConfigCmd,
+		CheatPredeploysCmd,
+		CheatRemoteDiffCmd,
+		CheatForkCmd,
+		CheatCompareDirsCmd,
+		CheatMigrateStateCmd,
+		CheatSelftestCmd,
 		CheatPrintHeadBlock,
 		CheatPrintHeadHeader,
 	},
@@ -481,5 +4291,86 @@ var EngineCmd = &cli.Command{
 		EngineAutoCmd,
 		EngineStatusCmd,
 		EngineCopyCmd,
+		EngineBenchCmd,
+		EngineSpamBlocksCmd,
+		EngineResetToFinalizedCmd,
+		EngineBackfillCmd,
+		EngineAncestryCmd,
+		EngineFeesCmd,
+		EngineProxyCmd,
+		EngineSubscribeReorgsCmd,
+		EngineReplayAttributesCmd,
+	},
+}
+
+// withDeadlineOf applies the deadline of the command context, i.e. the global timeout, to a context of its own,
+// for actions that handle interrupts themselves, and must not be canceled by them right away.
+func withDeadlineOf(ctx context.Context, cmdCtx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := cmdCtx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+// NodeAction dials the op-node rollup RPC, and the engine that it drives.
+func NodeAction(fn func(ctx *cli.Context, engineClient client.RPC, nodeClient client.RPC) error) cli.ActionFunc {
+	return EngineAction(func(ctx *cli.Context, engineClient client.RPC) error {
+		nodeClient, err := dialRPC(ctx.Context, ctx.String(RollupRPCFlag.Name))
+		if err != nil {
+			return fmt.Errorf("failed to dial rollup RPC: %w", err)
+		}
+		defer nodeClient.Close()
+		return fn(ctx, engineClient, nodeClient)
+	})
+}
+
+var (
+	NodeStatusCmd = &cli.Command{
+		Name:        "status",
+		Usage:       "Compare the engine forkchoice state with the op-node sync status.",
+		Description: "Outputs both states as JSON, with a summary, and the inconsistencies between the two.",
+		Flags:       []cli.Flag{EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag, RollupRPCFlag},
+		Action: NodeAction(func(ctx *cli.Context, engineClient client.RPC, nodeClient client.RPC) error {
+			diag, err := engine.DiagnoseNode(ctx.Context, engineClient, nodeClient)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(diag)
+		}),
+	}
+	NodeOutputCmd = &cli.Command{
+		Name:        "output",
+		Usage:       "Get the op-node output at a block, and check it against the engine block.",
+		Description: "Outputs the op-node output as JSON, with the inconsistencies with the engine block, if any.",
+		Flags: []cli.Flag{
+			EngineEndpoint, EngineJWTPath, ExpectChainIDFlag, RollupConfigFlag, ForensicsDirFlag, RollupRPCFlag,
+			&cli.Uint64Flag{
+				Name:     "block",
+				Usage:    "L2 block number to get the output of",
+				EnvVars:  prefixEnvVars("BLOCK"),
+				Required: true,
+			},
+		},
+		Action: NodeAction(func(ctx *cli.Context, engineClient client.RPC, nodeClient client.RPC) error {
+			out, err := engine.CheckNodeOutput(ctx.Context, engineClient, nodeClient, ctx.Uint64("block"))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		}),
+	}
+)
+
+var NodeCmd = &cli.Command{
+	Name:        "node",
+	Usage:       "op-node rollup RPC commands, correlated with the engine the op-node drives.",
+	Description: "Each sub-command dials the op-node rollup RPC and the engine API endpoint, and then runs the action",
+	Subcommands: []*cli.Command{
+		NodeStatusCmd,
+		NodeOutputCmd,
 	},
 }
@@ -0,0 +1,140 @@
+package wheel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum-optimism/optimism/op-wheel/cheat"
+)
+
+func TestForEachDataDirInput(t *testing.T) {
+	inputs := make(map[string]string)
+	var out bytes.Buffer
+	app := &cli.App{
+		Name:   "op-wheel",
+		Reader: strings.NewReader("0x6000\n"),
+		Writer: &out,
+		Commands: []*cli.Command{{
+			Name:  "cheat",
+			Flags: []cli.Flag{DataDirFlag},
+			Action: func(ctx *cli.Context) error {
+				return forEachDataDir(ctx, func(dataDir string) error {
+					data, err := io.ReadAll(ctx.App.Reader)
+					if err != nil {
+						return err
+					}
+					inputs[dataDir] = string(data)
+					if dataDir == "b" {
+						return errors.New("b failed")
+					}
+					return nil
+				})
+			},
+		}},
+	}
+	err := app.Run([]string{"op-wheel", "cheat", "--data-dir", "a", "--data-dir", "b", "--data-dir", "c"})
+	require.ErrorContains(t, err, "cheat failed on 1 of 3 data dirs: b")
+	// every data dir gets all of the input, not only the first
+	require.Equal(t, map[string]string{"a": "0x6000\n", "b": "0x6000\n", "c": "0x6000\n"}, inputs)
+
+	var results []DataDirResult
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var result DataDirResult
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		results = append(results, result)
+	}
+	require.Equal(t, []DataDirResult{{DataDir: "a"}, {DataDir: "b", Err: "b failed"}, {DataDir: "c"}}, results)
+}
+
+func TestStorageReadAllNextKey(t *testing.T) {
+	addr := common.Address{0: 0xa}
+	headState, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	headState.SetNonce(addr, 1)
+	for i := byte(1); i <= 3; i++ {
+		headState.SetState(addr, common.Hash{31: i}, common.Hash{31: i})
+	}
+	root, err := headState.Commit(true)
+	require.NoError(t, err)
+	headState, err = state.New(root, headState.Database(), nil)
+	require.NoError(t, err)
+
+	var page bytes.Buffer
+	require.NoError(t, cheat.StorageReadRange(addr, common.Hash{}, 2, "patch", &page, nil)(context.Background(), headState))
+	lines := strings.Split(strings.TrimSpace(page.String()), "\n")
+	require.Len(t, lines, 3)
+	cursor := strings.TrimPrefix(lines[2], "# next ")
+	// the cursor is passed to --start-key as is
+	start := &TextFlag[*common.Hash]{Value: new(common.Hash)}
+	require.NoError(t, start.Set(cursor))
+
+	page.Reset()
+	require.NoError(t, cheat.StorageReadRange(addr, *start.Value, 0, "patch", &page, nil)(context.Background(), headState))
+	require.Equal(t, fmt.Sprintf("+ %x = %x\n", start.Value[:], common.Hash{31: 3}), page.String())
+}
+
+func TestStreamLogger(t *testing.T) {
+	defer log.Root().SetHandler(log.Root().GetHandler())
+	var errOut bytes.Buffer
+	cfg := oplog.DefaultCLIConfig()
+	cfg.Format = "logfmt"
+	l := newStreamLogger(cfg, &errOut)
+	l.Info("built block", "number", 1)
+	log.Info("root logs too")
+	require.Contains(t, errOut.String(), "built block")
+	require.Contains(t, errOut.String(), "root logs too")
+}
+
+func TestWithDefaultSubcommand(t *testing.T) {
+	var set common.Address
+	sub := &cli.Command{
+		Name:  "set",
+		Flags: []cli.Flag{OptDataDirFlag, addrFlag("address", "Address to change")},
+		Action: func(ctx *cli.Context) error {
+			set = addrFlagValue("address", ctx)
+			return nil
+		},
+	}
+	other := false
+	group := withDefaultSubcommand(&cli.Command{
+		Name: "nonce",
+		Subcommands: []*cli.Command{sub, {
+			Name:   "other",
+			Action: func(ctx *cli.Context) error { other = true; return nil },
+		}},
+	}, sub)
+	run := func(args ...string) error {
+		app := &cli.App{Name: "op-wheel", Writer: io.Discard, Commands: []*cli.Command{group}}
+		return app.Run(append([]string{"op-wheel", "nonce"}, args...))
+	}
+	addr := common.Address{0: 0xa}
+
+	// the invocation from before the group existed runs the default subcommand
+	require.NoError(t, run("--address", addr.Hex()))
+	require.Equal(t, addr, set)
+	set = common.Address{}
+	require.NoError(t, run("set", "--address", addr.Hex()))
+	require.Equal(t, addr, set)
+	// the required flags of the default subcommand do not get in the way of the other subcommands
+	require.NoError(t, run("other"))
+	require.True(t, other)
+	require.ErrorContains(t, run("set"), `Required flag "address" not set`)
+	require.ErrorContains(t, run(), `required flag "address" not set`)
+}
@@ -0,0 +1,154 @@
+package wheel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+)
+
+// CommandSchema describes a command, its flags and its sub-commands, for tools that wrap op-wheel.
+type CommandSchema struct {
+	Name        string           `json:"name"`
+	Aliases     []string         `json:"aliases,omitempty"`
+	Usage       string           `json:"usage,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Flags       []*FlagSchema    `json:"flags,omitempty"`
+	Subcommands []*CommandSchema `json:"subcommands,omitempty"`
+}
+
+// FlagSchema describes a flag. Type is one of: bool, string, string-list, uint64, int, duration,
+// address, address-list, hash, bytes, big or generic.
+type FlagSchema struct {
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Type      string   `json:"type"`
+	Usage     string   `json:"usage,omitempty"`
+	EnvVars   []string `json:"envVars,omitempty"`
+	Required  bool     `json:"required"`
+	Default   string   `json:"default,omitempty"`
+	TakesFile bool     `json:"takesFile,omitempty"`
+}
+
+// DescribeApp describes the full command tree of the app.
+func DescribeApp(app *cli.App) *CommandSchema {
+	return &CommandSchema{
+		Name:        app.Name,
+		Usage:       app.Usage,
+		Description: app.Description,
+		Flags:       describeFlags(app.Flags),
+		Subcommands: describeCommands(app.Commands),
+	}
+}
+
+func describeCommands(cmds []*cli.Command) []*CommandSchema {
+	out := make([]*CommandSchema, 0, len(cmds))
+	for _, cmd := range cmds {
+		if cmd.Hidden {
+			continue
+		}
+		out = append(out, &CommandSchema{
+			Name:        cmd.Name,
+			Aliases:     cmd.Aliases,
+			Usage:       cmd.Usage,
+			Description: cmd.Description,
+			Flags:       describeFlags(cmd.Flags),
+			Subcommands: describeCommands(cmd.Subcommands),
+		})
+	}
+	return out
+}
+
+func describeFlags(flags []cli.Flag) []*FlagSchema {
+	out := make([]*FlagSchema, 0, len(flags))
+	for _, f := range flags {
+		names := f.Names()
+		schema := &FlagSchema{Name: names[0], Aliases: names[1:], Type: flagType(f)}
+		if df, ok := f.(cli.DocGenerationFlag); ok {
+			schema.Usage = df.GetUsage()
+			schema.EnvVars = df.GetEnvVars()
+			if df.TakesValue() {
+				schema.Default = df.GetValue()
+			}
+		}
+		if rf, ok := f.(cli.RequiredFlag); ok {
+			schema.Required = rf.IsRequired()
+		}
+		if sf, ok := f.(*cli.StringFlag); ok {
+			schema.TakesFile = sf.TakesFile
+		}
+		out = append(out, schema)
+	}
+	return out
+}
+
+func flagType(f cli.Flag) string {
+	switch f := f.(type) {
+	case *cli.BoolFlag:
+		return "bool"
+	case *cli.StringFlag:
+		return "string"
+	case *cli.StringSliceFlag:
+		return "string-list"
+	case *cli.Uint64Flag:
+		return "uint64"
+	case *cli.IntFlag:
+		return "int"
+	case *cli.DurationFlag:
+		return "duration"
+	case *cli.GenericFlag:
+		switch f.Value.(type) {
+		case *TextFlag[*common.Address]:
+			return "address"
+		case *TextFlag[*AddressList]:
+			return "address-list"
+		case *TextFlag[*common.Hash]:
+			return "hash"
+		case *TextFlag[*hexutil.Bytes]:
+			return "bytes"
+		case *TextFlag[*big.Int]:
+			return "big"
+		}
+	}
+	return "generic"
+}
+
+// writeCommandTree writes the command tree as indented text, one command per line.
+func writeCommandTree(w io.Writer, cmds []*CommandSchema, depth int) error {
+	for _, cmd := range cmds {
+		if _, err := fmt.Fprintf(w, "%s%s\t%s\n", strings.Repeat("  ", depth), cmd.Name, cmd.Usage); err != nil {
+			return err
+		}
+		if err := writeCommandTree(w, cmd.Subcommands, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var DescribeCmd = &cli.Command{
+	Name:  "describe",
+	Usage: "Describe the command tree, with the flags of every command",
+	Description: "With --json, the full command and flag tree is written as JSON, including flag types, defaults and env vars, " +
+		"for wrappers and UIs to generate forms, validation and shell completion from.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Write the command tree as JSON",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		schema := DescribeApp(ctx.App)
+		if !ctx.Bool("json") {
+			return writeCommandTree(ctx.App.Writer, schema.Subcommands, 0)
+		}
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	},
+}
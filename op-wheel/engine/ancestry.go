@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// AncestryResult is the outcome of an ancestry check between two blocks.
+type AncestryResult struct {
+	From eth.L1BlockRef `json:"from"`
+	To   eth.L1BlockRef `json:"to"`
+	// Related is true if either block is an ancestor of the other, or they are the same block.
+	Related bool `json:"related"`
+	// Ancestor is the hash of the ancestor block, if the blocks are related.
+	Ancestor *common.Hash `json:"ancestor,omitempty"`
+	// PathLength is the number of parent hashes between the blocks, if they are related.
+	PathLength uint64 `json:"pathLength"`
+	// Divergence is the block at the height of the lower block on the chain of the higher block,
+	// if the blocks are not related.
+	Divergence *eth.L1BlockRef `json:"divergence,omitempty"`
+}
+
+func headerRef(ctx context.Context, client client.RPC, hash common.Hash) (eth.L1BlockRef, error) {
+	header, err := getHeader(ctx, client, "eth_getBlockByHash", hash.Hex())
+	if err != nil {
+		return eth.L1BlockRef{}, fmt.Errorf("failed to get block %s: %w", hash, err)
+	}
+	if header == nil {
+		return eth.L1BlockRef{}, fmt.Errorf("block %s not found", hash)
+	}
+	return eth.L1BlockRef{Hash: header.Hash(), Number: header.Number.Uint64(), Time: header.Time, ParentHash: header.ParentHash}, nil
+}
+
+// CheckAncestry walks the parent hashes of the higher of the two blocks, down to the height of the lower block,
+// to confirm or refute that one block is an ancestor of the other.
+func CheckAncestry(ctx context.Context, client client.RPC, from, to common.Hash) (*AncestryResult, error) {
+	fromRef, err := headerRef(ctx, client, from)
+	if err != nil {
+		return nil, err
+	}
+	toRef, err := headerRef(ctx, client, to)
+	if err != nil {
+		return nil, err
+	}
+	result := &AncestryResult{From: fromRef, To: toRef}
+	low, high := fromRef, toRef
+	if low.Number > high.Number {
+		low, high = high, low
+	}
+	ref := high
+	for ref.Number > low.Number {
+		ref, err = headerRef(ctx, client, ref.ParentHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk back from block %d: %w", high.Number, err)
+		}
+	}
+	if ref.Hash != low.Hash {
+		result.Divergence = &ref
+		return result, nil
+	}
+	result.Related = true
+	result.Ancestor = &low.Hash
+	result.PathLength = high.Number - low.Number
+	return result, nil
+}
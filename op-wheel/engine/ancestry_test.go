@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+func TestCheckAncestry(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	genesis := mock.Head().Hash()
+
+	var chain []*engine.ExecutableData
+	for i := 0; i < 3; i++ {
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		payload, err := BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2})
+		require.NoError(t, err)
+		chain = append(chain, payload)
+	}
+	result, err := CheckAncestry(ctx, cl, chain[2].BlockHash, genesis)
+	require.NoError(t, err)
+	require.True(t, result.Related)
+	require.Equal(t, genesis, *result.Ancestor)
+	require.Equal(t, uint64(3), result.PathLength)
+
+	// fork off the first block, with a different timestamp than the canonical second block
+	status, err := Status(ctx, cl)
+	require.NoError(t, err)
+	status.Head = eth.L1BlockRef{Hash: chain[0].BlockHash, Number: chain[0].Number, Time: chain[0].Timestamp}
+	fork, err := BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 3})
+	require.NoError(t, err)
+
+	result, err = CheckAncestry(ctx, cl, chain[2].BlockHash, fork.BlockHash)
+	require.NoError(t, err)
+	require.False(t, result.Related)
+	require.Equal(t, chain[1].BlockHash, result.Divergence.Hash)
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// attributesLogStart is the start of payload attributes that op-node logs with %+v formatting,
+// e.g. in its "Adding next safe attributes" debug log line.
+const attributesLogStart = "&{Timestamp:"
+
+// LoggedAttributes are payload attributes that were parsed from an op-node log line.
+type LoggedAttributes struct {
+	// Line is the line number in the log, for error messages.
+	Line int `json:"line"`
+	// Parent is the number of the block that the attributes build on, from the safe_head of the log line, if logged.
+	Parent     *uint64             `json:"parent,omitempty"`
+	Attributes PayloadAttributesV2 `json:"attributes"`
+}
+
+// ParseAttributesLogs parses the payload attributes of op-node debug logs, in the terminal, logfmt or JSON log format.
+// Lines without payload attributes are skipped.
+func ParseAttributesLogs(r io.Reader) ([]LoggedAttributes, error) {
+	s := bufio.NewScanner(r)
+	// lines with many forced transactions are long
+	s.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	var out []LoggedAttributes
+	for i := 1; s.Scan(); i++ {
+		attrsText, safeHead, err := attributesLogFields(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+		if attrsText == "" {
+			continue
+		}
+		attrs, err := parseLoggedAttributes(attrsText)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+		entry := LoggedAttributes{Line: i, Attributes: *attrs}
+		if parent, ok := loggedBlockNumber(safeHead); ok {
+			entry.Parent = &parent
+		}
+		out = append(out, entry)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read logs: %w", err)
+	}
+	return out, nil
+}
+
+// parseLoggedAttributes parses the fields of payload attributes formatted with %+v,
+// e.g. Timestamp:0x64 PrevRandao:0x.. SuggestedFeeRecipient:0x.. Transactions:[0x.. 0x..] NoTxPool:false GasLimit:0x1c9c380
+func parseLoggedAttributes(fields string) (*PayloadAttributesV2, error) {
+	var attrs PayloadAttributesV2
+	for fields != "" {
+		key, rest, ok := strings.Cut(fields, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed payload attributes field %q", fields)
+		}
+		var value string
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("payload attributes field %s is not terminated", key)
+			}
+			value, fields = rest[:end+1], strings.TrimPrefix(rest[end+1:], " ")
+		} else {
+			value, fields, _ = strings.Cut(rest, " ")
+		}
+		var err error
+		switch key {
+		case "Timestamp":
+			var ok bool
+			if attrs.Timestamp, ok = math.ParseUint64(value); !ok {
+				err = fmt.Errorf("invalid number %q", value)
+			}
+		case "PrevRandao":
+			err = attrs.Random.UnmarshalText([]byte(value))
+		case "SuggestedFeeRecipient":
+			err = attrs.SuggestedFeeRecipient.UnmarshalText([]byte(value))
+		case "Transactions":
+			for _, tx := range strings.Fields(strings.Trim(value, "[]")) {
+				var data hexutil.Bytes
+				if err = data.UnmarshalText([]byte(tx)); err != nil {
+					break
+				}
+				attrs.Transactions = append(attrs.Transactions, data)
+			}
+		case "NoTxPool":
+			attrs.NoTxPool, err = strconv.ParseBool(value)
+		case "GasLimit":
+			if value != "<nil>" {
+				gasLimit, ok := math.ParseUint64(value)
+				if !ok {
+					err = fmt.Errorf("invalid number %q", value)
+				}
+				attrs.GasLimit = &gasLimit
+			}
+		default:
+			// fields of later versions of the attributes, that the engine API version of op-wheel does not support
+			log.Debug("ignoring unknown payload attributes field", "field", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload attributes field %s: %w", key, err)
+		}
+	}
+	if attrs.Timestamp == 0 {
+		return nil, fmt.Errorf("payload attributes have no timestamp")
+	}
+	return &attrs, nil
+}
+
+// attributesLogFields finds the payload attributes, without the surrounding &{ and }, and the safe_head of a log line.
+// The attributes are empty if the line has none.
+func attributesLogFields(line string) (attrs string, safeHead string, err error) {
+	if strings.HasPrefix(line, "{") {
+		// the JSON log format escapes the attributes, the fields are decoded instead of searched for
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return "", "", nil
+		}
+		for _, v := range fields {
+			if text, ok := v.(string); ok && strings.HasPrefix(text, attributesLogStart) {
+				line = text
+			}
+		}
+		safeHead, _ = fields["safe_head"].(string)
+	} else if idx := strings.Index(line, "safe_head="); idx >= 0 {
+		safeHead, _, _ = strings.Cut(line[idx+len("safe_head="):], " ")
+	}
+	start := strings.Index(line, attributesLogStart)
+	if start < 0 {
+		return "", "", nil
+	}
+	end := strings.IndexByte(line[start:], '}')
+	if end < 0 {
+		return "", "", fmt.Errorf("payload attributes are not terminated")
+	}
+	return line[start+len("&{") : start+end], safeHead, nil
+}
+
+// loggedBlockNumber parses the number of a block reference logged as <hash>:<number>.
+func loggedBlockNumber(ref string) (uint64, bool) {
+	_, num, ok := strings.Cut(ref, ":")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	return n, err == nil
+}
+
+// ReplayedAttributes is a block that was built from logged payload attributes.
+type ReplayedAttributes struct {
+	Line   int         `json:"line"`
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	Txs    int         `json:"txs"`
+}
+
+// ReplayAttributes builds a block with each of the logged payload attributes, in order, on top of the engine head,
+// and calls onBlock with each built block. Attributes with a parent before the engine head were already applied,
+// e.g. when op-node logged them again after a retry, and are skipped. A parent after the engine head is an error:
+// the engine is missing blocks. Attributes without logged parent are built on the head as they are.
+func ReplayAttributes(ctx context.Context, log log.Logger, client client.RPC, attrs []LoggedAttributes, buildTime time.Duration,
+	onBlock func(r *ReplayedAttributes) error) error {
+	for _, a := range attrs {
+		status, err := Status(ctx, client)
+		if err != nil {
+			return fmt.Errorf("failed to get engine status: %w", err)
+		}
+		if a.Parent != nil {
+			if *a.Parent < status.Head.Number {
+				log.Info("skipping attributes that build on an earlier block", "line", a.Line, "parent", *a.Parent, "head", status.Head)
+				continue
+			}
+			if *a.Parent > status.Head.Number {
+				return fmt.Errorf("attributes of line %d build on block %d, but the engine head is %s", a.Line, *a.Parent, status.Head)
+			}
+		}
+		payload, err := buildPayload(ctx, client, status, a.Attributes, payloadTiming{build: buildTime})
+		if err != nil {
+			return fmt.Errorf("failed to build block with attributes of line %d: %w", a.Line, err)
+		}
+		if err := onBlock(&ReplayedAttributes{
+			Line:   a.Line,
+			Number: payload.Number,
+			Hash:   payload.BlockHash,
+			Txs:    len(payload.Transactions),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+func TestParseAttributesLogs(t *testing.T) {
+	gasLimit := eth.Uint64Quantity(30_000_000)
+	attrs := &eth.PayloadAttributes{
+		Timestamp:             1000,
+		PrevRandao:            eth.Bytes32{0: 0xaa, 31: 0xbb},
+		SuggestedFeeRecipient: common.Address{0: 0xfe},
+		Transactions:          []eth.Data{{0x7e, 0x01}, {0x02, 0x03}},
+		NoTxPool:              true,
+		GasLimit:              &gasLimit,
+	}
+	for _, format := range []log.Format{log.LogfmtFormat(), log.JSONFormat(), log.TerminalFormat(false)} {
+		var buf bytes.Buffer
+		logger := log.New()
+		logger.SetHandler(log.StreamHandler(&buf, format))
+		logger.Info("unrelated line")
+		logger.Debug("Adding next safe attributes", "safe_head", eth.L2BlockRef{Hash: common.Hash{1}, Number: 41}, "next", attrs)
+		logger.Debug("Adding next safe attributes", "safe_head", eth.L2BlockRef{Hash: common.Hash{2}, Number: 42}, "next", &eth.PayloadAttributes{Timestamp: 1002})
+
+		parsed, err := ParseAttributesLogs(&buf)
+		require.NoError(t, err)
+		require.Len(t, parsed, 2)
+		require.Equal(t, 2, parsed[0].Line)
+		require.Equal(t, uint64(41), *parsed[0].Parent)
+		got := parsed[0].Attributes
+		require.Equal(t, uint64(1000), got.Timestamp)
+		require.Equal(t, common.Hash(attrs.PrevRandao), got.Random)
+		require.Equal(t, attrs.SuggestedFeeRecipient, got.SuggestedFeeRecipient)
+		require.Equal(t, []hexutil.Bytes{{0x7e, 0x01}, {0x02, 0x03}}, got.Transactions)
+		require.True(t, got.NoTxPool)
+		require.Equal(t, uint64(30_000_000), *got.GasLimit)
+		require.Nil(t, parsed[1].Attributes.GasLimit)
+		require.Empty(t, parsed[1].Attributes.Transactions)
+	}
+}
+
+func TestReplayAttributes(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	parent := func(n uint64) *uint64 { return &n }
+	genesisTime := mock.Head().Time()
+	attrs := []LoggedAttributes{
+		{Line: 1, Parent: parent(0), Attributes: PayloadAttributesV2{Timestamp: genesisTime + 2, SuggestedFeeRecipient: common.Address{1}}},
+		{Line: 2, Parent: parent(1), Attributes: PayloadAttributesV2{Timestamp: genesisTime + 4}},
+		// logged again, e.g. after a retry of op-node
+		{Line: 3, Parent: parent(1), Attributes: PayloadAttributesV2{Timestamp: genesisTime + 4}},
+		{Line: 4, Attributes: PayloadAttributesV2{Timestamp: genesisTime + 6}},
+	}
+	var replayed []*ReplayedAttributes
+	err = ReplayAttributes(ctx, log.New(), cl, attrs, 0, func(r *ReplayedAttributes) error {
+		replayed = append(replayed, r)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, replayed, 3)
+	require.Equal(t, []int{1, 2, 4}, []int{replayed[0].Line, replayed[1].Line, replayed[2].Line})
+	require.Equal(t, uint64(3), mock.Head().NumberU64())
+	require.Equal(t, common.Address{1}, mock.blockByNumber(1).Coinbase())
+
+	err = ReplayAttributes(ctx, log.New(), cl, []LoggedAttributes{{Line: 5, Parent: parent(7)}}, 0, nil)
+	require.ErrorContains(t, err, "attributes of line 5 build on block 7")
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AutoState is the persisted state of Auto block production, so a restarted process continues with identical settings.
+type AutoState struct {
+	BlockTime    uint64         `json:"blockTime"`
+	AllowGaps    bool           `json:"allowGaps"`
+	Random       common.Hash    `json:"random"`
+	FeeRecipient common.Address `json:"feeRecipient"`
+	// FeeRecipients is the fee recipient rotation, if any.
+	FeeRecipients FeeRecipientSchedule `json:"feeRecipients,omitempty"`
+	// FeeRecipientSource is the contract the fee recipients are read from, if any.
+	FeeRecipientSource *FeeRecipientSource `json:"feeRecipientSource,omitempty"`
+	// RandaoSource is the endpoint of the L1 RPC the prevRandao is taken from, empty if Random is used.
+	RandaoSource string `json:"randaoSource,omitempty"`
+	BuildTime    string `json:"buildTime"`
+	// NextBlock is the number of the next block to build, 0 if no block was built yet.
+	NextBlock uint64 `json:"nextBlock"`
+}
+
+// NewAutoState describes the given block building settings.
+func NewAutoState(settings *BlockBuildingSettings) *AutoState {
+	s := &AutoState{
+		BlockTime:    settings.BlockTime,
+		AllowGaps:    settings.AllowGaps,
+		Random:       settings.Random,
+		FeeRecipient: settings.FeeRecipient,
+		BuildTime:    settings.BuildTime.String(),
+
+		FeeRecipients:      settings.FeeRecipients,
+		FeeRecipientSource: settings.FeeRecipientSource,
+	}
+	if settings.RandaoSource != nil {
+		s.RandaoSource = settings.RandaoSource.Endpoint
+	}
+	return s
+}
+
+// Apply overrides the block building settings with the persisted settings.
+// The randao source cannot be restored without dialing it, so the settings must have the persisted randao source already.
+func (s *AutoState) Apply(settings *BlockBuildingSettings) error {
+	buildTime, err := time.ParseDuration(s.BuildTime)
+	if err != nil {
+		return fmt.Errorf("invalid persisted building time %q: %w", s.BuildTime, err)
+	}
+	if len(s.FeeRecipients) > 0 {
+		if err := s.FeeRecipients.Check(); err != nil {
+			return fmt.Errorf("invalid persisted fee recipients: %w", err)
+		}
+	}
+	var randaoSource string
+	if settings.RandaoSource != nil {
+		randaoSource = settings.RandaoSource.Endpoint
+	}
+	if randaoSource != s.RandaoSource {
+		return fmt.Errorf("randao source %q differs from the persisted randao source %q", randaoSource, s.RandaoSource)
+	}
+	settings.BlockTime = s.BlockTime
+	settings.AllowGaps = s.AllowGaps
+	settings.Random = s.Random
+	settings.FeeRecipient = s.FeeRecipient
+	settings.FeeRecipients = s.FeeRecipients
+	settings.FeeRecipientSource = s.FeeRecipientSource
+	settings.BuildTime = buildTime
+	return nil
+}
+
+// ReadAutoState reads the persisted Auto state, or returns nil if the state file does not exist yet.
+func ReadAutoState(path string) (*AutoState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read auto state: %w", err)
+	}
+	var s AutoState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode auto state: %w", err)
+	}
+	return &s, nil
+}
+
+// WriteAutoState writes the Auto state, replacing the state file atomically, so a crash cannot leave a partial file.
+func WriteAutoState(path string, s *AutoState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create auto state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write auto state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write auto state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace auto state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := ReadAutoState(path)
+	require.NoError(t, err)
+	require.Nil(t, s, "no state before the first run")
+
+	slot := common.Hash{31: 1}
+	settings := &BlockBuildingSettings{
+		BlockTime:          2,
+		AllowGaps:          true,
+		Random:             common.Hash{0: 0xaa},
+		FeeRecipient:       common.Address{0: 0xfe},
+		FeeRecipients:      FeeRecipientSchedule{{Address: common.Address{0: 0xa}, Weight: 2}, {Address: common.Address{0: 0xb}, Weight: 1}},
+		FeeRecipientSource: &FeeRecipientSource{Contract: common.Address{0: 0xc}, Slot: &slot},
+		RandaoSource:       &L1Randao{Endpoint: "http://l1:8545"},
+		BuildTime:          1500 * time.Millisecond,
+	}
+	state := NewAutoState(settings)
+	state.NextBlock = 42
+	require.NoError(t, WriteAutoState(path, state))
+	restored, err := ReadAutoState(path)
+	require.NoError(t, err)
+	require.Equal(t, state, restored)
+
+	applied := &BlockBuildingSettings{RandaoSource: &L1Randao{Endpoint: "http://l1:8545"}}
+	require.NoError(t, restored.Apply(applied))
+	require.Equal(t, settings, applied)
+
+	// the randao source is only restored with a client of the persisted endpoint
+	require.ErrorContains(t, restored.Apply(&BlockBuildingSettings{}), "randao source")
+	require.ErrorContains(t, restored.Apply(&BlockBuildingSettings{RandaoSource: &L1Randao{Endpoint: "http://other:8545"}}), "randao source")
+	require.NoError(t, NewAutoState(&BlockBuildingSettings{}).Apply(&BlockBuildingSettings{}))
+
+	restored.FeeRecipients = FeeRecipientSchedule{{Address: common.Address{0: 0xa}}}
+	require.ErrorContains(t, restored.Apply(applied), "zero weight")
+}
+
+func TestAutoStateNextBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	mock := NewMockEngine(MockEngineConfig{})
+	client, err := mock.Client()
+	require.NoError(t, err)
+	status, err := Status(context.Background(), client)
+	require.NoError(t, err)
+	settings := &BlockBuildingSettings{BlockTime: 2}
+	run := func(force bool) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		triggers := make(chan *Trigger)
+		done := make(chan error, 1)
+		go func() {
+			done <- Auto(ctx, NewMetrics("test", prometheus.NewRegistry()), client, log.New(), nil, settings,
+				WithManualTrigger(triggers), WithStateFile(path, force))
+		}()
+		results := make(chan *TriggerResult, 1)
+		select {
+		case triggers <- &Trigger{Result: results}:
+			require.NoError(t, (<-results).Err)
+			cancel()
+			require.ErrorIs(t, <-done, context.Canceled)
+			return nil
+		case err := <-done:
+			return err
+		}
+	}
+
+	require.NoError(t, run(false))
+	state, err := ReadAutoState(path)
+	require.NoError(t, err)
+	require.Equal(t, status.Head.Number+2, state.NextBlock)
+	require.NoError(t, run(false), "the restarted production continues where it stopped")
+
+	state.NextBlock = 100
+	require.NoError(t, WriteAutoState(path, state))
+	require.ErrorContains(t, run(false), "does not continue where block production stopped, at block 100")
+	require.NoError(t, run(true))
+}
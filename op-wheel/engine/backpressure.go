@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// LagSignal reports how many blocks a downstream consumer of the chain lags behind the given head.
+type LagSignal interface {
+	Lag(ctx context.Context, head eth.BlockID) (uint64, error)
+}
+
+// HTTPLagSignal probes an HTTP endpoint that responds with the number of the latest block
+// that the downstream consumer (e.g. an indexer) processed, as plain decimal or JSON number.
+type HTTPLagSignal struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *HTTPLagSignal) Lag(ctx context.Context, head eth.BlockID) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	cl := s.Client
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe downstream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("downstream probe responded with status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read downstream probe response: %w", err)
+	}
+	processed, err := strconv.ParseUint(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("downstream probe response is not a block number: %w", err)
+	}
+	return lagBehind(head, processed), nil
+}
+
+// RollupNodeLagSignal reports how far the L1 derivation of an op-node lags behind the head,
+// for setups where the engine builds the L1 chain that the op-node derives from.
+type RollupNodeLagSignal struct {
+	Client client.RPC
+}
+
+func (s *RollupNodeLagSignal) Lag(ctx context.Context, head eth.BlockID) (uint64, error) {
+	var status eth.SyncStatus
+	if err := s.Client.CallContext(ctx, &status, "optimism_syncStatus"); err != nil {
+		return 0, fmt.Errorf("failed to get op-node sync status: %w", err)
+	}
+	return lagBehind(head, status.CurrentL1.Number), nil
+}
+
+func lagBehind(head eth.BlockID, processed uint64) uint64 {
+	if processed >= head.Number {
+		return 0
+	}
+	return head.Number - processed
+}
@@ -0,0 +1,232 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	opcrypto "github.com/ethereum-optimism/optimism/op-service/crypto"
+)
+
+// TimedRPC is a wrapper around an RPC that records the latency of every call, by method name.
+type TimedRPC struct {
+	c client.RPC
+
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+}
+
+func NewTimedRPC(c client.RPC) *TimedRPC {
+	return &TimedRPC{c: c, latencies: make(map[string][]time.Duration)}
+}
+
+func (t *TimedRPC) record(method string, start time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latencies[method] = append(t.latencies[method], time.Since(start))
+}
+
+func (t *TimedRPC) Close() {
+	t.c.Close()
+}
+
+func (t *TimedRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	defer t.record(method, time.Now())
+	return t.c.CallContext(ctx, result, method, args...)
+}
+
+func (t *TimedRPC) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	defer t.record("<batch>", time.Now())
+	return t.c.BatchCallContext(ctx, b)
+}
+
+func (t *TimedRPC) EthSubscribe(ctx context.Context, channel any, args ...any) (ethereum.Subscription, error) {
+	return t.c.EthSubscribe(ctx, channel, args...)
+}
+
+// Latencies summarizes the recorded latencies, by method name.
+func (t *TimedRPC) Latencies() map[string]*LatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]*LatencyStats, len(t.latencies))
+	for method, durations := range t.latencies {
+		out[method] = NewLatencyStats(durations)
+	}
+	return out
+}
+
+var _ client.RPC = (*TimedRPC)(nil)
+
+// LatencyStats summarizes a set of latencies, in milliseconds.
+type LatencyStats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"minMs"`
+	Mean  float64 `json:"meanMs"`
+	P50   float64 `json:"p50Ms"`
+	P90   float64 `json:"p90Ms"`
+	P99   float64 `json:"p99Ms"`
+	Max   float64 `json:"maxMs"`
+}
+
+func NewLatencyStats(durations []time.Duration) *LatencyStats {
+	if len(durations) == 0 {
+		return &LatencyStats{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	percentile := func(p int) float64 {
+		return ms(sorted[(len(sorted)-1)*p/100])
+	}
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return &LatencyStats{
+		Count: len(sorted),
+		Min:   ms(sorted[0]),
+		Mean:  ms(total / time.Duration(len(sorted))),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   ms(sorted[len(sorted)-1]),
+	}
+}
+
+// TxGenerator generates transactions to load the engine with, before the next block is built.
+type TxGenerator interface {
+	Generate(ctx context.Context, client client.RPC, status *StatusData) (txs uint64, err error)
+}
+
+// TransferTxGenerator sends a fixed number of plain ETH transfers from the given account before every block.
+type TransferTxGenerator struct {
+	Signer    opcrypto.SignerFactory
+	From      common.Address
+	Recipient common.Address
+	Count     uint64
+
+	chainID *big.Int
+	signFn  opcrypto.SignerFn
+	nonce   uint64
+}
+
+func (g *TransferTxGenerator) init(ctx context.Context, client client.RPC) error {
+	var chainID hexutil.Big
+	if err := client.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		return fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	var nonce hexutil.Uint64
+	if err := client.CallContext(ctx, &nonce, "eth_getTransactionCount", g.From, "pending"); err != nil {
+		return fmt.Errorf("failed to get sender nonce: %w", err)
+	}
+	g.chainID = (*big.Int)(&chainID)
+	g.signFn = g.Signer(g.chainID)
+	g.nonce = uint64(nonce)
+	return nil
+}
+
+func (g *TransferTxGenerator) Generate(ctx context.Context, client client.RPC, status *StatusData) (uint64, error) {
+	if g.signFn == nil {
+		if err := g.init(ctx, client); err != nil {
+			return 0, err
+		}
+	}
+	tip := big.NewInt(params.GWei)
+	feeCap := new(big.Int).Set(tip)
+	if status.BaseFee != nil {
+		feeCap.Add(feeCap, new(big.Int).Mul(status.BaseFee, big.NewInt(2)))
+	}
+	for i := uint64(0); i < g.Count; i++ {
+		tx, err := g.signFn(ctx, g.From, types.NewTx(&types.DynamicFeeTx{
+			ChainID:   g.chainID,
+			Nonce:     g.nonce,
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       params.TxGas,
+			To:        &g.Recipient,
+			Value:     big.NewInt(1),
+		}))
+		if err != nil {
+			return i, fmt.Errorf("failed to sign transfer tx: %w", err)
+		}
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return i, fmt.Errorf("failed to encode transfer tx: %w", err)
+		}
+		if err := client.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Bytes(data)); err != nil {
+			return i, fmt.Errorf("failed to send transfer tx with nonce %d: %w", g.nonce, err)
+		}
+		g.nonce += 1
+	}
+	return g.Count, nil
+}
+
+// BenchReport is the result of a block building benchmark.
+type BenchReport struct {
+	Blocks       uint64        `json:"blocks"`
+	Txs          uint64        `json:"txs"`
+	GeneratedTxs uint64        `json:"generatedTxs"`
+	Gas          uint64        `json:"gas"`
+	Duration     time.Duration `json:"duration"`
+
+	BlocksPerSecond float64 `json:"blocksPerSecond"`
+	TxsPerSecond    float64 `json:"txsPerSecond"`
+	GasPerSecond    float64 `json:"gasPerSecond"`
+
+	// BlockLatency is the end-to-end latency of building a block, from forkchoice update to new canonical head.
+	BlockLatency *LatencyStats `json:"blockLatency"`
+	// Calls lists the latency of each RPC method that was used.
+	Calls map[string]*LatencyStats `json:"calls"`
+}
+
+// Bench builds the given number of blocks back-to-back, optionally loading the engine with generated
+// transactions before each block, and reports the throughput and latencies of the block building.
+func Bench(ctx context.Context, client client.RPC, blocks uint64, gen TxGenerator, settings *BlockBuildingSettings) (*BenchReport, error) {
+	timed := NewTimedRPC(client)
+	report := &BenchReport{}
+	var blockLatencies []time.Duration
+	start := time.Now()
+	for i := uint64(0); i < blocks; i++ {
+		status, err := Status(ctx, timed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pre-block engine status: %w", err)
+		}
+		if gen != nil {
+			txs, err := gen.Generate(ctx, timed, status)
+			report.GeneratedTxs += txs
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate txs for block %d: %w", status.Head.Number+1, err)
+			}
+		}
+		blockStart := time.Now()
+		payload, err := BuildBlock(ctx, timed, status, settings)
+		if err != nil {
+			return nil, err
+		}
+		blockLatencies = append(blockLatencies, time.Since(blockStart))
+		report.Blocks += 1
+		report.Txs += uint64(len(payload.Transactions))
+		report.Gas += payload.GasUsed
+	}
+	report.Duration = time.Since(start)
+	seconds := report.Duration.Seconds()
+	report.BlocksPerSecond = float64(report.Blocks) / seconds
+	report.TxsPerSecond = float64(report.Txs) / seconds
+	report.GasPerSecond = float64(report.Gas) / seconds
+	report.BlockLatency = NewLatencyStats(blockLatencies)
+	report.Calls = timed.Latencies()
+	return report, nil
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// L2StatusData is the forkchoice state of an OP Stack engine, as op-node L2 block refs,
+// with the same JSON field names as the op-node sync status.
+type L2StatusData struct {
+	Head      eth.L2BlockRef `json:"unsafe_l2"`
+	Safe      eth.L2BlockRef `json:"safe_l2"`
+	Finalized eth.L2BlockRef `json:"finalized_l2"`
+}
+
+// L2BlockRef retrieves the block by number, hash or tag, and extracts the op-node L2 block ref from it,
+// including the L1 origin from the L1 info deposit of the block.
+func L2BlockRef(ctx context.Context, client client.RPC, id string, genesis *rollup.Genesis) (eth.L2BlockRef, error) {
+	method := "eth_getBlockByNumber"
+	if len(id) == 2+common.HashLength*2 {
+		method = "eth_getBlockByHash"
+	}
+	block, err := getBlock(ctx, client, method, id)
+	if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to get block %s: %w", id, err)
+	}
+	ref, err := derive.L2BlockToBlockRef(block, genesis)
+	if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to convert block %s to L2 block ref: %w", id, err)
+	}
+	return ref, nil
+}
+
+// L2Status retrieves the forkchoice state of the engine as op-node L2 block refs.
+func L2Status(ctx context.Context, client client.RPC, genesis *rollup.Genesis) (*L2StatusData, error) {
+	var status L2StatusData
+	for _, v := range []struct {
+		tag string
+		ref *eth.L2BlockRef
+	}{{"latest", &status.Head}, {"safe", &status.Safe}, {"finalized", &status.Finalized}} {
+		ref, err := L2BlockRef(ctx, client, v.tag, genesis)
+		if err != nil {
+			return nil, err
+		}
+		*v.ref = ref
+	}
+	return &status, nil
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+func TestGetBlock(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(901))
+	var forced []hexutil.Bytes
+	for i := uint64(0); i < 2; i++ {
+		data, err := types.MustSignNewTx(key, signer, &types.DynamicFeeTx{Nonce: i, Gas: 21000, GasFeeCap: big.NewInt(1)}).MarshalBinary()
+		require.NoError(t, err)
+		forced = append(forced, data)
+	}
+	status, err := Status(ctx, cl)
+	require.NoError(t, err)
+	payload, err := BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2, Transactions: forced})
+	require.NoError(t, err)
+
+	for _, v := range []struct{ method, id string }{
+		{"eth_getBlockByNumber", "latest"},
+		{"eth_getBlockByHash", payload.BlockHash.Hex()},
+	} {
+		block, err := getBlock(ctx, cl, v.method, v.id)
+		require.NoError(t, err)
+		// the header decodes to the same block hash, despite the transactions being decoded separately
+		require.Equal(t, payload.BlockHash, block.Hash())
+		require.Len(t, block.Transactions(), 2)
+		require.Equal(t, mock.Head().Transactions()[1].Hash(), block.Transactions()[1].Hash())
+		require.NotNil(t, block.Withdrawals())
+	}
+	_, err = getBlock(ctx, cl, "eth_getBlockByHash", common.Hash{1}.Hex())
+	require.ErrorIs(t, err, ethereum.NotFound)
+}
+
+func TestL2BlockRef(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	genesisBlock := mock.Head()
+	genesis := &rollup.Genesis{
+		L1: eth.BlockID{Hash: common.Hash{0: 0x11}, Number: 100},
+		L2: eth.BlockID{Hash: genesisBlock.Hash(), Number: 0},
+	}
+	status, err := L2Status(ctx, cl, genesis)
+	require.NoError(t, err)
+	for _, ref := range []eth.L2BlockRef{status.Head, status.Safe, status.Finalized} {
+		require.Equal(t, genesisBlock.Hash(), ref.Hash)
+		require.Equal(t, genesis.L1, ref.L1Origin, "the genesis block has the L1 origin of the rollup genesis")
+	}
+
+	// blocks after genesis need an L1 info deposit
+	engineStatus, err := Status(ctx, cl)
+	require.NoError(t, err)
+	payload, err := BuildBlock(ctx, cl, engineStatus, &BlockBuildingSettings{BlockTime: 2})
+	require.NoError(t, err)
+	_, err = L2BlockRef(ctx, cl, payload.BlockHash.Hex(), genesis)
+	require.ErrorContains(t, err, "failed to convert block")
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BlockRange is an inclusive range of block numbers.
+type BlockRange struct {
+	From uint64
+	To   uint64
+}
+
+// BlockSet selects block numbers by a list of ranges, e.g. to apply block building settings to specific blocks only.
+// Its text encoding is a comma-separated list of block numbers and ranges: "10,20-30,40-", where "40-" is open-ended,
+// or "all" for every block.
+type BlockSet []BlockRange
+
+// Contains returns true if the block number is selected.
+func (s BlockSet) Contains(number uint64) bool {
+	for _, r := range s {
+		if r.From <= number && number <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+func (s BlockSet) MarshalText() ([]byte, error) {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		switch {
+		case r.From == 0 && r.To == math.MaxUint64:
+			parts[i] = "all"
+		case r.To == math.MaxUint64:
+			parts[i] = fmt.Sprintf("%d-", r.From)
+		case r.From == r.To:
+			parts[i] = strconv.FormatUint(r.From, 10)
+		default:
+			parts[i] = fmt.Sprintf("%d-%d", r.From, r.To)
+		}
+	}
+	return []byte(strings.Join(parts, ",")), nil
+}
+
+func (s *BlockSet) String() string {
+	text, _ := s.MarshalText()
+	return string(text)
+}
+
+func (s *BlockSet) UnmarshalText(text []byte) error {
+	*s = (*s)[:0]
+	for _, v := range strings.Split(string(text), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if v == "all" {
+			*s = append(*s, BlockRange{From: 0, To: math.MaxUint64})
+			continue
+		}
+		from, to, isRange := strings.Cut(v, "-")
+		r := BlockRange{To: math.MaxUint64}
+		var err error
+		if r.From, err = strconv.ParseUint(strings.TrimSpace(from), 10, 64); err != nil {
+			return fmt.Errorf("invalid block number %q: %w", from, err)
+		}
+		if !isRange {
+			r.To = r.From
+		} else if to = strings.TrimSpace(to); to != "" {
+			if r.To, err = strconv.ParseUint(to, 10, 64); err != nil {
+				return fmt.Errorf("invalid block number %q: %w", to, err)
+			}
+			if r.To < r.From {
+				return fmt.Errorf("invalid block range %q: end before start", v)
+			}
+		}
+		*s = append(*s, r)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+func TestBlockSet(t *testing.T) {
+	var s BlockSet
+	require.NoError(t, s.UnmarshalText([]byte("3, 10-12,20-")))
+	require.Equal(t, BlockSet{{From: 3, To: 3}, {From: 10, To: 12}, {From: 20, To: math.MaxUint64}}, s)
+	for _, n := range []uint64{3, 10, 11, 12, 20, 1000} {
+		require.True(t, s.Contains(n), "block %d", n)
+	}
+	for _, n := range []uint64{0, 2, 4, 9, 13, 19} {
+		require.False(t, s.Contains(n), "block %d", n)
+	}
+	text, err := s.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "3,10-12,20-", string(text))
+
+	require.NoError(t, s.UnmarshalText([]byte("all")))
+	require.True(t, s.Contains(0))
+	require.True(t, s.Contains(math.MaxUint64))
+
+	require.NoError(t, s.UnmarshalText([]byte("")))
+	require.False(t, s.Contains(0))
+
+	require.ErrorContains(t, s.UnmarshalText([]byte("5-4")), "end before start")
+	require.ErrorContains(t, s.UnmarshalText([]byte("x")), "invalid block number")
+}
+
+func TestBuildBlockNoTxPool(t *testing.T) {
+	var attrs []PayloadAttributesV2
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	rec := &attrsRecorder{RPC: cl, attrs: &attrs}
+
+	settings := &BlockBuildingSettings{BlockTime: 2, NoTxPool: BlockSet{{From: 2, To: 2}}}
+	for i := 0; i < 3; i++ {
+		status, err := Status(context.Background(), rec)
+		require.NoError(t, err)
+		_, err = BuildBlock(context.Background(), rec, status, settings)
+		require.NoError(t, err)
+	}
+	require.Len(t, attrs, 3)
+	require.False(t, attrs[0].NoTxPool)
+	require.True(t, attrs[1].NoTxPool)
+	require.False(t, attrs[2].NoTxPool)
+}
+
+// attrsRecorder records the payload attributes of the forkchoice updates that start block building.
+type attrsRecorder struct {
+	client.RPC
+	attrs *[]PayloadAttributesV2
+}
+
+func (r *attrsRecorder) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	if method == "engine_forkchoiceUpdatedV2" && len(args) == 2 {
+		if attrs, ok := args[1].(PayloadAttributesV2); ok {
+			*r.attrs = append(*r.attrs, attrs)
+		}
+	}
+	return r.RPC.CallContext(ctx, result, method, args...)
+}
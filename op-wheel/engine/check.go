@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// ChainExpectation describes the chain that an engine is expected to be on.
+// Nil fields are not checked.
+type ChainExpectation struct {
+	ChainID *big.Int
+	Genesis *eth.BlockID
+}
+
+// CheckChain verifies that the engine serves the expected chain, by comparing the chain ID and the genesis block.
+func CheckChain(ctx context.Context, client client.RPC, expected *ChainExpectation) error {
+	if expected.ChainID != nil {
+		var id hexutil.Big
+		if err := client.CallContext(ctx, &id, "eth_chainId"); err != nil {
+			return fmt.Errorf("failed to get chain ID: %w", err)
+		}
+		if (*big.Int)(&id).Cmp(expected.ChainID) != 0 {
+			return fmt.Errorf("engine is on chain ID %d, expected %d", (*big.Int)(&id), expected.ChainID)
+		}
+	}
+	if expected.Genesis != nil {
+		genesis, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.Uint64(expected.Genesis.Number).String())
+		if err != nil {
+			return fmt.Errorf("failed to get genesis block %d: %w", expected.Genesis.Number, err)
+		}
+		if genesis == nil {
+			return fmt.Errorf("engine does not have genesis block %d", expected.Genesis.Number)
+		}
+		if h := genesis.Hash(); h != expected.Genesis.Hash {
+			return fmt.Errorf("engine has genesis block %s, expected %s", h, expected.Genesis)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// Compatibility of an engine client with op-wheel.
+type Compatibility string
+
+const (
+	// CompatTested clients are the ones op-wheel is tested against.
+	CompatTested Compatibility = "tested"
+	// CompatUntested clients may work, but are not tested against.
+	CompatUntested Compatibility = "untested"
+	// CompatIncompatible clients are known to not work with op-wheel.
+	CompatIncompatible Compatibility = "incompatible"
+)
+
+// ClientVersion is a parsed web3_clientVersion, e.g. Geth/v1.101200.0-stable-f7376a28/linux-amd64/go1.20.7.
+type ClientVersion struct {
+	Raw string `json:"raw"`
+	// Client is the name of the client, op-geth is told apart from upstream geth by its version numbers.
+	Client  string    `json:"client"`
+	Version [3]uint64 `json:"version"`
+}
+
+func (v *ClientVersion) String() string {
+	return fmt.Sprintf("%s v%d.%d.%d", v.Client, v.Version[0], v.Version[1], v.Version[2])
+}
+
+// ParseClientVersion parses a web3_clientVersion of the form <name>/v<major>.<minor>.<patch>[-<pre>][+<build>][/...].
+func ParseClientVersion(raw string) (*ClientVersion, error) {
+	parts := strings.Split(raw, "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("client version %q has no version", raw)
+	}
+	num, _, _ := strings.Cut(strings.TrimPrefix(parts[1], "v"), "-")
+	num, _, _ = strings.Cut(num, "+")
+	fields := strings.Split(num, ".")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("client version %q is not major.minor.patch", raw)
+	}
+	out := &ClientVersion{Raw: raw, Client: strings.ToLower(parts[0])}
+	for i, f := range fields {
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version number in client version %q: %w", raw, err)
+		}
+		out.Version[i] = n
+	}
+	// op-geth encodes the upstream geth version in the minor version: v1.101200.0 is based on geth v1.12.0.
+	if out.Client == "geth" && out.Version[1] >= 100000 {
+		out.Client = "op-geth"
+	}
+	return out, nil
+}
+
+// CompatRule is an entry of the CompatMatrix, for the versions of a client in [Min, Max).
+type CompatRule struct {
+	Client string        `json:"client"`
+	Min    [3]uint64     `json:"min"`
+	Max    [3]uint64     `json:"max"`
+	Status Compatibility `json:"status"`
+	Note   string        `json:"note"`
+}
+
+func versionLess(a, b [3]uint64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// Matches returns true if the client version is covered by the rule.
+func (r *CompatRule) Matches(v *ClientVersion) bool {
+	return r.Client == v.Client && !versionLess(v.Version, r.Min) && versionLess(v.Version, r.Max)
+}
+
+// CompatMatrix lists the engine clients that op-wheel has been tested against, or is known to not work with.
+// The first matching rule applies, clients without matching rule are untested.
+var CompatMatrix = []CompatRule{
+	{Client: "op-geth", Min: [3]uint64{1, 101200, 0}, Max: [3]uint64{1, 101300, 0}, Status: CompatTested,
+		Note: "the op-geth release line that op-wheel is built against"},
+	{Client: "op-geth", Min: [3]uint64{1, 101100, 0}, Max: [3]uint64{1, 101200, 0}, Status: CompatUntested,
+		Note: "older op-geth release line"},
+	{Client: "op-geth", Min: [3]uint64{0, 0, 0}, Max: [3]uint64{1, 101100, 0}, Status: CompatIncompatible,
+		Note: "predates engine_forkchoiceUpdatedV2 and engine_getPayloadV2, which op-wheel builds blocks with"},
+	{Client: "geth", Min: [3]uint64{1, 11, 0}, Max: [3]uint64{2, 0, 0}, Status: CompatUntested,
+		Note: "upstream geth lacks the op-geth extensions: forced transactions, no-tx-pool blocks and L1 info deposits fail"},
+	{Client: "geth", Min: [3]uint64{0, 0, 0}, Max: [3]uint64{1, 11, 0}, Status: CompatIncompatible,
+		Note: "predates engine_forkchoiceUpdatedV2 and engine_getPayloadV2, which op-wheel builds blocks with"},
+}
+
+// CompatReport is the compatibility of a connected engine client.
+type CompatReport struct {
+	Version *ClientVersion `json:"version"`
+	Status  Compatibility  `json:"status"`
+	Note    string         `json:"note"`
+}
+
+// CheckCompatibility looks up the client version in the CompatMatrix.
+func CheckCompatibility(v *ClientVersion) *CompatReport {
+	for _, rule := range CompatMatrix {
+		if rule.Matches(v) {
+			return &CompatReport{Version: v, Status: rule.Status, Note: rule.Note}
+		}
+	}
+	return &CompatReport{Version: v, Status: CompatUntested, Note: "unknown client"}
+}
+
+// EngineCompatibility queries the client version of the engine, and checks its compatibility.
+func EngineCompatibility(ctx context.Context, client client.RPC) (*CompatReport, error) {
+	var raw string
+	if err := client.CallContext(ctx, &raw, "web3_clientVersion"); err != nil {
+		return nil, fmt.Errorf("failed to get client version: %w", err)
+	}
+	v, err := ParseClientVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	return CheckCompatibility(v), nil
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	for _, tc := range []struct {
+		raw    string
+		client string
+		status Compatibility
+	}{
+		{"Geth/v1.101200.0-stable-f7376a28/linux-amd64/go1.20.7", "op-geth", CompatTested},
+		{"Geth/v1.101200.1-rc.2/linux-amd64/go1.20.7", "op-geth", CompatTested},
+		{"Geth/v1.101106.0-stable/linux-amd64/go1.20.7", "op-geth", CompatUntested},
+		{"Geth/v1.101011.0-stable/linux-amd64/go1.19", "op-geth", CompatIncompatible},
+		{"Geth/v1.12.2-stable-bed84606/linux-amd64/go1.21.0", "geth", CompatUntested},
+		{"Geth/v1.10.26-stable/linux-amd64/go1.19", "geth", CompatIncompatible},
+		{"Nethermind/v1.20.1+f2a3b4c5/linux-x64/dotnet7.0.10", "nethermind", CompatUntested},
+	} {
+		v, err := ParseClientVersion(tc.raw)
+		require.NoError(t, err, tc.raw)
+		require.Equal(t, tc.client, v.Client, tc.raw)
+		require.Equal(t, tc.status, CheckCompatibility(v).Status, tc.raw)
+	}
+	_, err := ParseClientVersion("anvil")
+	require.ErrorContains(t, err, "has no version")
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// CopyBufferConfig bounds the blocks that a range copy fetches ahead of the destination engine,
+// so a fast source cannot grow the memory usage of the copy without bounds.
+type CopyBufferConfig struct {
+	// MaxBlocks is the maximum number of fetched blocks that are waiting to be inserted.
+	MaxBlocks int
+	// MaxBytes is the maximum total size of the fetched blocks that are waiting to be inserted.
+	// A single block that is larger is still fetched, once all other blocks are inserted.
+	MaxBytes uint64
+}
+
+// copyBuffer accounts the blocks and bytes that are buffered by a range copy.
+type copyBuffer struct {
+	cfg CopyBufferConfig
+
+	mu     sync.Mutex
+	blocks int
+	bytes  uint64
+
+	peakBlocks int
+	peakBytes  uint64
+
+	released chan struct{}
+}
+
+// acquire waits until there is room for a block of the given size in the buffer.
+func (b *copyBuffer) acquire(ctx context.Context, size uint64) error {
+	for {
+		b.mu.Lock()
+		if b.blocks == 0 || (b.blocks < b.cfg.MaxBlocks && b.bytes+size <= b.cfg.MaxBytes) {
+			b.blocks += 1
+			b.bytes += size
+			if b.blocks > b.peakBlocks {
+				b.peakBlocks = b.blocks
+			}
+			if b.bytes > b.peakBytes {
+				b.peakBytes = b.bytes
+			}
+			b.mu.Unlock()
+			return nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.released:
+		}
+	}
+}
+
+func (b *copyBuffer) release(size uint64) {
+	b.mu.Lock()
+	b.blocks -= 1
+	b.bytes -= size
+	b.mu.Unlock()
+	select {
+	case b.released <- struct{}{}:
+	default:
+	}
+}
+
+// CopyDestination receives the blocks of a range copy, e.g. an engine over the Engine API,
+// or the data dir of a stopped engine.
+type CopyDestination interface {
+	// InsertBlocks inserts the blocks, in ascending order, and makes the last block the head.
+	InsertBlocks(ctx context.Context, blocks []*types.Block) error
+	// Forkchoice applies the forkchoice state of the source, after all blocks are inserted.
+	Forkchoice(ctx context.Context, head, safe, finalized common.Hash) error
+}
+
+// engineDestination inserts the blocks of a range copy into an engine over the Engine API, one block at a time.
+type engineDestination struct {
+	client client.RPC
+	// safe and finalized are the blocks that the engine keeps, until the source forkchoice state is applied at the end
+	safe, finalized common.Hash
+}
+
+func (d *engineDestination) InsertBlocks(ctx context.Context, blocks []*types.Block) error {
+	for _, block := range blocks {
+		payload := engine.BlockToExecutableData(block, nil).ExecutionPayload
+		if err := insertBlock(ctx, d.client, payload); err != nil {
+			return err
+		}
+		if err := updateForkchoice(ctx, d.client, payload.BlockHash, d.safe, d.finalized); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *engineDestination) Forkchoice(ctx context.Context, head, safe, finalized common.Hash) error {
+	return updateForkchoice(ctx, d.client, head, safe, finalized)
+}
+
+// CopyRange inserts the blocks of copyFrom, from the given block number up to the head, into the copyTo engine,
+// and then applies the forkchoice state of copyFrom. See CopyRangeTo.
+func CopyRange(ctx context.Context, copyFrom client.RPC, copyTo client.RPC, from uint64, bufCfg CopyBufferConfig, stats *CopyStats) error {
+	dest, err := NewEngineDestination(ctx, copyTo)
+	if err != nil {
+		return err
+	}
+	return CopyRangeTo(ctx, copyFrom, dest, from, bufCfg, stats)
+}
+
+// NewEngineDestination returns the destination of a range copy into the engine, see CopyRangeTo.
+// The safe and finalized blocks of the engine are kept until the forkchoice state of the source is applied.
+func NewEngineDestination(ctx context.Context, copyTo client.RPC) (CopyDestination, error) {
+	destStatus, err := Status(ctx, copyTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get destination engine status: %w", err)
+	}
+	return &engineDestination{client: copyTo, safe: destStatus.Safe.Hash, finalized: destStatus.Finalized.Hash}, nil
+}
+
+// CopyRangeTo inserts the blocks of copyFrom, from the given block number up to the head, into the destination,
+// and then applies the forkchoice state of copyFrom. The parent of the first block must be known to the destination.
+// Blocks are fetched ahead while the destination inserts, within the bounds of the buffer config.
+// The blocks that were fetched while the destination inserted the previous blocks are inserted together.
+// The imported blocks, and the peak usage of the buffer, are recorded in the given stats, if not nil.
+func CopyRangeTo(ctx context.Context, copyFrom client.RPC, dest CopyDestination, from uint64, bufCfg CopyBufferConfig, stats *CopyStats) error {
+	copyHead, copySafe, copyFinalized, err := headSafeFinalized(ctx, copyFrom)
+	if err != nil {
+		return err
+	}
+	if from > copyHead.NumberU64() {
+		return fmt.Errorf("first block %d to copy is after source head %d", from, copyHead.NumberU64())
+	}
+	buf := &copyBuffer{cfg: bufCfg, released: make(chan struct{}, 1)}
+	defer func() {
+		if stats != nil {
+			stats.BufferPeak(buf.peakBlocks, buf.peakBytes)
+		}
+	}()
+
+	g, gctx := errgroup.WithContext(ctx)
+	blocks := make(chan *types.Block, bufCfg.MaxBlocks)
+	g.Go(func() error {
+		defer close(blocks)
+		for n := from; n <= copyHead.NumberU64(); n++ {
+			block, err := getBlock(gctx, copyFrom, "eth_getBlockByNumber", hexutil.Uint64(n).String())
+			if err != nil {
+				return fmt.Errorf("failed to get source block %d: %w", n, err)
+			}
+			if err := buf.acquire(gctx, block.Size()); err != nil {
+				return err
+			}
+			select {
+			case blocks <- block:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	g.Go(func() error {
+		for block := range blocks {
+			batch := []*types.Block{block}
+		drain:
+			for len(batch) < bufCfg.MaxBlocks {
+				select {
+				case next, ok := <-blocks:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+			if err := dest.InsertBlocks(gctx, batch); err != nil {
+				return err
+			}
+			for _, block := range batch {
+				if stats != nil {
+					stats.Add(block, engine.BlockToExecutableData(block, nil).ExecutionPayload)
+				}
+				buf.release(block.Size())
+			}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return dest.Forkchoice(ctx, copyHead.Hash(), copySafe.Hash(), copyFinalized.Hash())
+}
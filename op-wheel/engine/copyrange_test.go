@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyBuffer(t *testing.T) {
+	ctx := context.Background()
+	buf := &copyBuffer{cfg: CopyBufferConfig{MaxBlocks: 2, MaxBytes: 100}, released: make(chan struct{}, 1)}
+	full := func(size uint64) {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, buf.acquire(ctx, size), context.DeadlineExceeded)
+	}
+
+	// a block larger than the buffer is admitted when the buffer is empty
+	require.NoError(t, buf.acquire(ctx, 150))
+	full(1)
+	buf.release(150)
+
+	require.NoError(t, buf.acquire(ctx, 60))
+	full(50) // out of bytes
+	require.NoError(t, buf.acquire(ctx, 40))
+	full(0) // out of blocks
+	require.Equal(t, 2, buf.peakBlocks)
+	require.Equal(t, uint64(150), buf.peakBytes)
+
+	// a waiting acquire continues once a block is released
+	acquired := make(chan error)
+	go func() { acquired <- buf.acquire(ctx, 50) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	buf.release(60)
+	require.NoError(t, <-acquired)
+	require.Equal(t, 2, buf.blocks)
+	require.Equal(t, uint64(90), buf.bytes)
+}
+
+// slowDestination records the inserted blocks, and takes a while to insert each batch,
+// so the range copy fetches ahead as far as the buffer allows.
+type slowDestination struct {
+	mu         sync.Mutex
+	batches    [][]*types.Block
+	forkchoice [3]common.Hash
+}
+
+func (d *slowDestination) InsertBlocks(ctx context.Context, blocks []*types.Block) error {
+	time.Sleep(20 * time.Millisecond)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batches = append(d.batches, blocks)
+	return nil
+}
+
+func (d *slowDestination) Forkchoice(ctx context.Context, head, safe, finalized common.Hash) error {
+	d.forkchoice = [3]common.Hash{head, safe, finalized}
+	return nil
+}
+
+func TestCopyRangeToBackPressure(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		_, err = BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2})
+		require.NoError(t, err)
+	}
+	head := mock.Head()
+	blockSize := head.Size()
+
+	for _, tc := range []struct {
+		name      string
+		cfg       CopyBufferConfig
+		maxBlocks int
+	}{
+		{name: "block bound", cfg: CopyBufferConfig{MaxBlocks: 3, MaxBytes: 1 << 20}, maxBlocks: 3},
+		// the bytes fit two blocks, the mock blocks only differ in size by a few bytes
+		{name: "byte bound", cfg: CopyBufferConfig{MaxBlocks: 100, MaxBytes: 2*blockSize + blockSize/2}, maxBlocks: 2},
+		{name: "block larger than the buffer", cfg: CopyBufferConfig{MaxBlocks: 100, MaxBytes: 1}, maxBlocks: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := &slowDestination{}
+			stats := new(CopyStats)
+			require.NoError(t, CopyRangeTo(ctx, cl, dest, 2, tc.cfg, stats))
+
+			var number uint64 = 2
+			for _, batch := range dest.batches {
+				require.LessOrEqual(t, len(batch), tc.maxBlocks)
+				for _, block := range batch {
+					require.Equal(t, number, block.NumberU64())
+					number++
+				}
+			}
+			require.Equal(t, head.NumberU64()+1, number, "all blocks are inserted")
+			require.Equal(t, head.Hash(), dest.forkchoice[0])
+
+			report := stats.Report()
+			require.Equal(t, 9, report.Blocks)
+			// the slow destination lets the copy fill the buffer, but not beyond
+			require.Equal(t, tc.maxBlocks, report.BufferPeakBlocks)
+			if tc.maxBlocks > 1 {
+				require.LessOrEqual(t, report.BufferPeakBytes, tc.cfg.MaxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Distribution summarizes a set of values.
+type Distribution struct {
+	Count int     `json:"count"`
+	Min   uint64  `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   uint64  `json:"p50"`
+	P90   uint64  `json:"p90"`
+	P99   uint64  `json:"p99"`
+	Max   uint64  `json:"max"`
+	Total uint64  `json:"total"`
+}
+
+func NewDistribution(values []uint64) *Distribution {
+	if len(values) == 0 {
+		return &Distribution{}
+	}
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) uint64 {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	var total uint64
+	for _, v := range sorted {
+		total += v
+	}
+	return &Distribution{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Mean:  float64(total) / float64(len(sorted)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+		Total: total,
+	}
+}
+
+// CopyStats collects statistics of the blocks that are imported by a copy.
+type CopyStats struct {
+	first, last  uint64
+	gasUsed      []uint64
+	txs          []uint64
+	payloadSizes []uint64
+	blobs        []uint64
+
+	bufferPeakBlocks int
+	bufferPeakBytes  uint64
+}
+
+// Add records the block, and the execution payload it was imported with.
+func (s *CopyStats) Add(block *types.Block, payload *engine.ExecutableData) {
+	if len(s.gasUsed) == 0 || block.NumberU64() < s.first {
+		s.first = block.NumberU64()
+	}
+	if block.NumberU64() > s.last {
+		s.last = block.NumberU64()
+	}
+	var blobs uint64
+	for _, tx := range block.Transactions() {
+		blobs += uint64(len(tx.BlobHashes()))
+	}
+	var size uint64
+	if data, err := json.Marshal(payload); err == nil {
+		size = uint64(len(data))
+	}
+	s.gasUsed = append(s.gasUsed, block.GasUsed())
+	s.txs = append(s.txs, uint64(len(block.Transactions())))
+	s.payloadSizes = append(s.payloadSizes, size)
+	s.blobs = append(s.blobs, blobs)
+}
+
+// BufferPeak records the peak number and total size of the blocks that were fetched ahead of insertion.
+func (s *CopyStats) BufferPeak(blocks int, bytes uint64) {
+	s.bufferPeakBlocks, s.bufferPeakBytes = blocks, bytes
+}
+
+// CopyReport summarizes the chain segment that was imported by a copy.
+type CopyReport struct {
+	Blocks     int    `json:"blocks"`
+	FirstBlock uint64 `json:"firstBlock"`
+	LastBlock  uint64 `json:"lastBlock"`
+
+	GasUsed *Distribution `json:"gasUsed"`
+	Txs     *Distribution `json:"txs"`
+	// PayloadSize is the size in bytes of the JSON encoded execution payload, as sent over the Engine API.
+	PayloadSize *Distribution `json:"payloadSize"`
+	Blobs       *Distribution `json:"blobs"`
+
+	// BufferPeakBlocks and BufferPeakBytes are the peak usage of the block buffer of a range copy.
+	BufferPeakBlocks int    `json:"bufferPeakBlocks,omitempty"`
+	BufferPeakBytes  uint64 `json:"bufferPeakBytes,omitempty"`
+}
+
+func (s *CopyStats) Report() *CopyReport {
+	return &CopyReport{
+		Blocks:      len(s.gasUsed),
+		FirstBlock:  s.first,
+		LastBlock:   s.last,
+		GasUsed:     NewDistribution(s.gasUsed),
+		Txs:         NewDistribution(s.txs),
+		PayloadSize: NewDistribution(s.payloadSizes),
+		Blobs:       NewDistribution(s.blobs),
+
+		BufferPeakBlocks: s.bufferPeakBlocks,
+		BufferPeakBytes:  s.bufferPeakBytes,
+	}
+}
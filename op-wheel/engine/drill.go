@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// FailoverDrillConfig configures a sequencer failover drill, see SequencerFailoverDrill.
+type FailoverDrillConfig struct {
+	Settings *BlockBuildingSettings
+	// WarmupBlocks is the number of blocks to build on the first engine before the failover,
+	// to simulate the active sequencer. The first engine may also be driven by its own sequencer until the drill starts.
+	WarmupBlocks uint64
+	// StabilityWindow is how long the head of the first engine must not change after production stopped.
+	StabilityWindow time.Duration
+	// PollInterval is the interval to check the head of the first engine at, during the stability window.
+	PollInterval time.Duration
+	// Blocks is the number of blocks to build on the second engine after the failover.
+	Blocks uint64
+}
+
+// DrillStep is the outcome of a single step of a drill.
+type DrillStep struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"err,omitempty"`
+}
+
+// FailoverDrillReport describes the outcome of a sequencer failover drill.
+type FailoverDrillReport struct {
+	Steps []DrillStep `json:"steps"`
+	// Handover is the head of the first engine that production continued from on the second engine.
+	Handover eth.L1BlockRef `json:"handover"`
+	// HandoverBlocks is the number of blocks the second engine was behind, and had to insert.
+	HandoverBlocks uint64 `json:"handoverBlocks"`
+	// FirstBlock is the first block built on the second engine, if any.
+	FirstBlock *eth.L1BlockRef `json:"firstBlock,omitempty"`
+	// TimeToFirstBlock is the time from the start of the handover until the first block on the second engine.
+	TimeToFirstBlock time.Duration  `json:"timeToFirstBlock"`
+	Head             eth.L1BlockRef `json:"head"`
+	Passed           bool           `json:"passed"`
+}
+
+// step runs and times a step, and records it in the report.
+func (r *FailoverDrillReport) step(log log.Logger, name string, fn func() error) error {
+	log.Info("drill step", "step", name)
+	start := time.Now()
+	err := fn()
+	step := DrillStep{Name: name, Duration: time.Since(start)}
+	if err != nil {
+		step.Err = err.Error()
+		log.Error("drill step failed", "step", name, "err", err)
+	}
+	r.Steps = append(r.Steps, step)
+	return err
+}
+
+func buildBlocks(ctx context.Context, client client.RPC, settings *BlockBuildingSettings, count uint64, onBlock func(ref eth.L1BlockRef)) error {
+	for i := uint64(0); i < count; i++ {
+		status, err := Status(ctx, client)
+		if err != nil {
+			return err
+		}
+		payload, err := BuildBlock(ctx, client, status, settings)
+		if err != nil {
+			return err
+		}
+		if onBlock != nil {
+			onBlock(eth.L1BlockRef{Hash: payload.BlockHash, Number: payload.Number, Time: payload.Timestamp, ParentHash: payload.ParentHash})
+		}
+	}
+	return nil
+}
+
+// SequencerFailoverDrill scripts a standard sequencer failover from engine a to engine b:
+// production on a stops (after the optional warmup blocks), the head of a is verified to be stable,
+// b takes over the chain of a, and production continues on b, on top of the head of a.
+// The drill fails at the first failed step. The report with the timings of the steps is returned either way.
+func SequencerFailoverDrill(ctx context.Context, log log.Logger, a, b client.RPC, cfg *FailoverDrillConfig) (*FailoverDrillReport, error) {
+	report := &FailoverDrillReport{}
+	if err := report.step(log, "produce-a", func() error {
+		return buildBlocks(ctx, a, cfg.Settings, cfg.WarmupBlocks, nil)
+	}); err != nil {
+		return report, fmt.Errorf("failed to produce blocks on a: %w", err)
+	}
+
+	var handover *StatusData
+	if err := report.step(log, "head-stability-a", func() error {
+		var err error
+		if handover, err = Status(ctx, a); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(cfg.PollInterval)
+		defer ticker.Stop()
+		deadline := time.After(cfg.StabilityWindow)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-deadline:
+				return nil
+			case <-ticker.C:
+				status, err := Status(ctx, a)
+				if err != nil {
+					return err
+				}
+				if status.Head != handover.Head {
+					return fmt.Errorf("head of a changed from %s to %s, is its sequencer still running?", handover.Head, status.Head)
+				}
+			}
+		}
+	}); err != nil {
+		return report, fmt.Errorf("head of a is not stable: %w", err)
+	}
+	report.Handover = handover.Head
+
+	start := time.Now()
+	if err := report.step(log, "handover-b", func() error {
+		status, err := Status(ctx, b)
+		if err != nil {
+			return err
+		}
+		if status.Head.Number > handover.Head.Number {
+			return fmt.Errorf("b head %s is ahead of a head %s", status.Head, handover.Head)
+		}
+		canonical, err := getHeader(ctx, a, "eth_getBlockByNumber", hexutil.Uint64(status.Head.Number).String())
+		if err != nil {
+			return fmt.Errorf("failed to get block %d of a: %w", status.Head.Number, err)
+		}
+		if canonical == nil || canonical.Hash() != status.Head.Hash {
+			return fmt.Errorf("b head %s is not on the chain of a", status.Head)
+		}
+		report.HandoverBlocks = handover.Head.Number - status.Head.Number
+		if report.HandoverBlocks == 0 {
+			return updateForkchoice(ctx, b, handover.Head.Hash, handover.Safe.Hash, handover.Finalized.Hash)
+		}
+		return CopyRange(ctx, a, b, status.Head.Number+1, CopyBufferConfig{MaxBlocks: 16, MaxBytes: 64 << 20}, nil)
+	}); err != nil {
+		return report, fmt.Errorf("failed to hand over to b: %w", err)
+	}
+
+	if err := report.step(log, "produce-b", func() error {
+		return buildBlocks(ctx, b, cfg.Settings, cfg.Blocks, func(ref eth.L1BlockRef) {
+			if report.FirstBlock == nil {
+				report.FirstBlock = &ref
+				report.TimeToFirstBlock = time.Since(start)
+			}
+		})
+	}); err != nil {
+		return report, fmt.Errorf("failed to produce blocks on b: %w", err)
+	}
+
+	if err := report.step(log, "verify-b", func() error {
+		status, err := Status(ctx, b)
+		if err != nil {
+			return err
+		}
+		report.Head = status.Head
+		if report.FirstBlock != nil && report.FirstBlock.ParentHash != handover.Head.Hash {
+			return fmt.Errorf("first block %s on b does not build on the handover block %s", report.FirstBlock, handover.Head)
+		}
+		if status.Head.Number != handover.Head.Number+cfg.Blocks {
+			return fmt.Errorf("b head %s is not %d blocks after the handover block %s", status.Head, cfg.Blocks, handover.Head)
+		}
+		return nil
+	}); err != nil {
+		return report, fmt.Errorf("failed to verify b: %w", err)
+	}
+	report.Passed = true
+	return report, nil
+}
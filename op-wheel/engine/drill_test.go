@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencerFailoverDrill(t *testing.T) {
+	ctx := context.Background()
+	mockA, mockB := NewMockEngine(MockEngineConfig{}), NewMockEngine(MockEngineConfig{})
+	require.Equal(t, mockA.Head().Hash(), mockB.Head().Hash())
+	a, err := mockA.Client()
+	require.NoError(t, err)
+	b, err := mockB.Client()
+	require.NoError(t, err)
+
+	cfg := &FailoverDrillConfig{
+		Settings:        &BlockBuildingSettings{BlockTime: 2},
+		WarmupBlocks:    3,
+		StabilityWindow: 50 * time.Millisecond,
+		PollInterval:    10 * time.Millisecond,
+		Blocks:          2,
+	}
+	report, err := SequencerFailoverDrill(ctx, log.New(), a, b, cfg)
+	require.NoError(t, err)
+	require.True(t, report.Passed)
+	require.Equal(t, uint64(3), report.Handover.Number)
+	require.Equal(t, uint64(3), report.HandoverBlocks)
+	require.Equal(t, report.Handover.Hash, report.FirstBlock.ParentHash)
+	require.Equal(t, uint64(5), report.Head.Number)
+	require.Len(t, report.Steps, 5)
+
+	// b is now ahead of a, so a cannot take over without losing blocks
+	report, err = SequencerFailoverDrill(ctx, log.New(), b, a, &FailoverDrillConfig{
+		Settings: cfg.Settings, StabilityWindow: cfg.StabilityWindow, PollInterval: cfg.PollInterval,
+	})
+	require.NoError(t, err, "a is behind b, on the same chain")
+	require.Equal(t, uint64(2), report.HandoverBlocks)
+
+	require.NoError(t, buildBlocks(ctx, a, cfg.Settings, 1, nil))
+	report, err = SequencerFailoverDrill(ctx, log.New(), b, a, &FailoverDrillConfig{
+		Settings: cfg.Settings, StabilityWindow: cfg.StabilityWindow, PollInterval: cfg.PollInterval,
+	})
+	require.ErrorContains(t, err, "is ahead of a head")
+	require.False(t, report.Passed)
+}
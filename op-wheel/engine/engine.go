@@ -3,10 +3,12 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/beacon/engine"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -24,6 +26,12 @@ type PayloadAttributesV2 struct {
 	Random                common.Hash         `json:"prevRandao"`
 	SuggestedFeeRecipient common.Address      `json:"suggestedFeeRecipient"`
 	Withdrawals           []*types.Withdrawal `json:"withdrawals"`
+	// Transactions is an op-geth extension: the transactions are forced into the block
+	Transactions []hexutil.Bytes `json:"transactions,omitempty"`
+	// NoTxPool is an op-geth extension: if true, only the above Transactions are included
+	NoTxPool bool `json:"noTxPool,omitempty"`
+	// GasLimit is an op-geth extension: if set, the block is built with exactly this gas limit
+	GasLimit *uint64 `json:"gasLimit,omitempty"`
 }
 
 func (p PayloadAttributesV2) MarshalJSON() ([]byte, error) {
@@ -32,12 +40,18 @@ func (p PayloadAttributesV2) MarshalJSON() ([]byte, error) {
 		Random                common.Hash         `json:"prevRandao"            gencodec:"required"`
 		SuggestedFeeRecipient common.Address      `json:"suggestedFeeRecipient" gencodec:"required"`
 		Withdrawals           []*types.Withdrawal `json:"withdrawals"`
+		Transactions          []hexutil.Bytes     `json:"transactions,omitempty"`
+		NoTxPool              bool                `json:"noTxPool,omitempty"`
+		GasLimit              *hexutil.Uint64     `json:"gasLimit,omitempty"`
 	}
 	var enc PayloadAttributes
 	enc.Timestamp = hexutil.Uint64(p.Timestamp)
 	enc.Random = p.Random
 	enc.SuggestedFeeRecipient = p.SuggestedFeeRecipient
 	enc.Withdrawals = make([]*types.Withdrawal, 0)
+	enc.Transactions = p.Transactions
+	enc.NoTxPool = p.NoTxPool
+	enc.GasLimit = (*hexutil.Uint64)(p.GasLimit)
 	return json.Marshal(&enc)
 }
 
@@ -57,12 +71,28 @@ type RPCBlock struct {
 }
 
 func getBlock(ctx context.Context, client client.RPC, method string, tag string) (*types.Block, error) {
-	var bl *RPCBlock
-	err := client.CallContext(ctx, &bl, method, tag, true)
+	var raw json.RawMessage
+	err := client.CallContext(ctx, &raw, method, tag, true)
 	if err != nil {
 		return nil, err
 	}
-	return types.NewBlockWithHeader(&bl.Header).WithBody(bl.Transactions, nil), nil
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+	// The header and transactions are decoded separately:
+	// the JSON decoding of the header takes over the decoding of any struct that embeds it.
+	var header types.Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %w", err)
+	}
+	var body struct {
+		Transactions []*types.Transaction `json:"transactions"`
+		Withdrawals  []*types.Withdrawal  `json:"withdrawals"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode block transactions: %w", err)
+	}
+	return types.NewBlockWithHeader(&header).WithBody(body.Transactions, nil).WithWithdrawals(body.Withdrawals), nil
 }
 
 func getHeader(ctx context.Context, client client.RPC, method string, tag string) (*types.Header, error) {
@@ -95,6 +125,9 @@ func insertBlock(ctx context.Context, client client.RPC, payload *engine.Executa
 	if err := client.CallContext(ctx, &payloadResult, "engine_newPayloadV2", payload); err != nil {
 		return fmt.Errorf("failed to insert block %d: %w", payload.Number, err)
 	}
+	if isInvalid(payloadResult) {
+		return &InvalidStatusError{Method: "engine_newPayloadV2", Status: *payloadResult, Payload: payload}
+	}
 	if payloadResult.Status != string(eth.ExecutionValid) {
 		return fmt.Errorf("block insertion was not valid: %v", payloadResult.ValidationError)
 	}
@@ -103,14 +136,17 @@ func insertBlock(ctx context.Context, client client.RPC, payload *engine.Executa
 
 func updateForkchoice(ctx context.Context, client client.RPC, head, safe, finalized common.Hash) error {
 	var post engine.ForkChoiceResponse
-	if err := client.CallContext(ctx, &post, "engine_forkchoiceUpdatedV2",
-		engine.ForkchoiceStateV1{
-			HeadBlockHash:      head,
-			SafeBlockHash:      safe,
-			FinalizedBlockHash: finalized,
-		}, nil); err != nil {
+	fc := engine.ForkchoiceStateV1{
+		HeadBlockHash:      head,
+		SafeBlockHash:      safe,
+		FinalizedBlockHash: finalized,
+	}
+	if err := client.CallContext(ctx, &post, "engine_forkchoiceUpdatedV2", fc, nil); err != nil {
 		return fmt.Errorf("failed to set forkchoice with new block %s: %w", head, err)
 	}
+	if isInvalid(&post.PayloadStatus) {
+		return &InvalidStatusError{Method: "engine_forkchoiceUpdatedV2", Status: post.PayloadStatus, Forkchoice: &fc}
+	}
 	if post.PayloadStatus.Status != string(eth.ExecutionValid) {
 		return fmt.Errorf("post-block forkchoice update was not valid: %v", post.PayloadStatus.ValidationError)
 	}
@@ -123,7 +159,25 @@ type BlockBuildingSettings struct {
 	AllowGaps    bool
 	Random       common.Hash
 	FeeRecipient common.Address
-	BuildTime    time.Duration
+	// FeeRecipients rotates the fee recipient per block, instead of FeeRecipient, if not empty.
+	FeeRecipients FeeRecipientSchedule
+	// FeeRecipientSource reads the fee recipient of each block from the chain, instead of FeeRecipient(s), if not nil.
+	FeeRecipientSource *FeeRecipientSource
+	BuildTime          time.Duration
+	// RandaoSource overrides Random with the prevRandao of an L1 chain, if not nil.
+	RandaoSource *L1Randao
+	// Transactions to force into the block, in addition to the transactions from the tx-pool.
+	Transactions []hexutil.Bytes
+	// NoTxPool selects the blocks to build with only the forced transactions, without the tx-pool transactions,
+	// like a sequencer does while it only derives blocks from L1.
+	NoTxPool BlockSet
+	// L1Origin is set to build OP Stack L2 blocks, that start with an L1 info deposit.
+	L1Origin *L1OriginSettings
+	// WithholdPayload delays the insertion of the built payload, to simulate a sequencer that withholds its blocks.
+	WithholdPayload time.Duration
+	// DelayForkchoice delays the forkchoice update after the insertion of the built payload,
+	// to simulate a sequencer with misbehaving timing.
+	DelayForkchoice time.Duration
 }
 
 func BuildBlock(ctx context.Context, client client.RPC, status *StatusData, settings *BlockBuildingSettings) (*engine.ExecutableData, error) {
@@ -134,38 +188,96 @@ func BuildBlock(ctx context.Context, client client.RPC, status *StatusData, sett
 			timestamp = now - ((now - timestamp) % settings.BlockTime)
 		}
 	}
+	attrs := PayloadAttributesV2{
+		Timestamp:             timestamp,
+		Random:                settings.Random,
+		SuggestedFeeRecipient: settings.FeeRecipient,
+		Transactions:          settings.Transactions,
+		NoTxPool:              settings.NoTxPool.Contains(status.Head.Number + 1),
+	}
+	if len(settings.FeeRecipients) > 0 {
+		attrs.SuggestedFeeRecipient = settings.FeeRecipients.Pick(status.Head.Number + 1)
+	}
+	if settings.FeeRecipientSource != nil {
+		feeRecipient, err := settings.FeeRecipientSource.FeeRecipient(ctx, client, status.Head.Hash)
+		if err != nil {
+			return nil, err
+		}
+		attrs.SuggestedFeeRecipient = feeRecipient
+	}
+	var origin eth.BlockInfo
+	if settings.L1Origin != nil {
+		l1Info, l1Origin, err := settings.L1Origin.l1InfoTx(ctx, client, status, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create L1 info deposit: %w", err)
+		}
+		origin = l1Origin
+		attrs.Transactions = append([]hexutil.Bytes{l1Info}, settings.Transactions...)
+		gasLimit := settings.L1Origin.Rollup.Genesis.SystemConfig.GasLimit
+		attrs.GasLimit = &gasLimit
+	}
+	if settings.RandaoSource != nil {
+		random, err := settings.RandaoSource.Randao(ctx, origin)
+		if err != nil {
+			return nil, err
+		}
+		attrs.Random = random
+	}
+	return buildPayload(ctx, client, status, attrs, payloadTiming{
+		build:      settings.BuildTime,
+		withhold:   settings.WithholdPayload,
+		forkchoice: settings.DelayForkchoice,
+	})
+}
+
+// payloadTiming are the durations to wait for during the block building.
+type payloadTiming struct {
+	// build is the time between starting the block building and getting the payload.
+	build time.Duration
+	// withhold is the time between getting the payload and inserting it.
+	withhold time.Duration
+	// forkchoice is the time between inserting the payload and making it the head.
+	forkchoice time.Duration
+}
+
+// buildPayload instructs the engine to build a block with the given attributes on top of the head,
+// and makes it the new head after the build time.
+func buildPayload(ctx context.Context, client client.RPC, status *StatusData, attrs PayloadAttributesV2, timing payloadTiming) (*engine.ExecutableData, error) {
 	var pre engine.ForkChoiceResponse
-	if err := client.CallContext(ctx, &pre, "engine_forkchoiceUpdatedV2",
-		engine.ForkchoiceStateV1{
-			HeadBlockHash:      status.Head.Hash,
-			SafeBlockHash:      status.Safe.Hash,
-			FinalizedBlockHash: status.Finalized.Hash,
-		}, PayloadAttributesV2{
-			Timestamp:             timestamp,
-			Random:                settings.Random,
-			SuggestedFeeRecipient: settings.FeeRecipient,
-		}); err != nil {
+	fc := engine.ForkchoiceStateV1{
+		HeadBlockHash:      status.Head.Hash,
+		SafeBlockHash:      status.Safe.Hash,
+		FinalizedBlockHash: status.Finalized.Hash,
+	}
+	if err := client.CallContext(ctx, &pre, "engine_forkchoiceUpdatedV2", fc, attrs); err != nil {
 		return nil, fmt.Errorf("failed to set forkchoice when building new block: %w", err)
 	}
+	if isInvalid(&pre.PayloadStatus) {
+		return nil, &InvalidStatusError{Method: "engine_forkchoiceUpdatedV2", Status: pre.PayloadStatus, Forkchoice: &fc}
+	}
 	if pre.PayloadStatus.Status != string(eth.ExecutionValid) {
 		return nil, fmt.Errorf("pre-block forkchoice update was not valid: %v", pre.PayloadStatus.ValidationError)
 	}
 
 	// wait some time for the block to get built
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(settings.BuildTime):
+	if err := wait(ctx, timing.build); err != nil {
+		return nil, err
 	}
 
 	var payload *engine.ExecutionPayloadEnvelope
 	if err := client.CallContext(ctx, &payload, "engine_getPayloadV2", pre.PayloadID); err != nil {
-		return nil, fmt.Errorf("failed to get payload %v, %d time after instructing engine to build it: %w", pre.PayloadID, settings.BuildTime, err)
+		return nil, fmt.Errorf("failed to get payload %v, %d time after instructing engine to build it: %w", pre.PayloadID, timing.build, err)
 	}
 
+	if err := wait(ctx, timing.withhold); err != nil {
+		return nil, err
+	}
 	if err := insertBlock(ctx, client, payload.ExecutionPayload); err != nil {
 		return nil, err
 	}
+	if err := wait(ctx, timing.forkchoice); err != nil {
+		return nil, err
+	}
 	if err := updateForkchoice(ctx, client, payload.ExecutionPayload.BlockHash, status.Safe.Hash, status.Finalized.Hash); err != nil {
 		return nil, err
 	}
@@ -173,12 +285,316 @@ func BuildBlock(ctx context.Context, client client.RPC, status *StatusData, sett
 	return payload.ExecutionPayload, nil
 }
 
-func Auto(ctx context.Context, metrics Metricer, client client.RPC, log log.Logger, shutdown <-chan struct{}, settings *BlockBuildingSettings) error {
+// wait waits for the given duration, or until the context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+type autoConfig struct {
+	lagSignal LagSignal
+	maxLag    uint64
+
+	forensicsDir  string
+	forensicsLogs *LogRecorder
+
+	events EventSink
+
+	trigger <-chan *Trigger
+
+	stateFile  string
+	stateForce bool
+
+	health *Health
+
+	replay         *TxCorpus
+	replayPerBlock int
+
+	betweenBlocks func(ctx context.Context) error
+}
+
+func (cfg *autoConfig) emit(ev *Event) {
+	if cfg.events != nil {
+		ev.Time = time.Now()
+		cfg.events.Emit(ev)
+	}
+}
+
+// record records the outcome of an engine interaction in the health, if any.
+func (cfg *autoConfig) record(err error) {
+	if cfg.health != nil {
+		cfg.health.Record(err)
+	}
+}
+
+// AutoOption configures optional behavior of Auto block production.
+type AutoOption func(cfg *autoConfig)
+
+// WithBackpressure pauses block production while the lag signal reports that downstream consumers lag
+// more than maxLag blocks behind the head, and resumes once they catch up.
+func WithBackpressure(signal LagSignal, maxLag uint64) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.lagSignal = signal
+		cfg.maxLag = maxLag
+	}
+}
+
+// WithForensics writes a forensic bundle to the given directory whenever the engine responds with an INVALID status.
+func WithForensics(dir string, logs *LogRecorder) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.forensicsDir = dir
+		cfg.forensicsLogs = logs
+	}
+}
+
+// WithEvents emits the chain events of block production to the given sink,
+// so supervising tools can react to them without parsing logs.
+func WithEvents(sink EventSink) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.events = sink
+	}
+}
+
+// WithManualTrigger only builds blocks when triggered, instead of following the block time,
+// so tests can control the pacing of block production.
+func WithManualTrigger(trigger <-chan *Trigger) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.trigger = trigger
+	}
+}
+
+// WithStateFile persists the building settings, and the next block number, to the given file after every block.
+// The settings are not read from the file, see ReadAutoState to restore them.
+// Block production fails if the engine head does not continue where it stopped, unless force is set.
+func WithStateFile(path string, force bool) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.stateFile = path
+		cfg.stateForce = force
+	}
+}
+
+// WithHealth records the liveness and readiness of block production in the given health.
+func WithHealth(health *Health) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.health = health
+	}
+}
+
+// WithReplay forces up to perBlock transactions of the corpus into each block, in addition to the tx-pool.
+// Transactions of a block that fails to build are retried in the next block, so the replay stays deterministic.
+func WithReplay(corpus *TxCorpus, perBlock int) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.replay = corpus
+		cfg.replayPerBlock = perBlock
+	}
+}
+
+// WithBetweenBlocks runs fn after every built block, before the next block is built,
+// e.g. to change the state of the engine over RPC while no block is being built. Errors of fn are logged.
+func WithBetweenBlocks(fn func(ctx context.Context) error) AutoOption {
+	return func(cfg *autoConfig) {
+		cfg.betweenBlocks = fn
+	}
+}
+
+func Auto(ctx context.Context, metrics Metricer, client client.RPC, log log.Logger, shutdown <-chan struct{}, settings *BlockBuildingSettings, opts ...AutoOption) error {
+	var cfg autoConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if settings.WithholdPayload > 0 || settings.DelayForkchoice > 0 {
+		log.Warn("simulating misbehaving sequencer timing", "withhold_payload", settings.WithholdPayload, "delay_forkchoice", settings.DelayForkchoice)
+	}
+	var state *AutoState
+	if cfg.stateFile != "" {
+		state = NewAutoState(settings)
+		if prev, err := ReadAutoState(cfg.stateFile); err != nil {
+			return err
+		} else if prev != nil && prev.NextBlock != 0 {
+			status, err := Status(ctx, client)
+			if err != nil {
+				return fmt.Errorf("failed to get engine status: %w", err)
+			}
+			if status.Head.Number+1 != prev.NextBlock {
+				if !cfg.stateForce {
+					return fmt.Errorf("engine head %s does not continue where block production stopped, at block %d", status.Head, prev.NextBlock)
+				}
+				log.Warn("engine head does not continue where block production stopped", "head", status.Head, "expected_next", prev.NextBlock)
+			}
+			state.NextBlock = prev.NextBlock
+		}
+		if err := WriteAutoState(cfg.stateFile, state); err != nil {
+			return err
+		}
+	}
+
+	if cfg.health != nil {
+		// check the engine upfront, so readiness does not wait for the first block
+		_, err := Status(ctx, client)
+		cfg.record(err)
+	}
+
 	ticker := time.NewTicker(time.Millisecond * 100)
 	defer ticker.Stop()
 
 	var lastPayload *engine.ExecutableData
 	var buildErr error
+	// replayTxs are the corpus transactions of the next block
+	var replayTxs []hexutil.Bytes
+	paused := false
+	// build builds the next block, if it is time to do so or if forced.
+	// It returns the new block, or nil if no block was built.
+	build := func(now time.Time, force bool) (*engine.ExecutableData, error) {
+		blockTime := time.Duration(settings.BlockTime) * time.Second
+		lastTime := uint64(0)
+		if lastPayload != nil {
+			lastTime = lastPayload.Timestamp
+		}
+		buildTriggerTime := time.Unix(int64(lastTime), 0).Add(blockTime - settings.BuildTime)
+		if !force && lastPayload != nil && !now.After(buildTriggerTime) {
+			return nil, nil
+		}
+
+		buildTime := settings.BuildTime
+		// don't waste time on trying to include txs if we are lagging behind at least a block,
+		// but don't go ham if we are failing to build blocks already.
+		if !force && buildErr == nil && now.After(buildTriggerTime.Add(blockTime)) {
+			buildTime = 10 * time.Millisecond
+		}
+		buildErr = nil
+		status, err := Status(ctx, client)
+		if err != nil {
+			log.Error("failed to get pre-block engine status", "err", err)
+			metrics.RecordBlockFail()
+			cfg.record(err)
+			cfg.emit(&Event{Type: "error", Err: err.Error()})
+			buildErr = err
+			return nil, err
+		}
+		log.Info("status", "head", status.Head, "safe", status.Safe, "finalized", status.Finalized,
+			"head_time", status.Head.Time, "txs", status.Txs, "gas", status.Gas, "basefee", status.Gas)
+
+		if cfg.lagSignal != nil {
+			// Fail open: if the downstream lag is unknown, we keep producing blocks.
+			if lag, err := cfg.lagSignal.Lag(ctx, status.Head.ID()); err != nil {
+				log.Warn("failed to check downstream lag", "err", err)
+			} else if lag > cfg.maxLag {
+				if !paused {
+					log.Info("pausing block production, downstream is lagging", "lag", lag, "max_lag", cfg.maxLag)
+					cfg.emit(&Event{Type: "paused", Err: fmt.Sprintf("downstream lags %d blocks", lag)})
+					paused = true
+				}
+				return nil, fmt.Errorf("block production is paused, downstream lags %d blocks", lag)
+			} else if paused {
+				log.Info("resuming block production, downstream caught up", "lag", lag, "max_lag", cfg.maxLag)
+				cfg.emit(&Event{Type: "resumed"})
+				paused = false
+			}
+		}
+
+		// On a mocked "beacon epoch transition", update finalization and justification checkpoints.
+		// There are no gap slots, so we just go back 32 blocks.
+		if status.Head.Number%32 == 0 {
+			if status.Safe.Number+32 <= status.Head.Number {
+				safe, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.Uint64(status.Head.Number-32).String())
+				if err != nil {
+					buildErr = err
+					log.Error("failed to find block for new safe block progress", "err", err)
+					cfg.emit(&Event{Type: "error", Err: err.Error()})
+					return nil, err
+				}
+				status.Safe = eth.L1BlockRef{Hash: safe.Hash(), Number: safe.Number.Uint64(), Time: safe.Time, ParentHash: safe.ParentHash}
+			}
+			if status.Finalized.Number+32 <= status.Safe.Number {
+				finalized, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.Uint64(status.Safe.Number-32).String())
+				if err != nil {
+					buildErr = err
+					log.Error("failed to find block for new finalized block progress", "err", err)
+					cfg.emit(&Event{Type: "error", Err: err.Error()})
+					return nil, err
+				}
+				status.Finalized = eth.L1BlockRef{Hash: finalized.Hash(), Number: finalized.Number.Uint64(), Time: finalized.Time, ParentHash: finalized.ParentHash}
+			}
+		}
+
+		if cfg.replay != nil && replayTxs == nil && !cfg.replay.Done() {
+			if replayTxs, err = cfg.replay.Next(cfg.replayPerBlock); err != nil {
+				buildErr = err
+				log.Error("failed to read replay transactions", "err", err)
+				cfg.emit(&Event{Type: "error", Err: err.Error()})
+				return nil, err
+			}
+			if cfg.replay.Done() {
+				log.Info("replayed all transactions of the corpus", "txs", cfg.replay.Replayed)
+			}
+		}
+
+		payload, err := BuildBlock(ctx, client, status, &BlockBuildingSettings{
+			BlockTime:    settings.BlockTime,
+			AllowGaps:    settings.AllowGaps,
+			Random:       settings.Random,
+			RandaoSource: settings.RandaoSource,
+			FeeRecipient: settings.FeeRecipient,
+			BuildTime:    buildTime,
+			L1Origin:     settings.L1Origin,
+
+			FeeRecipients:      settings.FeeRecipients,
+			FeeRecipientSource: settings.FeeRecipientSource,
+			Transactions:       replayTxs,
+			NoTxPool:           settings.NoTxPool,
+
+			WithholdPayload: settings.WithholdPayload,
+			DelayForkchoice: settings.DelayForkchoice,
+		})
+		if err != nil {
+			buildErr = err
+			log.Error("failed to produce block", "err", err)
+			metrics.RecordBlockFail()
+			cfg.record(err)
+			cfg.emit(&Event{Type: "error", Err: err.Error()})
+			var invalid *InvalidStatusError
+			if cfg.forensicsDir != "" && errors.As(err, &invalid) {
+				if path, err := WriteForensicBundle(ctx, client, invalid, cfg.forensicsLogs, cfg.forensicsDir); err != nil {
+					log.Error("failed to write forensic bundle", "err", err)
+				} else {
+					log.Info("wrote forensic bundle", "path", path)
+				}
+			}
+			return nil, err
+		}
+		lastPayload = payload
+		replayTxs = nil
+		cfg.record(nil)
+		log.Info("created block", "hash", payload.BlockHash, "number", payload.Number,
+			"timestamp", payload.Timestamp, "txs", len(payload.Transactions),
+			"gas", payload.GasUsed, "basefee", payload.BaseFeePerGas)
+		basefee, _ := new(big.Float).SetInt(payload.BaseFeePerGas).Float64()
+		metrics.RecordBlockStats(payload.BlockHash, payload.Number, payload.Timestamp, uint64(len(payload.Transactions)), payload.GasUsed, basefee)
+		cfg.emit(&Event{Type: "block", Hash: &payload.BlockHash, Number: payload.Number,
+			Timestamp: payload.Timestamp, Txs: uint64(len(payload.Transactions)), Gas: payload.GasUsed})
+		cfg.emit(&Event{Type: "forkchoice", Head: &payload.BlockHash, Safe: &status.Safe.Hash, Finalized: &status.Finalized.Hash})
+		if state != nil {
+			state.NextBlock = payload.Number + 1
+			if err := WriteAutoState(cfg.stateFile, state); err != nil {
+				log.Error("failed to persist auto state", "err", err)
+			}
+		}
+		if cfg.betweenBlocks != nil {
+			if err := cfg.betweenBlocks(ctx); err != nil {
+				log.Error("failed to run between blocks", "err", err)
+			}
+		}
+		return payload, nil
+	}
+
 	for {
 		select {
 		case <-shutdown:
@@ -187,75 +603,22 @@ func Auto(ctx context.Context, metrics Metricer, client client.RPC, log log.Logg
 		case <-ctx.Done():
 			log.Info("context closed", "err", ctx.Err())
 			return ctx.Err()
+		case trigger := <-cfg.trigger:
+			if cfg.health != nil {
+				cfg.health.Tick(time.Now())
+			}
+			payload, err := build(time.Now(), true)
+			if trigger.Result != nil {
+				trigger.Result <- &TriggerResult{Payload: payload, Err: err}
+			}
 		case now := <-ticker.C:
-			blockTime := time.Duration(settings.BlockTime) * time.Second
-			lastTime := uint64(0)
-			if lastPayload != nil {
-				lastTime = lastPayload.Timestamp
+			if cfg.health != nil {
+				cfg.health.Tick(now)
 			}
-			buildTriggerTime := time.Unix(int64(lastTime), 0).Add(blockTime - settings.BuildTime)
-
-			if lastPayload == nil || now.After(buildTriggerTime) {
-				buildTime := settings.BuildTime
-				// don't waste time on trying to include txs if we are lagging behind at least a block,
-				// but don't go ham if we are failing to build blocks already.
-				if buildErr == nil && now.After(buildTriggerTime.Add(blockTime)) {
-					buildTime = 10 * time.Millisecond
-				}
-				buildErr = nil
-				status, err := Status(ctx, client)
-				if err != nil {
-					log.Error("failed to get pre-block engine status", "err", err)
-					metrics.RecordBlockFail()
-					buildErr = err
-					continue
-				}
-				log.Info("status", "head", status.Head, "safe", status.Safe, "finalized", status.Finalized,
-					"head_time", status.Head.Time, "txs", status.Txs, "gas", status.Gas, "basefee", status.Gas)
-
-				// On a mocked "beacon epoch transition", update finalization and justification checkpoints.
-				// There are no gap slots, so we just go back 32 blocks.
-				if status.Head.Number%32 == 0 {
-					if status.Safe.Number+32 <= status.Head.Number {
-						safe, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.Uint64(status.Head.Number-32).String())
-						if err != nil {
-							buildErr = err
-							log.Error("failed to find block for new safe block progress", "err", err)
-							continue
-						}
-						status.Safe = eth.L1BlockRef{Hash: safe.Hash(), Number: safe.Number.Uint64(), Time: safe.Time, ParentHash: safe.ParentHash}
-					}
-					if status.Finalized.Number+32 <= status.Safe.Number {
-						finalized, err := getHeader(ctx, client, "eth_getBlockByNumber", hexutil.Uint64(status.Safe.Number-32).String())
-						if err != nil {
-							buildErr = err
-							log.Error("failed to find block for new finalized block progress", "err", err)
-							continue
-						}
-						status.Finalized = eth.L1BlockRef{Hash: finalized.Hash(), Number: finalized.Number.Uint64(), Time: finalized.Time, ParentHash: finalized.ParentHash}
-					}
-				}
-
-				payload, err := BuildBlock(ctx, client, status, &BlockBuildingSettings{
-					BlockTime:    settings.BlockTime,
-					AllowGaps:    settings.AllowGaps,
-					Random:       settings.Random,
-					FeeRecipient: settings.FeeRecipient,
-					BuildTime:    buildTime,
-				})
-				if err != nil {
-					buildErr = err
-					log.Error("failed to produce block", "err", err)
-					metrics.RecordBlockFail()
-				} else {
-					lastPayload = payload
-					log.Info("created block", "hash", payload.BlockHash, "number", payload.Number,
-						"timestamp", payload.Timestamp, "txs", len(payload.Transactions),
-						"gas", payload.GasUsed, "basefee", payload.BaseFeePerGas)
-					basefee, _ := new(big.Float).SetInt(payload.BaseFeePerGas).Float64()
-					metrics.RecordBlockStats(payload.BlockHash, payload.Number, payload.Timestamp, uint64(len(payload.Transactions)), payload.GasUsed, basefee)
-				}
+			if cfg.trigger != nil {
+				continue // blocks are only built when triggered
 			}
+			_, _ = build(now, false) // errors are logged, and the next tick retries
 		}
 	}
 }
@@ -288,7 +651,8 @@ func Status(ctx context.Context, client client.RPC) (*StatusData, error) {
 
 // Copy takes the forkchoice state of copyFrom, and applies it to copyTo, and inserts the head-block.
 // The destination engine should then start syncing to this new chain if it has peers to do so.
-func Copy(ctx context.Context, copyFrom client.RPC, copyTo client.RPC) error {
+// The imported blocks are recorded in the given stats, if not nil.
+func Copy(ctx context.Context, copyFrom client.RPC, copyTo client.RPC, stats *CopyStats) error {
 	copyHead, copySafe, copyFinalized, err := headSafeFinalized(ctx, copyFrom)
 	if err != nil {
 		return err
@@ -301,8 +665,44 @@ func Copy(ctx context.Context, copyFrom client.RPC, copyTo client.RPC) error {
 	if err := insertBlock(ctx, copyTo, payload); err != nil {
 		return err
 	}
+	if stats != nil {
+		stats.Add(copyHead, payload)
+	}
 	if err := updateForkchoice(ctx, copyTo, payload.BlockHash, copySafe.Hash(), copyFinalized.Hash()); err != nil {
 		return err
 	}
 	return nil
 }
+
+// ResetPlan describes the forkchoice change of a reset of the engine chain.
+type ResetPlan struct {
+	Pre *StatusData `json:"pre"`
+	// Head, safe and finalized are all set to this block after the reset.
+	Target eth.L1BlockRef `json:"target"`
+	// Dropped is the number of blocks that are no longer canonical after the reset.
+	Dropped uint64 `json:"dropped"`
+	DryRun  bool   `json:"dryRun"`
+}
+
+// ResetToFinalized makes the finalized block the new head and safe block of the engine,
+// dropping the unsafe and safe chain on top of it. If dryRun is true, the reset is only planned, not executed.
+func ResetToFinalized(ctx context.Context, client client.RPC, dryRun bool) (*ResetPlan, error) {
+	status, err := Status(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ResetPlan{
+		Pre:     status,
+		Target:  status.Finalized,
+		Dropped: status.Head.Number - status.Finalized.Number,
+		DryRun:  dryRun,
+	}
+	if dryRun {
+		return plan, nil
+	}
+	finalized := status.Finalized.Hash
+	if err := updateForkchoice(ctx, client, finalized, finalized, finalized); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// timedRPC records the time of every call, by method.
+type timedRPC struct {
+	client.RPC
+	mu    sync.Mutex
+	calls map[string]time.Time
+}
+
+func (r *timedRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	r.mu.Lock()
+	r.calls[method] = time.Now()
+	r.mu.Unlock()
+	return r.RPC.CallContext(ctx, result, method, args...)
+}
+
+func TestBuildBlockTiming(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	timed := &timedRPC{RPC: cl, calls: make(map[string]time.Time)}
+	status, err := Status(ctx, timed)
+	require.NoError(t, err)
+
+	settings := &BlockBuildingSettings{BlockTime: 2, WithholdPayload: 50 * time.Millisecond, DelayForkchoice: 50 * time.Millisecond}
+	start := time.Now()
+	payload, err := BuildBlock(ctx, timed, status, settings)
+	require.NoError(t, err)
+	require.Equal(t, payload.BlockHash, mock.Head().Hash())
+	// the payload is withheld after it is built, and only made the head some time after its insertion
+	require.GreaterOrEqual(t, timed.calls["engine_newPayloadV2"].Sub(timed.calls["engine_getPayloadV2"]), settings.WithholdPayload)
+	require.GreaterOrEqual(t, timed.calls["engine_forkchoiceUpdatedV2"].Sub(timed.calls["engine_newPayloadV2"]), settings.DelayForkchoice)
+	require.GreaterOrEqual(t, time.Since(start), settings.WithholdPayload+settings.DelayForkchoice)
+
+	// a withheld payload is not inserted if block production stops meanwhile
+	status, err = Status(ctx, timed)
+	require.NoError(t, err)
+	delete(timed.calls, "engine_newPayloadV2")
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = BuildBlock(cctx, timed, status, &BlockBuildingSettings{BlockTime: 2, WithholdPayload: time.Minute})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotContains(t, timed.calls, "engine_newPayloadV2")
+	require.Equal(t, status.Head.Hash, mock.Head().Hash())
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Event is a chain event of Auto block production, emitted as JSON line.
+type Event struct {
+	// Type is one of: block, forkchoice, error, paused, resumed.
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Set for block events.
+	Hash      *common.Hash `json:"hash,omitempty"`
+	Number    uint64       `json:"number,omitempty"`
+	Timestamp uint64       `json:"timestamp,omitempty"`
+	Txs       uint64       `json:"txs,omitempty"`
+	Gas       uint64       `json:"gas,omitempty"`
+
+	// Set for forkchoice events.
+	Head      *common.Hash `json:"head,omitempty"`
+	Safe      *common.Hash `json:"safe,omitempty"`
+	Finalized *common.Hash `json:"finalized,omitempty"`
+
+	// Set for error events, and the reason of paused events.
+	Err string `json:"error,omitempty"`
+}
+
+// EventSink receives the events of Auto block production.
+type EventSink interface {
+	Emit(ev *Event)
+}
+
+// EventWriter writes events as JSON lines to a writer, e.g. stdout.
+type EventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+func (e *EventWriter) Emit(ev *Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(ev)
+}
+
+// EventSocket serves events as JSON lines on a unix socket, to every connected client.
+// Clients only receive the events that are emitted after they connect.
+// Clients that cannot keep up are disconnected.
+type EventSocket struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// ListenEventSocket creates the unix socket at the given path, replacing any stale socket file.
+func ListenEventSocket(path string) (*EventSocket, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale event socket: %w", err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on event socket: %w", err)
+	}
+	s := &EventSocket{listener: l, conns: make(map[net.Conn]struct{})}
+	go s.accept()
+	return s, nil
+}
+
+func (s *EventSocket) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+	}
+}
+
+func (s *EventSocket) Emit(ev *Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(data); err != nil {
+			_ = conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+}
+
+func (s *EventSocket) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+		delete(s.conns, conn)
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// explorerLatestBlocks is the number of blocks listed on the index page of the explorer.
+const explorerLatestBlocks = 20
+
+//go:embed explorer.html
+var explorerTemplates string
+
+var explorerTmpl = template.Must(template.New("explorer").Funcs(template.FuncMap{
+	"hex": func(b []byte) string { return hexutil.Encode(b) },
+}).Parse(explorerTemplates))
+
+// StorageLister writes all storage of an account, for the explorer to show.
+type StorageLister func(ctx context.Context, addr common.Address, w io.Writer) error
+
+// Explorer is a minimal block explorer web UI, backed by the eth RPC of the engine,
+// to inspect devnets without deploying a full explorer.
+type Explorer struct {
+	client  client.RPC
+	storage StorageLister
+	mux     *http.ServeMux
+}
+
+// NewExplorer creates an explorer that reads the chain from the given client.
+// The storage lister is optional, and used to list all storage of accounts, which the RPC does not support.
+func NewExplorer(client client.RPC, storage StorageLister) *Explorer {
+	e := &Explorer{client: client, storage: storage, mux: http.NewServeMux()}
+	e.mux.HandleFunc("/", e.serveIndex)
+	e.mux.HandleFunc("/block/", e.serveBlock)
+	e.mux.HandleFunc("/tx/", e.serveTx)
+	e.mux.HandleFunc("/account/", e.serveAccount)
+	e.mux.HandleFunc("/search", e.serveSearch)
+	return e
+}
+
+func (e *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+type explorerBlock struct {
+	*types.Header
+	Hash common.Hash
+	Txs  []common.Hash
+}
+
+type explorerTx struct {
+	*types.Transaction
+	From        common.Address
+	BlockHash   *common.Hash
+	BlockNumber *hexutil.Big
+	Receipt     *types.Receipt
+}
+
+type explorerAccount struct {
+	Address    common.Address
+	Balance    *big.Int
+	Nonce      uint64
+	Code       hexutil.Bytes
+	Slot       string
+	SlotValue  *common.Hash
+	AllStorage string
+}
+
+var errNotFound = errors.New("not found")
+
+// block fetches a block by number, hash or tag, with the hashes of its transactions.
+func (e *Explorer) block(ctx context.Context, id string) (*explorerBlock, error) {
+	method := "eth_getBlockByNumber"
+	if len(id) == 2+common.HashLength*2 {
+		method = "eth_getBlockByHash"
+	} else if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		id = hexutil.Uint64(n).String()
+	}
+	var raw json.RawMessage
+	if err := e.client.CallContext(ctx, &raw, method, id, false); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errNotFound
+	}
+	var header types.Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode block header: %w", err)
+	}
+	var body struct {
+		Transactions []common.Hash `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode block transactions: %w", err)
+	}
+	return &explorerBlock{Header: &header, Hash: header.Hash(), Txs: body.Transactions}, nil
+}
+
+func (e *Explorer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		e.renderError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	head, err := e.block(r.Context(), "latest")
+	if err != nil {
+		e.renderError(w, http.StatusBadGateway, err)
+		return
+	}
+	blocks := []*explorerBlock{head}
+	for n := head.Number.Uint64(); n > 0 && len(blocks) < explorerLatestBlocks; n-- {
+		bl, err := e.block(r.Context(), strconv.FormatUint(n-1, 10))
+		if err != nil {
+			e.renderError(w, http.StatusBadGateway, err)
+			return
+		}
+		blocks = append(blocks, bl)
+	}
+	e.render(w, "index", blocks)
+}
+
+func (e *Explorer) serveBlock(w http.ResponseWriter, r *http.Request) {
+	bl, err := e.block(r.Context(), strings.TrimPrefix(r.URL.Path, "/block/"))
+	if err != nil {
+		e.renderError(w, statusOf(err), err)
+		return
+	}
+	e.render(w, "block", bl)
+}
+
+func (e *Explorer) serveTx(w http.ResponseWriter, r *http.Request) {
+	hash := common.HexToHash(strings.TrimPrefix(r.URL.Path, "/tx/"))
+	var raw json.RawMessage
+	if err := e.client.CallContext(r.Context(), &raw, "eth_getTransactionByHash", hash); err != nil {
+		e.renderError(w, http.StatusBadGateway, err)
+		return
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		e.renderError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	tx := &explorerTx{Transaction: new(types.Transaction)}
+	if err := json.Unmarshal(raw, tx.Transaction); err != nil {
+		e.renderError(w, http.StatusBadGateway, fmt.Errorf("failed to decode transaction: %w", err))
+		return
+	}
+	var meta struct {
+		From        common.Address `json:"from"`
+		BlockHash   *common.Hash   `json:"blockHash"`
+		BlockNumber *hexutil.Big   `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		e.renderError(w, http.StatusBadGateway, fmt.Errorf("failed to decode transaction: %w", err))
+		return
+	}
+	tx.From, tx.BlockHash, tx.BlockNumber = meta.From, meta.BlockHash, meta.BlockNumber
+	if tx.BlockHash != nil {
+		if err := e.client.CallContext(r.Context(), &tx.Receipt, "eth_getTransactionReceipt", hash); err != nil {
+			e.renderError(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+	e.render(w, "tx", tx)
+}
+
+func (e *Explorer) serveAccount(w http.ResponseWriter, r *http.Request) {
+	addr := common.HexToAddress(strings.TrimPrefix(r.URL.Path, "/account/"))
+	acc := &explorerAccount{Address: addr, Slot: r.URL.Query().Get("slot")}
+	var balance hexutil.Big
+	var nonce hexutil.Uint64
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []any{addr, "latest"}, Result: &balance},
+		{Method: "eth_getTransactionCount", Args: []any{addr, "latest"}, Result: &nonce},
+		{Method: "eth_getCode", Args: []any{addr, "latest"}, Result: &acc.Code},
+	}
+	if acc.Slot != "" {
+		acc.SlotValue = new(common.Hash)
+		batch = append(batch, rpc.BatchElem{Method: "eth_getStorageAt", Args: []any{addr, common.HexToHash(acc.Slot), "latest"}, Result: acc.SlotValue})
+	}
+	if err := e.client.BatchCallContext(r.Context(), batch); err != nil {
+		e.renderError(w, http.StatusBadGateway, err)
+		return
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			e.renderError(w, http.StatusBadGateway, fmt.Errorf("failed to get account %s: %w", elem.Method, elem.Error))
+			return
+		}
+	}
+	acc.Balance, acc.Nonce = balance.ToInt(), uint64(nonce)
+	if e.storage != nil {
+		var buf bytes.Buffer
+		if err := e.storage(r.Context(), addr, &buf); err != nil {
+			fmt.Fprintf(&buf, "failed to list storage: %v", err)
+		}
+		acc.AllStorage = buf.String()
+	}
+	e.render(w, "account", acc)
+}
+
+// serveSearch redirects to the page of a block number, address, or a tx or block hash.
+func (e *Explorer) serveSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	switch {
+	case len(q) == 2+common.AddressLength*2:
+		http.Redirect(w, r, "/account/"+q, http.StatusFound)
+	case len(q) == 2+common.HashLength*2:
+		var tx json.RawMessage
+		if err := e.client.CallContext(r.Context(), &tx, "eth_getTransactionByHash", common.HexToHash(q)); err == nil && len(tx) > 0 && string(tx) != "null" {
+			http.Redirect(w, r, "/tx/"+q, http.StatusFound)
+		} else {
+			http.Redirect(w, r, "/block/"+q, http.StatusFound)
+		}
+	default:
+		http.Redirect(w, r, "/block/"+q, http.StatusFound)
+	}
+}
+
+func (e *Explorer) render(w http.ResponseWriter, name string, data any) {
+	var buf bytes.Buffer
+	if err := explorerTmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		e.renderError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+func (e *Explorer) renderError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = explorerTmpl.ExecuteTemplate(w, "error", err.Error())
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, errNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
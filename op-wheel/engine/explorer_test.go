@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// explorerRPC serves the transaction and account methods of the explorer, on top of the blocks of a mock engine.
+type explorerRPC struct {
+	client.RPC
+	tx      *types.Transaction
+	from    common.Address
+	block   common.Hash
+	balance *big.Int
+}
+
+func (r *explorerRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	var res any
+	switch method {
+	case "eth_getTransactionByHash":
+		if args[0].(common.Hash) != r.tx.Hash() {
+			break // null, like an unknown transaction
+		}
+		data, err := json.Marshal(r.tx)
+		if err != nil {
+			return err
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		fields["from"], fields["blockHash"], fields["blockNumber"] = r.from, r.block, (*hexutil.Big)(big.NewInt(1))
+		res = fields
+	case "eth_getTransactionReceipt":
+		res = &types.Receipt{Type: r.tx.Type(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000, Logs: []*types.Log{},
+			TxHash: r.tx.Hash(), BlockHash: r.block, BlockNumber: big.NewInt(1)}
+	case "eth_getBalance":
+		res = (*hexutil.Big)(r.balance)
+	case "eth_getTransactionCount":
+		res = hexutil.Uint64(3)
+	case "eth_getCode":
+		res = hexutil.Bytes{0x60, 0x00}
+	case "eth_getStorageAt":
+		res = common.Hash{31: 0x11}
+	default:
+		return r.RPC.CallContext(ctx, result, method, args...)
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (r *explorerRPC) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for i := range b {
+		b[i].Error = r.CallContext(ctx, b[i].Result, b[i].Method, b[i].Args...)
+	}
+	return nil
+}
+
+func TestExplorer(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	feeRecipient := common.Address{0: 0xfe}
+	for i := 0; i < 3; i++ {
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		_, err = BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2, FeeRecipient: feeRecipient})
+		require.NoError(t, err)
+	}
+	head := mock.Head()
+	tx := types.NewTx(&types.LegacyTx{Nonce: 7, Gas: 21000, GasPrice: big.NewInt(1), To: &feeRecipient})
+	eth := &explorerRPC{RPC: cl, tx: tx, from: common.Address{0: 0xa}, block: head.Hash(), balance: big.NewInt(42)}
+	storage := func(ctx context.Context, addr common.Address, w io.Writer) error {
+		_, err := io.WriteString(w, "+ 0x01 = 0x02")
+		return err
+	}
+	srv := httptest.NewServer(NewExplorer(eth, storage))
+	defer srv.Close()
+	noRedirect := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(path string) (int, string) {
+		resp, err := noRedirect.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		if resp.StatusCode == http.StatusFound {
+			return resp.StatusCode, resp.Header.Get("Location")
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/")
+	require.Equal(t, http.StatusOK, status)
+	// the head block first, down to genesis
+	require.Equal(t, 4, strings.Count(body, `<tr><td><a href="/block/`))
+	require.Less(t, strings.Index(body, head.Hash().Hex()), strings.Index(body, head.ParentHash().Hex()))
+
+	for _, id := range []string{"2", head.ParentHash().Hex()} {
+		status, body = get("/block/" + id)
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, body, "<h2>Block 2</h2>")
+		require.Contains(t, body, head.ParentHash().Hex())
+	}
+	status, body = get("/block/100")
+	require.Equal(t, http.StatusNotFound, status)
+	require.Contains(t, body, "not found")
+
+	status, body = get("/tx/" + tx.Hash().Hex())
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, "success")
+	require.Contains(t, body, `<a href="/account/0x0a00000000000000000000000000000000000000">`)
+	status, _ = get("/tx/" + common.Hash{1}.Hex())
+	require.Equal(t, http.StatusNotFound, status)
+
+	status, body = get("/account/" + feeRecipient.Hex() + "?slot=0x01")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, "<tr><td>balance</td><td>42</td></tr>")
+	require.Contains(t, body, "<tr><td>nonce</td><td>3</td></tr>")
+	require.Contains(t, body, "= "+common.Hash{31: 0x11}.Hex())
+	require.Contains(t, body, "&#43; 0x01 = 0x02", "the storage of the lister is listed, escaped")
+
+	for q, location := range map[string]string{
+		"2":                     "/block/2",
+		feeRecipient.Hex():      "/account/" + feeRecipient.Hex(),
+		tx.Hash().Hex():         "/tx/" + tx.Hash().Hex(),
+		head.Hash().Hex():       "/block/" + head.Hash().Hex(),
+		" " + head.Hash().Hex(): "/block/" + head.Hash().Hex(),
+	} {
+		status, got := get("/search?q=" + strings.ReplaceAll(q, " ", "+"))
+		require.Equal(t, http.StatusFound, status)
+		require.Equal(t, location, got, q)
+	}
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// WeightedFeeRecipient is an entry of a FeeRecipientSchedule.
+type WeightedFeeRecipient struct {
+	Address common.Address `json:"address"`
+	// Weight is the number of blocks per rotation that use this fee recipient.
+	Weight uint64 `json:"weight"`
+}
+
+// FeeRecipientSchedule rotates the fee recipient per block, weighted round-robin.
+// The fee recipient is a function of the block number, so the rotation continues where it stopped after a restart.
+type FeeRecipientSchedule []WeightedFeeRecipient
+
+// RoundRobin creates a schedule that rotates through the given fee recipients, one block each.
+func RoundRobin(addrs []common.Address) FeeRecipientSchedule {
+	s := make(FeeRecipientSchedule, len(addrs))
+	for i, addr := range addrs {
+		s[i] = WeightedFeeRecipient{Address: addr, Weight: 1}
+	}
+	return s
+}
+
+// ReadFeeRecipientSchedule reads a JSON array of weighted fee recipients.
+func ReadFeeRecipientSchedule(path string) (FeeRecipientSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee recipient schedule: %w", err)
+	}
+	var s FeeRecipientSchedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode fee recipient schedule: %w", err)
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Check verifies that the schedule is not empty, has no zero weights, and that the total weight fits in a uint64.
+func (s FeeRecipientSchedule) Check() error {
+	if len(s) == 0 {
+		return fmt.Errorf("empty fee recipient schedule")
+	}
+	var total uint64
+	for i, r := range s {
+		if r.Weight == 0 {
+			return fmt.Errorf("fee recipient %d (%s) has zero weight", i, r.Address)
+		}
+		if total+r.Weight < total {
+			return fmt.Errorf("total weight of the fee recipients overflows at fee recipient %d (%s)", i, r.Address)
+		}
+		total += r.Weight
+	}
+	return nil
+}
+
+// Pick returns the fee recipient of the block with the given number. The schedule must pass Check.
+func (s FeeRecipientSchedule) Pick(number uint64) common.Address {
+	var total uint64
+	for _, r := range s {
+		total += r.Weight
+	}
+	i := number % total
+	for _, r := range s {
+		if i < r.Weight {
+			return r.Address
+		}
+		i -= r.Weight
+	}
+	panic("unreachable")
+}
+
+// FeeRecipientSource reads the fee recipient of each block from the state of its parent block,
+// e.g. from a fee vault config contract, so devnets mirror chains where the fee recipient is governed on-chain.
+// The fee recipient is read from the storage slot if Slot is set, and else returned by a call with Data.
+type FeeRecipientSource struct {
+	Contract common.Address `json:"contract"`
+	// Slot is the storage slot that holds the fee recipient, left-padded like Solidity stores an address.
+	Slot *common.Hash `json:"slot,omitempty"`
+	// Data is the calldata of a view function that returns the fee recipient, e.g. the selector of recipient().
+	Data hexutil.Bytes `json:"data,omitempty"`
+}
+
+func (s *FeeRecipientSource) String() string {
+	if s == nil {
+		return "none"
+	}
+	if s.Slot != nil {
+		return fmt.Sprintf("slot %s of %s", *s.Slot, s.Contract)
+	}
+	return fmt.Sprintf("call %s of %s", s.Data, s.Contract)
+}
+
+// FeeRecipient reads the fee recipient from the state of the given parent block, through the engine eth RPC.
+func (s *FeeRecipientSource) FeeRecipient(ctx context.Context, client client.RPC, parent common.Hash) (common.Address, error) {
+	at := rpc.BlockNumberOrHashWithHash(parent, false)
+	var out hexutil.Bytes
+	if s.Slot != nil {
+		var value common.Hash
+		if err := client.CallContext(ctx, &value, "eth_getStorageAt", s.Contract, *s.Slot, at); err != nil {
+			return common.Address{}, fmt.Errorf("failed to read fee recipient slot %s of %s: %w", *s.Slot, s.Contract, err)
+		}
+		out = value[:]
+	} else {
+		call := map[string]any{"to": s.Contract, "data": s.Data}
+		if err := client.CallContext(ctx, &out, "eth_call", call, at); err != nil {
+			return common.Address{}, fmt.Errorf("failed to call %s for the fee recipient: %w", s.Contract, err)
+		}
+	}
+	if len(out) < common.HashLength {
+		return common.Address{}, fmt.Errorf("fee recipient of %s is %d bytes, not an ABI-encoded address", s.Contract, len(out))
+	}
+	word := common.BytesToHash(out[:common.HashLength])
+	if common.BytesToHash(word[:common.HashLength-common.AddressLength]) != (common.Hash{}) {
+		return common.Address{}, fmt.Errorf("fee recipient of %s is not an address: %s", s.Contract, word)
+	}
+	return common.BytesToAddress(word[:]), nil
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+func TestFeeRecipientSource(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	recipient := common.Address{19: 0xfe}
+	contract := common.Address{0: 0xc}
+	state := &stateReader{RPC: cl, value: common.BytesToHash(recipient[:])}
+
+	slot := common.Hash{31: 1}
+	for _, src := range []*FeeRecipientSource{
+		{Contract: contract, Slot: &slot},
+		{Contract: contract, Data: hexutil.Bytes{0xde, 0xad, 0xbe, 0xef}},
+	} {
+		status, err := Status(ctx, state)
+		require.NoError(t, err)
+		payload, err := BuildBlock(ctx, state, status, &BlockBuildingSettings{
+			BlockTime:          2,
+			FeeRecipient:       common.Address{1},
+			FeeRecipientSource: src,
+		})
+		require.NoError(t, err)
+		require.Equal(t, recipient, payload.FeeRecipient)
+		require.Equal(t, status.Head.Hash, state.at)
+	}
+
+	state.value = common.Hash{0: 1}
+	_, err = (&FeeRecipientSource{Contract: contract, Slot: &slot}).FeeRecipient(ctx, state, common.Hash{})
+	require.ErrorContains(t, err, "not an address")
+}
+
+// stateReader answers the storage reads and calls of the fee recipient source with a fixed value.
+type stateReader struct {
+	client.RPC
+	value common.Hash
+	at    common.Hash
+}
+
+func (r *stateReader) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	switch method {
+	case "eth_getStorageAt":
+		r.at = *args[2].(rpc.BlockNumberOrHash).BlockHash
+		*result.(*common.Hash) = r.value
+		return nil
+	case "eth_call":
+		r.at = *args[1].(rpc.BlockNumberOrHash).BlockHash
+		*result.(*hexutil.Bytes) = r.value[:]
+		return nil
+	}
+	return r.RPC.CallContext(ctx, result, method, args...)
+}
+
+func TestFeeRecipientSchedulePick(t *testing.T) {
+	a, b, c := common.Address{0: 0xa}, common.Address{0: 0xb}, common.Address{0: 0xc}
+	s := FeeRecipientSchedule{{Address: a, Weight: 2}, {Address: b, Weight: 1}, {Address: c, Weight: 3}}
+	require.NoError(t, s.Check())
+	var picked []common.Address
+	for n := uint64(0); n < 12; n++ {
+		picked = append(picked, s.Pick(n))
+	}
+	// each rotation gives every fee recipient as many blocks in a row as its weight
+	rotation := []common.Address{a, a, b, c, c, c}
+	require.Equal(t, append(rotation, rotation...), picked)
+	require.Equal(t, b, s.Pick(6*1000+2), "the rotation is a function of the block number")
+
+	rr := RoundRobin([]common.Address{a, b})
+	for n, addr := range []common.Address{a, b, a, b} {
+		require.Equal(t, addr, rr.Pick(uint64(n)))
+	}
+
+	max := FeeRecipientSchedule{{Address: a, Weight: math.MaxUint64}}
+	require.NoError(t, max.Check())
+	require.Equal(t, a, max.Pick(math.MaxUint64))
+}
+
+func TestFeeRecipientScheduleCheck(t *testing.T) {
+	a, b := common.Address{0: 0xa}, common.Address{0: 0xb}
+	require.ErrorContains(t, FeeRecipientSchedule{}.Check(), "empty")
+	require.ErrorContains(t, FeeRecipientSchedule{{Address: a, Weight: 1}, {Address: b}}.Check(), "fee recipient 1")
+	// a total weight that wraps around to a small number, or 0, would skew or break the rotation
+	require.ErrorContains(t, FeeRecipientSchedule{{Address: a, Weight: math.MaxUint64}, {Address: b, Weight: 1}}.Check(), "overflows")
+	require.ErrorContains(t, FeeRecipientSchedule{{Address: a, Weight: 1 << 63}, {Address: b, Weight: 1 << 63}}.Check(), "overflows")
+}
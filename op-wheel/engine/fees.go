@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// BlockFees is the fee market of a single block. Fees are in wei.
+type BlockFees struct {
+	Number  uint64 `json:"number"`
+	BaseFee uint64 `json:"baseFee"`
+	// BaseFeeChange is the relative change of the base fee from the parent block, e.g. 0.125 for a 12.5% increase.
+	BaseFeeChange float64 `json:"baseFeeChange"`
+	GasUsed       uint64  `json:"gasUsed"`
+	GasLimit      uint64  `json:"gasLimit"`
+	GasUsedRatio  float64 `json:"gasUsedRatio"`
+	Txs           int     `json:"txs"`
+	// PriorityFees are the effective priority fees per gas that the transactions of the block paid.
+	PriorityFees *Distribution `json:"priorityFees"`
+}
+
+// FeeReport summarizes the fee market of a range of blocks, e.g. to tune the EIP-1559 parameters of a chain.
+type FeeReport struct {
+	First  uint64      `json:"first"`
+	Last   uint64      `json:"last"`
+	Blocks []BlockFees `json:"blocks"`
+	// BaseFee is the distribution of the base fees of the blocks.
+	BaseFee *Distribution `json:"baseFee"`
+	// PriorityFee is the distribution of the effective priority fees per gas of all transactions.
+	PriorityFee *Distribution `json:"priorityFee"`
+	// GasUsedRatio is the mean ratio of gas used to the gas limit of the blocks.
+	GasUsedRatio float64 `json:"gasUsedRatio"`
+}
+
+// Fees reads the last blocks up to the head, and reports how the base fee, priority fees and gas usage developed.
+// Deposit transactions do not pay a priority fee, and are not counted in the priority fees.
+func Fees(ctx context.Context, client client.RPC, last uint64) (*FeeReport, error) {
+	if last == 0 {
+		return nil, fmt.Errorf("no blocks to report")
+	}
+	head, err := getHeader(ctx, client, "eth_getBlockByNumber", "latest")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head: %w", err)
+	}
+	if head == nil {
+		return nil, fmt.Errorf("head not found")
+	}
+	report := &FeeReport{Last: head.Number.Uint64()}
+	if last > report.Last {
+		report.First = 0
+	} else {
+		report.First = report.Last + 1 - last
+	}
+	var parentBaseFee *big.Int
+	if report.First > 0 {
+		parent, err := getHeader(ctx, client, "eth_getBlockByNumber", rpc.BlockNumber(report.First-1).String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", report.First-1, err)
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("block %d not found", report.First-1)
+		}
+		parentBaseFee = parent.BaseFee
+	}
+	var baseFees, allTips []uint64
+	var ratios float64
+	for n := report.First; n <= report.Last; n++ {
+		block, err := getBlock(ctx, client, "eth_getBlockByNumber", rpc.BlockNumber(n).String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", n, err)
+		}
+		fees, tips := blockFees(block, parentBaseFee)
+		allTips = append(allTips, tips...)
+		report.Blocks = append(report.Blocks, fees)
+		baseFees = append(baseFees, fees.BaseFee)
+		ratios += fees.GasUsedRatio
+		parentBaseFee = block.BaseFee()
+	}
+	report.BaseFee = NewDistribution(baseFees)
+	report.PriorityFee = NewDistribution(allTips)
+	report.GasUsedRatio = ratios / float64(len(report.Blocks))
+	return report, nil
+}
+
+// blockFees reports the fee market of the block, and returns the effective priority fees of its transactions.
+func blockFees(block *types.Block, parentBaseFee *big.Int) (BlockFees, []uint64) {
+	fees := BlockFees{
+		Number:   block.NumberU64(),
+		GasUsed:  block.GasUsed(),
+		GasLimit: block.GasLimit(),
+		Txs:      len(block.Transactions()),
+	}
+	if block.GasLimit() > 0 {
+		fees.GasUsedRatio = float64(block.GasUsed()) / float64(block.GasLimit())
+	}
+	baseFee := block.BaseFee()
+	if baseFee != nil {
+		fees.BaseFee = baseFee.Uint64()
+		if parentBaseFee != nil && parentBaseFee.Sign() > 0 {
+			change, _ := new(big.Float).Quo(
+				new(big.Float).SetInt(new(big.Int).Sub(baseFee, parentBaseFee)),
+				new(big.Float).SetInt(parentBaseFee)).Float64()
+			fees.BaseFeeChange = change
+		}
+	}
+	var tips []uint64
+	for _, tx := range block.Transactions() {
+		if tx.IsDepositTx() {
+			continue
+		}
+		if tip, err := tx.EffectiveGasTip(baseFee); err == nil {
+			tips = append(tips, tip.Uint64())
+		}
+	}
+	fees.PriorityFees = NewDistribution(tips)
+	return fees, tips
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFees(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(901))
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+
+	var nonce uint64
+	for i := 0; i < 4; i++ {
+		var txs []hexutil.Bytes
+		for j := 0; j < i; j++ {
+			tx := types.MustSignNewTx(key, signer, &types.DynamicFeeTx{
+				Nonce:     nonce,
+				Gas:       21000,
+				GasTipCap: big.NewInt(int64(j+1) * params.GWei),
+				GasFeeCap: big.NewInt(10 * params.GWei),
+			})
+			nonce++
+			data, err := tx.MarshalBinary()
+			require.NoError(t, err)
+			txs = append(txs, data)
+		}
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		_, err = BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2, Transactions: txs})
+		require.NoError(t, err)
+	}
+
+	report, err := Fees(ctx, cl, 3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), report.First)
+	require.Equal(t, uint64(4), report.Last)
+	require.Len(t, report.Blocks, 3)
+	require.Equal(t, 1, report.Blocks[0].Txs)
+	require.Equal(t, 3, report.Blocks[2].Txs)
+	require.Equal(t, uint64(params.GWei), report.Blocks[2].BaseFee)
+	require.Zero(t, report.Blocks[2].BaseFeeChange)
+	require.Equal(t, uint64(3*params.GWei), report.Blocks[2].PriorityFees.Max)
+	require.Equal(t, 6, report.PriorityFee.Count)
+	require.Equal(t, uint64(params.GWei), report.PriorityFee.Min)
+	require.Equal(t, uint64(10*params.GWei), report.PriorityFee.Total)
+
+	// more blocks than the chain has start at genesis
+	report, err = Fees(ctx, cl, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), report.First)
+	require.Len(t, report.Blocks, 5)
+	require.Equal(t, 0, report.Blocks[1].PriorityFees.Count)
+
+	_, err = Fees(ctx, cl, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// InvalidStatusError is returned when the engine responds with an INVALID payload status,
+// and captures the request that was deemed invalid, for forensics.
+type InvalidStatusError struct {
+	Method     string
+	Status     engine.PayloadStatusV1
+	Forkchoice *engine.ForkchoiceStateV1
+	Payload    *engine.ExecutableData
+}
+
+func (e *InvalidStatusError) Error() string {
+	msg := "<none>"
+	if e.Status.ValidationError != nil {
+		msg = *e.Status.ValidationError
+	}
+	return fmt.Sprintf("engine responded to %s with %s status: %s", e.Method, e.Status.Status, msg)
+}
+
+func isInvalid(status *engine.PayloadStatusV1) bool {
+	return status.Status == string(eth.ExecutionInvalid) || status.Status == string(eth.ExecutionInvalidBlockHash)
+}
+
+// LogRecorder is a log handler that keeps the most recent log lines in memory,
+// so they can be attached to a forensic bundle.
+type LogRecorder struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+}
+
+func NewLogRecorder(capacity int) *LogRecorder {
+	return &LogRecorder{lines: make([][]byte, capacity)}
+}
+
+func (r *LogRecorder) Log(rec *log.Record) error {
+	line := log.LogfmtFormat().Format(rec)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+// Bytes returns the recorded log lines, oldest first.
+func (r *LogRecorder) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []byte
+	if r.full {
+		for _, line := range r.lines[r.next:] {
+			out = append(out, line...)
+		}
+	}
+	for _, line := range r.lines[:r.next] {
+		out = append(out, line...)
+	}
+	return out
+}
+
+var _ log.Handler = (*LogRecorder)(nil)
+
+// WriteForensicBundle assembles a tar.gz bundle in the given directory, with everything needed
+// to report the INVALID status as bug against the engine: the payload, its parent header, the forkchoice state,
+// the engine client version and the recent logs. Information that cannot be retrieved from the engine is skipped.
+// The path of the bundle is returned.
+func WriteForensicBundle(ctx context.Context, client client.RPC, invalid *InvalidStatusError, logs *LogRecorder, dir string) (string, error) {
+	files := make(map[string]any)
+	files["error.json"] = map[string]string{"method": invalid.Method, "error": invalid.Error()}
+	files["status.json"] = invalid.Status
+	if invalid.Forkchoice != nil {
+		files["forkchoice.json"] = invalid.Forkchoice
+	}
+	if invalid.Payload != nil {
+		files["payload.json"] = invalid.Payload
+		var parent *types.Header
+		if err := client.CallContext(ctx, &parent, "eth_getBlockByHash", invalid.Payload.ParentHash, false); err == nil && parent != nil {
+			files["parent_header.json"] = parent
+		}
+	}
+	var version string
+	if err := client.CallContext(ctx, &version, "web3_clientVersion"); err == nil {
+		files["client_version.json"] = version
+	}
+	if status, err := Status(ctx, client); err == nil {
+		files["engine_status.json"] = status
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	writeFile := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: now}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for name, v := range files {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		if err := writeFile(name, data); err != nil {
+			return "", fmt.Errorf("failed to add %s to bundle: %w", name, err)
+		}
+	}
+	if logs != nil {
+		if err := writeFile("wheel.log", logs.Bytes()); err != nil {
+			return "", fmt.Errorf("failed to add logs to bundle: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create forensics dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("invalid-%s-%d.tar.gz", invalid.Method, now.Unix()))
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write forensic bundle: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health tracks the liveness and readiness of Auto block production, for service probes.
+type Health struct {
+	mu sync.Mutex
+
+	livenessTimeout time.Duration
+
+	lastTick time.Time
+	checked  bool
+	lastErr  error
+	stopping bool
+}
+
+// NewHealth creates a Health that reports the block production as not live
+// if its loop made no progress for the liveness timeout.
+func NewHealth(livenessTimeout time.Duration) *Health {
+	return &Health{livenessTimeout: livenessTimeout, lastTick: time.Now()}
+}
+
+// Tick records progress of the block production loop.
+func (h *Health) Tick(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastTick = now
+}
+
+// Record records the outcome of the latest interaction with the engine.
+func (h *Health) Record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checked = true
+	h.lastErr = err
+}
+
+// SetStopping marks the block production as shutting down, so it is no longer ready.
+func (h *Health) SetStopping() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopping = true
+}
+
+// Live returns an error if the block production loop is stuck.
+func (h *Health) Live(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if since := now.Sub(h.lastTick); since > h.livenessTimeout {
+		return fmt.Errorf("no block production progress for %s", since.Truncate(time.Second))
+	}
+	return nil
+}
+
+// Ready returns an error if the block production is not ready:
+// if it is shutting down, has not reached the engine yet, or failed its latest engine interaction.
+func (h *Health) Ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.stopping:
+		return errors.New("shutting down")
+	case !h.checked:
+		return errors.New("engine not checked yet")
+	case h.lastErr != nil:
+		return fmt.Errorf("latest engine interaction failed: %w", h.lastErr)
+	}
+	return nil
+}
+
+// ServeHTTP serves the liveness probe on /healthz, and the readiness probe on /readyz.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.URL.Path {
+	case "/healthz":
+		err = h.Live(time.Now())
+	case "/readyz":
+		err = h.Ready()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	h := NewHealth(time.Minute)
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, probe("/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, probe("/readyz"), "not ready before the engine is checked")
+	require.Equal(t, http.StatusNotFound, probe("/other"))
+
+	h.Record(nil)
+	require.Equal(t, http.StatusOK, probe("/readyz"))
+	h.Record(errors.New("engine down"))
+	require.ErrorContains(t, h.Ready(), "engine down")
+	h.Record(nil)
+	require.NoError(t, h.Ready())
+
+	now := time.Now()
+	h.Tick(now)
+	require.NoError(t, h.Live(now.Add(time.Minute)))
+	require.Error(t, h.Live(now.Add(2*time.Minute)), "stuck loop is not live")
+
+	h.SetStopping()
+	require.ErrorContains(t, h.Ready(), "shutting down")
+	require.Equal(t, http.StatusOK, probe("/healthz"), "still live while stopping")
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// L1OriginSource selects the L1 origin of the next L2 block.
+type L1OriginSource interface {
+	// NextOrigin returns the L1 origin for an L2 block with the given timestamp,
+	// given the L1 origin of the parent L2 block, if any.
+	NextOrigin(ctx context.Context, prev *derive.L1BlockInfo, l2Time uint64) (eth.BlockInfo, error)
+}
+
+// FileL1Origin always uses the same L1 header as origin.
+type FileL1Origin struct {
+	Header *types.Header
+}
+
+// ReadL1OriginFile reads a JSON encoded L1 header, e.g. as returned by eth_getBlockByNumber, to use as L1 origin.
+func ReadL1OriginFile(path string) (*FileL1Origin, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read L1 origin file: %w", err)
+	}
+	var header types.Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode L1 origin header: %w", err)
+	}
+	return &FileL1Origin{Header: &header}, nil
+}
+
+func (s *FileL1Origin) NextOrigin(ctx context.Context, prev *derive.L1BlockInfo, l2Time uint64) (eth.BlockInfo, error) {
+	return eth.HeaderBlockInfo(s.Header), nil
+}
+
+// RPCL1Origin follows the L1 chain of an L1 RPC: like the op-node sequencer,
+// the origin advances to the next L1 block as soon as the L2 timestamp has passed it.
+type RPCL1Origin struct {
+	Client client.RPC
+}
+
+func (s *RPCL1Origin) NextOrigin(ctx context.Context, prev *derive.L1BlockInfo, l2Time uint64) (eth.BlockInfo, error) {
+	if prev == nil {
+		header, err := getHeader(ctx, s.Client, "eth_getBlockByNumber", "latest")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get latest L1 block: %w", err)
+		}
+		if header.Time > l2Time {
+			return nil, fmt.Errorf("latest L1 block %d with time %d is ahead of L2 time %d", header.Number, header.Time, l2Time)
+		}
+		return eth.HeaderBlockInfo(header), nil
+	}
+	next, err := getHeader(ctx, s.Client, "eth_getBlockByNumber", hexutil.Uint64(prev.Number+1).String())
+	if err == nil && next != nil && next.ParentHash == prev.BlockHash && next.Time <= l2Time {
+		return eth.HeaderBlockInfo(next), nil
+	}
+	current, err := getHeader(ctx, s.Client, "eth_getBlockByHash", prev.BlockHash.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current L1 origin %d: %w", prev.Number, err)
+	}
+	if current == nil {
+		return nil, fmt.Errorf("current L1 origin %s is not known by L1 RPC, was it reorged out?", prev.BlockHash)
+	}
+	return eth.HeaderBlockInfo(current), nil
+}
+
+// L1OriginSettings configure the L1 info deposit of OP Stack L2 blocks.
+type L1OriginSettings struct {
+	Source L1OriginSource
+	Rollup *rollup.Config
+}
+
+// l1InfoTx creates the L1 info deposit transaction of the next L2 block,
+// continuing the epoch and sequence number of the L1 info of the head block, and returns its L1 origin.
+// User deposits of a new L1 origin are not included.
+func (s *L1OriginSettings) l1InfoTx(ctx context.Context, client client.RPC, status *StatusData, l2Time uint64) (hexutil.Bytes, eth.BlockInfo, error) {
+	head, err := getBlock(ctx, client, "eth_getBlockByHash", status.Head.Hash.Hex())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get head block: %w", err)
+	}
+	var prev *derive.L1BlockInfo
+	if txs := head.Transactions(); len(txs) > 0 && txs[0].Type() == types.DepositTxType {
+		info, err := derive.L1InfoDepositTxData(txs[0].Data())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode L1 info of head block: %w", err)
+		}
+		prev = &info
+	}
+	origin, err := s.Source.NextOrigin(ctx, prev, l2Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	seqNumber := uint64(0)
+	if prev != nil && prev.BlockHash == origin.Hash() {
+		seqNumber = prev.SequenceNumber + 1
+	}
+	data, err := derive.L1InfoDepositBytes(seqNumber, origin, s.Rollup.Genesis.SystemConfig, s.Rollup.IsRegolith(l2Time))
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, origin, nil
+}
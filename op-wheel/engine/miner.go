@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// SetMinPriorityFee sets the minimum priority fee of the transactions that the engine includes from its tx pool
+// when building blocks, with the miner API, so low-tip spam cannot crowd out test transactions.
+// The payload attributes have no tip controls, so this is configured on the engine itself, and applies until it restarts.
+func SetMinPriorityFee(ctx context.Context, client client.RPC, fee *big.Int) error {
+	var ok bool
+	if err := client.CallContext(ctx, &ok, "miner_setGasPrice", (*hexutil.Big)(fee)); err != nil {
+		return fmt.Errorf("failed to set minimum priority fee, is the miner API enabled?: %w", err)
+	}
+	if !ok {
+		return errors.New("engine rejected the minimum priority fee")
+	}
+	return nil
+}
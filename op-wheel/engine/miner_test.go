@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// mockMinerAPI serves miner_setGasPrice, like geth, and records the set price.
+type mockMinerAPI struct {
+	price  *big.Int
+	reject bool
+}
+
+func (api *mockMinerAPI) SetGasPrice(price hexutil.Big) bool {
+	if api.reject {
+		return false
+	}
+	api.price = price.ToInt()
+	return true
+}
+
+func TestSetMinPriorityFee(t *testing.T) {
+	ctx := context.Background()
+	miner := &mockMinerAPI{}
+	srv := rpc.NewServer()
+	require.NoError(t, srv.RegisterName("miner", miner))
+	cl := client.NewBaseRPCClient(rpc.DialInProc(srv))
+
+	require.NoError(t, SetMinPriorityFee(ctx, cl, big.NewInt(1_000_000_000)))
+	require.Equal(t, big.NewInt(1_000_000_000), miner.price)
+
+	miner.reject = true
+	require.ErrorContains(t, SetMinPriorityFee(ctx, cl, big.NewInt(2)), "engine rejected the minimum priority fee")
+
+	// an engine without the miner API
+	mock := NewMockEngine(MockEngineConfig{})
+	engineClient, err := mock.Client()
+	require.NoError(t, err)
+	require.ErrorContains(t, SetMinPriorityFee(ctx, engineClient, big.NewInt(2)), "is the miner API enabled?")
+}
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// MockEngineConfig configures the behavior of a MockEngine.
+type MockEngineConfig struct {
+	ChainID *big.Int
+	// Delay is the time every Engine API call takes before it responds.
+	Delay time.Duration
+	// InvalidEvery makes every n-th new payload INVALID, if not zero.
+	InvalidEvery uint64
+}
+
+// MockEngine is an in-memory Engine API server, to test op-wheel and other Engine API tools without a real engine.
+// It implements engine_forkchoiceUpdatedV2, engine_getPayloadV2 and engine_newPayloadV2,
+// and the eth_chainId, eth_getBlockByNumber and eth_getBlockByHash methods that op-wheel reads the chain with.
+// Transactions are included in the blocks it builds, but not executed: the state root never changes.
+type MockEngine struct {
+	cfg MockEngineConfig
+
+	mu        sync.Mutex
+	blocks    map[common.Hash]*types.Block
+	canonical []common.Hash
+	head      common.Hash
+	safe      common.Hash
+	finalized common.Hash
+
+	payloads      map[engine.PayloadID]*types.Block
+	nextPayloadID uint64
+	newPayloads   uint64
+}
+
+// NewMockEngine creates a MockEngine with only a genesis block.
+func NewMockEngine(cfg MockEngineConfig) *MockEngine {
+	if cfg.ChainID == nil {
+		cfg.ChainID = big.NewInt(901)
+	}
+	genesis := types.NewBlockWithWithdrawals(&types.Header{
+		Difficulty: common.Big0,
+		Number:     common.Big0,
+		GasLimit:   30_000_000,
+		BaseFee:    big.NewInt(params.GWei),
+		Root:       types.EmptyRootHash,
+		UncleHash:  types.EmptyUncleHash,
+	}, nil, nil, nil, []*types.Withdrawal{}, trie.NewStackTrie(nil))
+	return &MockEngine{
+		cfg:       cfg,
+		blocks:    map[common.Hash]*types.Block{genesis.Hash(): genesis},
+		canonical: []common.Hash{genesis.Hash()},
+		head:      genesis.Hash(),
+		safe:      genesis.Hash(),
+		finalized: genesis.Hash(),
+		payloads:  make(map[engine.PayloadID]*types.Block),
+	}
+}
+
+// Server creates an RPC server that serves the mock engine.
+func (m *MockEngine) Server() (*rpc.Server, error) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("engine", &mockEngineAPI{m}); err != nil {
+		return nil, fmt.Errorf("failed to register engine API: %w", err)
+	}
+	if err := srv.RegisterName("eth", &mockEthAPI{m}); err != nil {
+		return nil, fmt.Errorf("failed to register eth API: %w", err)
+	}
+	return srv, nil
+}
+
+// Client creates an in-process client of the mock engine, to use it in tests.
+func (m *MockEngine) Client() (client.RPC, error) {
+	srv, err := m.Server()
+	if err != nil {
+		return nil, err
+	}
+	return client.NewBaseRPCClient(rpc.DialInProc(srv)), nil
+}
+
+// Head returns the current head block of the mock engine.
+func (m *MockEngine) Head() *types.Block {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blocks[m.head]
+}
+
+func (m *MockEngine) delay(ctx context.Context) error {
+	return wait(ctx, m.cfg.Delay)
+}
+
+// setCanonical makes the given known block the head of the canonical chain. The lock must be held.
+func (m *MockEngine) setCanonical(head *types.Block) {
+	number := head.NumberU64()
+	if uint64(len(m.canonical)) > number+1 {
+		m.canonical = m.canonical[:number+1]
+	}
+	for uint64(len(m.canonical)) <= number {
+		m.canonical = append(m.canonical, common.Hash{})
+	}
+	for b := head; b != nil && m.canonical[b.NumberU64()] != b.Hash(); b = m.blocks[b.ParentHash()] {
+		m.canonical[b.NumberU64()] = b.Hash()
+	}
+	m.head = head.Hash()
+}
+
+func (m *MockEngine) blockByNumber(tag rpc.BlockNumber) *types.Block {
+	switch tag {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		return m.blocks[m.head]
+	case rpc.SafeBlockNumber:
+		return m.blocks[m.safe]
+	case rpc.FinalizedBlockNumber:
+		return m.blocks[m.finalized]
+	case rpc.EarliestBlockNumber:
+		return m.blocks[m.canonical[0]]
+	}
+	if tag < 0 || int64(tag) >= int64(len(m.canonical)) {
+		return nil
+	}
+	return m.blocks[m.canonical[tag]]
+}
+
+func (m *MockEngine) buildBlock(parent *types.Block, attrs *engine.PayloadAttributes) (*types.Block, error) {
+	if attrs.Timestamp <= parent.Time() {
+		return nil, fmt.Errorf("timestamp %d is not after parent timestamp %d", attrs.Timestamp, parent.Time())
+	}
+	txs := make([]*types.Transaction, len(attrs.Transactions))
+	for i, data := range attrs.Transactions {
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("failed to decode transaction %d: %w", i, err)
+		}
+		txs[i] = &tx
+	}
+	gasLimit := parent.GasLimit()
+	if attrs.GasLimit != nil {
+		gasLimit = *attrs.GasLimit
+	}
+	withdrawals := attrs.Withdrawals
+	if withdrawals == nil {
+		withdrawals = []*types.Withdrawal{}
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Coinbase:   attrs.SuggestedFeeRecipient,
+		Root:       parent.Root(),
+		Difficulty: common.Big0,
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   gasLimit,
+		Time:       attrs.Timestamp,
+		MixDigest:  attrs.Random,
+		BaseFee:    parent.BaseFee(),
+	}
+	return types.NewBlockWithWithdrawals(header, txs, nil, nil, withdrawals, trie.NewStackTrie(nil)), nil
+}
+
+type mockEngineAPI struct {
+	m *MockEngine
+}
+
+func (api *mockEngineAPI) ForkchoiceUpdatedV2(ctx context.Context, fc engine.ForkchoiceStateV1, attrs *engine.PayloadAttributes) (engine.ForkChoiceResponse, error) {
+	m := api.m
+	if err := m.delay(ctx); err != nil {
+		return engine.STATUS_SYNCING, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	head, ok := m.blocks[fc.HeadBlockHash]
+	if !ok {
+		return engine.STATUS_SYNCING, nil
+	}
+	for _, h := range []common.Hash{fc.SafeBlockHash, fc.FinalizedBlockHash} {
+		if _, ok := m.blocks[h]; !ok && h != (common.Hash{}) {
+			return engine.STATUS_INVALID, engine.InvalidForkChoiceState.With(fmt.Errorf("unknown block %s", h))
+		}
+	}
+	m.setCanonical(head)
+	if fc.SafeBlockHash != (common.Hash{}) {
+		m.safe = fc.SafeBlockHash
+	}
+	if fc.FinalizedBlockHash != (common.Hash{}) {
+		m.finalized = fc.FinalizedBlockHash
+	}
+	headHash := head.Hash()
+	resp := engine.ForkChoiceResponse{
+		PayloadStatus: engine.PayloadStatusV1{Status: engine.VALID, LatestValidHash: &headHash},
+	}
+	if attrs != nil {
+		block, err := m.buildBlock(head, attrs)
+		if err != nil {
+			return engine.STATUS_INVALID, engine.InvalidPayloadAttributes.With(err)
+		}
+		m.nextPayloadID++
+		var id engine.PayloadID
+		new(big.Int).SetUint64(m.nextPayloadID).FillBytes(id[:])
+		m.payloads[id] = block
+		resp.PayloadID = &id
+	}
+	return resp, nil
+}
+
+func (api *mockEngineAPI) GetPayloadV2(ctx context.Context, id engine.PayloadID) (*engine.ExecutionPayloadEnvelope, error) {
+	m := api.m
+	if err := m.delay(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	block, ok := m.payloads[id]
+	if !ok {
+		return nil, engine.UnknownPayload
+	}
+	return engine.BlockToExecutableData(block, new(big.Int)), nil
+}
+
+func (api *mockEngineAPI) NewPayloadV2(ctx context.Context, payload engine.ExecutableData) (engine.PayloadStatusV1, error) {
+	m := api.m
+	if err := m.delay(ctx); err != nil {
+		return engine.PayloadStatusV1{Status: engine.SYNCING}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.newPayloads++
+	block, err := engine.ExecutableDataToBlock(payload)
+	if err != nil {
+		msg := err.Error()
+		return engine.PayloadStatusV1{Status: engine.INVALID, ValidationError: &msg}, nil
+	}
+	hash := block.Hash()
+	if _, ok := m.blocks[hash]; ok {
+		return engine.PayloadStatusV1{Status: engine.VALID, LatestValidHash: &hash}, nil
+	}
+	parent := block.ParentHash()
+	if _, ok := m.blocks[parent]; !ok {
+		return engine.PayloadStatusV1{Status: engine.SYNCING}, nil
+	}
+	if m.cfg.InvalidEvery != 0 && m.newPayloads%m.cfg.InvalidEvery == 0 {
+		msg := fmt.Sprintf("mock engine rejects new payload %d, as configured to reject every %d payloads", m.newPayloads, m.cfg.InvalidEvery)
+		return engine.PayloadStatusV1{Status: engine.INVALID, LatestValidHash: &parent, ValidationError: &msg}, nil
+	}
+	m.blocks[hash] = block
+	return engine.PayloadStatusV1{Status: engine.VALID, LatestValidHash: &hash}, nil
+}
+
+type mockEthAPI struct {
+	m *MockEngine
+}
+
+func (api *mockEthAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(api.m.cfg.ChainID)
+}
+
+func (api *mockEthAPI) GetBlockByNumber(tag rpc.BlockNumber, fullTx bool) (map[string]any, error) {
+	api.m.mu.Lock()
+	defer api.m.mu.Unlock()
+	return rpcMarshalBlock(api.m.blockByNumber(tag), fullTx)
+}
+
+func (api *mockEthAPI) GetBlockByHash(hash common.Hash, fullTx bool) (map[string]any, error) {
+	api.m.mu.Lock()
+	defer api.m.mu.Unlock()
+	return rpcMarshalBlock(api.m.blocks[hash], fullTx)
+}
+
+// rpcMarshalBlock encodes the block like the eth_getBlockBy* methods, or returns nil if there is no block.
+func rpcMarshalBlock(block *types.Block, fullTx bool) (map[string]any, error) {
+	if block == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(block.Header())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode header fields: %w", err)
+	}
+	if fullTx {
+		fields["transactions"] = block.Transactions()
+	} else {
+		hashes := make([]common.Hash, len(block.Transactions()))
+		for i, tx := range block.Transactions() {
+			hashes[i] = tx.Hash()
+		}
+		fields["transactions"] = hashes
+	}
+	fields["withdrawals"] = block.Withdrawals()
+	fields["size"] = hexutil.Uint64(block.Size())
+	return fields, nil
+}
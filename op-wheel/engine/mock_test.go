@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockEngineBuildBlock(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+
+	settings := &BlockBuildingSettings{BlockTime: 2, FeeRecipient: common.Address{0: 0xf}}
+	for i := uint64(1); i <= 3; i++ {
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		payload, err := BuildBlock(ctx, cl, status, settings)
+		require.NoError(t, err)
+		require.Equal(t, i, payload.Number)
+		require.Equal(t, status.Head.Time+2, payload.Timestamp)
+		require.Equal(t, payload.BlockHash, mock.Head().Hash())
+	}
+}
+
+func TestMockEngineInvalidEvery(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{InvalidEvery: 2})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+
+	settings := &BlockBuildingSettings{BlockTime: 2}
+	status, err := Status(ctx, cl)
+	require.NoError(t, err)
+	_, err = BuildBlock(ctx, cl, status, settings)
+	require.NoError(t, err)
+
+	status, err = Status(ctx, cl)
+	require.NoError(t, err)
+	_, err = BuildBlock(ctx, cl, status, settings)
+	var invalidErr *InvalidStatusError
+	require.True(t, errors.As(err, &invalidErr))
+	require.Equal(t, engine.INVALID, invalidErr.Status.Status)
+	require.Equal(t, status.Head.Hash, *invalidErr.Status.LatestValidHash)
+	require.Equal(t, status.Head.Hash, mock.Head().Hash(), "invalid payload must not become the head")
+}
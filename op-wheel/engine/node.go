@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// NodeDiagnostics correlates the forkchoice state of the engine with the sync status of the op-node that drives it.
+type NodeDiagnostics struct {
+	Engine *StatusData     `json:"engine"`
+	Node   *eth.SyncStatus `json:"node"`
+	// Summary is a one-line overview, e.g. "engine head 10 vs node unsafe 10, safe 8 vs 8, finalized 4 vs 4".
+	Summary string `json:"summary"`
+	// Issues lists the inconsistencies between the engine and the op-node, if any.
+	Issues []string `json:"issues"`
+}
+
+// DiagnoseNode compares the engine forkchoice state with the op-node sync status.
+// The engine status is fetched first, so a progressing chain may show the op-node slightly ahead.
+func DiagnoseNode(ctx context.Context, engineClient client.RPC, nodeClient client.RPC) (*NodeDiagnostics, error) {
+	status, err := Status(ctx, engineClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get engine status: %w", err)
+	}
+	var syncStatus eth.SyncStatus
+	if err := nodeClient.CallContext(ctx, &syncStatus, "optimism_syncStatus"); err != nil {
+		return nil, fmt.Errorf("failed to get op-node sync status: %w", err)
+	}
+	d := &NodeDiagnostics{
+		Engine: status,
+		Node:   &syncStatus,
+		Summary: fmt.Sprintf("engine head %d vs node unsafe %d, safe %d vs %d, finalized %d vs %d",
+			status.Head.Number, syncStatus.UnsafeL2.Number, status.Safe.Number, syncStatus.SafeL2.Number,
+			status.Finalized.Number, syncStatus.FinalizedL2.Number),
+		Issues: []string{},
+	}
+	compare := func(label string, engineRef eth.L1BlockRef, nodeRef eth.L2BlockRef) {
+		switch {
+		case engineRef.Number == nodeRef.Number && engineRef.Hash != nodeRef.Hash:
+			d.Issues = append(d.Issues, fmt.Sprintf("%s block %d differs: engine %s, node %s", label, engineRef.Number, engineRef.Hash, nodeRef.Hash))
+		case engineRef.Number < nodeRef.Number:
+			d.Issues = append(d.Issues, fmt.Sprintf("engine %s block %d is behind node %s block %d", label, engineRef.Number, label, nodeRef.Number))
+		case engineRef.Number > nodeRef.Number:
+			d.Issues = append(d.Issues, fmt.Sprintf("engine %s block %d is ahead of node %s block %d", label, engineRef.Number, label, nodeRef.Number))
+		}
+	}
+	compare("unsafe", status.Head, syncStatus.UnsafeL2)
+	compare("safe", status.Safe, syncStatus.SafeL2)
+	compare("finalized", status.Finalized, syncStatus.FinalizedL2)
+	if target := syncStatus.EngineSyncTarget; target.Number > syncStatus.UnsafeL2.Number {
+		d.Issues = append(d.Issues, fmt.Sprintf("engine is syncing to block %d, ahead of node unsafe block %d", target.Number, syncStatus.UnsafeL2.Number))
+	}
+	if syncStatus.CurrentL1.Number+10 < syncStatus.HeadL1.Number {
+		d.Issues = append(d.Issues, fmt.Sprintf("node L1 derivation at block %d lags behind L1 head %d", syncStatus.CurrentL1.Number, syncStatus.HeadL1.Number))
+	}
+	return d, nil
+}
+
+// NodeOutput is an op-node output, checked against the block of the engine at the same height.
+type NodeOutput struct {
+	Output          *eth.OutputResponse `json:"output"`
+	EngineBlockHash common.Hash         `json:"engineBlockHash"`
+	EngineStateRoot common.Hash         `json:"engineStateRoot"`
+	Issues          []string            `json:"issues"`
+}
+
+// CheckNodeOutput fetches the output of the op-node at the given block number,
+// and checks that it commits to the block of the engine.
+func CheckNodeOutput(ctx context.Context, engineClient client.RPC, nodeClient client.RPC, number uint64) (*NodeOutput, error) {
+	var output eth.OutputResponse
+	if err := nodeClient.CallContext(ctx, &output, "optimism_outputAtBlock", hexutil.Uint64(number)); err != nil {
+		return nil, fmt.Errorf("failed to get op-node output at block %d: %w", number, err)
+	}
+	header, err := getHeader(ctx, engineClient, "eth_getBlockByNumber", hexutil.Uint64(number).String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get engine block %d: %w", number, err)
+	}
+	out := &NodeOutput{Output: &output, EngineBlockHash: header.Hash(), EngineStateRoot: header.Root, Issues: []string{}}
+	if output.BlockRef.Hash != out.EngineBlockHash {
+		out.Issues = append(out.Issues, fmt.Sprintf("output block %s differs from engine block %s", output.BlockRef.Hash, out.EngineBlockHash))
+	}
+	if output.StateRoot != out.EngineStateRoot {
+		out.Issues = append(out.Issues, fmt.Sprintf("output state root %s differs from engine state root %s", output.StateRoot, out.EngineStateRoot))
+	}
+	expected := eth.OutputRoot(&eth.OutputV0{
+		StateRoot:                eth.Bytes32(output.StateRoot),
+		MessagePasserStorageRoot: eth.Bytes32(output.WithdrawalStorageRoot),
+		BlockHash:                output.BlockRef.Hash,
+	})
+	if output.OutputRoot != expected {
+		out.Issues = append(out.Issues, fmt.Sprintf("output root %s does not match the output contents, expected %s", output.OutputRoot, expected))
+	}
+	return out, nil
+}
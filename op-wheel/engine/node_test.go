@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// nodeRPC serves the op-node methods of the node diagnostics.
+type nodeRPC struct {
+	client.RPC
+	syncStatus *eth.SyncStatus
+	outputs    map[uint64]*eth.OutputResponse
+}
+
+func (r *nodeRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	var res any
+	switch method {
+	case "optimism_syncStatus":
+		res = r.syncStatus
+	case "optimism_outputAtBlock":
+		out, ok := r.outputs[uint64(args[0].(hexutil.Uint64))]
+		if !ok {
+			return fmt.Errorf("no output at block %d", args[0])
+		}
+		res = out
+	default:
+		return fmt.Errorf("unexpected method %q", method)
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// newNodeTestEngine builds a few blocks on a mock engine, and returns its client with the engine status.
+func newNodeTestEngine(t *testing.T) (client.RPC, *StatusData) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		status, err := Status(ctx, cl)
+		require.NoError(t, err)
+		_, err = BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2})
+		require.NoError(t, err)
+	}
+	status, err := Status(ctx, cl)
+	require.NoError(t, err)
+	return cl, status
+}
+
+func l2Ref(ref eth.L1BlockRef) eth.L2BlockRef {
+	return eth.L2BlockRef{Hash: ref.Hash, Number: ref.Number, ParentHash: ref.ParentHash, Time: ref.Time}
+}
+
+func TestDiagnoseNode(t *testing.T) {
+	ctx := context.Background()
+	cl, status := newNodeTestEngine(t)
+	synced := func() *eth.SyncStatus {
+		return &eth.SyncStatus{
+			UnsafeL2:    l2Ref(status.Head),
+			SafeL2:      l2Ref(status.Safe),
+			FinalizedL2: l2Ref(status.Finalized),
+		}
+	}
+
+	t.Run("in sync", func(t *testing.T) {
+		d, err := DiagnoseNode(ctx, cl, &nodeRPC{syncStatus: synced()})
+		require.NoError(t, err)
+		require.Empty(t, d.Issues)
+		require.Equal(t, fmt.Sprintf("engine head %d vs node unsafe %d, safe %d vs %d, finalized %d vs %d",
+			status.Head.Number, status.Head.Number, status.Safe.Number, status.Safe.Number,
+			status.Finalized.Number, status.Finalized.Number), d.Summary)
+	})
+
+	t.Run("inconsistent", func(t *testing.T) {
+		s := synced()
+		s.UnsafeL2.Hash = common.Hash{0: 0xaa}
+		s.SafeL2.Number = status.Safe.Number + 1
+		s.EngineSyncTarget = eth.L2BlockRef{Number: status.Head.Number + 5}
+		s.CurrentL1.Number, s.HeadL1.Number = 100, 200
+		d, err := DiagnoseNode(ctx, cl, &nodeRPC{syncStatus: s})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			fmt.Sprintf("unsafe block %d differs: engine %s, node %s", status.Head.Number, status.Head.Hash, s.UnsafeL2.Hash),
+			fmt.Sprintf("engine safe block %d is behind node safe block %d", status.Safe.Number, s.SafeL2.Number),
+			fmt.Sprintf("engine is syncing to block %d, ahead of node unsafe block %d", status.Head.Number+5, status.Head.Number),
+			"node L1 derivation at block 100 lags behind L1 head 200",
+		}, d.Issues)
+	})
+
+	t.Run("ahead", func(t *testing.T) {
+		s := synced()
+		s.UnsafeL2 = l2Ref(status.Finalized)
+		d, err := DiagnoseNode(ctx, cl, &nodeRPC{syncStatus: s})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			fmt.Sprintf("engine unsafe block %d is ahead of node unsafe block %d", status.Head.Number, status.Finalized.Number),
+		}, d.Issues)
+	})
+}
+
+func TestCheckNodeOutput(t *testing.T) {
+	ctx := context.Background()
+	cl, status := newNodeTestEngine(t)
+	number := status.Head.Number
+	validOutput := func() *eth.OutputResponse {
+		out := &eth.OutputResponse{
+			BlockRef:              l2Ref(status.Head),
+			StateRoot:             status.StateRoot,
+			WithdrawalStorageRoot: common.Hash{0: 0x11},
+		}
+		out.OutputRoot = eth.OutputRoot(&eth.OutputV0{
+			StateRoot:                eth.Bytes32(out.StateRoot),
+			MessagePasserStorageRoot: eth.Bytes32(out.WithdrawalStorageRoot),
+			BlockHash:                out.BlockRef.Hash,
+		})
+		return out
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		node := &nodeRPC{outputs: map[uint64]*eth.OutputResponse{number: validOutput()}}
+		out, err := CheckNodeOutput(ctx, cl, node, number)
+		require.NoError(t, err)
+		require.Equal(t, status.Head.Hash, out.EngineBlockHash)
+		require.Equal(t, status.StateRoot, out.EngineStateRoot)
+		require.Empty(t, out.Issues)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		bad := validOutput()
+		bad.StateRoot = common.Hash{0: 0x22}
+		node := &nodeRPC{outputs: map[uint64]*eth.OutputResponse{number: bad}}
+		out, err := CheckNodeOutput(ctx, cl, node, number)
+		require.NoError(t, err)
+		require.Len(t, out.Issues, 2)
+		require.Contains(t, out.Issues[0], "output state root")
+		require.Contains(t, out.Issues[1], "does not match the output contents")
+	})
+
+	t.Run("unknown block", func(t *testing.T) {
+		node := &nodeRPC{outputs: map[uint64]*eth.OutputResponse{}}
+		_, err := CheckNodeOutput(ctx, cl, node, number)
+		require.ErrorContains(t, err, "failed to get op-node output")
+	})
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// readProxyAPI serves the read-only eth methods to read blocks,
+// by forwarding them over the authenticated engine connection.
+type readProxyAPI struct {
+	client client.RPC
+}
+
+func (api *readProxyAPI) ChainId(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := api.client.CallContext(ctx, &out, "eth_chainId")
+	return out, err
+}
+
+func (api *readProxyAPI) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
+	header, err := getHeader(ctx, api.client, "eth_getBlockByNumber", "latest")
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, fmt.Errorf("latest block not found")
+	}
+	return hexutil.Uint64(header.Number.Uint64()), nil
+}
+
+func (api *readProxyAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := api.client.CallContext(ctx, &out, "eth_getBlockByNumber", number.String(), fullTx)
+	return out, err
+}
+
+func (api *readProxyAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := api.client.CallContext(ctx, &out, "eth_getBlockByHash", hash, fullTx)
+	return out, err
+}
+
+// NewReadProxy creates an unauthenticated RPC server that serves read access to the blocks of the engine:
+// eth_chainId, eth_blockNumber, eth_getBlockByNumber and eth_getBlockByHash.
+// All other methods, including the engine API, are not available through the proxy.
+func NewReadProxy(client client.RPC) (*rpc.Server, error) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", &readProxyAPI{client}); err != nil {
+		return nil, fmt.Errorf("failed to register eth API: %w", err)
+	}
+	return srv, nil
+}
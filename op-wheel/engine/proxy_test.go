@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+func TestReadProxy(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	cl, err := mock.Client()
+	require.NoError(t, err)
+	status, err := Status(ctx, cl)
+	require.NoError(t, err)
+	payload, err := BuildBlock(ctx, cl, status, &BlockBuildingSettings{BlockTime: 2})
+	require.NoError(t, err)
+
+	srv, err := NewReadProxy(cl)
+	require.NoError(t, err)
+	proxy := client.NewBaseRPCClient(rpc.DialInProc(srv))
+
+	var number hexutil.Uint64
+	require.NoError(t, proxy.CallContext(ctx, &number, "eth_blockNumber"))
+	require.Equal(t, hexutil.Uint64(1), number)
+	byNumber, err := getHeader(ctx, proxy, "eth_getBlockByNumber", "0x1")
+	require.NoError(t, err)
+	require.Equal(t, payload.BlockHash, byNumber.Hash())
+	byHash, err := getHeader(ctx, proxy, "eth_getBlockByHash", payload.BlockHash.Hex())
+	require.NoError(t, err)
+	require.Equal(t, payload.BlockHash, byHash.Hash())
+
+	var out any
+	require.ErrorContains(t, proxy.CallContext(ctx, &out, "engine_forkchoiceUpdatedV2", nil, nil), "does not exist")
+}
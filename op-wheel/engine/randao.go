@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// L1Randao takes the prevRandao of built blocks from an L1 chain, like OP Stack L2 blocks in production,
+// for contracts that consume the randomness.
+type L1Randao struct {
+	Client client.RPC
+	// Endpoint is the RPC endpoint of the client, persisted in the AutoState to restore the randao source.
+	Endpoint string
+}
+
+// Randao returns the prevRandao of the L1 origin of the block, if any, or else of the latest L1 block.
+func (r *L1Randao) Randao(ctx context.Context, origin eth.BlockInfo) (common.Hash, error) {
+	if origin != nil {
+		return origin.MixDigest(), nil
+	}
+	header, err := getHeader(ctx, r.Client, "eth_getBlockByNumber", "latest")
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get latest L1 block for prevRandao: %w", err)
+	}
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("randao source has no latest block")
+	}
+	return header.MixDigest, nil
+}
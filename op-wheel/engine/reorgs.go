@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// Reorg is a change of the head to a block that does not build on the previous head.
+type Reorg struct {
+	Time time.Time `json:"time"`
+	// Depth is the number of blocks of the old chain that are no longer canonical.
+	Depth    uint64         `json:"depth"`
+	OldHead  eth.L1BlockRef `json:"oldHead"`
+	NewHead  eth.L1BlockRef `json:"newHead"`
+	Ancestor eth.L1BlockRef `json:"ancestor"`
+	// Old and New are the blocks of the old and new branch after the common ancestor, in ascending order.
+	// New is empty if the head was rewound.
+	Old []eth.L1BlockRef `json:"old"`
+	New []eth.L1BlockRef `json:"new"`
+}
+
+// findReorg walks back the previous and the new head to their common ancestor.
+// It returns nil if the new head builds on the previous head.
+// The walk fails if the common ancestor is more than maxDepth blocks behind either head.
+func findReorg(ctx context.Context, client client.RPC, prev, head eth.L1BlockRef, maxDepth uint64) (*Reorg, error) {
+	var oldBranch, newBranch []eth.L1BlockRef
+	oldRef, newRef := prev, head
+	for oldRef.Hash != newRef.Hash {
+		if uint64(len(oldBranch)) > maxDepth || uint64(len(newBranch)) > maxDepth {
+			return nil, fmt.Errorf("no common ancestor of %s and %s within %d blocks", prev, head, maxDepth)
+		}
+		var err error
+		if oldRef.Number >= newRef.Number {
+			oldBranch = append(oldBranch, oldRef)
+			if oldRef, err = headerRef(ctx, client, oldRef.ParentHash); err != nil {
+				return nil, err
+			}
+		} else {
+			newBranch = append(newBranch, newRef)
+			if newRef, err = headerRef(ctx, client, newRef.ParentHash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(oldBranch) == 0 {
+		return nil, nil
+	}
+	reverse(oldBranch)
+	reverse(newBranch)
+	return &Reorg{
+		Depth:    uint64(len(oldBranch)),
+		OldHead:  prev,
+		NewHead:  head,
+		Ancestor: oldRef,
+		Old:      oldBranch,
+		New:      newBranch,
+	}, nil
+}
+
+func reverse(refs []eth.L1BlockRef) {
+	for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+		refs[i], refs[j] = refs[j], refs[i]
+	}
+}
+
+// WatchReorgs polls the head of the engine at the given interval, and calls onReorg for every reorg.
+// Heads that build on the previous head, also if blocks were skipped in between polls, are not reorgs.
+// Errors to get the head are logged and retried at the next poll, until the context is done.
+// Errors to walk the chain are logged, and the watch continues from the new head.
+func WatchReorgs(ctx context.Context, log log.Logger, client client.RPC, interval time.Duration, maxDepth uint64, onReorg func(r *Reorg) error) error {
+	status, err := Status(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to get engine status: %w", err)
+	}
+	prev := status.Head
+	log.Info("watching for reorgs", "head", prev)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		status, err := Status(ctx, client)
+		if err != nil {
+			log.Warn("failed to get engine status", "err", err)
+			continue
+		}
+		head := status.Head
+		if head.Hash == prev.Hash {
+			continue
+		}
+		reorg, err := findReorg(ctx, client, prev, head, maxDepth)
+		if err != nil {
+			// continue from the new head, to not get stuck on a reorg that is too deep to walk
+			log.Error("failed to check new head for reorg", "prev", prev, "head", head, "err", err)
+		} else if reorg != nil {
+			reorg.Time = time.Now()
+			log.Warn("detected reorg", "depth", reorg.Depth, "old_head", reorg.OldHead, "new_head", reorg.NewHead, "ancestor", reorg.Ancestor)
+			if err := onReorg(reorg); err != nil {
+				return err
+			}
+		} else {
+			log.Debug("new head", "head", head)
+		}
+		prev = head
+	}
+}
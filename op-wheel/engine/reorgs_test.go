@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindReorg(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockEngine(MockEngineConfig{})
+	client, err := mock.Client()
+	require.NoError(t, err)
+	require.NoError(t, buildBlocks(ctx, client, &BlockBuildingSettings{BlockTime: 2}, 3, nil))
+	status, err := Status(ctx, client)
+	require.NoError(t, err)
+	oldHead := status.Head
+	ancestor, err := headerRef(ctx, client, mock.blockByNumber(1).Hash())
+	require.NoError(t, err)
+
+	// build a competing branch on top of block 1
+	require.NoError(t, updateForkchoice(ctx, client, ancestor.Hash, ancestor.Hash, ancestor.Hash))
+	settings := &BlockBuildingSettings{BlockTime: 2, FeeRecipient: common.Address{0: 1}}
+	require.NoError(t, buildBlocks(ctx, client, settings, 3, nil))
+	status, err = Status(ctx, client)
+	require.NoError(t, err)
+	newHead := status.Head
+
+	reorg, err := findReorg(ctx, client, oldHead, newHead, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reorg.Depth)
+	require.Equal(t, ancestor, reorg.Ancestor)
+	require.Len(t, reorg.Old, 2)
+	require.Equal(t, oldHead, reorg.Old[1])
+	require.Equal(t, ancestor.Hash, reorg.Old[0].ParentHash)
+	require.Len(t, reorg.New, 3)
+	require.Equal(t, newHead, reorg.New[2])
+	require.Equal(t, ancestor.Hash, reorg.New[0].ParentHash)
+
+	// a rewind of the head is a reorg without new branch
+	reorg, err = findReorg(ctx, client, newHead, ancestor, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), reorg.Depth)
+	require.Empty(t, reorg.New)
+
+	// extending the chain is not a reorg
+	reorg, err = findReorg(ctx, client, ancestor, newHead, 10)
+	require.NoError(t, err)
+	require.Nil(t, reorg)
+
+	_, err = findReorg(ctx, client, oldHead, newHead, 1)
+	require.ErrorContains(t, err, "no common ancestor")
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxCorpus is a directory of recorded raw transactions to replay, e.g. captured mainnet traffic.
+// Each regular file in the directory is a tx file, see ReadTxFile. The files are replayed in the order of their names,
+// and the transactions in the order of the file, so the replay is deterministic.
+// Files are read when they are reached, so the corpus does not have to fit in memory.
+type TxCorpus struct {
+	files []string
+	// txs are the remaining transactions of the current file.
+	txs []*types.Transaction
+	// Replayed is the number of transactions that were taken from the corpus.
+	Replayed uint64
+}
+
+// OpenTxCorpus lists the tx files of the corpus directory.
+func OpenTxCorpus(dir string) (*TxCorpus, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tx corpus directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("tx corpus directory %s has no files", dir)
+	}
+	sort.Strings(files)
+	return &TxCorpus{files: files}, nil
+}
+
+// Next takes up to n transactions from the corpus, encoded to force them into a block.
+// Fewer transactions are returned once the corpus runs out.
+func (c *TxCorpus) Next(n int) ([]hexutil.Bytes, error) {
+	var out []hexutil.Bytes
+	for len(out) < n {
+		if len(c.txs) == 0 {
+			if len(c.files) == 0 {
+				break
+			}
+			txs, err := ReadTxFile(c.files[0])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tx corpus file %s: %w", c.files[0], err)
+			}
+			c.files, c.txs = c.files[1:], txs
+			continue
+		}
+		data, err := c.txs[0].MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tx %s: %w", c.txs[0].Hash(), err)
+		}
+		out = append(out, data)
+		c.txs = c.txs[1:]
+		c.Replayed += 1
+	}
+	return out, nil
+}
+
+// Done returns true if all transactions of the corpus were taken.
+func (c *TxCorpus) Done() bool {
+	return len(c.txs) == 0 && len(c.files) == 0
+}
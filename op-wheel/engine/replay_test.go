@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoReplay(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	var txs []*types.Transaction
+	dir := t.TempDir()
+	// the file names order the corpus, not the order in which they are written
+	for _, name := range []string{"b.txt", "a.txt"} {
+		var lines []string
+		for i := 0; i < 3; i++ {
+			tx := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: uint64(len(txs)), Gas: 21000, GasPrice: big.NewInt(1)})
+			data, err := tx.MarshalBinary()
+			require.NoError(t, err)
+			lines = append(lines, hexutil.Encode(data))
+			txs = append(txs, tx)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("# recorded\n"+strings.Join(lines, "\n")), 0o644))
+	}
+	txs = append(txs[3:], txs[:3]...)
+
+	corpus, err := OpenTxCorpus(dir)
+	require.NoError(t, err)
+	mock := NewMockEngine(MockEngineConfig{})
+	client, err := mock.Client()
+	require.NoError(t, err)
+	triggers := make(chan *Trigger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- Auto(ctx, NewMetrics("test", prometheus.NewRegistry()), client, log.New(), nil, &BlockBuildingSettings{BlockTime: 2},
+			WithManualTrigger(triggers), WithReplay(corpus, 4))
+	}()
+
+	var replayed []*types.Transaction
+	for _, expected := range []int{4, 2, 0} {
+		results := make(chan *TriggerResult, 1)
+		triggers <- &Trigger{Result: results}
+		res := <-results
+		require.NoError(t, res.Err)
+		require.Len(t, res.Payload.Transactions, expected)
+		for _, data := range res.Payload.Transactions {
+			var tx types.Transaction
+			require.NoError(t, tx.UnmarshalBinary(data))
+			replayed = append(replayed, &tx)
+		}
+	}
+	require.Len(t, replayed, len(txs))
+	for i, tx := range txs {
+		require.Equal(t, tx.Hash(), replayed[i].Hash())
+	}
+	require.True(t, corpus.Done())
+	require.Equal(t, uint64(6), corpus.Replayed)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// ScheduledRPC is a wrapper around an engine RPC that limits the number of concurrent calls,
+// and prioritizes block production calls (forkchoice updates, new and get payload) over background queries,
+// so inspection of the engine cannot delay block production.
+// Waiting calls of the same priority are served in order.
+// Background queries are also rate-limited, so they cannot keep the engine busy between blocks either.
+type ScheduledRPC struct {
+	c          client.RPC
+	limit      int
+	background *rate.Limiter
+
+	mu     sync.Mutex
+	active int
+	high   []chan struct{}
+	low    []chan struct{}
+}
+
+// NewScheduledRPC creates a ScheduledRPC that limits background queries to the given number of calls per second,
+// with bursts of up to maxConcurrent calls. A batch counts as one call. Background queries are not rate-limited if the rate is 0.
+func NewScheduledRPC(c client.RPC, maxConcurrent int, backgroundRate float64) *ScheduledRPC {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	limit := rate.Inf
+	if backgroundRate > 0 {
+		limit = rate.Limit(backgroundRate)
+	}
+	return &ScheduledRPC{c: c, limit: maxConcurrent, background: rate.NewLimiter(limit, maxConcurrent)}
+}
+
+// isPriorityMethod returns true for the methods that are on the critical path of block production.
+func isPriorityMethod(method string) bool {
+	return strings.HasPrefix(method, "engine_forkchoiceUpdated") ||
+		strings.HasPrefix(method, "engine_newPayload") ||
+		strings.HasPrefix(method, "engine_getPayload")
+}
+
+func (s *ScheduledRPC) acquire(ctx context.Context, priority bool) error {
+	if !priority {
+		// wait for the rate limit before queueing, so rate-limited calls do not hold up the queue
+		if err := s.background.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	if s.active < s.limit && len(s.high) == 0 && (priority || len(s.low) == 0) {
+		s.active += 1
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	if priority {
+		s.high = append(s.high, ready)
+	} else {
+		s.low = append(s.low, ready)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.dequeue(ready) { // the slot was already handed over to us, pass it on
+			s.releaseLocked()
+		}
+		return ctx.Err()
+	}
+}
+
+// dequeue removes the waiter from the queues, and returns false if it was not waiting anymore.
+func (s *ScheduledRPC) dequeue(ready chan struct{}) bool {
+	for _, q := range []*[]chan struct{}{&s.high, &s.low} {
+		for i, w := range *q {
+			if w == ready {
+				*q = append((*q)[:i], (*q)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *ScheduledRPC) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+// releaseLocked hands the slot of a finished call over to the next waiting call, priority calls first.
+func (s *ScheduledRPC) releaseLocked() {
+	for _, q := range []*[]chan struct{}{&s.high, &s.low} {
+		if len(*q) > 0 {
+			next := (*q)[0]
+			*q = (*q)[1:]
+			close(next)
+			return
+		}
+	}
+	s.active -= 1
+}
+
+func (s *ScheduledRPC) Close() {
+	s.c.Close()
+}
+
+func (s *ScheduledRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	if err := s.acquire(ctx, isPriorityMethod(method)); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.c.CallContext(ctx, result, method, args...)
+}
+
+func (s *ScheduledRPC) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if err := s.acquire(ctx, false); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.c.BatchCallContext(ctx, b)
+}
+
+func (s *ScheduledRPC) EthSubscribe(ctx context.Context, channel any, args ...any) (ethereum.Subscription, error) {
+	return s.c.EthSubscribe(ctx, channel, args...)
+}
+
+var _ client.RPC = (*ScheduledRPC)(nil)
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingRPC reports every call as it starts, and blocks it until it is released.
+type blockingRPC struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingRPC() *blockingRPC {
+	return &blockingRPC{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (b *blockingRPC) Close() {}
+
+func (b *blockingRPC) CallContext(ctx context.Context, result any, method string, args ...any) error {
+	b.started <- method
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blockingRPC) BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
+	return b.CallContext(ctx, nil, "batch")
+}
+
+func (b *blockingRPC) EthSubscribe(ctx context.Context, channel any, args ...any) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func (b *blockingRPC) expectStarted(t *testing.T, method string) {
+	t.Helper()
+	select {
+	case m := <-b.started:
+		require.Equal(t, method, m)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("call %s did not start", method)
+	}
+}
+
+func (b *blockingRPC) expectIdle(t *testing.T) {
+	t.Helper()
+	select {
+	case m := <-b.started:
+		t.Fatalf("call %s started beyond the limit", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// waitQueued waits until the given number of calls wait for a slot.
+func waitQueued(t *testing.T, s *ScheduledRPC, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.high)+len(s.low) == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestScheduledRPCLimit(t *testing.T) {
+	b := newBlockingRPC()
+	s := NewScheduledRPC(b, 2, 0)
+	errs := make(chan error, 3)
+	for _, method := range []string{"eth_a", "eth_b"} {
+		method := method
+		go func() { errs <- s.CallContext(context.Background(), nil, method) }()
+		b.expectStarted(t, method)
+	}
+	go func() { errs <- s.CallContext(context.Background(), nil, "eth_c") }()
+	waitQueued(t, s, 1)
+	b.expectIdle(t)
+
+	b.release <- struct{}{}
+	require.NoError(t, <-errs)
+	b.expectStarted(t, "eth_c")
+	close(b.release)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	require.Zero(t, s.active)
+}
+
+func TestScheduledRPCPriority(t *testing.T) {
+	b := newBlockingRPC()
+	s := NewScheduledRPC(b, 1, 0)
+	errs := make(chan error, 4)
+	call := func(method string) {
+		go func() { errs <- s.CallContext(context.Background(), nil, method) }()
+	}
+	call("eth_getBlockByNumber")
+	b.expectStarted(t, "eth_getBlockByNumber")
+	call("eth_getLogs")
+	waitQueued(t, s, 1)
+	call("eth_chainId")
+	waitQueued(t, s, 2)
+	call("engine_forkchoiceUpdatedV2")
+	waitQueued(t, s, 3)
+
+	// block production calls go first, background queries in order
+	for _, method := range []string{"engine_forkchoiceUpdatedV2", "eth_getLogs", "eth_chainId"} {
+		b.release <- struct{}{}
+		require.NoError(t, <-errs)
+		b.expectStarted(t, method)
+	}
+	b.release <- struct{}{}
+	require.NoError(t, <-errs)
+	require.Zero(t, s.active)
+}
+
+func TestScheduledRPCCancelWaiter(t *testing.T) {
+	b := newBlockingRPC()
+	s := NewScheduledRPC(b, 1, 0)
+	errs := make(chan error, 2)
+	go func() { errs <- s.CallContext(context.Background(), nil, "eth_a") }()
+	b.expectStarted(t, "eth_a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() { canceled <- s.CallContext(ctx, nil, "eth_canceled") }()
+	waitQueued(t, s, 1)
+	go func() { errs <- s.CallContext(context.Background(), nil, "eth_c") }()
+	waitQueued(t, s, 2)
+
+	cancel()
+	require.ErrorIs(t, <-canceled, context.Canceled)
+	waitQueued(t, s, 1)
+	// the canceled waiter does not hold on to a slot: the next waiter gets the slot of the finished call
+	b.release <- struct{}{}
+	require.NoError(t, <-errs)
+	b.expectStarted(t, "eth_c")
+	b.release <- struct{}{}
+	require.NoError(t, <-errs)
+	require.Zero(t, s.active)
+}
+
+func TestScheduledRPCCancelHandover(t *testing.T) {
+	// a waiter may be canceled just as the slot is handed over to it: it must pass the slot on to the next waiter
+	for i := 0; i < 100; i++ {
+		s := NewScheduledRPC(newBlockingRPC(), 1, 0)
+		require.NoError(t, s.acquire(context.Background(), false))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		acquired := make(chan error, 1)
+		go func() { acquired <- s.acquire(ctx, false) }()
+		waitQueued(t, s, 1)
+		next := make(chan error, 1)
+		go func() { next <- s.acquire(context.Background(), false) }()
+		waitQueued(t, s, 2)
+
+		s.mu.Lock()
+		s.releaseLocked() // hands the slot over to the first waiter
+		cancel()
+		s.mu.Unlock()
+		if err := <-acquired; err == nil {
+			s.release()
+		} else {
+			require.ErrorIs(t, err, context.Canceled)
+		}
+		require.NoError(t, <-next)
+		s.release()
+		require.Zero(t, s.active)
+		require.Empty(t, s.high)
+		require.Empty(t, s.low)
+	}
+}
+
+func TestScheduledRPCRateLimit(t *testing.T) {
+	b := newBlockingRPC()
+	close(b.release)
+	// a burst of 2 background calls, then one every 100ms
+	s := NewScheduledRPC(b, 2, 10)
+	ctx := context.Background()
+	start := time.Now()
+	require.NoError(t, s.CallContext(ctx, nil, "eth_a"))
+	require.NoError(t, s.CallContext(ctx, nil, "eth_b"))
+	require.Less(t, time.Since(start), 50*time.Millisecond, "the burst is not delayed")
+	// block production calls are not rate-limited
+	require.NoError(t, s.CallContext(ctx, nil, "engine_forkchoiceUpdatedV2"))
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+
+	require.NoError(t, s.BatchCallContext(ctx, nil))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "background calls beyond the burst wait for the rate limit")
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, s.CallContext(cctx, nil, "eth_c"), "a call that cannot get a turn before its deadline fails")
+	require.Zero(t, s.active)
+}
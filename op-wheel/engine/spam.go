@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+	opcrypto "github.com/ethereum-optimism/optimism/op-service/crypto"
+)
+
+// spamTxDataSize is the maximum amount of garbage calldata per spam transaction.
+const spamTxDataSize = 100_000
+
+// SpamConfig configures the garbage block generation of SpamBlocks.
+type SpamConfig struct {
+	Signer opcrypto.SignerFactory
+	From   common.Address
+	// Rate is the number of blocks to build per second, regardless of the block time.
+	Rate float64
+	// Size is the amount of garbage calldata to fill each block with, in bytes.
+	// Blocks are filled up to the block gas limit at most.
+	Size uint64
+	// Blocks is the number of blocks to build, or 0 to build blocks until the context is canceled.
+	Blocks uint64
+}
+
+// SpamReport is the result of a garbage block generation run.
+type SpamReport struct {
+	Blocks          uint64        `json:"blocks"`
+	Txs             uint64        `json:"txs"`
+	Bytes           uint64        `json:"bytes"`
+	Gas             uint64        `json:"gas"`
+	Duration        time.Duration `json:"duration"`
+	BlocksPerSecond float64       `json:"blocksPerSecond"`
+}
+
+// SpamBlocks builds blocks filled with garbage calldata transactions at a sustained rate,
+// to stress storage growth and downstream indexing. The transactions are forced into the blocks, which requires op-geth.
+// Block timestamps advance by the block time per block, so the chain runs ahead of the wall-clock if the rate is high.
+// If the context is canceled, the report of the blocks built so far is returned, without error.
+func SpamBlocks(ctx context.Context, client client.RPC, cfg *SpamConfig, settings *BlockBuildingSettings) (*SpamReport, error) {
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("invalid block rate: %f", cfg.Rate)
+	}
+	var chainID hexutil.Big
+	if err := client.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	signFn := cfg.Signer(chainID.ToInt())
+
+	report := &SpamReport{}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+	defer ticker.Stop()
+	start := time.Now()
+	finish := func() *SpamReport {
+		report.Duration = time.Since(start)
+		report.BlocksPerSecond = float64(report.Blocks) / report.Duration.Seconds()
+		return report
+	}
+	for cfg.Blocks == 0 || report.Blocks < cfg.Blocks {
+		select {
+		case <-ctx.Done():
+			return finish(), nil
+		case <-ticker.C:
+		}
+		status, err := Status(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pre-block engine status: %w", err)
+		}
+		head, err := getHeader(ctx, client, "eth_getBlockByHash", status.Head.Hash.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get head header: %w", err)
+		}
+		// the nonce is read from the head every block, in case the engine did not include all spam txs
+		var nonce hexutil.Uint64
+		if err := client.CallContext(ctx, &nonce, "eth_getTransactionCount", cfg.From, status.Head.Hash); err != nil {
+			return nil, fmt.Errorf("failed to get sender nonce: %w", err)
+		}
+		next := uint64(nonce)
+		tip := big.NewInt(params.GWei)
+		feeCap := new(big.Int).Set(tip)
+		if status.BaseFee != nil {
+			feeCap.Add(feeCap, new(big.Int).Mul(status.BaseFee, big.NewInt(2)))
+		}
+		var txs []hexutil.Bytes
+		var size, gas uint64
+		for size < cfg.Size {
+			n := cfg.Size - size
+			if n > spamTxDataSize {
+				n = spamTxDataSize
+			}
+			data := make([]byte, n)
+			if _, err := rand.Read(data); err != nil {
+				return nil, err
+			}
+			txGas := dataGas(data)
+			if gas+txGas > head.GasLimit {
+				break
+			}
+			tx, err := signFn(ctx, cfg.From, types.NewTx(&types.DynamicFeeTx{
+				ChainID:   chainID.ToInt(),
+				Nonce:     next,
+				GasTipCap: tip,
+				GasFeeCap: feeCap,
+				Gas:       txGas,
+				To:        &common.Address{1: 0x13, 2: 0x37},
+				Data:      data,
+			}))
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign spam tx: %w", err)
+			}
+			enc, err := tx.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode spam tx: %w", err)
+			}
+			txs = append(txs, enc)
+			size += uint64(len(data))
+			gas += txGas
+			next += 1
+		}
+		blockSettings := *settings
+		blockSettings.Transactions = txs
+		payload, err := BuildBlock(ctx, client, status, &blockSettings)
+		if errors.Is(err, context.Canceled) {
+			return finish(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		report.Blocks += 1
+		report.Txs += uint64(len(txs))
+		report.Bytes += size
+		report.Gas += payload.GasUsed
+	}
+	return finish(), nil
+}
+
+// dataGas returns the intrinsic gas of a call transaction with the given calldata.
+func dataGas(data []byte) uint64 {
+	gas := params.TxGas
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas
+}
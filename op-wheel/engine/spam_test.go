@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataGas(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		gas  uint64
+	}{
+		{name: "empty", data: nil, gas: 21000},
+		{name: "zero bytes", data: []byte{0, 0, 0}, gas: 21000 + 3*4},
+		{name: "non-zero bytes", data: []byte{1, 0xff}, gas: 21000 + 2*16},
+		{name: "mixed", data: []byte{0, 1, 0, 2}, gas: 21000 + 2*4 + 2*16},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.gas, dataGas(tc.data))
+			// matches the intrinsic gas of geth for a call after Istanbul
+			intrinsic, err := core.IntrinsicGas(tc.data, nil, false, true, true, false)
+			require.NoError(t, err)
+			require.Equal(t, intrinsic, dataGas(tc.data))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// TransformBlock is the block content that is rebuilt on the destination engine by a transformed copy.
+type TransformBlock struct {
+	Timestamp    uint64
+	Random       common.Hash
+	FeeRecipient common.Address
+	GasLimit     uint64
+	Transactions []*types.Transaction
+}
+
+// BlockTransform modifies a copied block, before it is rebuilt on the destination engine.
+type BlockTransform func(b *TransformBlock)
+
+// DropBlobTxs removes all blob transactions from the block.
+func DropBlobTxs() BlockTransform {
+	return func(b *TransformBlock) {
+		txs := b.Transactions[:0]
+		for _, tx := range b.Transactions {
+			if tx.Type() != types.BlobTxType {
+				txs = append(txs, tx)
+			}
+		}
+		b.Transactions = txs
+	}
+}
+
+// RewriteFeeRecipient changes the fee recipient of the block to the given address.
+func RewriteFeeRecipient(addr common.Address) BlockTransform {
+	return func(b *TransformBlock) {
+		b.FeeRecipient = addr
+	}
+}
+
+// ClampGasLimit lowers the gas limit of the block to max, if it is higher.
+// Transactions with a gas limit higher than max can never fit, and are dropped.
+// The transactions must still fit in the clamped block together, or the rebuild of the block fails.
+func ClampGasLimit(max uint64) BlockTransform {
+	return func(b *TransformBlock) {
+		if b.GasLimit <= max {
+			return
+		}
+		b.GasLimit = max
+		txs := b.Transactions[:0]
+		for _, tx := range b.Transactions {
+			if tx.Gas() <= max {
+				txs = append(txs, tx)
+			}
+		}
+		b.Transactions = txs
+	}
+}
+
+// CopyTransformed takes the head block of copyFrom, applies the transforms to it,
+// and rebuilds it on top of the current head of copyTo, with exactly the transformed transactions.
+// Unlike Copy, the resulting block has a different hash than the source block,
+// so the destination chain is a modified copy that cannot sync from the source chain.
+// The imported blocks are recorded in the given stats, if not nil.
+func CopyTransformed(ctx context.Context, copyFrom client.RPC, copyTo client.RPC, transforms []BlockTransform, stats *CopyStats) error {
+	copyHead, _, _, err := headSafeFinalized(ctx, copyFrom)
+	if err != nil {
+		return err
+	}
+	b := &TransformBlock{
+		Timestamp:    copyHead.Time(),
+		Random:       copyHead.MixDigest(),
+		FeeRecipient: copyHead.Coinbase(),
+		GasLimit:     copyHead.GasLimit(),
+		Transactions: append([]*types.Transaction(nil), copyHead.Transactions()...),
+	}
+	for _, transform := range transforms {
+		transform(b)
+	}
+	txs, err := EncodeTxs(b.Transactions)
+	if err != nil {
+		return err
+	}
+	status, err := Status(ctx, copyTo)
+	if err != nil {
+		return fmt.Errorf("failed to get destination engine status: %w", err)
+	}
+	if b.Timestamp <= status.Head.Time {
+		return fmt.Errorf("source block timestamp %d is not after destination head timestamp %d", b.Timestamp, status.Head.Time)
+	}
+	gasLimit := b.GasLimit
+	payload, err := buildPayload(ctx, copyTo, status, PayloadAttributesV2{
+		Timestamp:             b.Timestamp,
+		Random:                b.Random,
+		SuggestedFeeRecipient: b.FeeRecipient,
+		Transactions:          txs,
+		NoTxPool:              true,
+		GasLimit:              &gasLimit,
+	}, payloadTiming{})
+	if err != nil {
+		return err
+	}
+	if stats != nil {
+		block, err := engine.ExecutableDataToBlock(*payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode rebuilt block: %w", err)
+		}
+		stats.Add(block, payload)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Trigger requests Auto block production to build a block, see WithManualTrigger.
+type Trigger struct {
+	// Result receives the outcome of the block building, if not nil. It must be buffered.
+	Result chan<- *TriggerResult
+}
+
+// TriggerResult is the outcome of a triggered block building.
+type TriggerResult struct {
+	Payload *engine.ExecutableData
+	Err     error
+}
+
+// TriggerResponse is the JSON response of the TriggerHandler.
+type TriggerResponse struct {
+	Hash   *common.Hash `json:"hash,omitempty"`
+	Number uint64       `json:"number,omitempty"`
+	Err    string       `json:"error,omitempty"`
+}
+
+// TriggerHandler triggers a block on every POST request, and responds with the built block once it is inserted.
+type TriggerHandler struct {
+	Triggers chan<- *Trigger
+}
+
+func (h *TriggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST to trigger a block", http.StatusMethodNotAllowed)
+		return
+	}
+	result := make(chan *TriggerResult, 1)
+	select {
+	case h.Triggers <- &Trigger{Result: result}:
+	case <-r.Context().Done():
+		return
+	}
+	var res *TriggerResult
+	select {
+	case res = <-result:
+	case <-r.Context().Done():
+		return
+	}
+	var resp TriggerResponse
+	status := http.StatusOK
+	if res.Err != nil {
+		resp.Err = res.Err.Error()
+		status = http.StatusInternalServerError
+	} else if res.Payload != nil {
+		resp.Hash, resp.Number = &res.Payload.BlockHash, res.Payload.Number
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&resp)
+}
+
+// NotifyTrigger triggers a block on every one of the given signals, until the context is canceled.
+// Signals that arrive while a block is being built are coalesced.
+func NotifyTrigger(ctx context.Context, triggers chan<- *Trigger, sig ...os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig...)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				select {
+				case triggers <- &Trigger{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+}
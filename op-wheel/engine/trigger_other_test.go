@@ -0,0 +1,34 @@
+//go:build !windows
+
+package engine
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyTrigger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	triggers := make(chan *Trigger)
+	NotifyTrigger(ctx, triggers, syscall.SIGUSR1)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	select {
+	case trig := <-triggers:
+		require.Nil(t, trig.Result, "signal triggers do not wait for a result")
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal did not trigger a block")
+	}
+
+	// no more triggers without a signal
+	select {
+	case <-triggers:
+		t.Fatal("unexpected trigger")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
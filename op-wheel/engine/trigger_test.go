@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/beacon/engine"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerHandler(t *testing.T) {
+	triggers := make(chan *Trigger)
+	srv := httptest.NewServer(&TriggerHandler{Triggers: triggers})
+	t.Cleanup(srv.Close)
+
+	// answer the triggers like Auto block production would
+	results := make(chan *TriggerResult)
+	go func() {
+		for trig := range triggers {
+			trig.Result <- <-results
+		}
+	}()
+	t.Cleanup(func() { close(triggers) })
+
+	t.Run("not a post", func(t *testing.T) {
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	post := func(t *testing.T, res *TriggerResult) (int, TriggerResponse) {
+		go func() { results <- res }()
+		resp, err := http.Post(srv.URL, "", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var out TriggerResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		return resp.StatusCode, out
+	}
+
+	t.Run("block", func(t *testing.T) {
+		hash := common.HexToHash("0x1234")
+		status, out := post(t, &TriggerResult{Payload: &engine.ExecutableData{BlockHash: hash, Number: 7}})
+		require.Equal(t, http.StatusOK, status)
+		require.NotNil(t, out.Hash)
+		require.Equal(t, hash, *out.Hash)
+		require.Equal(t, uint64(7), out.Number)
+		require.Empty(t, out.Err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		status, out := post(t, &TriggerResult{Err: errors.New("engine is syncing")})
+		require.Equal(t, http.StatusInternalServerError, status)
+		require.Nil(t, out.Hash)
+		require.Equal(t, "engine is syncing", out.Err)
+	})
+}
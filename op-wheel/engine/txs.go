@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/ethereum-optimism/optimism/op-node/client"
+)
+
+// ReadTxFile reads signed raw transactions from a file, hex-encoded, one per line.
+// Comments (#) and empty lines are ignored.
+func ReadTxFile(path string) ([]*types.Transaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tx file: %w", err)
+	}
+	defer f.Close()
+	var txs []*types.Transaction
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if len(line) < 1 || line[0] == '#' {
+			continue
+		}
+		data, err := hexutil.Decode(line)
+		if err != nil {
+			return nil, fmt.Errorf("tx on line %d is not valid hex: %w", i, err)
+		}
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("failed to decode tx on line %d: %w", i, err)
+		}
+		txs = append(txs, &tx)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tx file: %w", err)
+	}
+	return txs, nil
+}
+
+// TxSimResult is the outcome of simulating a transaction against the head state of the engine.
+type TxSimResult struct {
+	Hash         common.Hash    `json:"hash"`
+	From         common.Address `json:"from"`
+	GasLimit     uint64         `json:"gasLimit"`
+	EstimatedGas uint64         `json:"estimatedGas,omitempty"`
+	Err          string         `json:"error,omitempty"`
+}
+
+// OK returns true if the transaction is expected to succeed.
+func (r *TxSimResult) OK() bool {
+	return r.Err == ""
+}
+
+// SimulateTx runs the transaction with eth_call and eth_estimateGas against the latest state of the engine,
+// to detect transactions that revert or run out of gas before they are included in a block.
+// Each transaction is simulated in isolation: dependencies between transactions are not accounted for.
+func SimulateTx(ctx context.Context, client client.RPC, tx *types.Transaction) *TxSimResult {
+	res := &TxSimResult{Hash: tx.Hash(), GasLimit: tx.Gas()}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		res.Err = fmt.Sprintf("invalid signature: %v", err)
+		return res
+	}
+	res.From = from
+	msg := map[string]any{
+		"from":  from,
+		"to":    tx.To(),
+		"gas":   hexutil.Uint64(tx.Gas()),
+		"value": (*hexutil.Big)(tx.Value()),
+		"input": hexutil.Bytes(tx.Data()),
+	}
+	var result hexutil.Bytes
+	if err := client.CallContext(ctx, &result, "eth_call", msg, "latest"); err != nil {
+		res.Err = fmt.Sprintf("call failed: %v", err)
+		return res
+	}
+	var estimate hexutil.Uint64
+	if err := client.CallContext(ctx, &estimate, "eth_estimateGas", msg, "latest"); err != nil {
+		res.Err = fmt.Sprintf("gas estimation failed: %v", err)
+		return res
+	}
+	res.EstimatedGas = uint64(estimate)
+	if res.EstimatedGas > res.GasLimit {
+		res.Err = fmt.Sprintf("gas limit %d is below estimated gas %d", res.GasLimit, res.EstimatedGas)
+	}
+	return res
+}
+
+// EncodeTxs encodes the transactions to include them in the payload attributes.
+func EncodeTxs(txs []*types.Transaction) ([]hexutil.Bytes, error) {
+	out := make([]hexutil.Bytes, 0, len(txs))
+	for _, tx := range txs {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tx %s: %w", tx.Hash(), err)
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
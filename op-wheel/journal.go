@@ -0,0 +1,323 @@
+package wheel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+)
+
+// journalVersion is the version of the journal format, journals of other versions are rejected.
+const journalVersion = 1
+
+// checkpointInterval is the minimum time between writes of the journal for checkpoints: steps checkpoint every block,
+// and resuming from a slightly older checkpoint only repeats some work. The last checkpoint is written when the job ends.
+const checkpointInterval = 5 * time.Second
+
+// Job is the journal of a run of a long, multi-step command, so a crashed or interrupted run can be resumed with --resume.
+// Only engine backfill and engine copy journal their progress: migrate-state writes a new data dir that must be empty,
+// so an interrupted migration is started over, after removing the partial destination.
+type Job struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+	// Command is the path of the command, e.g. ["engine", "backfill"].
+	Command []string `json:"command"`
+	// Flags are the values of the flags the job was started with, see Plan. A resumed run must have the same flags.
+	Flags   map[string][]string `json:"flags"`
+	Created time.Time           `json:"created"`
+	Updated time.Time           `json:"updated"`
+	// Status is one of running, done or failed. A job that crashed is left as running.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Runs is the number of times the job was started, including resumes.
+	Runs int `json:"runs"`
+	// Checkpoints are the progress of the steps of the job, by name, e.g. the last copied block.
+	Checkpoints map[string]json.RawMessage `json:"checkpoints,omitempty"`
+}
+
+var (
+	JournalDirFlag = &cli.StringFlag{
+		Name:      "journal.dir",
+		Usage:     "Directory to journal the progress of the job to, so it can be resumed with --resume. Journaling is off if not set.",
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("JOURNAL_DIR"),
+	}
+	ResumeFlag = &cli.StringFlag{
+		Name:    "resume",
+		Usage:   "ID of a failed or interrupted job to resume from its journal, instead of starting over. The other flags must be the same.",
+		EnvVars: prefixEnvVars("RESUME"),
+	}
+)
+
+// Journal records the progress of a Job. A nil Journal records nothing, and has no progress to resume from.
+type Journal struct {
+	path string
+	job  *Job
+	// interval is the minimum time between writes for checkpoints.
+	interval time.Duration
+}
+
+// JournalAction runs the action with the journal of a new job, or of the job of --resume.
+// The job is marked done or failed when the action returns.
+func JournalAction(fn func(ctx *cli.Context, j *Journal) error) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		dir := ctx.String(JournalDirFlag.Name)
+		if dir == "" {
+			if ctx.IsSet(ResumeFlag.Name) {
+				return fmt.Errorf("--%s requires --%s", ResumeFlag.Name, JournalDirFlag.Name)
+			}
+			return fn(ctx, nil)
+		}
+		plan, err := NewPlan(ctx)
+		if err != nil {
+			return err
+		}
+		delete(plan.Flags, ResumeFlag.Name)
+		delete(plan.Flags, JournalDirFlag.Name)
+		var j *Journal
+		if id := ctx.String(ResumeFlag.Name); id != "" {
+			if j, err = OpenJournal(dir, id); err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(j.job.Command, plan.Command) {
+				return fmt.Errorf("job %s is of command %q, not %q", id, strings.Join(j.job.Command, " "), strings.Join(plan.Command, " "))
+			}
+			if !reflect.DeepEqual(j.job.Flags, plan.Flags) {
+				return fmt.Errorf("flags differ from the flags job %s was started with: %v", id, j.job.Flags)
+			}
+			if j.job.Status == "done" {
+				return fmt.Errorf("job %s is done already", id)
+			}
+			log.Info("resuming job", "id", id, "runs", j.job.Runs)
+		} else {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create journal dir: %w", err)
+			}
+			id, err := newJobID()
+			if err != nil {
+				return err
+			}
+			j = &Journal{
+				path: filepath.Join(dir, id+".json"),
+				job: &Job{
+					Version: journalVersion,
+					ID:      id,
+					Command: plan.Command,
+					Flags:   plan.Flags,
+					Created: time.Now().UTC(),
+				},
+			}
+			log.Info("journaling job", "id", id, "path", j.path)
+		}
+		j.interval = checkpointInterval
+		j.job.Status = "running"
+		j.job.Error = ""
+		j.job.Runs += 1
+		if err := j.write(); err != nil {
+			return err
+		}
+		runErr := fn(ctx, j)
+		if runErr != nil {
+			j.job.Status = "failed"
+			j.job.Error = runErr.Error()
+		} else {
+			j.job.Status = "done"
+			j.job.Checkpoints = nil
+		}
+		if err := j.write(); err != nil {
+			log.Error("failed to journal the outcome of the job", "id", j.job.ID, "err", err)
+		}
+		if runErr != nil {
+			return fmt.Errorf("%w (resume job with --%s=%s)", runErr, ResumeFlag.Name, j.job.ID)
+		}
+		return nil
+	}
+}
+
+// OpenJournal opens the journal of the job with the given ID, to resume it.
+func OpenJournal(dir string, id string) (*Journal, error) {
+	path := filepath.Join(dir, id+".json")
+	job, err := ReadJob(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, job: job}, nil
+}
+
+// ReadJob reads the journal of a job.
+func ReadJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job journal: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job journal %s: %w", path, err)
+	}
+	if job.Version != journalVersion {
+		return nil, fmt.Errorf("unsupported journal version %d of %s, expected %d", job.Version, path, journalVersion)
+	}
+	return &job, nil
+}
+
+func newJobID() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b[:]), nil
+}
+
+// Checkpoint records the progress of the step with the given name, to resume the step from.
+// The journal is only written if it was not written within the checkpoint interval, or when the job ends.
+// The checkpoints are dropped once the job is done.
+func (j *Journal) Checkpoint(name string, v any) error {
+	if j == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint of step %s: %w", name, err)
+	}
+	if j.job.Checkpoints == nil {
+		j.job.Checkpoints = make(map[string]json.RawMessage)
+	}
+	j.job.Checkpoints[name] = data
+	if time.Since(j.job.Updated) < j.interval {
+		return nil
+	}
+	return j.write()
+}
+
+// dataDirStep returns the name of a step for the given data dir, so each data dir of a job is resumed from its own checkpoint.
+func dataDirStep(step string, dataDir string) string {
+	return step + "@" + dataDir
+}
+
+// Restore decodes the last checkpoint of the step with the given name into v, and returns false if there is none.
+func (j *Journal) Restore(name string, v any) (bool, error) {
+	if j == nil {
+		return false, nil
+	}
+	data, ok := j.job.Checkpoints[name]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode checkpoint of step %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// write replaces the journal file, through a temporary file, so a crash cannot leave a partial journal behind.
+func (j *Journal) write() error {
+	j.job.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(j.job, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write job journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to write job journal: %w", err)
+	}
+	return nil
+}
+
+// JobSummary is a job as listed by jobs list.
+type JobSummary struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	Status  string    `json:"status"`
+	Runs    int       `json:"runs"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// ListJobs reads the journals of the jobs in the directory, oldest first.
+func ListJobs(dir string) ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(paths))
+	for _, path := range paths {
+		job, err := ReadJob(path)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs, nil
+}
+
+var (
+	JobsCmd = &cli.Command{
+		Name:  "jobs",
+		Usage: "Inspect the journals of long-running commands, e.g. to find the ID of a job to resume",
+		Subcommands: []*cli.Command{
+			JobsListCmd,
+			JobsDescribeCmd,
+		},
+	}
+	JobsListCmd = &cli.Command{
+		Name:  "list",
+		Usage: "List the journaled jobs as JSON lines, oldest first",
+		Flags: []cli.Flag{JournalDirFlag},
+		Action: func(ctx *cli.Context) error {
+			if !ctx.IsSet(JournalDirFlag.Name) {
+				return fmt.Errorf("--%s is required", JournalDirFlag.Name)
+			}
+			jobs, err := ListJobs(ctx.String(JournalDirFlag.Name))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			for _, job := range jobs {
+				if err := enc.Encode(JobSummary{
+					ID: job.ID, Command: strings.Join(job.Command, " "), Status: job.Status, Runs: job.Runs,
+					Created: job.Created, Updated: job.Updated,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	JobsDescribeCmd = &cli.Command{
+		Name:      "describe",
+		Usage:     "Write the journal of a job as JSON: its flags, status and checkpoints",
+		ArgsUsage: "<id>",
+		Flags:     []cli.Flag{JournalDirFlag},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return errors.New("expected the ID of the job as only argument")
+			}
+			if !ctx.IsSet(JournalDirFlag.Name) {
+				return fmt.Errorf("--%s is required", JournalDirFlag.Name)
+			}
+			j, err := OpenJournal(ctx.String(JournalDirFlag.Name), ctx.Args().First())
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(j.job)
+		},
+	}
+)
@@ -0,0 +1,95 @@
+package wheel
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestJournalAction(t *testing.T) {
+	dir := t.TempDir()
+	var journal *Journal
+	var restored map[string]uint64
+	run := func(fail bool, args ...string) error {
+		app := &cli.App{
+			Name:   "op-wheel",
+			Writer: io.Discard,
+			Commands: []*cli.Command{{
+				Name:  "backfill",
+				Flags: []cli.Flag{DataDirFlag, JournalDirFlag, ResumeFlag},
+				Action: JournalAction(func(ctx *cli.Context, j *Journal) error {
+					journal = j
+					restored = make(map[string]uint64)
+					return forEachDataDir(ctx, func(dataDir string) error {
+						step := dataDirStep("backfill", dataDir)
+						var last uint64
+						if ok, err := j.Restore(step, &last); err != nil {
+							return err
+						} else if ok {
+							restored[dataDir] = last
+						}
+						for n := last + 1; n <= last+3; n++ {
+							if err := j.Checkpoint(step, n); err != nil {
+								return err
+							}
+						}
+						if fail && dataDir == "b" {
+							return errors.New("b failed")
+						}
+						return nil
+					})
+				}),
+			}},
+		}
+		return app.Run(append([]string{"op-wheel", "backfill"}, args...))
+	}
+
+	require.NoError(t, run(false, "--data-dir", "a"))
+	require.Nil(t, journal, "journaling is off unless a journal dir is set")
+
+	err := run(true, "--data-dir", "a", "--data-dir", "b", "--journal.dir", dir)
+	require.ErrorContains(t, err, "resume job with --resume="+journal.job.ID)
+	id := journal.job.ID
+	job, err := ReadJob(filepath.Join(dir, id+".json"))
+	require.NoError(t, err)
+	require.Equal(t, "failed", job.Status)
+	require.Equal(t, 1, job.Runs)
+	// the checkpoints are batched, but the last ones are written when the job ends
+	require.Len(t, job.Checkpoints, 2)
+
+	err = run(false, "--data-dir", "a", "--data-dir", "c", "--journal.dir", dir, "--resume", id)
+	require.ErrorContains(t, err, "flags differ")
+
+	require.NoError(t, run(false, "--data-dir", "a", "--data-dir", "b", "--journal.dir", dir, "--resume", id))
+	// each data dir resumes from its own checkpoint
+	require.Equal(t, map[string]uint64{"a": 3, "b": 3}, restored)
+	job, err = ReadJob(filepath.Join(dir, id+".json"))
+	require.NoError(t, err)
+	require.Equal(t, "done", job.Status)
+	require.Equal(t, 2, job.Runs)
+	require.Empty(t, job.Checkpoints)
+
+	err = run(false, "--data-dir", "a", "--data-dir", "b", "--journal.dir", dir, "--resume", id)
+	require.ErrorContains(t, err, "done already")
+	require.ErrorContains(t, run(false, "--data-dir", "a", "--resume", id), "requires --journal.dir")
+}
+
+func TestJournalCheckpointInterval(t *testing.T) {
+	dir := t.TempDir()
+	j := &Journal{path: filepath.Join(dir, "job.json"), job: &Job{Version: journalVersion, ID: "job"}, interval: checkpointInterval}
+	require.NoError(t, j.write())
+	require.NoError(t, j.Checkpoint("copy", uint64(1)))
+	job, err := ReadJob(j.path)
+	require.NoError(t, err)
+	require.Empty(t, job.Checkpoints, "checkpoints within the interval are not written")
+
+	j.interval = 0
+	require.NoError(t, j.Checkpoint("copy", uint64(2)))
+	job, err = ReadJob(j.path)
+	require.NoError(t, err)
+	require.JSONEq(t, "2", string(job.Checkpoints["copy"]))
+}
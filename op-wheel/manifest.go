@@ -0,0 +1,228 @@
+package wheel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+)
+
+// manifestVersion is the version of the manifest format, manifests of other versions are rejected.
+const manifestVersion = 1
+
+// Manifest describes exported artifacts, with checksums, so imports can detect truncated or mixed-up files.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Tool is the name and version of the tool that exported the artifacts.
+	Tool string `json:"tool"`
+	// Command is the path of the command that exported the artifacts, e.g. ["cheat", "preimages"].
+	Command []string     `json:"command"`
+	ChainID *hexutil.Big `json:"chainId,omitempty"`
+	// FromBlock and ToBlock are the inclusive block range that the artifacts cover, if any.
+	FromBlock *hexutil.Uint64 `json:"fromBlock,omitempty"`
+	ToBlock   *hexutil.Uint64 `json:"toBlock,omitempty"`
+	Files     []ManifestFile  `json:"files"`
+}
+
+// ManifestFile is a checksummed artifact. The path is relative to the directory of the manifest.
+type ManifestFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	SHA256 common.Hash `json:"sha256"`
+}
+
+var ManifestFlag = &cli.StringFlag{
+	Name:      "manifest",
+	Usage:     "Write a manifest with the checksums of the exported files, and their chain ID and block range, to the given JSON file",
+	TakesFile: true,
+	EnvVars:   prefixEnvVars("MANIFEST"),
+}
+
+var VerifyManifestFlag = &cli.StringFlag{
+	Name:      "verify-manifest",
+	Usage:     "Verify the input against the given manifest before importing it",
+	TakesFile: true,
+	EnvVars:   prefixEnvVars("VERIFY_MANIFEST"),
+}
+
+// WriteManifest writes a manifest of the given exported files, if --manifest is set.
+// The chain ID and block range are optional.
+func WriteManifest(ctx *cli.Context, chainID *big.Int, fromBlock, toBlock *uint64, files ...string) error {
+	path := ctx.String(ManifestFlag.Name)
+	if path == "" {
+		return nil
+	}
+	m := &Manifest{
+		Version: manifestVersion,
+		Created: time.Now().UTC(),
+		Tool:    fmt.Sprintf("%s %s", ctx.App.Name, ctx.App.Version),
+		Command: commandPath(ctx),
+		ChainID: (*hexutil.Big)(chainID),
+		Files:   []ManifestFile{},
+	}
+	if fromBlock != nil {
+		m.FromBlock = (*hexutil.Uint64)(fromBlock)
+	}
+	if toBlock != nil {
+		m.ToBlock = (*hexutil.Uint64)(toBlock)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve manifest dir: %w", err)
+	}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve exported file: %w", err)
+		}
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil {
+			return fmt.Errorf("failed to make exported file %s relative to manifest: %w", file, err)
+		}
+		entry, err := checksumFile(abs)
+		if err != nil {
+			return err
+		}
+		entry.Path = filepath.ToSlash(rel)
+		m.Files = append(m.Files, *entry)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func checksumFile(path string) (*ManifestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum file %s: %w", path, err)
+	}
+	return &ManifestFile{Size: n, SHA256: common.BytesToHash(h.Sum(nil))}, nil
+}
+
+// ReadManifest reads a manifest, and verifies the checksums of all files it lists.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d, expected %d", m.Version, manifestVersion)
+	}
+	dir := filepath.Dir(path)
+	for _, expected := range m.Files {
+		got, err := checksumFile(filepath.Join(dir, filepath.FromSlash(expected.Path)))
+		if err != nil {
+			return nil, err
+		}
+		if got.Size != expected.Size {
+			return nil, fmt.Errorf("file %s has size %d, expected %d, it may be truncated or replaced", expected.Path, got.Size, expected.Size)
+		}
+		if got.SHA256 != expected.SHA256 {
+			return nil, fmt.Errorf("file %s has checksum %s, expected %s", expected.Path, got.SHA256, expected.SHA256)
+		}
+	}
+	return &m, nil
+}
+
+// ManifestInputAction verifies the input of the command against the manifest of --verify-manifest, if set,
+// before running the action. Input that is not a file, like stdin, must match the checksum of one of the files of the manifest.
+func ManifestInputAction(fn cli.ActionFunc) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		path := ctx.String(VerifyManifestFlag.Name)
+		if path == "" {
+			return fn(ctx)
+		}
+		m, err := ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(ctx.App.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		sum := common.Hash(sha256.Sum256(data))
+		if !m.Lists(sum, int64(len(data))) {
+			return fmt.Errorf("input with checksum %s is not listed in manifest %s", sum, path)
+		}
+		ctx.App.Reader = bytes.NewReader(data)
+		return fn(ctx)
+	}
+}
+
+// ManifestFileAction verifies the input file of the given flag against the manifest of --verify-manifest, if set,
+// before running the action. The file must match the checksum of one of the files of the manifest.
+func ManifestFileAction(fileFlag string, fn cli.ActionFunc) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		path := ctx.String(VerifyManifestFlag.Name)
+		if path == "" {
+			return fn(ctx)
+		}
+		m, err := ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		file := ctx.String(fileFlag)
+		got, err := checksumFile(file)
+		if err != nil {
+			return err
+		}
+		if !m.Lists(got.SHA256, got.Size) {
+			return fmt.Errorf("file %s with checksum %s is not listed in manifest %s", file, got.SHA256, path)
+		}
+		return fn(ctx)
+	}
+}
+
+// Lists returns whether the manifest has a file with the given checksum and size.
+func (m *Manifest) Lists(sum common.Hash, size int64) bool {
+	for _, f := range m.Files {
+		if f.SHA256 == sum && f.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+var VerifyManifestCmd = &cli.Command{
+	Name:      "verify-manifest",
+	Usage:     "Verify the checksums of the files of a manifest written with --manifest",
+	ArgsUsage: "<manifest.json>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return errors.New("expected the path of the manifest as only argument")
+		}
+		m, err := ReadManifest(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	},
+}
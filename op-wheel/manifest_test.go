@@ -0,0 +1,138 @@
+package wheel
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// runManifestCmd runs a command with the manifest flags, that runs the given action.
+func runManifestCmd(t *testing.T, input string, action cli.ActionFunc, args ...string) error {
+	t.Helper()
+	app := &cli.App{
+		Name:    "op-wheel",
+		Version: "test",
+		Reader:  strings.NewReader(input),
+		Writer:  io.Discard,
+		Commands: []*cli.Command{{
+			Name:   "export",
+			Flags:  []cli.Flag{ManifestFlag, VerifyManifestFlag, &cli.StringFlag{Name: "file"}},
+			Action: action,
+		}},
+	}
+	return app.Run(append([]string{"op-wheel", "export"}, args...))
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "sub", "b.json")
+	require.NoError(t, os.WriteFile(a, []byte(`{"a":1}`), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Dir(b), 0o755))
+	require.NoError(t, os.WriteFile(b, []byte(`{"b":2}`), 0o644))
+	path := filepath.Join(dir, "manifest.json")
+	from, to := uint64(10), uint64(20)
+	require.NoError(t, runManifestCmd(t, "", func(ctx *cli.Context) error {
+		return WriteManifest(ctx, big.NewInt(901), &from, &to, a, b)
+	}, "--manifest", path))
+
+	m, err := ReadManifest(path)
+	require.NoError(t, err)
+	require.Equal(t, manifestVersion, m.Version)
+	require.Equal(t, "op-wheel test", m.Tool)
+	require.Equal(t, []string{"export"}, m.Command)
+	require.Equal(t, big.NewInt(901), m.ChainID.ToInt())
+	require.Equal(t, hexutil.Uint64(10), *m.FromBlock)
+	require.Equal(t, hexutil.Uint64(20), *m.ToBlock)
+	require.Len(t, m.Files, 2)
+	require.Equal(t, "a.json", m.Files[0].Path)
+	require.Equal(t, "sub/b.json", m.Files[1].Path, "paths are relative to the manifest, with forward slashes")
+	require.Equal(t, int64(7), m.Files[0].Size)
+
+	// without --manifest, nothing is written
+	require.NoError(t, runManifestCmd(t, "", func(ctx *cli.Context) error {
+		return WriteManifest(ctx, nil, nil, nil, a)
+	}))
+
+	require.NoError(t, os.WriteFile(b, []byte(`{"b":3}`), 0o644))
+	_, err = ReadManifest(path)
+	require.ErrorContains(t, err, "file sub/b.json has checksum")
+	require.NoError(t, os.WriteFile(b, []byte(`{"b":`), 0o644))
+	_, err = ReadManifest(path)
+	require.ErrorContains(t, err, "file sub/b.json has size 5, expected 7, it may be truncated")
+	require.NoError(t, os.Remove(b))
+	_, err = ReadManifest(path)
+	require.ErrorContains(t, err, "failed to open file")
+
+	data, err := json.Marshal(&Manifest{Version: manifestVersion + 1})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	_, err = ReadManifest(path)
+	require.ErrorContains(t, err, "unsupported manifest version")
+}
+
+func TestManifestInput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "patch.txt")
+	require.NoError(t, os.WriteFile(file, []byte("+ 0x01 = 0x02\n"), 0o644))
+	path := filepath.Join(dir, "manifest.json")
+	require.NoError(t, runManifestCmd(t, "", func(ctx *cli.Context) error {
+		return WriteManifest(ctx, nil, nil, nil, file)
+	}, "--manifest", path))
+
+	var input string
+	readInput := ManifestInputAction(func(ctx *cli.Context) error {
+		data, err := io.ReadAll(ctx.App.Reader)
+		input = string(data)
+		return err
+	})
+	require.NoError(t, runManifestCmd(t, "+ 0x01 = 0x02\n", readInput, "--verify-manifest", path))
+	require.Equal(t, "+ 0x01 = 0x02\n", input, "the verified input is passed on")
+	require.ErrorContains(t, runManifestCmd(t, "+ 0x01 = 0x03\n", readInput, "--verify-manifest", path), "is not listed in manifest")
+	require.NoError(t, runManifestCmd(t, "anything", readInput), "the input is not verified without a manifest")
+
+	ran := false
+	readFile := ManifestFileAction("file", func(ctx *cli.Context) error {
+		ran = true
+		return nil
+	})
+	require.NoError(t, runManifestCmd(t, "", readFile, "--verify-manifest", path, "--file", file))
+	require.True(t, ran)
+	ran = false
+	other := filepath.Join(dir, "other.txt")
+	require.NoError(t, os.WriteFile(other, []byte("+ 0x01 = 0x03\n"), 0o644))
+	require.ErrorContains(t, runManifestCmd(t, "", readFile, "--verify-manifest", path, "--file", other), "is not listed in manifest")
+	require.False(t, ran)
+}
+
+func TestVerifyCopyManifest(t *testing.T) {
+	mock := engine.NewMockEngine(engine.MockEngineConfig{ChainID: big.NewInt(901)})
+	source, err := mock.Client()
+	require.NoError(t, err)
+	ctx := context.Background()
+	block := func(n uint64) *hexutil.Uint64 { return (*hexutil.Uint64)(&n) }
+
+	from, err := verifyCopyManifest(ctx, source, &Manifest{ChainID: (*hexutil.Big)(big.NewInt(901)), FromBlock: block(0), ToBlock: block(0)}, 0)
+	require.NoError(t, err)
+	require.Zero(t, from)
+	from, err = verifyCopyManifest(ctx, source, &Manifest{}, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), from, "a manifest without a block range keeps the first block")
+
+	_, err = verifyCopyManifest(ctx, source, &Manifest{ChainID: (*hexutil.Big)(big.NewInt(10))}, 0)
+	require.ErrorContains(t, err, "chain ID 901 differs from 10")
+	_, err = verifyCopyManifest(ctx, source, &Manifest{FromBlock: block(3)}, 5)
+	require.ErrorContains(t, err, "first block 5 differs from 3")
+	_, err = verifyCopyManifest(ctx, source, &Manifest{ToBlock: block(1)}, 0)
+	require.ErrorContains(t, err, "head block 0 is before the last block 1")
+}
@@ -0,0 +1,141 @@
+package wheel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/cheat"
+)
+
+var GzipFlag = &cli.BoolFlag{
+	Name:    "gzip",
+	Usage:   "Gzip-compress the output, also when written to stdout",
+	EnvVars: prefixEnvVars("GZIP"),
+}
+
+var (
+	RedactFlag = &cli.PathFlag{
+		Name: "redact",
+		Usage: "Path to a JSON file with the sensitive addresses, and storage slots by account, to redact from the output: " +
+			`{"addresses": [...], "slots": {"<address>": [...]}}. Values and addresses are hashed, unless --redact.zero is set.`,
+		TakesFile: true,
+		EnvVars:   prefixEnvVars("REDACT"),
+	}
+	RedactZeroFlag = &cli.BoolFlag{
+		Name:    "redact.zero",
+		Usage:   "Zero out the redacted values and addresses, and leave out the redacted accounts, instead of hashing them",
+		EnvVars: prefixEnvVars("REDACT_ZERO"),
+	}
+)
+
+// redactor reads the redact config of --redact, and returns nil if it is not set.
+func redactor(ctx *cli.Context) (*cheat.Redactor, error) {
+	path := ctx.Path(RedactFlag.Name)
+	if path == "" {
+		if ctx.Bool(RedactZeroFlag.Name) {
+			return nil, fmt.Errorf("--%s requires --%s", RedactZeroFlag.Name, RedactFlag.Name)
+		}
+		return nil, nil
+	}
+	cfg, err := cheat.ReadRedactConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return cheat.NewRedactor(cfg, ctx.Bool(RedactZeroFlag.Name)), nil
+}
+
+// output is the buffered, and optionally gzip-compressed, output of a command that streams large outputs.
+type output struct {
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+	file *os.File
+
+	closed bool
+}
+
+// openOutput opens the given file, or the app writer if the path is empty, as output of a command.
+// The output is buffered, and gzip-compressed if --gzip is set, so it is written with constant memory.
+// Close must be called to complete the output, also if it is the app writer.
+func openOutput(ctx *cli.Context, path string) (*output, error) {
+	out := &output{}
+	var w io.Writer = ctx.App.Writer
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		out.file = f
+		w = f
+	}
+	if ctx.Bool(GzipFlag.Name) {
+		out.gz = gzip.NewWriter(w)
+		w = out.gz
+	}
+	out.buf = bufio.NewWriterSize(w, 1<<16)
+	return out, nil
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+// Close flushes the buffer, completes the gzip stream, and closes the file. Only the first call has any effect,
+// so Close can be deferred, and still be called explicitly to check the error.
+func (o *output) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	err := o.buf.Flush()
+	if err != nil {
+		err = fmt.Errorf("failed to flush output: %w", err)
+	}
+	if o.gz != nil {
+		if gzErr := o.gz.Close(); gzErr != nil && err == nil {
+			err = fmt.Errorf("failed to complete gzip output: %w", gzErr)
+		}
+	}
+	if o.file != nil {
+		if fErr := o.file.Close(); fErr != nil && err == nil {
+			err = fmt.Errorf("failed to write output file: %w", fErr)
+		}
+	}
+	return err
+}
+
+// gzipMagic is the start of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// openInput opens the given file as input of a command, and decompresses it if it is gzip-compressed,
+// so outputs written with --gzip can be read back directly.
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to open gzip input: %w", err)
+		}
+		return &input{Reader: gz, file: f}, nil
+	}
+	return &input{Reader: br, file: f}, nil
+}
+
+type input struct {
+	io.Reader
+	file *os.File
+}
+
+func (i *input) Close() error {
+	return i.file.Close()
+}
@@ -0,0 +1,242 @@
+package wheel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/urfave/cli/v2"
+)
+
+// planVersion is the version of the plan format, plans of other versions are rejected.
+const planVersion = 1
+
+// Plan describes a mutating command invocation, to review before it is executed with apply-plan.
+type Plan struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Command is the path of the command, e.g. ["cheat", "storage", "set"].
+	Command []string `json:"command"`
+	Usage   string   `json:"usage,omitempty"`
+	// Flags are the values of the flags that were set on the command line or with env vars.
+	// Secrets are not included, and are read from the environment again when the plan is applied.
+	Flags map[string][]string `json:"flags"`
+	// GlobalFlags are the values of the flags of the app that were set, e.g. --timeout, in the same form as Flags.
+	GlobalFlags map[string][]string `json:"globalFlags,omitempty"`
+	// Files are the hashes of the input files that the flags refer to,
+	// applying the plan fails if any of them changed.
+	Files map[string]common.Hash `json:"files,omitempty"`
+	// Input is the standard input of the command, if the command reads any.
+	Input hexutil.Bytes `json:"input,omitempty"`
+}
+
+var PlanFlag = &cli.StringFlag{
+	Name:      "plan",
+	Usage:     "Write a plan of the command to the given JSON file instead of running it, to run it later with apply-plan.",
+	TakesFile: true,
+	EnvVars:   prefixEnvVars("PLAN"),
+}
+
+// secretFlags are never written to plans.
+var secretFlags = map[string]struct{}{
+	"private-key": {},
+	"mnemonic":    {},
+}
+
+// PlanAction writes a plan of the command if --plan is set, and runs the action otherwise.
+// If readsInput is true, the standard input is included in the plan.
+func PlanAction(readsInput bool, fn cli.ActionFunc) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		path := ctx.String(PlanFlag.Name)
+		if path == "" {
+			return fn(ctx)
+		}
+		plan, err := NewPlan(ctx)
+		if err != nil {
+			return err
+		}
+		if readsInput {
+			if plan.Input, err = io.ReadAll(ctx.App.Reader); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+		}
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+		_, err = fmt.Fprintf(ctx.App.Writer, "plan written to %s, run it with: apply-plan %s\n", path, path)
+		return err
+	}
+}
+
+// NewPlan describes the invocation of the command of the context.
+func NewPlan(ctx *cli.Context) (*Plan, error) {
+	plan := &Plan{
+		Version: planVersion,
+		Created: time.Now().UTC(),
+		Command: commandPath(ctx),
+		Usage:   ctx.Command.Usage,
+		Flags:   make(map[string][]string),
+		Files:   make(map[string]common.Hash),
+	}
+	if err := plan.addFlags(ctx, ctx.Command.Flags, plan.Flags); err != nil {
+		return nil, err
+	}
+	globals := make(map[string][]string)
+	if err := plan.addFlags(ctx, ctx.App.Flags, globals); err != nil {
+		return nil, err
+	}
+	if len(globals) > 0 {
+		plan.GlobalFlags = globals
+	}
+	return plan, nil
+}
+
+// addFlags adds the values of the given flags that are set to values, and the hashes of the files they refer to.
+func (p *Plan) addFlags(ctx *cli.Context, flags []cli.Flag, values map[string][]string) error {
+	for _, f := range flags {
+		name := f.Names()[0]
+		if name == PlanFlag.Name || !ctx.IsSet(name) {
+			continue
+		}
+		if _, ok := secretFlags[name]; ok {
+			continue
+		}
+		var vs []string
+		switch f.(type) {
+		case *cli.StringSliceFlag:
+			vs = ctx.StringSlice(name)
+		case *cli.GenericFlag:
+			vs = []string{fmt.Sprint(ctx.Generic(name))}
+		default:
+			vs = []string{fmt.Sprint(ctx.Value(name))}
+		}
+		values[name] = vs
+		takesFile := false
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			takesFile = f.TakesFile
+		case *cli.PathFlag:
+			takesFile = true
+		}
+		if takesFile {
+			path := vs[0]
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				continue // data dirs, and outputs that only exist after applying, are not tracked
+			}
+			h, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			p.Files[path] = h
+		}
+	}
+	return nil
+}
+
+// commandPath returns the names of the command of the context and its parent commands, excluding the app itself.
+func commandPath(ctx *cli.Context) []string {
+	var path []string
+	for _, c := range ctx.Lineage() {
+		if c.Command != nil && c.Command.Name != "" {
+			path = append([]string{c.Command.Name}, path...)
+		}
+	}
+	if len(path) > 0 && path[0] == ctx.App.Name {
+		path = path[1:]
+	}
+	return path
+}
+
+func hashFile(path string) (common.Hash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to open plan input file: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to hash plan input file: %w", err)
+	}
+	return common.BytesToHash(h.Sum(nil)), nil
+}
+
+// ReadPlan reads a plan, and checks that the input files it refers to did not change since it was written.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d, expected %d", plan.Version, planVersion)
+	}
+	if len(plan.Command) == 0 {
+		return nil, errors.New("plan has no command")
+	}
+	for file, expected := range plan.Files {
+		h, err := hashFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if h != expected {
+			return nil, fmt.Errorf("input file %s changed since the plan was written", file)
+		}
+	}
+	return &plan, nil
+}
+
+// Args returns the command-line arguments to run the planned command with:
+// the global flags precede the command, and the flags of the command follow it, in order of their names.
+func (p *Plan) Args(appName string) []string {
+	args := flagArgs([]string{appName}, p.GlobalFlags)
+	return flagArgs(append(args, p.Command...), p.Flags)
+}
+
+func flagArgs(args []string, flags map[string][]string) []string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range flags[name] {
+			args = append(args, fmt.Sprintf("--%s=%s", name, v))
+		}
+	}
+	return args
+}
+
+var ApplyPlanCmd = &cli.Command{
+	Name:      "apply-plan",
+	Usage:     "Run a command from a plan written with --plan",
+	ArgsUsage: "<plan.json>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return errors.New("expected the path of the plan as only argument")
+		}
+		plan, err := ReadPlan(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		if plan.Command[0] == ctx.Command.Name {
+			return errors.New("plans cannot apply other plans")
+		}
+		ctx.App.Reader = bytes.NewReader(plan.Input)
+		return ctx.App.RunContext(ctx.Context, plan.Args(ctx.App.Name))
+	},
+}
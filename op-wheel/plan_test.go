@@ -0,0 +1,104 @@
+package wheel
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPlanPathFlagFiles(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.yaml")
+	require.NoError(t, os.WriteFile(script, []byte("steps: []\n"), 0o644))
+	cmd := &cli.Command{
+		Name: "apply",
+		Flags: []cli.Flag{
+			PlanFlag,
+			&cli.PathFlag{Name: "script", TakesFile: true},
+		},
+		Action: PlanAction(false, func(ctx *cli.Context) error {
+			t.Fatal("planned command must not run")
+			return nil
+		}),
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	app := &cli.App{Name: "op-wheel", Writer: io.Discard, Commands: []*cli.Command{cmd}}
+	require.NoError(t, app.Run([]string{"op-wheel", "apply", "--script", script, "--plan", planPath}))
+	plan, err := ReadPlan(planPath)
+	require.NoError(t, err)
+	require.Contains(t, plan.Files, script)
+
+	// the script is edited after the plan was reviewed
+	require.NoError(t, os.WriteFile(script, []byte("steps: [{op: delete, address: 0x4200000000000000000000000000000000000016}]\n"), 0o644))
+	_, err = ReadPlan(planPath)
+	require.ErrorContains(t, err, "changed since the plan was written")
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.yaml")
+	require.NoError(t, os.WriteFile(script, []byte("steps: []\n"), 0o644))
+	planPath := filepath.Join(dir, "plan.json")
+
+	type run struct {
+		timeout  time.Duration
+		logLevel string
+		dataDirs []string
+		script   string
+		input    string
+	}
+	var runs []run
+	app := &cli.App{
+		Name:   "op-wheel",
+		Writer: io.Discard,
+		Reader: strings.NewReader("0x6000"),
+		Flags:  []cli.Flag{GlobalGethLogLvlFlag, GlobalTimeoutFlag},
+		Commands: []*cli.Command{
+			{
+				Name: "cheat",
+				Subcommands: []*cli.Command{{
+					Name:  "apply",
+					Flags: []cli.Flag{PlanFlag, DataDirFlag, &cli.PathFlag{Name: "script"}},
+					Action: PlanAction(true, func(ctx *cli.Context) error {
+						input, err := io.ReadAll(ctx.App.Reader)
+						if err != nil {
+							return err
+						}
+						runs = append(runs, run{
+							timeout:  ctx.Duration(GlobalTimeoutFlag.Name),
+							logLevel: ctx.String(GlobalGethLogLvlFlag.Name),
+							dataDirs: ctx.StringSlice(DataDirFlag.Name),
+							script:   ctx.Path("script"),
+							input:    string(input),
+						})
+						return nil
+					}),
+				}},
+			},
+			ApplyPlanCmd,
+		},
+	}
+	require.NoError(t, app.Run([]string{"op-wheel", "--timeout", "5m", "--geth-log-level", "debug",
+		"cheat", "apply", "--data-dir", "a", "--data-dir", "b", "--script", script, "--plan", planPath}))
+	require.Empty(t, runs, "planned command must not run")
+
+	plan, err := ReadPlan(planPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cheat", "apply"}, plan.Command)
+	require.Equal(t, map[string][]string{"timeout": {"5m0s"}, "geth-log-level": {"debug"}}, plan.GlobalFlags)
+	require.Equal(t, map[string][]string{"data-dir": {"a", "b"}, "script": {script}}, plan.Flags)
+	require.Equal(t, "0x6000", string(plan.Input))
+	require.Equal(t, []string{"op-wheel", "--geth-log-level=debug", "--timeout=5m0s",
+		"cheat", "apply", "--data-dir=a", "--data-dir=b", "--script=" + script}, plan.Args("op-wheel"))
+
+	// the plan is applied with the global flags it was planned with, not those of apply-plan
+	app.Reader = bytes.NewReader(nil)
+	require.NoError(t, app.Run([]string{"op-wheel", "--timeout", "1s", "apply-plan", planPath}))
+	require.Equal(t, []run{{timeout: 5 * time.Minute, logLevel: "debug", dataDirs: []string{"a", "b"}, script: script, input: "0x6000"}}, runs)
+}
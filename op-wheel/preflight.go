@@ -0,0 +1,184 @@
+package wheel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/cheat"
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// PreflightCheck is one item of the preflight checklist.
+type PreflightCheck struct {
+	Name string
+	// Skipped is set if the check is not configured, Err if it failed.
+	Skipped bool
+	Err     error
+	Detail  string
+}
+
+func (c *PreflightCheck) String() string {
+	switch {
+	case c.Skipped:
+		return fmt.Sprintf("[skip] %s: not configured", c.Name)
+	case c.Err != nil:
+		return fmt.Sprintf("[FAIL] %s: %v", c.Name, c.Err)
+	default:
+		return fmt.Sprintf("[ ok ] %s: %s", c.Name, c.Detail)
+	}
+}
+
+// readJWTSecret reads a JWT secret file, and checks that it is exactly 32 hex encoded bytes.
+func readJWTSecret(path string) ([32]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("failed to read jwt: %w", err)
+	}
+	secret, err := hexutil.Decode("0x" + strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("jwt secret is not hex encoded: %w", err)
+	}
+	if len(secret) != 32 {
+		return [32]byte{}, fmt.Errorf("jwt secret is %d bytes, expected 32", len(secret))
+	}
+	return common.BytesToHash(secret), nil
+}
+
+// checkEngine checks that the engine is reachable, accepts the JWT secret, and serves the expected chain.
+func checkEngine(ctx context.Context, endpoint string, secret [32]byte, expected *engine.ChainExpectation) (string, error) {
+	client, err := engine.DialClient(ctx, endpoint, secret)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	var chainID hexutil.Big
+	if err := client.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		var httpErr rpc.HTTPError
+		if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+			return "", fmt.Errorf("engine is reachable, but rejected the jwt secret: %w", err)
+		}
+		return "", fmt.Errorf("engine is not reachable: %w", err)
+	}
+	if err := engine.CheckChain(ctx, client, expected); err != nil {
+		return "", fmt.Errorf("chain sanity check failed: %w", err)
+	}
+	return fmt.Sprintf("authenticated, chain ID %d", chainID.ToInt()), nil
+}
+
+// checkDataDir checks that the database of the data dir can be opened, i.e. that it is not in use by a node.
+func checkDataDir(dataDir string) (string, error) {
+	db, err := cheat.OpenGethRawDB(dataDir, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database, is the node still running? %w", err)
+	}
+	defer db.Close()
+	head := rawdb.ReadHeadHeader(db)
+	if head == nil {
+		return "", errors.New("no head header found")
+	}
+	return fmt.Sprintf("head block %d (%s)", head.Number, head.Hash()), nil
+}
+
+// checkDiskSpace checks that the file system of the path has at least the given free space, in bytes.
+func checkDiskSpace(path string, minFree uint64) (string, error) {
+	free, err := freeDiskSpace(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file system: %w", err)
+	}
+	return checkFreeSpace(free, minFree)
+}
+
+// checkFreeSpace checks the free space against the minimum, both in bytes, and describes it in MiB.
+func checkFreeSpace(free uint64, minFree uint64) (string, error) {
+	if free < minFree {
+		return "", fmt.Errorf("%d MiB free, need at least %d MiB", free>>20, minFree>>20)
+	}
+	return fmt.Sprintf("%d MiB free", free>>20), nil
+}
+
+var PreflightCmd = &cli.Command{
+	Name:  "preflight",
+	Usage: "Validate the configuration at once, and print a checklist. A first step before destructive operations.",
+	Description: "Checks the JWT secret, that the engine is reachable and accepts it, " +
+		"that the data dir can be opened (so no node is using it), and that there is enough free disk space. " +
+		"Only the configured items are checked. Fails if any check fails.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    EngineEndpoint.Name,
+			Usage:   EngineEndpoint.Usage,
+			EnvVars: EngineEndpoint.EnvVars,
+		},
+		&cli.StringFlag{
+			Name:      EngineJWTPath.Name,
+			Usage:     EngineJWTPath.Usage,
+			TakesFile: true,
+			EnvVars:   EngineJWTPath.EnvVars,
+		},
+		ExpectChainIDFlag, RollupConfigFlag,
+		&cli.StringFlag{
+			Name:      DataDirFlag.Name,
+			Usage:     "Geth data dir location. Must not be in use by a running node.",
+			TakesFile: true,
+			EnvVars:   DataDirFlag.EnvVars,
+		},
+		&cli.Uint64Flag{
+			Name:    "min-free-space",
+			Usage:   "Minimum free disk space in bytes, on the file system of the data dir",
+			EnvVars: prefixEnvVars("MIN_FREE_SPACE"),
+			Value:   10 << 30,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		jwt := &PreflightCheck{Name: "jwt secret", Skipped: !ctx.IsSet(EngineJWTPath.Name)}
+		var secret [32]byte
+		if !jwt.Skipped {
+			secret, jwt.Err = readJWTSecret(ctx.String(EngineJWTPath.Name))
+			jwt.Detail = "32 bytes"
+		}
+		eng := &PreflightCheck{Name: "engine", Skipped: !ctx.IsSet(EngineEndpoint.Name)}
+		if !eng.Skipped {
+			expected, err := ParseChainExpectation(ctx)
+			if err != nil {
+				return err
+			}
+			if jwt.Skipped || jwt.Err != nil {
+				eng.Err = errors.New("requires a valid jwt secret")
+			} else {
+				reqCtx, cancel := context.WithTimeout(ctx.Context, 10*time.Second)
+				eng.Detail, eng.Err = checkEngine(reqCtx, ctx.String(EngineEndpoint.Name), secret, expected)
+				cancel()
+			}
+		}
+		dataDir := ctx.String(DataDirFlag.Name)
+		db := &PreflightCheck{Name: "data dir", Skipped: dataDir == ""}
+		disk := &PreflightCheck{Name: "disk space", Skipped: dataDir == ""}
+		if dataDir != "" {
+			db.Detail, db.Err = checkDataDir(dataDir)
+			disk.Detail, disk.Err = checkDiskSpace(dataDir, ctx.Uint64("min-free-space"))
+		}
+		failed := 0
+		for _, check := range []*PreflightCheck{jwt, eng, db, disk} {
+			if _, err := fmt.Fprintln(ctx.App.Writer, check); err != nil {
+				return err
+			}
+			if check.Err != nil {
+				failed += 1
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d preflight checks failed", failed)
+		}
+		return nil
+	},
+}
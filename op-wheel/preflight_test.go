@@ -0,0 +1,72 @@
+package wheel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		free    uint64
+		minFree uint64
+		detail  string
+		err     string
+	}{
+		{name: "plenty", free: 20 << 30, minFree: 10 << 30, detail: "20480 MiB free"},
+		{name: "exactly the minimum", free: 10 << 30, minFree: 10 << 30, detail: "10240 MiB free"},
+		{name: "one byte short", free: 10<<30 - 1, minFree: 10 << 30, err: "10239 MiB free, need at least 10240 MiB"},
+		{name: "no minimum", free: 0, minFree: 0, detail: "0 MiB free"},
+		{name: "full", free: 0, minFree: 1 << 20, err: "0 MiB free, need at least 1 MiB"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			detail, err := checkFreeSpace(tc.free, tc.minFree)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.detail, detail)
+		})
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	detail, err := checkDiskSpace(t.TempDir(), 0)
+	require.NoError(t, err)
+	require.Contains(t, detail, "MiB free")
+	_, err = checkDiskSpace(t.TempDir(), 1<<62)
+	require.ErrorContains(t, err, "need at least")
+	_, err = checkDiskSpace(filepath.Join(t.TempDir(), "missing"), 0)
+	require.ErrorContains(t, err, "failed to stat file system")
+}
+
+func TestReadJWTSecret(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "hex", content: "0x0102030405060708091011121314151617181920212223242526272829303132\n"},
+		{name: "no prefix", content: "0102030405060708091011121314151617181920212223242526272829303132"},
+		{name: "short", content: "0x0102", err: "jwt secret is 2 bytes, expected 32"},
+		{name: "not hex", content: "secret", err: "not hex encoded"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+			secret, err := readJWTSecret(path)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, byte(0x01), secret[0])
+			require.Equal(t, byte(0x32), secret[31])
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package wheel
+
+import "syscall"
+
+// freeDiskSpace returns the free space in bytes that is available to the user, on the file system of the path.
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package wheel
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the free space in bytes that is available to the user, on the volume of the path.
+func freeDiskSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
@@ -0,0 +1,175 @@
+package wheel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// serviceManager reports the lifecycle of the process to the service manager it runs under, if any:
+// systemd with sd_notify, or the Windows service control manager.
+type serviceManager interface {
+	// Ready reports that the service finished starting up.
+	Ready() error
+	// Stopping reports that the service is shutting down.
+	Stopping() error
+	// Watchdog reports that the service is alive.
+	Watchdog() error
+	// WatchdogInterval is the interval to report liveness at, or 0 if the service manager has no watchdog.
+	WatchdogInterval() time.Duration
+	// Stop is closed when the service manager requests the service to stop.
+	// Stop requests by signal are handled by ServiceAction.
+	Stop() <-chan struct{}
+	// Close reports that the service stopped.
+	Close() error
+}
+
+// ServiceConfig configures the service lifecycle mode of long-running commands, see ServiceAction.
+type ServiceConfig struct {
+	Name            string
+	HealthAddr      string
+	LivenessTimeout time.Duration
+	ShutdownTimeout time.Duration
+}
+
+var (
+	ServiceFlag = &cli.BoolFlag{
+		Name: "service",
+		Usage: "Run with the lifecycle of a service: serve health probes, notify systemd (sd_notify) or the Windows service manager, " +
+			"and finish the current block before shutting down",
+		EnvVars: prefixEnvVars("SERVICE"),
+	}
+	ServiceHealthAddrFlag = &cli.StringFlag{
+		Name:    "service.health-addr",
+		Usage:   "Listen address of the liveness (/healthz) and readiness (/readyz) probes in service mode. Disabled if empty.",
+		EnvVars: prefixEnvVars("SERVICE_HEALTH_ADDR"),
+		Value:   "127.0.0.1:8561",
+	}
+	ServiceLivenessTimeoutFlag = &cli.DurationFlag{
+		Name:    "service.liveness-timeout",
+		Usage:   "Time without block production progress, after which the service is reported as not live",
+		EnvVars: prefixEnvVars("SERVICE_LIVENESS_TIMEOUT"),
+		Value:   time.Minute,
+	}
+	ServiceShutdownTimeoutFlag = &cli.DurationFlag{
+		Name:    "service.shutdown-timeout",
+		Usage:   "Time to wait for the current block to finish on shutdown, before it is aborted",
+		EnvVars: prefixEnvVars("SERVICE_SHUTDOWN_TIMEOUT"),
+		Value:   30 * time.Second,
+	}
+)
+
+var ServiceFlags = []cli.Flag{ServiceFlag, ServiceHealthAddrFlag, ServiceLivenessTimeoutFlag, ServiceShutdownTimeoutFlag}
+
+func ReadServiceConfig(ctx *cli.Context) *ServiceConfig {
+	return &ServiceConfig{
+		Name:            ctx.App.Name,
+		HealthAddr:      ctx.String(ServiceHealthAddrFlag.Name),
+		LivenessTimeout: ctx.Duration(ServiceLivenessTimeoutFlag.Name),
+		ShutdownTimeout: ctx.Duration(ServiceShutdownTimeoutFlag.Name),
+	}
+}
+
+// ServiceAction is like opservice.CloseAction, but runs the function with the lifecycle of a service.
+// The health probes are served, and readiness and liveness are reported to the service manager.
+// On shutdown the readiness is dropped and the function is asked to stop first, so it can finish its current work,
+// and only after it returns (or after the shutdown timeout) the context is canceled,
+// which stops the remaining servers like the metrics server last.
+func ServiceAction(l log.Logger, cfg *ServiceConfig, health *engine.Health, fn func(ctx context.Context, shutdown <-chan struct{}) error) error {
+	mgr, err := newServiceManager(cfg.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer func() {
+		if err := mgr.Close(); err != nil {
+			l.Warn("failed to report service stop", "err", err)
+		}
+	}()
+
+	if cfg.HealthAddr != "" {
+		srv := &http.Server{Addr: cfg.HealthAddr, Handler: health}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Error("failed to serve health probes", "err", err)
+			}
+		}()
+		defer srv.Close()
+		l.Info("serving health probes", "addr", cfg.HealthAddr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	shutdown := make(chan struct{})
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- fn(ctx, shutdown)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	interval := time.Second
+	if wd := mgr.WatchdogInterval(); wd > 0 && wd < interval {
+		interval = wd
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ready := false
+	for {
+		select {
+		case now := <-ticker.C:
+			if !ready && health.Ready() == nil {
+				if err := mgr.Ready(); err != nil {
+					l.Warn("failed to report service readiness", "err", err)
+				}
+				ready = true
+			}
+			if mgr.WatchdogInterval() > 0 && health.Live(now) == nil {
+				if err := mgr.Watchdog(); err != nil {
+					l.Warn("failed to report service liveness", "err", err)
+				}
+			}
+		case err := <-stopped:
+			return err
+		case <-mgr.Stop():
+			l.Info("service manager requested stop")
+			return stopService(l, cfg, mgr, health, shutdown, stopped, cancel)
+		case sig := <-signals:
+			l.Info("received signal, stopping", "signal", sig)
+			return stopService(l, cfg, mgr, health, shutdown, stopped, cancel)
+		}
+	}
+}
+
+func stopService(l log.Logger, cfg *ServiceConfig, mgr serviceManager, health *engine.Health,
+	shutdown chan struct{}, stopped <-chan error, cancel context.CancelFunc) error {
+	health.SetStopping()
+	if err := mgr.Stopping(); err != nil {
+		l.Warn("failed to report service stopping", "err", err)
+	}
+	close(shutdown)
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(cfg.ShutdownTimeout):
+		l.Warn("service did not stop in time, aborting", "timeout", cfg.ShutdownTimeout)
+		cancel()
+	}
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(10 * time.Second):
+		return errors.New("service is unresponsive for more than 10 seconds after aborting... shutting down")
+	}
+}
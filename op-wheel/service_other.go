@@ -0,0 +1,74 @@
+//go:build !windows
+
+package wheel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemdManager notifies systemd with the sd_notify protocol,
+// if the process runs as a notify type unit, i.e. if NOTIFY_SOCKET is set.
+type systemdManager struct {
+	conn     *net.UnixConn
+	watchdog time.Duration
+}
+
+func newServiceManager(name string) (serviceManager, error) {
+	m := &systemdManager{}
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return m, nil
+	}
+	if socket[0] == '@' { // abstract socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial notify socket: %w", err)
+	}
+	m.conn = conn
+	if usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		// report twice per watchdog interval, as recommended by sd_watchdog_enabled(3)
+		m.watchdog = time.Duration(usec) * time.Microsecond / 2
+	}
+	return m, nil
+}
+
+func (m *systemdManager) notify(state string) error {
+	if m.conn == nil {
+		return nil
+	}
+	_, err := m.conn.Write([]byte(state))
+	return err
+}
+
+func (m *systemdManager) Ready() error {
+	return m.notify("READY=1")
+}
+
+func (m *systemdManager) Stopping() error {
+	return m.notify("STOPPING=1")
+}
+
+func (m *systemdManager) Watchdog() error {
+	return m.notify("WATCHDOG=1")
+}
+
+func (m *systemdManager) WatchdogInterval() time.Duration {
+	return m.watchdog
+}
+
+func (m *systemdManager) Stop() <-chan struct{} {
+	return nil // systemd stops the service with SIGTERM
+}
+
+func (m *systemdManager) Close() error {
+	if m.conn == nil {
+		return nil
+	}
+	return m.conn.Close()
+}
@@ -0,0 +1,98 @@
+//go:build windows
+
+package wheel
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// windowsManager reports to the Windows service control manager,
+// if the process runs as a Windows service.
+type windowsManager struct {
+	states   chan svc.State
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	exited   chan error
+}
+
+func newServiceManager(name string) (serviceManager, error) {
+	m := &windowsManager{
+		states: make(chan svc.State, 4),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return nil, err
+	}
+	if isService {
+		m.exited = make(chan error, 1)
+		go func() {
+			m.exited <- svc.Run(name, m)
+		}()
+	}
+	return m, nil
+}
+
+// Execute implements svc.Handler, and runs until the manager is closed.
+func (m *windowsManager) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+	for {
+		select {
+		case state := <-m.states:
+			var accepts svc.Accepted
+			if state == svc.Running {
+				accepts = svc.AcceptStop | svc.AcceptShutdown
+			}
+			s <- svc.Status{State: state, Accepts: accepts}
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				m.stopOnce.Do(func() { close(m.stop) })
+			}
+		case <-m.done:
+			return false, 0
+		}
+	}
+}
+
+func (m *windowsManager) setState(state svc.State) error {
+	if m.exited != nil {
+		m.states <- state
+	}
+	return nil
+}
+
+func (m *windowsManager) Ready() error {
+	return m.setState(svc.Running)
+}
+
+func (m *windowsManager) Stopping() error {
+	return m.setState(svc.StopPending)
+}
+
+func (m *windowsManager) Watchdog() error {
+	return nil
+}
+
+func (m *windowsManager) WatchdogInterval() time.Duration {
+	return 0
+}
+
+func (m *windowsManager) Stop() <-chan struct{} {
+	return m.stop
+}
+
+func (m *windowsManager) Close() error {
+	close(m.done)
+	if m.exited == nil {
+		return nil
+	}
+	return <-m.exited
+}
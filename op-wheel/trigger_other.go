@@ -0,0 +1,16 @@
+//go:build !windows
+
+package wheel
+
+import (
+	"context"
+	"syscall"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// notifySignalTrigger triggers a block on every SIGUSR1, until the context is canceled.
+func notifySignalTrigger(ctx context.Context, triggers chan<- *engine.Trigger) error {
+	engine.NotifyTrigger(ctx, triggers, syscall.SIGUSR1)
+	return nil
+}
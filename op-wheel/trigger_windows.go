@@ -0,0 +1,15 @@
+//go:build windows
+
+package wheel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// notifySignalTrigger is not supported on Windows, which has no SIGUSR1: use the manual trigger HTTP endpoint instead.
+func notifySignalTrigger(ctx context.Context, triggers chan<- *engine.Trigger) error {
+	return errors.New("the SIGUSR1 manual trigger is not supported on Windows")
+}
@@ -0,0 +1,95 @@
+package wheel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ethereum-optimism/optimism/op-wheel/engine"
+)
+
+// BuildInfo describes the op-wheel binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	// Geth is the geth module version that op-wheel is built with, op-geth if it replaces upstream geth.
+	Geth string `json:"geth,omitempty"`
+	// Engine is the compatibility of the engine, if checked.
+	Engine *engine.CompatReport `json:"engine,omitempty"`
+}
+
+func readBuildInfo(version string) *BuildInfo {
+	info := &BuildInfo{Version: version, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path != "github.com/ethereum/go-ethereum" {
+				continue
+			}
+			info.Geth = dep.Path + " " + dep.Version
+			if dep.Replace != nil {
+				info.Geth = dep.Replace.Path + " " + dep.Replace.Version
+			}
+		}
+	}
+	return info
+}
+
+var VersionCmd = &cli.Command{
+	Name:  "version",
+	Usage: "Print the build info, and optionally check the compatibility of the engine client",
+	Description: "With --check, the client version of the engine is looked up in the matrix of clients that op-wheel is tested against. " +
+		"Known-incompatible clients are warned about.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "check",
+			Usage:   "Check the compatibility of the engine client. Requires the engine and its JWT secret.",
+			EnvVars: prefixEnvVars("CHECK"),
+		},
+		&cli.StringFlag{
+			Name:    EngineEndpoint.Name,
+			Usage:   EngineEndpoint.Usage,
+			EnvVars: EngineEndpoint.EnvVars,
+		},
+		&cli.StringFlag{
+			Name:      EngineJWTPath.Name,
+			Usage:     EngineJWTPath.Usage,
+			TakesFile: true,
+			EnvVars:   EngineJWTPath.EnvVars,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		info := readBuildInfo(ctx.App.Version)
+		if ctx.Bool("check") {
+			if !ctx.IsSet(EngineEndpoint.Name) || !ctx.IsSet(EngineJWTPath.Name) {
+				return errors.New("--check requires the engine and its JWT secret")
+			}
+			secret, err := readJWTSecret(ctx.String(EngineJWTPath.Name))
+			if err != nil {
+				return err
+			}
+			endpoint := ctx.String(EngineEndpoint.Name)
+			client, err := engine.DialClient(ctx.Context, endpoint, secret)
+			if err != nil {
+				return fmt.Errorf("failed to dial Engine API endpoint %q: %w", endpoint, err)
+			}
+			defer client.Close()
+			if info.Engine, err = engine.EngineCompatibility(ctx.Context, client); err != nil {
+				return err
+			}
+			switch info.Engine.Status {
+			case engine.CompatIncompatible:
+				log.Warn("engine client is known to be incompatible", "client", info.Engine.Version, "note", info.Engine.Note)
+			case engine.CompatUntested:
+				log.Info("engine client is not tested against", "client", info.Engine.Version, "note", info.Engine.Note)
+			}
+		}
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	},
+}